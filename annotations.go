@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// annotationMapper maps chunk-relative line numbers, as an LLM reviewing a
+// chunk reports them, back to lines of the source file.
+type annotationMapper struct {
+	dir            string
+	chunkType      string
+	relativeToFile bool // line 1 is the first line of the chunk file, header included
+	byIndex        map[int]ManifestChunk
+	byFile         map[string]ManifestChunk
+
+	contents map[int]string   // chunk content, by index
+	headers  map[int]int      // metadata header lines, by chunk index
+	sources  map[string][]int // byte offsets of line starts, by source
+	manifest *Manifest
+}
+
+func runMergeAnnotations(args []string) error {
+	fs := flag.NewFlagSet("merge-annotations", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory of chunk files with a manifest (required)")
+	manifestPath := fs.String("manifest", "", "Manifest describing the chunks (default: manifest.json in the input directory)")
+	annotations := fs.String("annotations", "-", "JSONL file of per-chunk annotations, or - for stdin")
+	output := fs.String("output", "-", "File to write the mapped annotations to, or - for stdout")
+	format := fs.String("format", "jsonl", "Output format: jsonl, or text for path:line: message")
+	relativeTo := fs.String("relative-to", "content", "What annotation line numbers count from: content (the chunk text) or file (the chunk file, metadata header included)")
+	dedupe := fs.Bool("dedupe", false, "Drop annotations repeated at the same source lines, as reported once per overlapping chunk")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s merge-annotations -input ./chunks -annotations review.jsonl\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Map annotations with chunk-relative line numbers back to source files and lines.\n")
+		fmt.Fprintf(os.Stderr, "Each input line is a JSON object with \"chunk\" (index) or \"chunk_file\", \"line\",\n")
+		fmt.Fprintf(os.Stderr, "optionally \"end_line\", and any other fields, which are passed through.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *input == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *format != "jsonl" && *format != "text" {
+		return fmt.Errorf("unsupported annotation output format: %s", *format)
+	}
+	if *relativeTo != "content" && *relativeTo != "file" {
+		return fmt.Errorf("-relative-to must be content or file, got %s", *relativeTo)
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*input, manifestFilename)
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if m.ChunkType == "tokens" {
+		return fmt.Errorf("token chunks do not keep line breaks, so their line numbers cannot be mapped back")
+	}
+	if len(m.Transforms) > 0 {
+		return fmt.Errorf("the source was transformed (%s) before chunking, so their line numbers cannot be mapped back", strings.Join(m.Transforms, ", "))
+	}
+	mapper := newAnnotationMapper(*input, m, *relativeTo == "file")
+
+	var in io.Reader = os.Stdin
+	if *annotations != "-" {
+		file, err := os.Open(*annotations)
+		if err != nil {
+			return fmt.Errorf("error opening annotations: %v", err)
+		}
+		defer file.Close()
+		in = file
+	}
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating output file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	seen := map[string]bool{}
+	mapped, skipped, duplicates := 0, 0, 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var annotation map[string]any
+		if err := json.Unmarshal([]byte(text), &annotation); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: annotation %d: %v\n", lineNumber, err)
+			skipped++
+			continue
+		}
+		if err := mapper.mapAnnotation(annotation); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: annotation %d: %v\n", lineNumber, err)
+			skipped++
+			continue
+		}
+
+		if *dedupe {
+			key := fmt.Sprintf("%v\x00%v\x00%v\x00%v", annotation["source"], annotation["source_line"], annotation["source_end_line"], annotation["message"])
+			if seen[key] {
+				duplicates++
+				continue
+			}
+			seen[key] = true
+		}
+
+		if *format == "text" {
+			fmt.Fprintf(w, "%s:%v: %v\n", annotation["source"], annotation["source_line"], annotationMessage(annotation))
+		} else if err := enc.Encode(annotation); err != nil {
+			return fmt.Errorf("error writing annotations: %v", err)
+		}
+		mapped++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading annotations: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing annotations: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Mapped %d annotation(s), skipped %d", mapped, skipped)
+	if *dedupe {
+		fmt.Fprintf(os.Stderr, ", dropped %d duplicate(s)", duplicates)
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
+
+func newAnnotationMapper(dir string, m *Manifest, relativeToFile bool) *annotationMapper {
+	a := &annotationMapper{
+		dir:            dir,
+		manifest:       m,
+		chunkType:      m.ChunkType,
+		relativeToFile: relativeToFile,
+		byIndex:        map[int]ManifestChunk{},
+		byFile:         map[string]ManifestChunk{},
+		contents:       map[int]string{},
+		headers:        map[int]int{},
+		sources:        map[string][]int{},
+	}
+	for _, chunk := range m.Chunks {
+		a.byIndex[chunk.Index] = chunk
+		a.byFile[chunk.File] = chunk
+	}
+	return a
+}
+
+// mapAnnotation adds source, source_line, source_end_line and in_overlap to
+// an annotation. in_overlap marks lines that the previous chunk also holds,
+// whose annotations may be reported twice.
+func (a *annotationMapper) mapAnnotation(annotation map[string]any) error {
+	chunk, err := a.findChunk(annotation)
+	if err != nil {
+		return err
+	}
+	line, ok := annotationInt(annotation, "line")
+	if !ok {
+		return fmt.Errorf("missing or invalid \"line\"")
+	}
+	endLine, ok := annotationInt(annotation, "end_line")
+	if !ok {
+		endLine = line
+	}
+	if endLine < line {
+		return fmt.Errorf("end_line %d is before line %d", endLine, line)
+	}
+
+	if a.relativeToFile {
+		header, err := a.headerLines(chunk)
+		if err != nil {
+			return err
+		}
+		if line <= header {
+			return fmt.Errorf("line %d of %s is in the metadata header", line, chunk.File)
+		}
+		line, endLine = line-header, endLine-header
+	}
+
+	start, inOverlap, err := a.sourceLine(chunk, line)
+	if err != nil {
+		return err
+	}
+	if _, _, err := a.sourceLine(chunk, endLine); err != nil {
+		return err
+	}
+
+	annotation["source"] = chunk.Source
+	annotation["source_line"] = start
+	annotation["source_end_line"] = start + endLine - line
+	annotation["in_overlap"] = inOverlap
+	return nil
+}
+
+func (a *annotationMapper) findChunk(annotation map[string]any) (ManifestChunk, error) {
+	if index, ok := annotationInt(annotation, "chunk"); ok {
+		if chunk, ok := a.byIndex[index]; ok {
+			return chunk, nil
+		}
+		return ManifestChunk{}, fmt.Errorf("the manifest has no chunk %d", index)
+	}
+	if name, ok := annotation["chunk_file"].(string); ok {
+		if chunk, ok := a.byFile[filepath.Base(name)]; ok {
+			return chunk, nil
+		}
+		return ManifestChunk{}, fmt.Errorf("the manifest has no chunk file %s", name)
+	}
+	return ManifestChunk{}, fmt.Errorf("annotation names no \"chunk\" or \"chunk_file\"")
+}
+
+// sourceLine returns the source line of a chunk content line.
+func (a *annotationMapper) sourceLine(chunk ManifestChunk, line int) (int, bool, error) {
+	if line < 1 {
+		return 0, false, fmt.Errorf("line %d is not a line number", line)
+	}
+
+	if a.chunkType == "lines" {
+		if line > chunk.End-chunk.Start+1 {
+			return 0, false, fmt.Errorf("chunk %d has %d lines, not %d", chunk.Index, chunk.End-chunk.Start+1, line)
+		}
+		return chunk.Start + line - 1, line <= chunk.Overlap, nil
+	}
+
+	// Char chunks start anywhere in a line: find the line of the chunk's
+	// first byte in the source, and where the content line starts
+	content, err := a.content(chunk)
+	if err != nil {
+		return 0, false, err
+	}
+	offset := 0
+	for i := 1; i < line; i++ {
+		next := strings.IndexByte(content[offset:], '\n')
+		if next < 0 {
+			return 0, false, fmt.Errorf("chunk %d has fewer than %d lines", chunk.Index, line)
+		}
+		offset += next + 1
+	}
+	starts, err := a.sourceLineStarts(chunk.Source)
+	if err != nil {
+		return 0, false, err
+	}
+	first := 0
+	for first+1 < len(starts) && starts[first+1] <= chunk.Start {
+		first++
+	}
+	return first + line, offset < chunk.Overlap, nil
+}
+
+func (a *annotationMapper) content(chunk ManifestChunk) (string, error) {
+	if content, ok := a.contents[chunk.Index]; ok {
+		return content, nil
+	}
+	content, err := readChunkContent(a.dir, chunk)
+	if err != nil {
+		return "", err
+	}
+	a.contents[chunk.Index] = content
+	return content, nil
+}
+
+func (a *annotationMapper) headerLines(chunk ManifestChunk) (int, error) {
+	if n, ok := a.headers[chunk.Index]; ok {
+		return n, nil
+	}
+	data, err := os.ReadFile(filepath.Join(a.dir, chunk.File))
+	if err != nil {
+		return 0, fmt.Errorf("error reading chunk file: %v", err)
+	}
+	content, err := a.content(chunk)
+	if err != nil {
+		return 0, err
+	}
+	n := strings.Count(string(data[:len(data)-len(content)]), "\n")
+	a.headers[chunk.Index] = n
+	return n, nil
+}
+
+func (a *annotationMapper) sourceLineStarts(source string) ([]int, error) {
+	if starts, ok := a.sources[source]; ok {
+		return starts, nil
+	}
+	data, err := a.manifest.readSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("char chunks are mapped through their source: %v", err)
+	}
+	starts := []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	a.sources[source] = starts
+	return starts, nil
+}
+
+// annotationInt reads a whole number from a decoded JSON field.
+func annotationInt(annotation map[string]any, key string) (int, bool) {
+	n, ok := annotation[key].(float64)
+	if !ok || n != float64(int(n)) {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func annotationMessage(annotation map[string]any) any {
+	for _, key := range []string{"message", "comment", "text"} {
+		if message, ok := annotation[key]; ok {
+			return message
+		}
+	}
+	data, _ := json.Marshal(annotation)
+	return string(data)
+}
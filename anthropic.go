@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096 // the Messages API needs a limit
+)
+
+// anthropicClient talks to the Anthropic Messages API.
+type anthropicClient struct {
+	endpoint  string
+	model     string
+	apiKey    string
+	maxTokens int
+	client    *http.Client
+	retries   int // times a request that failed with a network error, 429 or 5xx is retried
+}
+
+type anthropicRequest struct {
+	Model     string        `json:"model"`
+	MaxTokens int           `json:"max_tokens"`
+	System    string        `json:"system,omitempty"`
+	Messages  []chatMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropicClient(endpoint, model, apiKey string, maxTokens int) *anthropicClient {
+	if apiKey == "" {
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if maxTokens == 0 {
+		maxTokens = anthropicMaxTokens
+	}
+	return &anthropicClient{
+		endpoint:  endpoint,
+		model:     model,
+		apiKey:    apiKey,
+		maxTokens: maxTokens,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (c *anthropicClient) Complete(system, prompt string) (string, error) {
+	if err := activePolicy.allowURL(c.endpoint); err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(anthropicRequest{
+		Model:     c.model,
+		MaxTokens: c.maxTokens,
+		System:    system,
+		Messages:  []chatMessage{{Role: "user", Content: prompt}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding Anthropic request: %v", err)
+	}
+
+	var content string
+	tokens := len(tokenize(system+"\n"+prompt)) + c.maxTokens
+	_, err = withRetries("Anthropic", c.retries, tokens, func() (int, time.Duration, error) {
+		var status int
+		var wait time.Duration
+		content, status, wait, err = c.send(body)
+		return status, wait, err
+	})
+	return content, err
+}
+
+// send makes one Messages request, returning the text of the answer, or
+// the HTTP status and how long the API asked to wait before trying again.
+func (c *anthropicClient) send(body []byte) (content string, status int, wait time.Duration, err error) {
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error creating Anthropic request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Anthropic-Version", anthropicVersion)
+	if c.apiKey != "" {
+		req.Header.Set("X-Api-Key", c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error calling Anthropic API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error reading Anthropic response: %v", err)
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", resp.StatusCode, retryAfter(resp), fmt.Errorf("error decoding Anthropic response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if parsed.Error != nil {
+		return "", resp.StatusCode, retryAfter(resp), fmt.Errorf("Anthropic API returned %s: %s", parsed.Error.Type, parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode, retryAfter(resp), fmt.Errorf("Anthropic API returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var text strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if parsed.StopReason == "max_tokens" {
+		logWarning(trf("the response was cut off at -max-tokens %d", c.maxTokens), map[string]any{"max_tokens": c.maxTokens})
+	}
+	return text.String(), resp.StatusCode, 0, nil
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sourceEdit replaces the bytes [start, end) of a source file with text.
+type sourceEdit struct {
+	start, end int
+	text       string
+	chunk      int  // index of the chunk the edit came from
+	inOverlap  bool // the edit touches lines repeated from the previous chunk
+}
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory of the original chunk files with a manifest (required)")
+	manifestPath := fs.String("manifest", "", "Manifest describing the chunks (default: manifest.json in the input directory)")
+	index := fs.Int("chunk", -1, "Index of the chunk the edited file replaces (default: match edited file names to chunk file names)")
+	output := fs.String("output", "", "File to write the patched source to (default: patch the source in place)")
+	skipOverlap := fs.Bool("skip-overlap", false, "Ignore edits to a chunk's overlap, the lines it repeats from the previous chunk")
+	check := fs.Bool("check", false, "Print the changes that would be made without writing anything")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s apply -input ./chunks [options] edited-chunk ...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Diff edited chunks, e.g. returned by an LLM, against the originals and apply the\n")
+		fmt.Fprintf(os.Stderr, "changes to the source files. Apply every edited chunk of a source in one run:\n")
+		fmt.Fprintf(os.Stderr, "edits to the overlap shared by two chunks must agree.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	editedFiles := fs.Args()
+	if *input == "" || len(editedFiles) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *index >= 0 && len(editedFiles) != 1 {
+		return fmt.Errorf("-chunk names the chunk of a single edited file, got %d files", len(editedFiles))
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*input, manifestFilename)
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if m.ChunkType == "tokens" {
+		return fmt.Errorf("token chunks do not keep the source whitespace, so edits to them cannot be applied")
+	}
+	if len(m.Transforms) > 0 {
+		return fmt.Errorf("the source was transformed (%s) before chunking, so edits to them cannot be applied", strings.Join(m.Transforms, ", "))
+	}
+	if m.Context {
+		return fmt.Errorf("the chunks start with context headers, so edits to them cannot be applied")
+	}
+	if m.Prompt != "" {
+		return fmt.Errorf("the chunks were wrapped in the prompt template %s, so edits to them cannot be applied", m.Prompt)
+	}
+
+	// Group the edits by source, in manifest order
+	var sources []string
+	edits := map[string][]sourceEdit{}
+	contents := map[string][]byte{}
+	for _, name := range editedFiles {
+		chunk, err := findEditedChunk(m, name, *index)
+		if err != nil {
+			return err
+		}
+		original, err := readChunkContent(*input, chunk)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("error reading edited chunk: %v", err)
+		}
+		if encoding := m.sourceEncoding(chunk.Source); encoding != "" {
+			return fmt.Errorf("%s was transcoded from %s before chunking, so edits to it cannot be applied", chunk.Source, encoding)
+		}
+		if m.sourceNotebook(chunk.Source) != nil {
+			return fmt.Errorf("%s is a notebook, chunked as its cells rendered as text, so edits to it cannot be applied", chunk.Source)
+		}
+		if _, ok := contents[chunk.Source]; !ok {
+			content, err := os.ReadFile(chunk.Source)
+			if err != nil {
+				return fmt.Errorf("error reading source: %v", err)
+			}
+			contents[chunk.Source] = content
+			sources = append(sources, chunk.Source)
+		}
+
+		chunkEdits, err := diffChunk(m.ChunkType, chunk, contents[chunk.Source], original, cleanEditedChunk(string(data), original))
+		if err != nil {
+			return err
+		}
+		for _, edit := range chunkEdits {
+			if edit.inOverlap && *skipOverlap {
+				continue
+			}
+			edits[chunk.Source] = append(edits[chunk.Source], edit)
+		}
+	}
+	if *output != "" && len(sources) > 1 {
+		return fmt.Errorf("-output takes the patched source of a single file; the edited chunks cover %d sources", len(sources))
+	}
+
+	for _, source := range sources {
+		merged, err := mergeEdits(edits[source])
+		if err != nil {
+			return fmt.Errorf("%s: %v", source, err)
+		}
+		content := contents[source]
+
+		if len(merged) == 0 {
+			fmt.Printf("%s: no changes\n", source)
+			continue
+		}
+		if *check {
+			bounds := lineBounds(content)
+			for _, edit := range merged {
+				line := sort.Search(len(bounds)-1, func(i int) bool { return bounds[i+1] > edit.start }) + 1
+				fmt.Printf("%s:%d: replace %d bytes with %d bytes (chunk %d)\n", source, line, edit.end-edit.start, len(edit.text), edit.chunk)
+			}
+			continue
+		}
+
+		target := source
+		if *output != "" {
+			target = *output
+		}
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(source); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(target, applyEdits(content, merged), mode); err != nil {
+			return fmt.Errorf("error writing patched source: %v", err)
+		}
+		fmt.Printf("Applied %d change(s) to %s\n", len(merged), target)
+	}
+	return nil
+}
+
+// findEditedChunk finds the chunk an edited file replaces: the one given by
+// -chunk, or the chunk file of the same name.
+func findEditedChunk(m *Manifest, name string, index int) (ManifestChunk, error) {
+	for _, chunk := range m.Chunks {
+		if index >= 0 && chunk.Index == index || index < 0 && chunk.File == filepath.Base(name) {
+			return chunk, nil
+		}
+	}
+	if index >= 0 {
+		return ManifestChunk{}, fmt.Errorf("the manifest has no chunk %d", index)
+	}
+	return ManifestChunk{}, fmt.Errorf("%s does not match a chunk file in the manifest; name the chunk with -chunk", name)
+}
+
+// cleanEditedChunk removes what an LLM tends to wrap around a returned
+// chunk: the metadata header it was shown, and a Markdown code fence.
+func cleanEditedChunk(edited, original string) string {
+	if strings.HasPrefix(edited, "=== CHUNK ") {
+		if i := strings.Index(edited, "\n"+metadataContentMarker); i >= 0 {
+			edited = edited[i+1+len(metadataContentMarker):]
+		}
+	}
+	if strings.HasPrefix(edited, "```") && !strings.HasPrefix(original, "```") {
+		body := strings.TrimRight(edited, " \t\r\n")
+		if first := strings.IndexByte(body, '\n'); first >= 0 && strings.HasSuffix(body, "\n```") {
+			edited = body[first+1 : len(body)-len("```")]
+		}
+	}
+	return edited
+}
+
+// diffChunk diffs an edited chunk against the original line by line and
+// returns the changes as byte ranges of the source. The source must still
+// hold the original chunk at its recorded range.
+func diffChunk(chunkType string, chunk ManifestChunk, source []byte, original, edited string) ([]sourceEdit, error) {
+	// offsets[i] is where line i of the original chunk starts in the source
+	var offsets []int
+	crlf := false
+	switch chunkType {
+	case "lines":
+		bounds := lineBounds(source)
+		if chunk.Start < 1 || chunk.End > len(bounds)-1 || chunk.Start > chunk.End {
+			return nil, fmt.Errorf("chunk %d (lines %d-%d) is outside %s; the source has changed since it was chunked", chunk.Index, chunk.Start, chunk.End, chunk.Source)
+		}
+		offsets = bounds[chunk.Start-1 : chunk.End+1]
+		region := string(source[offsets[0]:offsets[len(offsets)-1]])
+		crlf = strings.Contains(region, "\r\n")
+		normalized := strings.ReplaceAll(region, "\r\n", "\n")
+		if normalized != "" && !strings.HasSuffix(normalized, "\n") {
+			normalized += "\n"
+		}
+		if normalized != original {
+			return nil, fmt.Errorf("lines %d-%d of %s no longer match chunk %d; the source has changed since it was chunked (apply every edited chunk in one run)", chunk.Start, chunk.End, chunk.Source, chunk.Index)
+		}
+		edited = strings.ReplaceAll(edited, "\r\n", "\n")
+		if edited != "" && !strings.HasSuffix(edited, "\n") {
+			edited += "\n"
+		}
+	case "chars":
+		if chunk.End > len(source) || string(source[chunk.Start:chunk.End]) != original {
+			return nil, fmt.Errorf("bytes %d-%d of %s no longer match chunk %d; the source has changed since it was chunked (apply every edited chunk in one run)", chunk.Start, chunk.End, chunk.Source, chunk.Index)
+		}
+		offsets = []int{chunk.Start}
+		for _, line := range splitLines(original) {
+			offsets = append(offsets, offsets[len(offsets)-1]+len(line))
+		}
+	}
+
+	a, b := splitLines(original), splitLines(edited)
+	overlapLines := chunk.Overlap
+	if chunkType == "chars" {
+		// A line is in the overlap if it starts within the overlapping bytes
+		overlapLines = sort.Search(len(a), func(i int) bool { return offsets[i]-chunk.Start >= chunk.Overlap })
+	}
+
+	var edits []sourceEdit
+	for _, h := range diffLines(a, b) {
+		text := strings.Join(b[h.j1:h.j2], "")
+		if crlf {
+			text = strings.ReplaceAll(text, "\n", "\r\n")
+		}
+		start, end := offsets[h.i1], offsets[h.i2]
+		// Line chunks end every line with \n; keep a missing final newline missing
+		if chunkType == "lines" && end == len(source) && len(source) > 0 && source[len(source)-1] != '\n' {
+			text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		}
+		edits = append(edits, sourceEdit{
+			start:     start,
+			end:       end,
+			text:      text,
+			chunk:     chunk.Index,
+			inOverlap: h.i1 < overlapLines,
+		})
+	}
+	return edits, nil
+}
+
+// mergeEdits sorts the edits of one source and drops duplicates, which
+// overlapping chunks produce when both make the same change. Different
+// edits of the same bytes conflict.
+func mergeEdits(edits []sourceEdit) ([]sourceEdit, error) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end < edits[j].end
+	})
+
+	var merged []sourceEdit
+	for _, edit := range edits {
+		if len(merged) > 0 {
+			last := merged[len(merged)-1]
+			if edit.start == last.start && edit.end == last.end && edit.text == last.text {
+				continue
+			}
+			insertion := edit.start == edit.end || last.start == last.end
+			if edit.start < last.end || edit.start == last.start && insertion {
+				return nil, fmt.Errorf("chunks %d and %d change the same lines differently; edit their overlap the same way or use -skip-overlap", last.chunk, edit.chunk)
+			}
+		}
+		merged = append(merged, edit)
+	}
+	return merged, nil
+}
+
+// applyEdits returns content with sorted, non-overlapping edits applied.
+func applyEdits(content []byte, edits []sourceEdit) []byte {
+	var b strings.Builder
+	pos := 0
+	for _, edit := range edits {
+		b.Write(content[pos:edit.start])
+		b.WriteString(edit.text)
+		pos = edit.end
+	}
+	b.Write(content[pos:])
+	return []byte(b.String())
+}
+
+// lineBounds returns the byte offset of the start of every line, followed
+// by the length of data, so that line i spans bounds[i] to bounds[i+1],
+// terminator included. A final line without a newline counts as a line.
+func lineBounds(data []byte) []int {
+	bounds := []int{0}
+	for i, b := range data {
+		if b == '\n' && i+1 < len(data) {
+			bounds = append(bounds, i+1)
+		}
+	}
+	if len(data) == 0 {
+		return bounds
+	}
+	return append(bounds, len(data))
+}
+
+// splitLines splits text into lines that keep their terminators.
+func splitLines(text string) []string {
+	var lines []string
+	for text != "" {
+		i := strings.IndexByte(text, '\n') + 1
+		if i == 0 {
+			i = len(text)
+		}
+		lines = append(lines, text[:i])
+		text = text[i:]
+	}
+	return lines
+}
+
+// diffHunk replaces lines a[i1:i2] with b[j1:j2].
+type diffHunk struct {
+	i1, i2, j1, j2 int
+}
+
+// maxDiffCells bounds the table of the line diff; larger changes are
+// replaced as one hunk.
+const maxDiffCells = 4 << 20
+
+// diffLines returns the hunks that turn a into b, from a longest common
+// subsequence of lines. Common leading and trailing lines are trimmed first,
+// so the table only covers the changed middle.
+func diffLines(a, b []string) []diffHunk {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma) == 0 && len(mb) == 0 {
+		return nil
+	}
+	if len(ma) == 0 || len(mb) == 0 || (len(ma)+1)*(len(mb)+1) > maxDiffCells {
+		return []diffHunk{{prefix, prefix + len(ma), prefix, prefix + len(mb)}}
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+	cols := len(mb) + 1
+	lcs := make([]int32, (len(ma)+1)*cols)
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i*cols+j] = lcs[(i+1)*cols+j+1] + 1
+			} else {
+				lcs[i*cols+j] = max(lcs[(i+1)*cols+j], lcs[i*cols+j+1])
+			}
+		}
+	}
+
+	var hunks []diffHunk
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		if i < len(ma) && j < len(mb) && ma[i] == mb[j] {
+			i++
+			j++
+			continue
+		}
+		h := diffHunk{prefix + i, 0, prefix + j, 0}
+		for i < len(ma) || j < len(mb) {
+			if i < len(ma) && j < len(mb) && ma[i] == mb[j] {
+				break
+			}
+			if j == len(mb) || i < len(ma) && lcs[(i+1)*cols+j] >= lcs[i*cols+j+1] {
+				i++
+			} else {
+				j++
+			}
+		}
+		h.i2, h.j2 = prefix+i, prefix+j
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadBoundaries reads a boundary file (-boundaries): the positions at which
+// new chunks start, as line numbers for line chunks and byte offsets for
+// char and token chunks. Positions are separated by whitespace or commas, so
+// both one-per-line files and JSON arrays work; # starts a comment.
+func loadBoundaries(fsys FS, filename string) ([]int, error) {
+	data, err := fsys.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading boundary file: %v", err)
+	}
+
+	var positions []int
+	for lineNumber, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == '[' || r == ']' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, field := range fields {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid boundary %q", filename, lineNumber+1, field)
+			}
+			positions = append(positions, n)
+		}
+	}
+	return positions, nil
+}
+
+// chunkAtBoundaries splits the input at the positions in the boundary file
+// instead of every -size units.
+func (c *Chunker) chunkAtBoundaries() error {
+	positions, err := loadBoundaries(c.config.filesystem(), c.config.Boundaries)
+	if err != nil {
+		return err
+	}
+	logDebug("boundaries_loaded", fmt.Sprintf("%d positions from %s; duplicates and positions past the end are dropped", len(positions), c.config.Boundaries), map[string]any{"file": c.config.Boundaries, "positions": len(positions)})
+	switch c.config.ChunkType {
+	case "lines":
+		return c.chunkLinesAtBoundaries(positions)
+	case "chars":
+		return c.chunkCharactersAtBoundaries(positions)
+	case "tokens":
+		return c.chunkTokensAtBoundaries(positions)
+	default:
+		return fmt.Errorf("unsupported chunk type: %s", c.config.ChunkType)
+	}
+}
+
+// boundaryCuts turns positions into sorted, distinct cut points strictly
+// inside [0, n), framed by 0 and n.
+func boundaryCuts(positions []int, n int) []int {
+	cuts := []int{0}
+	if n == 0 {
+		return cuts
+	}
+	sorted := append([]int(nil), positions...)
+	sort.Ints(sorted)
+	for _, p := range sorted {
+		if p > cuts[len(cuts)-1] && p < n {
+			cuts = append(cuts, p)
+		}
+	}
+	return append(cuts, n)
+}
+
+// chunkAtCuts emits one chunk per pair of cuts. Each chunk after the first
+// reaches back by the overlap, but never past the start of the previous
+// chunk, so the overlap always repeats the end of that chunk. back returns
+// the position n units before a cut, e.g. n runes back for chars.
+func (c *Chunker) chunkAtCuts(cuts []int, back func(cut, n int) int, write func(number, start, end, overlap int) error) error {
+	chunkNumber := c.firstChunkNumber()
+	prevStart := 0
+	for i := 0; i+1 < len(cuts); i++ {
+		cut, end := cuts[i], cuts[i+1]
+		start := cut
+		if i > 0 && c.config.OverlapSize > 0 {
+			start = max(back(cut, c.config.OverlapSize), prevStart)
+		}
+		if err := write(chunkNumber, start, end, cut-start); err != nil {
+			return err
+		}
+		prevStart = start
+		chunkNumber++
+	}
+	return nil
+}
+
+func unitsBack(cut, n int) int {
+	return cut - n
+}
+
+// readLines reads the lines of the input, for the line chunkings that look
+// at all of them before cutting any.
+func (c *Chunker) readLines() ([]string, error) {
+	file, err := c.openInput(c.digest, c.transformed)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file, int64(c.config.MaxMemory))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// chunkLinesPacked writes line chunks that start at sections of lines, the
+// sorted lines from 0 in starts, each holding as many whole sections as fit
+// in -size lines. A section longer than that is split every -size lines.
+func (c *Chunker) chunkLinesPacked(lines []string, starts []int) error {
+	return c.chunkAtCuts(boundaryCuts(packBoundaries(starts, len(lines), c.config.ChunkSize), len(lines)), unitsBack, func(number, start, end, overlap int) error {
+		return c.writeChunk(lines[start:end], number, start+1, end, overlap)
+	})
+}
+
+func (c *Chunker) chunkLinesAtBoundaries(positions []int) error {
+	file, err := c.openInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file, int64(c.config.MaxMemory))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Line n starts at index n-1
+	starts := make([]int, len(positions))
+	for i, line := range positions {
+		starts[i] = line - 1
+	}
+	return c.chunkAtCuts(boundaryCuts(starts, len(lines)), unitsBack, func(number, start, end, overlap int) error {
+		return c.writeChunk(lines[start:end], number, start+1, end, overlap)
+	})
+}
+
+func (c *Chunker) chunkCharactersAtBoundaries(positions []int) error {
+	content, err := c.readInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	text := string(content)
+
+	// Offsets inside a multi-byte character move to the next character
+	offsets := make([]int, len(positions))
+	for i, p := range positions {
+		offsets[i] = runeStart(text, min(p, len(text)), len(text))
+		if c.config.Graphemes {
+			offsets[i] = graphemeForward(text, offsets[i])
+		}
+	}
+	back := func(cut, n int) int {
+		if c.config.Graphemes {
+			return graphemeForward(text, runesBack(text, cut, n, 0))
+		}
+		return runesBack(text, cut, n, 0)
+	}
+	return c.chunkAtCuts(boundaryCuts(offsets, len(text)), back, func(number, start, end, overlap int) error {
+		return c.writeTextChunk(text[start:end], number, start, end, overlap)
+	})
+}
+
+func (c *Chunker) chunkTokensAtBoundaries(positions []int) error {
+	content, err := c.readInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	text := string(content)
+	spans := tokenSpans(text)
+	tokens := c.config.Cache.tokenize(c.config.InputFile, text)
+
+	// A byte offset starts a chunk at the first token beginning at or after it
+	indices := make([]int, len(positions))
+	for i, p := range positions {
+		indices[i] = sort.Search(len(spans), func(j int) bool { return spans[j][0] >= p })
+	}
+	return c.chunkAtCuts(boundaryCuts(indices, len(tokens)), unitsBack, func(number, start, end, overlap int) error {
+		return c.writeTextChunk(strings.Join(tokens[start:end], " "), number, start, end, overlap)
+	})
+}
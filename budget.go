@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// budgetReport records how a run fit its chunks into a token budget
+// (-budget): the chunks it kept, in the order they were written, and those
+// it dropped.
+type budgetReport struct {
+	Tokens    int            `json:"tokens"`
+	Used      int            `json:"used"`
+	Kept      int            `json:"kept"`
+	Truncated *int           `json:"truncated,omitempty"` // index of the chunk cut short to fit
+	Dropped   []droppedChunk `json:"dropped,omitempty"`
+}
+
+type droppedChunk struct {
+	Index  int    `json:"index"`
+	Source string `json:"source"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Tokens int    `json:"tokens"`
+}
+
+// chunkCollector holds on to every chunk of a run, so that the chunks can
+// be chosen once they are all known.
+type chunkCollector struct {
+	chunks []*Chunk
+}
+
+func (c *chunkCollector) WriteChunk(chunk *Chunk) error {
+	c.chunks = append(c.chunks, chunk)
+	return nil
+}
+
+func (c *chunkCollector) Close() error {
+	return nil
+}
+
+// chunkWithinBudget chunks the inputs, then writes the chunks in priority
+// order until -budget tokens are used. The chunk that crosses the budget is
+// truncated to fit, the rest are dropped; the manifest lists only the
+// chunks written, and the dropped ones in its budget report.
+func chunkWithinBudget(config ChunkConfig, inputs []inputFile, writer ChunkWriter, manifest *Manifest) error {
+	collector := &chunkCollector{}
+	if err := chunkInputs(config, inputs, collector, manifest); err != nil {
+		return err
+	}
+
+	report := &budgetReport{Tokens: config.Budget}
+	kept := map[int]*Chunk{}
+	var stats RunStats
+	for _, chunk := range budgetOrder(collector.chunks) {
+		tokens := chunk.Tokens
+		if report.Used+tokens > config.Budget {
+			if report.Truncated == nil && truncateChunk(chunk, config.Budget-report.Used) {
+				report.Truncated = &chunk.Index
+				tokens = chunk.Tokens
+				if chunk.Embedding != nil {
+					if err := config.Embedder.embedChunk(chunk); err != nil {
+						return err
+					}
+				}
+			} else {
+				report.Dropped = append(report.Dropped, droppedChunk{Index: chunk.Index, Source: chunk.Source, Start: chunk.Start, End: chunk.End, Tokens: tokens})
+				continue
+			}
+		}
+		if err := writer.WriteChunk(chunk); err != nil {
+			return err
+		}
+		report.Used += tokens
+		report.Kept++
+		stats.add(chunk)
+		kept[chunk.Index] = chunk
+	}
+
+	// The manifest keeps the chunks written, as written
+	var chunks []ManifestChunk
+	for _, entry := range manifest.Chunks {
+		if chunk, ok := kept[entry.Index]; ok {
+			entry.End, entry.Bytes, entry.SHA256, entry.Tokens, entry.Embedding = chunk.End, len(chunk.Content), chunk.SHA256, chunk.Tokens, chunk.Embedding
+			chunks = append(chunks, entry)
+		}
+	}
+	manifest.Chunks = chunks
+	manifest.Stats = stats
+	manifest.Budget = report
+
+	logEvent("budget", trf("Budget: kept %d chunks with %d of %d tokens, dropped %d", report.Kept, report.Used, report.Tokens, len(report.Dropped)), map[string]any{"budget": report})
+	var sources []string
+	dropped, droppedTokens := map[string]int{}, map[string]int{}
+	for _, chunk := range report.Dropped {
+		if dropped[chunk.Source] == 0 {
+			sources = append(sources, chunk.Source)
+		}
+		dropped[chunk.Source]++
+		droppedTokens[chunk.Source] += chunk.Tokens
+	}
+	for _, source := range sources {
+		textf("  dropped %d chunk(s) of %s (%d tokens)\n", dropped[source], source, droppedTokens[source])
+	}
+	return nil
+}
+
+// budgetOrder returns the chunks in the order they are kept: the order of
+// the run, so that earlier inputs, and with -priority the more important
+// ones, take precedence.
+func budgetOrder(chunks []*Chunk) []*Chunk {
+	return chunks
+}
+
+// truncateChunk cuts a chunk down to at most tokens tokens, and for line
+// chunks to whole lines. It reports false if nothing would be left.
+func truncateChunk(chunk *Chunk, tokens int) bool {
+	if tokens <= 0 {
+		return false
+	}
+	spans := tokenSpans(chunk.Content)
+	end := spans[tokens-1][1]
+	content := chunk.Content[:end]
+
+	switch chunk.Type {
+	case "lines":
+		lines := strings.Count(content, "\n")
+		if lines == 0 {
+			return false
+		}
+		content = content[:strings.LastIndexByte(content, '\n')+1]
+		if lines <= chunk.Overlap {
+			return false
+		}
+		chunk.End = chunk.Start + lines - 1
+		chunk.LineCount = lines
+	case "chars":
+		chunk.End = chunk.Start + len(content)
+	case "tokens":
+		chunk.End = chunk.Start + tokens
+	}
+	chunk.Content = content
+	chunk.SHA256 = contentChecksum(content)
+	chunk.Tokens = len(tokenSpans(content))
+	logDebug("chunk_truncated", fmt.Sprintf("chunk %d is cut to %d tokens to fit the budget", chunk.Index, len(tokenSpans(content))), map[string]any{"index": chunk.Index})
+	return true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// capabilities lists what the installed build supports, for orchestration
+// code to feature-detect instead of failing at runtime.
+type capabilities struct {
+	Build        BuildInfo          `json:"build"`
+	Commands     []string           `json:"commands"`
+	ChunkTypes   []string           `json:"chunk_types"`
+	Tokenizers   []tokenizerInfo    `json:"tokenizers"`
+	Formats      []formatCapability `json:"formats"`
+	Retrievers   []string           `json:"retrievers"`
+	LLM          []string           `json:"llm"`
+	Embeddings   []string           `json:"embedding_providers"`
+	VectorStores []string           `json:"vector_stores"`
+	Transforms   []string           `json:"transforms"`
+	Timestamps   []string           `json:"timestamp_formats"`
+	LogFormats   []string           `json:"log_formats"`
+	Languages    []string           `json:"languages"`
+	NameFields   []string           `json:"name_template_fields"`
+	PromptFields []string           `json:"prompt_template_fields"`
+}
+
+type tokenizerInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	UsedBy      []string `json:"used_by"`
+}
+
+// formatCapability describes an output sink. Available is false when the
+// sink depends on something missing from this machine, with the reason in
+// Requires.
+type formatCapability struct {
+	Name      string `json:"name"`
+	Extension string `json:"extension,omitempty"`
+	Stdout    bool   `json:"stdout"`
+	Available bool   `json:"available"`
+	Requires  string `json:"requires,omitempty"`
+}
+
+func runCapabilities(args []string) error {
+	fs := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the capabilities as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s capabilities [-json]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "List the chunk types, formats, tokenizers and sinks this build supports.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	caps := currentCapabilities()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(caps)
+	}
+
+	fmt.Println(caps.Build)
+	fmt.Printf("Commands:    %s\n", strings.Join(caps.Commands, ", "))
+	fmt.Printf("Chunk types: %s\n", strings.Join(caps.ChunkTypes, ", "))
+	for _, tok := range caps.Tokenizers {
+		fmt.Printf("Tokenizer:   %s (%s)\n", tok.Name, tok.Description)
+	}
+	fmt.Println("Formats:")
+	for _, f := range caps.Formats {
+		status := "available"
+		if !f.Available {
+			status = "unavailable: needs " + f.Requires
+		}
+		stdout := ""
+		if f.Stdout {
+			stdout = ", streams to stdout"
+		}
+		fmt.Printf("  %-10s %s%s\n", f.Name, status, stdout)
+	}
+	fmt.Printf("Retrievers:  %s\n", strings.Join(caps.Retrievers, ", "))
+	fmt.Printf("LLM:         %s\n", strings.Join(caps.LLM, ", "))
+	fmt.Printf("Embeddings:  %s\n", strings.Join(caps.Embeddings, ", "))
+	fmt.Printf("Vector DBs:  %s\n", strings.Join(caps.VectorStores, ", "))
+	fmt.Printf("Transforms:  %s\n", strings.Join(caps.Transforms, ", "))
+	fmt.Printf("Timestamps:  %s\n", strings.Join(caps.Timestamps, ", "))
+	fmt.Printf("Log formats: %s\n", strings.Join(caps.LogFormats, ", "))
+	fmt.Printf("Languages:   %s\n", strings.Join(caps.Languages, ", "))
+	return nil
+}
+
+func currentCapabilities() capabilities {
+	caps := capabilities{
+		Build: currentBuild(),
+		Tokenizers: []tokenizerInfo{{
+			Name:        tokenizerName,
+			Description: "words and single punctuation marks, split on whitespace",
+			UsedBy:      []string{"-type tokens", "stats", "eval", "compare"},
+		}},
+		Retrievers:   []string{"bm25", "exec:<command>"},
+		LLM:          []string{"questions"},
+		Embeddings:   embedProviderNames(),
+		VectorStores: vectorStoreNames(),
+		Transforms: ChunkConfig{
+			MergeLogs: true, RedactSecrets: true, StripComments: true, Grep: []string{"."}, SampleRate: 0.5,
+			NormalizeWhitespace: true, CollapseRepeats: true, MaxLine: 1,
+		}.transformNames(),
+		Timestamps: timestampFormats,
+		LogFormats: []string{"text", "json"},
+	}
+	for _, cmd := range commands() {
+		caps.Commands = append(caps.Commands, cmd.name)
+	}
+	for chunkType := range validChunkTypes {
+		caps.ChunkTypes = append(caps.ChunkTypes, chunkType)
+	}
+	caps.ChunkTypes = append(caps.ChunkTypes, "semantic", "diff", "subtitles")
+	sort.Strings(caps.ChunkTypes)
+	for code := range supportedLangs {
+		caps.Languages = append(caps.Languages, code)
+	}
+	sort.Strings(caps.Languages)
+	fields := reflect.TypeOf(chunkName{})
+	for i := 0; i < fields.NumField(); i++ {
+		caps.NameFields = append(caps.NameFields, fields.Field(i).Name)
+	}
+	fields = reflect.TypeOf(promptChunk{})
+	for i := 0; i < fields.NumField(); i++ {
+		caps.PromptFields = append(caps.PromptFields, fields.Field(i).Name)
+	}
+
+	for name, ext := range formatExtensions {
+		f := formatCapability{Name: name, Extension: ext, Stdout: streamFormats[name], Available: true}
+		if name == "sqlite" {
+			if _, err := exec.LookPath("sqlite3"); err != nil {
+				f.Available = false
+				f.Requires = "sqlite3 in PATH"
+			}
+		}
+		caps.Formats = append(caps.Formats, f)
+	}
+	sort.Slice(caps.Formats, func(i, j int) bool { return caps.Formats[i].Name < caps.Formats[j].Name })
+	return caps
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sinkCheck is one pre-flight check run by -sink-check.
+type sinkCheck struct {
+	name  string
+	check func() error
+}
+
+// checkSinks validates every configured sink, and the LLM endpoint when
+// questions are enabled, before any input is read, so that a bad path,
+// missing tool or rejected API key fails the run up front instead of after
+// the chunking work is done.
+func checkSinks(config ChunkConfig) error {
+	var checks []sinkCheck
+	for _, format := range config.formats() {
+		checks = append(checks, sinkCheck{name: format, check: func() error {
+			return checkFormat(config, format)
+		}})
+	}
+	if config.WriteManifest && !outputIsStdout(config) {
+		checks = append(checks, sinkCheck{name: "manifest", check: func() error {
+			return checkWritableDir(filepath.Dir(auxiliaryPath(config, manifestFilename)))
+		}})
+	}
+	if config.Semantic || config.Embed != "" {
+		checks = append(checks, sinkCheck{name: "embeddings endpoint", check: func() error {
+			client := newEmbeddingClient(config)
+			client.retries = 0
+			_, err := client.Embed([]string{"OK"})
+			return err
+		}})
+	}
+	if config.Sink != "" {
+		checks = append(checks, sinkCheck{name: config.Sink, check: func() error {
+			return checkVectorStore(config)
+		}})
+	}
+	if config.Questions > 0 {
+		checks = append(checks, sinkCheck{name: "questions endpoint", check: func() error {
+			return checkChatEndpoint(newChatClient(config.QuestionsEndpoint, config.QuestionsModel, config.QuestionsAPIKey))
+		}})
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			logEvent("sink_check", trf("Sink check %s: FAILED: %v", c.name, err),
+				map[string]any{"sink": c.name, "ok": false, "error": err.Error()})
+			failed++
+			continue
+		}
+		logEvent("sink_check", trf("Sink check %s: ok", c.name), map[string]any{"sink": c.name, "ok": true})
+	}
+	textf("\n")
+
+	if failed > 0 {
+		return fmt.Errorf(tr("%d of %d sink checks failed"), failed, len(checks))
+	}
+	return nil
+}
+
+func checkFormat(config ChunkConfig, format string) error {
+	if outputIsStdout(config) {
+		if !streamFormats[format] {
+			return fmt.Errorf("the %s format cannot be streamed to stdout", format)
+		}
+		return nil
+	}
+	if format == "files" {
+		return checkWritableDir(config.OutputDir)
+	}
+
+	path := formatOutputPath(config, format)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("output path %s is a directory", path)
+	}
+	if err := checkWritableDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	switch format {
+	case "corpus":
+		return checkWritableDir(filepath.Dir(auxiliaryPath(config, corpusIndexName)))
+	case "sqlite":
+		return checkSQLite()
+	}
+	return nil
+}
+
+// checkWritableDir creates and removes a scratch file in dir.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+	file, err := os.CreateTemp(dir, ".sink-check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %v", dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// checkSQLite creates the schema in an in-memory database, which confirms
+// that sqlite3 is installed and built with FTS5.
+func checkSQLite() error {
+	bin, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return fmt.Errorf("the sqlite format needs the sqlite3 command-line shell in PATH: %v", err)
+	}
+	cmd := exec.Command(bin, "-bail", ":memory:")
+	cmd.Stdin = strings.NewReader(sqliteSchema)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sqlite3 cannot create the chunks schema: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// checkChatEndpoint sends a minimal completion request, which verifies the
+// endpoint, the model name and the API key in one round trip.
+func checkChatEndpoint(client *chatClient) error {
+	_, err := client.Complete("", "Reply with OK.")
+	return err
+}
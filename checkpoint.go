@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+const checkpointFilename = "checkpoint.json"
+
+// checkpointEvery is how many chunks are written between checkpoints.
+const checkpointEvery = 50
+
+// checkpoint records how far a run got, so that -resume can skip the chunk
+// files an interrupted run already wrote. It is written to the output
+// directory during the run and removed when the run completes.
+type checkpoint struct {
+	Settings  string                 `json:"settings"` // fingerprint of the options that decide the chunks
+	Source    string                 `json:"source"`   // file the last chunk came from
+	Index     int                    `json:"index"`    // last chunk written
+	End       int                    `json:"end"`      // where that chunk ends, in manifest units
+	Sources   map[string]sourceStamp `json:"sources"`
+	Questions map[int][]string       `json:"questions,omitempty"` // generated questions, by chunk index
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// sourceStamp identifies the version of a source that was chunked.
+type sourceStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// chunkSettings are the options that decide which chunks a run produces and
+// how they are named, each under the name of its ChunkConfig field.
+type chunkSettings struct {
+	Inputs             []string
+	Include            []string
+	Exclude            []string
+	ChunkSize          int
+	OverlapSize        int
+	ChunkType          string
+	AddMetadata        bool
+	ChecksumHeader     bool
+	Prefix             string
+	NameTemplate       string
+	IndexWidth         int
+	StartIndex         int
+	Format             string
+	Boundaries         string
+	Questions          int
+	QuestionsModel     string
+	QuestionsEndpoint  string
+	Transforms         []string // transformNames, the transforms that are on
+	SampleRate         float64
+	SampleLevels       string
+	MaxLine            int
+	MaxLineType        string
+	Timestamps         bool
+	InputTimezone      string
+	Timezone           string
+	TimeWindow         time.Duration
+	LSP                string
+	Graphemes          bool
+	Priority           []string
+	Encoding           string
+	MinSize            int
+	MaxChunks          int
+	SizeBytes          bool
+	Grep               []string
+	GrepV              []string
+	TabWidth           int
+	DedupeFuzzy        float64
+	DedupeAction       string
+	ContextHeader      bool
+	PromptTemplate     string
+	Semantic           bool
+	SemanticPercentile float64
+	EmbedEndpoint      string
+	EmbedModel         string
+	Embed              string
+	MetadataMode       string
+	Meta               []string
+	Git                bool
+	Diff               bool
+	NotebookOutputs    bool
+	Subtitles          bool
+	SizeDuration       time.Duration
+	CodeRefs           bool
+}
+
+// checkpointSettings fingerprints the chunkSettings of config, so a run is
+// only resumed with the options it started with.
+func checkpointSettings(config ChunkConfig) string {
+	settings, _ := json.Marshal(chunkSettings{
+		Inputs:             config.Inputs,
+		Include:            config.Include,
+		Exclude:            config.Exclude,
+		ChunkSize:          config.ChunkSize,
+		OverlapSize:        config.OverlapSize,
+		ChunkType:          config.ChunkType,
+		AddMetadata:        config.AddMetadata,
+		ChecksumHeader:     config.ChecksumHeader,
+		Prefix:             config.Prefix,
+		NameTemplate:       config.NameTemplate,
+		IndexWidth:         config.IndexWidth,
+		StartIndex:         config.StartIndex,
+		Format:             config.Format,
+		Boundaries:         config.Boundaries,
+		Questions:          config.Questions,
+		QuestionsModel:     config.QuestionsModel,
+		QuestionsEndpoint:  config.QuestionsEndpoint,
+		Transforms:         config.transformNames(),
+		SampleRate:         config.SampleRate,
+		SampleLevels:       config.SampleLevels,
+		MaxLine:            config.MaxLine,
+		MaxLineType:        config.MaxLineType,
+		Timestamps:         config.Timestamps,
+		InputTimezone:      config.InputTimezone,
+		Timezone:           config.Timezone,
+		TimeWindow:         config.TimeWindow,
+		LSP:                config.LSP,
+		Graphemes:          config.Graphemes,
+		Priority:           config.Priority,
+		Encoding:           config.Encoding,
+		MinSize:            config.MinSize,
+		MaxChunks:          config.MaxChunks,
+		SizeBytes:          config.SizeBytes,
+		Grep:               config.Grep,
+		GrepV:              config.GrepV,
+		TabWidth:           config.TabWidth,
+		DedupeFuzzy:        config.DedupeFuzzy,
+		DedupeAction:       config.DedupeAction,
+		ContextHeader:      config.ContextHeader,
+		PromptTemplate:     config.PromptTemplate,
+		Semantic:           config.Semantic,
+		SemanticPercentile: config.SemanticPercentile,
+		EmbedEndpoint:      config.EmbedEndpoint,
+		EmbedModel:         config.EmbedModel,
+		Embed:              config.Embed,
+		MetadataMode:       config.MetadataMode,
+		Meta:               config.Meta,
+		Git:                config.Git,
+		Diff:               config.Diff,
+		NotebookOutputs:    config.NotebookOutputs,
+		Subtitles:          config.Subtitles,
+		SizeDuration:       config.SizeDuration,
+		CodeRefs:           config.CodeRefs,
+	})
+	sum := sha256.Sum256(settings)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCheckpoint reads the checkpoint of an interrupted run with the same
+// settings. It returns nil if there is none.
+func loadCheckpoint(config ChunkConfig, filename string) (*checkpoint, error) {
+	fsys := config.filesystem()
+	data, err := fsys.ReadFile(filename)
+	if err != nil {
+		if _, statErr := fsys.Stat(filename); statErr != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading checkpoint: %v", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("error decoding checkpoint %s: %v", filename, err)
+	}
+	if cp.Settings != checkpointSettings(config) {
+		return nil, fmt.Errorf("%s was written with different options; run without -resume to start over", filename)
+	}
+	for path, stamp := range cp.Sources {
+		info, err := fsys.Stat(path)
+		if err != nil || !stampOf(info).equal(stamp) {
+			return nil, fmt.Errorf("%s has changed since the interrupted run; run without -resume to start over", path)
+		}
+	}
+	return &cp, nil
+}
+
+func stampOf(info fs.FileInfo) sourceStamp {
+	return sourceStamp{Size: info.Size(), ModTime: info.ModTime().UTC()}
+}
+
+func (s sourceStamp) equal(other sourceStamp) bool {
+	return s.Size == other.Size && s.ModTime.Equal(other.ModTime)
+}
+
+// written reports whether the interrupted run wrote the chunk, and returns
+// the questions it generated for it.
+func (cp *checkpoint) written(index int) ([]string, bool) {
+	if cp == nil || index > cp.Index {
+		return nil, false
+	}
+	return cp.Questions[index], true
+}
+
+// checkpointWriter passes chunks on to the output and writes a checkpoint
+// every checkpointEvery chunks.
+type checkpointWriter struct {
+	ChunkWriter
+	config  ChunkConfig
+	path    string
+	state   checkpoint
+	pending int
+}
+
+func newCheckpointWriter(w ChunkWriter, config ChunkConfig, path string) *checkpointWriter {
+	state := checkpoint{Settings: checkpointSettings(config), Sources: map[string]sourceStamp{}, Questions: map[int][]string{}}
+	// The checkpoint being resumed keeps covering the chunks it recorded
+	if cp := config.Checkpoint; cp != nil {
+		state.Source, state.Index, state.End = cp.Source, cp.Index, cp.End
+		for path, stamp := range cp.Sources {
+			state.Sources[path] = stamp
+		}
+		for index, questions := range cp.Questions {
+			state.Questions[index] = questions
+		}
+	}
+	return &checkpointWriter{ChunkWriter: w, config: config, path: path, state: state}
+}
+
+func (w *checkpointWriter) WriteChunk(chunk *Chunk) error {
+	if err := w.ChunkWriter.WriteChunk(chunk); err != nil {
+		return err
+	}
+
+	if _, ok := w.state.Sources[chunk.Source]; !ok {
+		info, err := w.config.filesystem().Stat(chunk.Source)
+		if err != nil {
+			return fmt.Errorf("error writing checkpoint: %v", err)
+		}
+		w.state.Sources[chunk.Source] = stampOf(info)
+	}
+	w.state.Source, w.state.Index, w.state.End = chunk.Source, chunk.Index, chunk.End
+	if len(chunk.Questions) > 0 {
+		w.state.Questions[chunk.Index] = chunk.Questions
+	}
+
+	w.pending++
+	if w.pending < checkpointEvery {
+		return nil
+	}
+	w.pending = 0
+	return w.save()
+}
+
+// Flush waits for chunks still being written by -workers.
+func (w *checkpointWriter) Flush() error {
+	return flushChunks(w.ChunkWriter)
+}
+
+// save writes the checkpoint once every chunk it records is on disk; if a
+// write failed, the previous checkpoint stays.
+func (w *checkpointWriter) save() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.state.UpdatedAt = w.config.now().UTC()
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %v", err)
+	}
+	file, err := w.config.filesystem().Create(w.path)
+	if err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	return nil
+}
+
+// finish removes the checkpoint of a completed run.
+func (w *checkpointWriter) finish() error {
+	if _, err := w.config.filesystem().Stat(w.path); err != nil {
+		return nil
+	}
+	return w.config.filesystem().Remove(w.path)
+}
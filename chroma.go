@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	chromaBatch   = 100 // records per upsert
+	chromaStartup = 30 * time.Second
+	chromaPrefix  = "/api/v2/tenants/default_tenant/databases/default_database"
+)
+
+// chromaWriter upserts chunks into a ChromaDB collection (-sink chroma),
+// created for cosine distance if it does not exist, chromaBatch at a time.
+// The collection is on the server at -sink-url or, with -chroma-path, in a
+// persistent directory, through a chroma server the writer starts for the
+// run: Chroma's on-disk format is its own, so as with sqlite3 the chroma
+// command does the writing.
+type chromaWriter struct {
+	store      *storeClient
+	url        string // of the database
+	collection string
+	id         string // of the collection, once it is known
+	server     *exec.Cmd
+	exited     chan struct{} // closed once the server has exited
+	stderr     bytes.Buffer
+
+	ids        []string
+	embeddings [][]float32
+	documents  []string
+	metadatas  []map[string]any
+	chunks     []*Chunk
+}
+
+func newChromaWriter(config ChunkConfig, baseURL, apiKey string) (ChunkWriter, error) {
+	w := &chromaWriter{store: newChromaClient(apiKey), collection: config.Collection}
+	if config.ChromaPath != "" {
+		var err error
+		if baseURL, err = w.startServer(config.ChromaPath); err != nil {
+			return nil, err
+		}
+		w.store.local = true
+	}
+	w.store.retries = config.Retries
+	w.url = baseURL + chromaPrefix
+	return w, nil
+}
+
+func newChromaClient(apiKey string) *storeClient {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("X-Chroma-Token", apiKey)
+	}
+	return newStoreClient("Chroma", header)
+}
+
+// checkChroma checks the chroma command is there for -chroma-path, or
+// that the server at -sink-url answers.
+func checkChroma(config ChunkConfig, baseURL, apiKey string) error {
+	if config.ChromaPath != "" {
+		if _, err := exec.LookPath("chroma"); err != nil {
+			return fmt.Errorf("-chroma-path needs the chroma command in PATH: %v", err)
+		}
+		return checkWritableDir(config.ChromaPath)
+	}
+	_, err := newChromaClient(apiKey).do(http.MethodGet, baseURL+"/api/v2/heartbeat", nil, nil)
+	return err
+}
+
+// startServer runs chroma on dir, on a free local port, and waits for it
+// to answer.
+func (w *chromaWriter) startServer(dir string) (string, error) {
+	bin, err := exec.LookPath("chroma")
+	if err != nil {
+		return "", fmt.Errorf("-chroma-path needs the chroma command in PATH: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating Chroma directory: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("error finding a port for chroma: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	w.server = exec.Command(bin, "run", "--path", dir, "--host", "127.0.0.1", "--port", fmt.Sprint(port))
+	w.server.Stdout, w.server.Stderr = &w.stderr, &w.stderr
+	if err := w.server.Start(); err != nil {
+		return "", fmt.Errorf("error starting chroma: %v", err)
+	}
+	w.exited = make(chan struct{})
+	go func() {
+		w.server.Wait()
+		close(w.exited)
+	}()
+
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	deadline := time.Now().Add(chromaStartup)
+	for {
+		select {
+		case <-w.exited:
+			w.server = nil
+			return "", fmt.Errorf("chroma exited: %s", strings.TrimSpace(w.stderr.String()))
+		case <-time.After(200 * time.Millisecond):
+		}
+		if resp, err := http.Get(baseURL + "/api/v2/heartbeat"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return baseURL, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			w.stopServer()
+			return "", fmt.Errorf("chroma did not start within %s", chromaStartup)
+		}
+	}
+}
+
+// stopServer stops the chroma server of -chroma-path, which has stored
+// every upsert it answered.
+func (w *chromaWriter) stopServer() {
+	if w.server == nil {
+		return
+	}
+	w.server.Process.Signal(os.Interrupt)
+	select {
+	case <-w.exited:
+	case <-time.After(10 * time.Second):
+		w.server.Process.Kill()
+		<-w.exited
+	}
+	w.server = nil
+}
+
+// chromaMetadata is the chunk's flat metadata without its content, which
+// Chroma keeps as the document. Its metadata has no lists, so they are
+// joined with newlines.
+func chromaMetadata(chunk *Chunk) map[string]any {
+	metadata := flatMetadata(chunk)
+	delete(metadata, "content")
+	for key, value := range metadata {
+		if list, ok := value.([]string); ok {
+			metadata[key] = strings.Join(list, "\n")
+		}
+	}
+	return metadata
+}
+
+func (w *chromaWriter) WriteChunk(chunk *Chunk) error {
+	w.ids = append(w.ids, chunkUUID(chunk))
+	w.embeddings = append(w.embeddings, chunk.Embedding)
+	w.documents = append(w.documents, chunk.Content)
+	w.metadatas = append(w.metadatas, chromaMetadata(chunk))
+	w.chunks = append(w.chunks, chunk)
+	if len(w.ids) < chromaBatch {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush upserts the records not sent yet.
+func (w *chromaWriter) Flush() error {
+	if len(w.ids) == 0 {
+		return nil
+	}
+	if w.id == "" {
+		var collection struct {
+			ID string `json:"id"`
+		}
+		body := map[string]any{"name": w.collection, "get_or_create": true, "metadata": map[string]any{"hnsw:space": "cosine"}}
+		if _, err := w.store.do(http.MethodPost, w.url+"/collections", body, &collection); err != nil {
+			return fmt.Errorf("error opening Chroma collection %s: %v", w.collection, err)
+		}
+		w.id = collection.ID
+	}
+
+	body := map[string]any{"ids": w.ids, "embeddings": w.embeddings, "documents": w.documents, "metadatas": w.metadatas}
+	if _, err := w.store.do(http.MethodPost, w.url+"/collections/"+url.PathEscape(w.id)+"/upsert", body, nil); err != nil {
+		return fmt.Errorf("error upserting chunks into Chroma collection %s: %v", w.collection, err)
+	}
+	for _, chunk := range w.chunks {
+		logChunk(chunk, trf("document in Chroma collection %s", w.collection))
+	}
+	w.ids, w.embeddings, w.documents, w.metadatas, w.chunks = nil, nil, nil, nil, nil
+	return nil
+}
+
+func (w *chromaWriter) Close() error {
+	err := w.Flush()
+	w.stopServer()
+	return err
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Chunk is a single piece of an input file, ready to be written out.
+// Start and End follow the same conventions as ManifestChunk.
+type Chunk struct {
+	Index      int
+	Type       string // "lines", "chars", "tokens"
+	Source     string
+	Filename   string
+	Start      int
+	End        int
+	LineCount  int // only set for line chunks
+	Overlap    int // leading lines, bytes or tokens repeated from the previous chunk
+	Content    string
+	SHA256     string // hex SHA-256 of Content
+	Tokens     int    // tokens in Content, counted with tokenizerName
+	TimeStart  string // earliest and latest log timestamp in Content (-timestamps)
+	TimeEnd    string
+	References []codeReference // other inputs the chunk's code refers to (-code-refs)
+	Questions  []string
+	Meta       map[string]string // -meta fields
+	Git        *chunkGit         // -git commit and last commit of its lines
+	Cells      *cellRange        // notebook cells it holds lines of
+
+	// The earlier chunk this one nearly repeats, and how closely (-dedupe-fuzzy)
+	DuplicateOf int
+	Similarity  float64
+
+	Embedding []float32 // of Content (-embed)
+
+	raw string // Content before -context-header and -prompt-template added to it
+}
+
+// ChunkWriter receives every chunk produced by a Chunker.
+type ChunkWriter interface {
+	WriteChunk(chunk *Chunk) error
+	Close() error
+}
+
+// fileWriter writes each chunk to its own file in the output directory,
+// optionally preceded by a metadata header.
+type fileWriter struct {
+	fs          FS
+	dir         string
+	addMetadata bool
+	addChecksum bool
+	sidecars    bool
+
+	mu       sync.Mutex // -workers writes chunks in parallel
+	dirReady bool
+	names    chunkNames
+}
+
+func newFileWriter(config ChunkConfig) *fileWriter {
+	return &fileWriter{
+		fs:          config.filesystem(),
+		dir:         config.OutputDir,
+		addMetadata: config.metadataHeader(),
+		addChecksum: config.ChecksumHeader,
+		sidecars:    config.sidecars(),
+	}
+}
+
+func (w *fileWriter) WriteChunk(chunk *Chunk) error {
+	if err := w.claim(chunk.Filename); err != nil {
+		return err
+	}
+	file, err := w.fs.Create(filepath.Join(w.dir, chunk.Filename))
+	if err != nil {
+		return fmt.Errorf("error creating chunk file: %v", err)
+	}
+	defer file.Close()
+
+	if err := writeChunkFile(file, chunk, w.addMetadata, w.addChecksum); err != nil {
+		return fmt.Errorf("error writing chunk file: %v", err)
+	}
+	if w.sidecars {
+		if err := w.writeSidecar(chunk); err != nil {
+			return err
+		}
+	}
+
+	if chunk.Type == "lines" {
+		logChunk(chunk, trf("%s (lines %d-%d)", chunk.Filename, chunk.Start, chunk.End))
+	} else {
+		logChunk(chunk, chunk.Filename)
+	}
+	return nil
+}
+
+// claim creates the output directory the first time and reserves a chunk's
+// file name.
+func (w *fileWriter) claim(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Create output directory if it doesn't exist
+	if !w.dirReady {
+		if err := w.fs.MkdirAll(w.dir); err != nil {
+			return fmt.Errorf("error creating output directory: %v", err)
+		}
+		w.dirReady = true
+	}
+	return w.names.add(name)
+}
+
+// writeSidecar writes the metadata of chunk to its sidecar file
+// (-metadata-mode sidecar).
+func (w *fileWriter) writeSidecar(chunk *Chunk) error {
+	name := sidecarName(chunk.Filename)
+	if err := w.claim(name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(newChunkSidecar(chunk), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sidecar file: %v", err)
+	}
+	file, err := w.fs.Create(filepath.Join(w.dir, name))
+	if err != nil {
+		return fmt.Errorf("error creating sidecar file: %v", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing sidecar file: %v", err)
+	}
+	return file.Close()
+}
+
+func (w *fileWriter) Close() error {
+	return nil
+}
+
+// writeChunkFile writes the body of a chunk file, optionally preceded by a
+// metadata header, which can carry the checksum of the content.
+func writeChunkFile(w io.Writer, chunk *Chunk, addMetadata, addChecksum bool) error {
+	if addMetadata {
+		fmt.Fprintf(w, "=== CHUNK %d ===\n", chunk.Index)
+		fmt.Fprintf(w, "Source: %s\n", chunk.Source)
+		if chunk.Type == "lines" {
+			fmt.Fprintf(w, "Lines: %d-%d\n", chunk.Start, chunk.End)
+			fmt.Fprintf(w, "Total lines in chunk: %d\n", chunk.LineCount)
+		} else {
+			fmt.Fprintf(w, "Range: %d-%d\n", chunk.Start, chunk.End)
+		}
+		fmt.Fprintf(w, "Tokens: %d\n", chunk.Tokens)
+		if chunk.Cells != nil {
+			fmt.Fprintf(w, "Cells: %d-%d\n", chunk.Cells.First, chunk.Cells.Last)
+		}
+		if chunk.TimeStart != "" {
+			fmt.Fprintf(w, "Time: %s to %s\n", chunk.TimeStart, chunk.TimeEnd)
+		}
+		if addChecksum {
+			fmt.Fprintf(w, "SHA-256: %s\n", chunk.SHA256)
+		}
+		if chunk.DuplicateOf > 0 {
+			fmt.Fprintf(w, "Duplicate of: chunk %d (%.0f%% similar)\n", chunk.DuplicateOf, chunk.Similarity*100)
+		}
+		if chunk.Git != nil {
+			fmt.Fprintf(w, "Git: %s at %s\n", chunk.Git.Path, chunk.Git.Commit)
+			if chunk.Git.Uncommitted {
+				fmt.Fprintf(w, "Last commit: uncommitted changes\n")
+			} else if chunk.Git.LastCommit != "" {
+				fmt.Fprintf(w, "Last commit: %s (%s)\n", chunk.Git.LastCommit, chunk.Git.LastModified)
+			}
+		}
+		for _, key := range sortedMetaKeys(chunk.Meta) {
+			fmt.Fprintf(w, "%s: %s\n", key, chunk.Meta[key])
+		}
+		writeQuestionsHeader(w, chunk.Questions)
+		fmt.Fprintf(w, "=== CONTENT ===\n\n")
+	}
+
+	_, err := io.WriteString(w, chunk.Content)
+	return err
+}
+
+// metadataHeader reports whether chunk files start with a metadata header.
+func (config ChunkConfig) metadataHeader() bool {
+	return config.AddMetadata && config.MetadataMode != "sidecar"
+}
+
+// sidecars reports whether every chunk file has a sidecar file with its
+// metadata instead (-metadata-mode sidecar).
+func (config ChunkConfig) sidecars() bool {
+	return config.AddMetadata && config.MetadataMode == "sidecar"
+}
+
+// chunkSidecar is the sidecar file of a chunk: its JSONL record, without the
+// content, which is the chunk file's, and with the content's checksum and
+// line count.
+type chunkSidecar struct {
+	jsonlRecord
+	Content   string `json:"content,omitempty"` // left empty, hiding the record's
+	SHA256    string `json:"sha256"`
+	LineCount int    `json:"lines,omitempty"`
+}
+
+func newChunkSidecar(chunk *Chunk) chunkSidecar {
+	return chunkSidecar{jsonlRecord: newJSONLRecord(chunk), SHA256: chunk.SHA256, LineCount: chunk.LineCount}
+}
+
+// sidecarName returns the name of the sidecar file of a chunk file:
+// chunk_001.json for chunk_001.txt.
+func sidecarName(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".json"
+}
+
+// contentChecksum returns the hex SHA-256 of a chunk's content.
+func contentChecksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// memoryWriter keeps chunks in memory instead of writing them anywhere.
+type memoryWriter struct {
+	chunks []Chunk
+}
+
+func (w *memoryWriter) WriteChunk(chunk *Chunk) error {
+	w.chunks = append(w.chunks, *chunk)
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// codeReference is another input a code chunk depends on (-code-refs):
+// through an import that resolves to it, or a call to a symbol it defines.
+type codeReference struct {
+	File   string `json:"file"`
+	Symbol string `json:"symbol,omitempty"`
+	Import string `json:"import,omitempty"`
+}
+
+// symbolDefinition finds the functions, types and classes a line defines,
+// in Go, Python, JavaScript/TypeScript, Java, C# and Rust. It is lexical:
+// good enough to link chunks, not to compile them.
+var symbolDefinition = []*regexp.Regexp{
+	regexp.MustCompile(`^\s*func\s+(?:\([^)]*\)\s*)?([A-Za-z_]\w*)`),
+	regexp.MustCompile(`^\s*type\s+([A-Za-z_]\w*)\s`),
+	regexp.MustCompile(`^\s*(?:async\s+)?def\s+([A-Za-z_]\w*)`),
+	regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?(?:public\s+|private\s+|internal\s+)?(?:static\s+)?class\s+([A-Za-z_$][\w$]*)`),
+	regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)`),
+	regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*=\s*(?:async\s*)?(?:function\b|\([^)]*\)\s*=>|[A-Za-z_$][\w$]*\s*=>)`),
+	regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:fn|struct|enum|trait)\s+([A-Za-z_]\w*)`),
+}
+
+// importPatterns find the module a line imports.
+var importPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\s*import\s+(?:[\w.]+\s+)?"([^"]+)"`),                  // Go
+	regexp.MustCompile(`^\s*(?:from\s+([\w.]+)\s+import|import\s+([\w.]+))`),    // Python
+	regexp.MustCompile(`(?:\bfrom\s+|^\s*import\s+)['"]([^'"]+)['"]`),           // JavaScript
+	regexp.MustCompile(`\brequire\(\s*['"]([^'"]+)['"]\s*\)`),                   // CommonJS
+	regexp.MustCompile(`^\s*#\s*include\s*["<]([^">]+)[">]`),                    // C and C++
+	regexp.MustCompile(`^\s*(?:pub\s+)?use\s+((?:crate|super|self)(?:::\w+)+)`), // Rust
+}
+
+// goImportLine is a path on its own line inside a Go import ( ... ) block.
+var goImportLine = regexp.MustCompile(`^\s*(?:[\w.]+\s+)?"([^"]+)"\s*$`)
+
+var callSite = regexp.MustCompile(`\b([A-Za-z_$][\w$]*)\s*\(`)
+
+// symbolIndex records which inputs define each symbol, and where imports
+// may resolve to, across all the inputs of a run.
+type symbolIndex struct {
+	definedIn map[string][]string
+	modules   map[string][]string // input path without extension, with / separators
+}
+
+// buildSymbolIndex reads every input for the symbols it defines. It reads
+// the files as they are, without pre-chunk transforms, which do not apply to
+// code.
+func buildSymbolIndex(config ChunkConfig, inputs []inputFile) (*symbolIndex, error) {
+	idx := &symbolIndex{definedIn: map[string][]string{}, modules: map[string][]string{}}
+	for _, input := range inputs {
+		data, err := config.filesystem().ReadFile(input.Path)
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, line := range strings.Split(string(data), "\n") {
+			for _, pattern := range symbolDefinition {
+				m := pattern.FindStringSubmatch(line)
+				// Short and entry-point names would link everything to everything
+				if m == nil || len(m[1]) < 3 || m[1] == "main" || m[1] == "init" || seen[m[1]] {
+					continue
+				}
+				seen[m[1]] = true
+				idx.definedIn[m[1]] = append(idx.definedIn[m[1]], input.Path)
+			}
+		}
+		module := filepath.ToSlash(strings.TrimSuffix(input.Path, filepath.Ext(input.Path)))
+		idx.modules[module] = append(idx.modules[module], input.Path)
+	}
+	return idx, nil
+}
+
+// references lists the other inputs a chunk of source refers to, sorted by
+// file and then symbol or import.
+func (idx *symbolIndex) references(source, content string) []codeReference {
+	if idx == nil {
+		return nil
+	}
+	var refs []codeReference
+	seen := map[codeReference]bool{}
+	add := func(ref codeReference) {
+		if ref.File != source && !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	for _, spec := range chunkImports(content) {
+		for _, file := range idx.resolveImport(source, spec) {
+			add(codeReference{File: file, Import: spec})
+		}
+	}
+	for _, m := range callSite.FindAllStringSubmatch(content, -1) {
+		for _, file := range idx.definedIn[m[1]] {
+			add(codeReference{File: file, Symbol: m[1]})
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Symbol+a.Import < b.Symbol+b.Import
+	})
+	return refs
+}
+
+// chunkImports returns the modules imported in content.
+func chunkImports(content string) []string {
+	var specs []string
+	inGoBlock := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "import ("):
+			inGoBlock = true
+			continue
+		case inGoBlock && trimmed == ")":
+			inGoBlock = false
+			continue
+		case inGoBlock:
+			if m := goImportLine.FindStringSubmatch(line); m != nil {
+				specs = append(specs, m[1])
+			}
+			continue
+		}
+		for _, pattern := range importPatterns {
+			if m := pattern.FindStringSubmatch(line); m != nil {
+				specs = append(specs, firstNonEmpty(m[1:]))
+				break
+			}
+		}
+	}
+	return specs
+}
+
+// resolveImport finds the inputs an import refers to: relative imports
+// from the importing file's directory, others by their trailing path, e.g.
+// "app/models" or Python's "app.models" matching app/models.py.
+func (idx *symbolIndex) resolveImport(source, spec string) []string {
+	var modules []string
+	switch {
+	case strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../"):
+		modules = []string{filepath.ToSlash(filepath.Join(filepath.Dir(source), spec))}
+	case strings.Contains(spec, "::"):
+		modules = []string{strings.ReplaceAll(strings.TrimPrefix(strings.TrimPrefix(spec, "crate::"), "super::"), "::", "/")}
+	case !strings.Contains(spec, "/") && strings.Contains(spec, "."):
+		// util.h is a file, app.models a Python module
+		modules = []string{spec, strings.ReplaceAll(spec, ".", "/")}
+	default:
+		modules = []string{spec}
+	}
+
+	var files []string
+	for _, module := range modules {
+		module = strings.TrimSuffix(module, filepath.Ext(module))
+		if module == "" {
+			continue
+		}
+		for candidate, paths := range idx.modules {
+			if candidate == module || strings.HasSuffix(candidate, "/"+module) {
+				files = append(files, paths...)
+			}
+		}
+		// A Go import names a package directory: every file in it
+		if len(files) == 0 && !strings.Contains(spec, ".") {
+			for candidate, paths := range idx.modules {
+				if dir := filepath.ToSlash(filepath.Dir(candidate)); dir == module || strings.HasSuffix(dir, "/"+module) {
+					files = append(files, paths...)
+				}
+			}
+		}
+		if len(files) > 0 {
+			break
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func firstNonEmpty(values []string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runCombineResponses(args []string) error {
+	fs := flag.NewFlagSet("combine-responses", flag.ExitOnError)
+
+	input := fs.String("input", "responses", "Directory of responses written by process, with its "+processIndexFilename)
+	output := fs.String("output", "-", "File to write the combined document to, or - for stdout")
+	headings := fs.Bool("headings", false, "Start every response with a heading naming its chunk")
+	skipMissing := fs.Bool("skip-missing", false, "Leave out the chunks without a response instead of failing")
+	reduce := fs.String("reduce", "", "Prompt sent with the combined responses to the chat model, whose answer is written instead, a Go template with the -prompt-template fields; the responses follow it unless it uses .Content")
+	reduceTemplate := fs.String("reduce-template", "", "File of the -reduce prompt")
+	system := fs.String("system", "", "System prompt sent with the -reduce prompt")
+	provider := fs.String("provider", "", "Chat API of the -reduce prompt: openai or anthropic (defaults to that of the process run)")
+	endpoint := fs.String("endpoint", "", "Chat endpoint URL of the -reduce prompt (defaults to that of the process run)")
+	model := fs.String("model", "", "Chat model of the -reduce prompt (defaults to that of the process run)")
+	apiKey := fs.String("api-key", "", "API key for the chat endpoint (defaults to $OPENAI_API_KEY, or $ANTHROPIC_API_KEY for anthropic)")
+	maxTokens := fs.Int("max-tokens", 0, "Most tokens the -reduce answer may have (0 for the endpoint's default; anthropic, which needs a limit, then uses 4096)")
+	retries := fs.Int("retries", 5, "How many times a -reduce request failing with a network error, HTTP 429 or 5xx is retried")
+	policyFile := fs.String("policy", "", "Policy file restricting the endpoints the responses may be sent to")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s combine-responses [-input responses] [-output combined.md] [-reduce TEXT]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Merge the per-chunk responses of a process run into one document, in chunk order,\n")
+		fmt.Fprintf(os.Stderr, "optionally sending it with a final reduce prompt to the chat model and writing its answer.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  %s combine-responses -input responses -reduce 'Merge these section summaries into one summary:' -output summary.md\n", os.Args[0])
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q; give the responses directory with -input", fs.Arg(0))
+	}
+	if *retries < 0 {
+		return errors.New("-retries must not be negative")
+	}
+	if *maxTokens < 0 {
+		return errors.New("-max-tokens must not be negative")
+	}
+
+	// -reduce-template is the file form of -reduce
+	text := *reduce
+	if *reduceTemplate != "" {
+		if text != "" {
+			return errors.New("give -reduce or -reduce-template, not both")
+		}
+		data, err := os.ReadFile(*reduceTemplate)
+		if err != nil {
+			return fmt.Errorf("error reading reduce template: %v", err)
+		}
+		text = string(data)
+	}
+
+	indexPath := filepath.Join(*input, processIndexFilename)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", processIndexFilename, err)
+	}
+	var index processIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("error decoding %s: %v", indexPath, err)
+	}
+
+	combined, missing, err := index.combine(*input, *headings)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		if !*skipMissing {
+			return fmt.Errorf("%d of %d chunks have no response, starting with chunk %d of %s; run process again to answer them, or give -skip-missing", len(missing), len(index.Responses), missing[0].Index, missing[0].Source)
+		}
+		for _, response := range missing {
+			fmt.Fprintf(os.Stderr, "Warning: leaving out chunk %d of %s, which has no response\n", response.Index, response.Source)
+		}
+	}
+	answered := len(index.Responses) - len(missing)
+	if answered == 0 {
+		return fmt.Errorf("%s lists no responses to combine", indexPath)
+	}
+
+	reducing := strings.TrimSpace(text) != ""
+	if reducing {
+		if !strings.Contains(text, ".Content") {
+			text = strings.TrimRight(text, "\n") + "\n\n{{.Content}}"
+		}
+		tmpl, err := parsePrompt(text)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, promptChunk{Index: 1, Total: 1, Part: 1, Parts: 1, Number: 1, Type: "responses", Content: combined}); err != nil {
+			return fmt.Errorf("error applying reduce prompt: %v", err)
+		}
+
+		// The reduce prompt goes to the model that wrote the responses
+		if *provider == "" {
+			*provider = index.Provider
+		}
+		if *provider == "" {
+			*provider = "openai"
+		}
+		if _, ok := chatProviders[*provider]; !ok {
+			return fmt.Errorf("invalid -provider %q; must be openai or anthropic", *provider)
+		}
+		if *endpoint == "" && *provider == index.Provider {
+			*endpoint = index.Endpoint
+		}
+		if *endpoint == "" {
+			*endpoint = chatProviders[*provider].endpoint
+		}
+		if *model == "" && *provider == index.Provider {
+			*model = index.Model
+		}
+		if *model == "" {
+			*model = chatProviders[*provider].model
+		}
+		if *policyFile != "" {
+			if activePolicy, err = loadPolicy(*policyFile); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "Reducing %d response(s) with %s\n", answered, *model)
+		client := newCompleter(*provider, *endpoint, *model, *apiKey, *maxTokens, *retries)
+		if combined, err = client.Complete(*system, b.String()); err != nil {
+			return fmt.Errorf("error running reduce prompt: %v", err)
+		}
+		if !strings.HasSuffix(combined, "\n") {
+			combined += "\n"
+		}
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.WriteString(combined)
+		return err
+	}
+	if err := writeResponse(*output, combined); err != nil {
+		return fmt.Errorf("error writing combined document: %v", err)
+	}
+	if reducing {
+		fmt.Fprintf(os.Stderr, "Reduced %d response(s) into %s (%d bytes)\n", answered, *output, len(combined))
+	} else {
+		fmt.Fprintf(os.Stderr, "Combined %d response(s) into %s (%d bytes)\n", answered, *output, len(combined))
+	}
+	return nil
+}
+
+// combine joins the response files of the index in dir, in chunk order,
+// with a blank line between them and, with headings, a heading naming the
+// chunk before each. It returns the responses whose chunks have none: those
+// that failed and those whose files are gone.
+func (index processIndex) combine(dir string, headings bool) (string, []processResponse, error) {
+	var b strings.Builder
+	var missing []processResponse
+	for _, response := range index.Responses {
+		if response.Error != "" || response.File == "" {
+			missing = append(missing, response)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, response.File))
+		if errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, response)
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("error reading response: %v", err)
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		if headings {
+			fmt.Fprintf(&b, "## %s (chunk %d, %d-%d)\n\n", response.Source, response.Index, response.Start, response.End)
+		}
+		b.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), missing, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of the CLI. Each command parses its own flags.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands in the order help shows them. It is a
+// function rather than a variable because capabilities reports the list.
+func commands() []command {
+	return []command{
+		{"chunk", "Split files into chunks (the default command)", runChunk},
+		{"count", "Report how many chunks the options would produce, without writing", runCount},
+		{"export-repo", "Render a repository as one document and chunk it at file boundaries", runExportRepo},
+		{"merge", "Reassemble a source file from its chunks", runMerge},
+		{"join", "Same as merge", runMerge},
+		{"verify", "Check a chunk directory against its manifest", runVerify},
+		{"inspect", "Summarize a chunk set, or show one chunk", runInspect},
+		{"graph", "Export documents, sections and chunks as a graph", runGraph},
+		{"prune", "Remove chunk sets older than a given age", runPrune},
+		{"merge-annotations", "Map per-chunk annotations back to source lines", runMergeAnnotations},
+		{"apply", "Apply edited chunks to their source files", runApply},
+		{"process", "Send every chunk with a prompt to a chat model and save the responses", runProcess},
+		{"combine-responses", "Merge the responses of process into one document, optionally reducing them with a prompt", runCombineResponses},
+		{"eval", "Grid-search chunk size and overlap against retrieval queries", runEval},
+		{"compare", "Compare two chunking configurations", runCompare},
+		{"init", "Write a recommended config file interactively", runInit},
+		{"suggest", "Sample the input and recommend chunk options", runSuggest},
+		{"serve", "Serve a REST API that chunks uploaded files", runServe},
+		{"mcp", "Serve chunking to MCP hosts such as Claude Desktop over stdio", runMCP},
+		{"capabilities", "List what this build supports", runCapabilities},
+		{"update", "Replace this binary with the latest release", runUpdate},
+		{"help", "Show help for the CLI or a command", runHelp},
+	}
+}
+
+func findCommand(name string) *command {
+	switch name {
+	case "-h", "-help", "--help":
+		name = "help"
+	}
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return &cmd
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [options]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [chunk options] [input ...]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Chunk large files for AI processing.\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s help <command>' for a command's options.\n", os.Args[0])
+}
+
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		printUsage()
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.name == "help" {
+		printUsage()
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	// Every command prints its usage for -h and exits
+	return cmd.run([]string{"-h"})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// commentSyntax is how a language writes comments and the strings that may
+// contain comment markers, enough to strip comments without parsing.
+type commentSyntax struct {
+	line      []string    // start comments that run to the end of the line
+	block     [][2]string // start and end of comments that may span lines
+	quotes    string      // delimiters of strings that end on their line, with backslash escapes
+	multiline []string    // delimiters of strings that may span lines, with backslash escapes
+	raw       []string    // delimiters of strings that may span lines, without escapes
+	hashWord  bool        // # only starts a comment at the start of a word, as in shell
+}
+
+var (
+	cComments      = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	cTextBlocks    = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`, multiline: []string{`"""`}}
+	goComments     = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`, raw: []string{"`"}}
+	jsComments     = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`, multiline: []string{"`"}}
+	cssComments    = commentSyntax{block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	pyComments     = commentSyntax{line: []string{"#"}, quotes: `"'`, multiline: []string{`"""`, `'''`}}
+	hashComments   = commentSyntax{line: []string{"#"}, quotes: `"'`}
+	shellComments  = commentSyntax{line: []string{"#"}, quotes: `"'`, hashWord: true}
+	sqlComments    = commentSyntax{line: []string{"--"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	luaComments    = commentSyntax{line: []string{"--"}, block: [][2]string{{"--[[", "]]"}}, quotes: `"'`}
+	haskellComment = commentSyntax{line: []string{"--"}, block: [][2]string{{"{-", "-}"}}, quotes: `"`}
+	markupComments = commentSyntax{block: [][2]string{{"<!--", "-->"}}}
+)
+
+// commentSyntaxes maps file extensions to the comment syntax of their
+// language, for -strip-comments.
+var commentSyntaxes = map[string]commentSyntax{
+	".go": goComments,
+	".c":  cComments, ".h": cComments, ".cc": cComments, ".cpp": cComments, ".cxx": cComments, ".hpp": cComments,
+	".cs": cComments, ".rs": cComments, ".php": cComments, ".dart": cComments, ".proto": cComments,
+	".java": cTextBlocks, ".kt": cTextBlocks, ".kts": cTextBlocks, ".scala": cTextBlocks, ".swift": cTextBlocks,
+	".js": jsComments, ".mjs": jsComments, ".cjs": jsComments, ".jsx": jsComments, ".ts": jsComments, ".tsx": jsComments,
+	".css": cssComments, ".scss": cComments, ".less": cComments,
+	".py": pyComments,
+	".rb": hashComments, ".pl": hashComments, ".r": hashComments, ".yaml": hashComments, ".yml": hashComments, ".toml": hashComments,
+	".sh": shellComments, ".bash": shellComments, ".zsh": shellComments,
+	".sql": sqlComments, ".lua": luaComments, ".hs": haskellComment,
+	".html": markupComments, ".xml": markupComments, ".svg": markupComments,
+}
+
+// stripComments removes the comments of path's language from the input
+// (-strip-comments), keeping strings that contain comment markers intact. A
+// line left blank by it is dropped, as is every line of a block comment;
+// blank lines of the input stay. A #! line at the start is kept. Inputs in
+// other languages pass through. The lines changed or dropped count as
+// changed.
+func stripComments(path string) func(r io.Reader, count func(lines int)) io.Reader {
+	return func(r io.Reader, count func(lines int)) io.Reader {
+		syntax, ok := commentSyntaxes[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			logDebug("comments_kept", path+" is not in a language -strip-comments knows, so its comments are kept", map[string]any{"path": path})
+			return r
+		}
+		s := &commentStripper{syntax: syntax}
+		first := true
+		return newLineReader(r, func(out *bytes.Buffer, line string, eof bool) {
+			if eof {
+				return
+			}
+			if first && strings.HasPrefix(line, "#!") {
+				first = false
+				out.WriteString(line + "\n")
+				return
+			}
+			first = false
+			stripped, changed := s.strip(line)
+			if !changed {
+				out.WriteString(line + "\n")
+				return
+			}
+			count(1)
+			if strings.TrimSpace(stripped) != "" {
+				out.WriteString(stripped + "\n")
+			}
+		})
+	}
+}
+
+// commentStripper carries the block comment or string a line ends in over
+// to the next.
+type commentStripper struct {
+	syntax commentSyntax
+	block  string // end of the block comment being skipped
+	str    string // delimiter of the multi-line string being copied
+	raw    bool   // whether that string has no escapes
+}
+
+// strip returns line without its comments and whether it had any.
+func (s *commentStripper) strip(line string) (string, bool) {
+	var out strings.Builder
+	changed := false
+	i := 0
+	for i < len(line) {
+		switch {
+		case s.block != "":
+			changed = true
+			end := strings.Index(line[i:], s.block)
+			if end < 0 {
+				return strings.TrimRight(out.String(), " \t"), true
+			}
+			i += end + len(s.block)
+			s.block = ""
+			continue
+		case s.str != "":
+			end := stringEnd(line, i, s.str, s.raw)
+			if end < 0 {
+				out.WriteString(line[i:])
+				return out.String(), changed
+			}
+			out.WriteString(line[i:end])
+			i = end
+			s.str = ""
+			continue
+		}
+
+		if start, end, ok := s.blockAt(line, i); ok {
+			changed = true
+			i += len(start)
+			s.block = end
+			continue
+		}
+		if s.lineCommentAt(line, i) {
+			return strings.TrimRight(out.String(), " \t"), true
+		}
+		if delim, raw, ok := s.multilineAt(line, i); ok {
+			out.WriteString(delim)
+			i += len(delim)
+			s.str, s.raw = delim, raw
+			continue
+		}
+		if strings.IndexByte(s.syntax.quotes, line[i]) >= 0 {
+			// A quote without its closing one, such as a Rust lifetime, is copied as it is
+			if end := stringEnd(line, i+1, line[i:i+1], false); end >= 0 {
+				out.WriteString(line[i:end])
+				i = end
+				continue
+			}
+		}
+		out.WriteByte(line[i])
+		i++
+	}
+	if changed {
+		return strings.TrimRight(out.String(), " \t"), true
+	}
+	return out.String(), false
+}
+
+func (s *commentStripper) blockAt(line string, i int) (string, string, bool) {
+	for _, block := range s.syntax.block {
+		if strings.HasPrefix(line[i:], block[0]) {
+			return block[0], block[1], true
+		}
+	}
+	return "", "", false
+}
+
+func (s *commentStripper) lineCommentAt(line string, i int) bool {
+	for _, start := range s.syntax.line {
+		if !strings.HasPrefix(line[i:], start) {
+			continue
+		}
+		if start == "#" && s.syntax.hashWord && i > 0 && line[i-1] != ' ' && line[i-1] != '\t' {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (s *commentStripper) multilineAt(line string, i int) (string, bool, bool) {
+	for _, delim := range s.syntax.multiline {
+		if strings.HasPrefix(line[i:], delim) {
+			return delim, false, true
+		}
+	}
+	for _, delim := range s.syntax.raw {
+		if strings.HasPrefix(line[i:], delim) {
+			return delim, true, true
+		}
+	}
+	return "", false, false
+}
+
+// stringEnd returns the offset just past the delimiter that closes a string
+// whose contents start at offset i of line, or -1 if it does not close on
+// this line.
+func stringEnd(line string, i int, delim string, raw bool) int {
+	for i < len(line) {
+		switch {
+		case !raw && line[i] == '\\':
+			i += 2
+		case strings.HasPrefix(line[i:], delim):
+			return i + len(delim)
+		default:
+			i++
+		}
+	}
+	return -1
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// chunkSetStats summarizes one way of chunking the input.
+type chunkSetStats struct {
+	Label            string  `json:"label"`
+	ChunkType        string  `json:"chunk_type"`
+	ChunkSize        int     `json:"chunk_size"`
+	Overlap          int     `json:"overlap"`
+	Chunks           int     `json:"chunks"`
+	TotalBytes       int     `json:"total_bytes"`
+	MinBytes         int     `json:"min_bytes"`
+	AvgBytes         float64 `json:"avg_bytes"`
+	MaxBytes         int     `json:"max_bytes"`
+	TotalTokens      int     `json:"total_tokens"`
+	MinTokens        int     `json:"min_tokens"`
+	AvgTokens        float64 `json:"avg_tokens"`
+	MaxTokens        int     `json:"max_tokens"`
+	SourceTokens     int     `json:"source_tokens"`
+	DuplicatedTokens int     `json:"duplicated_tokens"`
+	Overhead         float64 `json:"overhead"` // duplicated tokens as a share of source tokens
+
+	// boundaries holds, per source, the byte offsets at which chunks end
+	boundaries map[string][]int
+}
+
+type boundaryDiff struct {
+	Shared       int      `json:"shared"`
+	OnlyA        int      `json:"only_a"`
+	OnlyB        int      `json:"only_b"`
+	MeanDistance float64  `json:"mean_distance_bytes"` // from each A-only boundary to the nearest B boundary
+	Samples      []string `json:"samples,omitempty"`
+}
+
+type compareReport struct {
+	A          chunkSetStats `json:"a"`
+	B          chunkSetStats `json:"b"`
+	Boundaries boundaryDiff  `json:"boundaries"`
+}
+
+// sourceIndex maps chunk positions in any unit back to byte offsets.
+type sourceIndex struct {
+	text     string
+	lineEnds []int    // byte offset just past each line
+	spans    [][2]int // token byte ranges
+}
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+
+	configA := fs.String("config-a", "", "Config file for the first chunking (required)")
+	configB := fs.String("config-b", "", "Config file for the second chunking (required)")
+	var inputs stringList
+	fs.Var(&inputs, "input", "Input file or directory, overriding the configs' input (repeatable; positional arguments are also accepted)")
+	samples := fs.Int("samples", 10, "Number of differing boundaries to list")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s compare -config-a a.yaml -config-b b.yaml [input ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Chunk the same input two ways and report the differences.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	inputs = append(inputs, fs.Args()...)
+	if *configA == "" || *configB == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	a, err := loadCompareConfig(*configA, inputs)
+	if err != nil {
+		return err
+	}
+	b, err := loadCompareConfig(*configB, inputs)
+	if err != nil {
+		return err
+	}
+	if len(a.Inputs) == 0 {
+		return fmt.Errorf("no input given on the command line or in %s", *configA)
+	}
+	// Both sides must see the same input for the comparison to mean anything
+	b.Inputs = a.Inputs
+
+	files, err := resolveInputs(a)
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[string]*sourceIndex)
+	for _, file := range files {
+		data, err := a.filesystem().ReadFile(file.Path)
+		if err != nil {
+			return fmt.Errorf("error reading file: %v", err)
+		}
+		sources[file.Path] = newSourceIndex(string(data))
+	}
+
+	report := compareReport{}
+	if report.A, err = chunkSetFor(*configA, a, files, sources); err != nil {
+		return err
+	}
+	if report.B, err = chunkSetFor(*configB, b, files, sources); err != nil {
+		return err
+	}
+	report.Boundaries = diffBoundaries(report.A, report.B, files, sources, *samples)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	printCompareReport(report)
+	return nil
+}
+
+func loadCompareConfig(filename string, inputs []string) (ChunkConfig, error) {
+	var config ChunkConfig
+	fs := flag.NewFlagSet(filename, flag.ContinueOnError)
+	defineChunkFlags(fs, &config)
+	if err := applyConfigFile(fs, filename); err != nil {
+		return config, err
+	}
+	if len(inputs) > 0 {
+		config.Inputs = inputs
+	}
+	config.resolveOverlap()
+	if !validChunkTypes[config.ChunkType] {
+		return config, fmt.Errorf("%s: unsupported chunk type: %s", filename, config.ChunkType)
+	}
+	if config.ChunkSize <= 0 {
+		return config, fmt.Errorf("%s: chunk size must be positive", filename)
+	}
+	return config, nil
+}
+
+func chunkSetFor(label string, config ChunkConfig, files []inputFile, sources map[string]*sourceIndex) (chunkSetStats, error) {
+	stats := chunkSetStats{
+		Label:      label,
+		ChunkType:  config.ChunkType,
+		ChunkSize:  config.ChunkSize,
+		Overlap:    config.OverlapSize,
+		boundaries: make(map[string][]int),
+	}
+
+	writer := &memoryWriter{}
+	if err := chunkInputs(config, files, writer, NewManifest(config)); err != nil {
+		return stats, err
+	}
+
+	for _, source := range sources {
+		stats.SourceTokens += len(source.spans)
+	}
+
+	stats.Chunks = len(writer.chunks)
+	for i, chunk := range writer.chunks {
+		size := len(chunk.Content)
+		tokens := chunk.Tokens
+		if i == 0 || size < stats.MinBytes {
+			stats.MinBytes = size
+		}
+		if i == 0 || tokens < stats.MinTokens {
+			stats.MinTokens = tokens
+		}
+		stats.MaxBytes = max(stats.MaxBytes, size)
+		stats.MaxTokens = max(stats.MaxTokens, tokens)
+		stats.TotalBytes += size
+		stats.TotalTokens += tokens
+
+		source := sources[chunk.Source]
+		if end := source.byteOffset(chunk.Type, chunk.End); end < len(source.text) {
+			stats.boundaries[chunk.Source] = append(stats.boundaries[chunk.Source], end)
+		}
+	}
+
+	if stats.Chunks > 0 {
+		stats.AvgBytes = float64(stats.TotalBytes) / float64(stats.Chunks)
+		stats.AvgTokens = float64(stats.TotalTokens) / float64(stats.Chunks)
+	}
+	stats.DuplicatedTokens = max(0, stats.TotalTokens-stats.SourceTokens)
+	if stats.SourceTokens > 0 {
+		stats.Overhead = float64(stats.DuplicatedTokens) / float64(stats.SourceTokens)
+	}
+
+	return stats, nil
+}
+
+func newSourceIndex(text string) *sourceIndex {
+	index := &sourceIndex{text: text, spans: tokenSpans(text)}
+	start := 0
+	for start < len(text) {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			index.lineEnds = append(index.lineEnds, len(text))
+			break
+		}
+		start += end + 1
+		index.lineEnds = append(index.lineEnds, start)
+	}
+	return index
+}
+
+// byteOffset converts an exclusive chunk end position in the given unit to
+// a byte offset in the source.
+func (s *sourceIndex) byteOffset(unit string, end int) int {
+	switch unit {
+	case "lines":
+		if end <= 0 {
+			return 0
+		}
+		if end > len(s.lineEnds) {
+			return len(s.text)
+		}
+		return s.lineEnds[end-1]
+	case "tokens":
+		if end <= 0 {
+			return 0
+		}
+		if end > len(s.spans) {
+			return len(s.text)
+		}
+		return s.spans[end-1][1]
+	default:
+		return min(end, len(s.text))
+	}
+}
+
+// lineOf returns the 1-based line containing the byte offset.
+func (s *sourceIndex) lineOf(offset int) int {
+	return sort.SearchInts(s.lineEnds, offset+1) + 1
+}
+
+func diffBoundaries(a, b chunkSetStats, files []inputFile, sources map[string]*sourceIndex, samples int) boundaryDiff {
+	var diff boundaryDiff
+	totalDistance := 0
+
+	for _, file := range files {
+		inA := make(map[int]bool)
+		inB := make(map[int]bool)
+		for _, offset := range a.boundaries[file.Path] {
+			inA[offset] = true
+		}
+		for _, offset := range b.boundaries[file.Path] {
+			inB[offset] = true
+		}
+		sortedB := append([]int(nil), b.boundaries[file.Path]...)
+		sort.Ints(sortedB)
+
+		for _, offset := range a.boundaries[file.Path] {
+			if inB[offset] {
+				diff.Shared++
+				continue
+			}
+			diff.OnlyA++
+			if len(sortedB) > 0 {
+				totalDistance += nearestDistance(sortedB, offset)
+			}
+			if len(diff.Samples) < samples {
+				diff.Samples = append(diff.Samples, fmt.Sprintf("A only: %s:%d (byte %d)", file.Path, sources[file.Path].lineOf(offset), offset))
+			}
+		}
+		for _, offset := range b.boundaries[file.Path] {
+			if inA[offset] {
+				continue
+			}
+			diff.OnlyB++
+			if len(diff.Samples) < samples {
+				diff.Samples = append(diff.Samples, fmt.Sprintf("B only: %s:%d (byte %d)", file.Path, sources[file.Path].lineOf(offset), offset))
+			}
+		}
+	}
+
+	if diff.OnlyA > 0 {
+		diff.MeanDistance = float64(totalDistance) / float64(diff.OnlyA)
+	}
+	return diff
+}
+
+func nearestDistance(sorted []int, offset int) int {
+	i := sort.SearchInts(sorted, offset)
+	best := -1
+	if i < len(sorted) {
+		best = sorted[i] - offset
+	}
+	if i > 0 && (best < 0 || offset-sorted[i-1] < best) {
+		best = offset - sorted[i-1]
+	}
+	return best
+}
+
+func printCompareReport(r compareReport) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	row := func(name string, a, b any) {
+		fmt.Fprintf(tw, "%s\t%v\t%v\n", name, a, b)
+	}
+	minAvgMax := func(lo int, avg float64, hi int) string {
+		return fmt.Sprintf("%d / %.1f / %d", lo, avg, hi)
+	}
+	overhead := func(s chunkSetStats) string {
+		return fmt.Sprintf("%d (%.1f%%)", s.DuplicatedTokens, s.Overhead*100)
+	}
+
+	row("", "A: "+r.A.Label, "B: "+r.B.Label)
+	row("type", r.A.ChunkType, r.B.ChunkType)
+	row("size", r.A.ChunkSize, r.B.ChunkSize)
+	row("overlap", r.A.Overlap, r.B.Overlap)
+	row("chunks", r.A.Chunks, r.B.Chunks)
+	row("total bytes", r.A.TotalBytes, r.B.TotalBytes)
+	row("bytes min/avg/max", minAvgMax(r.A.MinBytes, r.A.AvgBytes, r.A.MaxBytes), minAvgMax(r.B.MinBytes, r.B.AvgBytes, r.B.MaxBytes))
+	row("total tokens", r.A.TotalTokens, r.B.TotalTokens)
+	row("tokens min/avg/max", minAvgMax(r.A.MinTokens, r.A.AvgTokens, r.A.MaxTokens), minAvgMax(r.B.MinTokens, r.B.AvgTokens, r.B.MaxTokens))
+	row("duplicated tokens", overhead(r.A), overhead(r.B))
+	tw.Flush()
+
+	d := r.Boundaries
+	fmt.Printf("\nBoundaries: %d shared, %d only in A, %d only in B", d.Shared, d.OnlyA, d.OnlyB)
+	if d.OnlyA > 0 && d.OnlyB+d.Shared > 0 {
+		fmt.Printf(", A-only boundaries are %.1f bytes from the nearest B boundary on average", d.MeanDistance)
+	}
+	fmt.Println()
+	for _, sample := range d.Samples {
+		fmt.Printf("  %s\n", sample)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultSeparator = "----- CHUNK {n}/{total} -----"
+
+// concatWriter writes all chunks into one plain text file, each preceded by
+// a separator line, for pasting into a chat UI section by section. The
+// separator can show the total chunk count, which is only known at the end,
+// so chunk content is spooled to a temporary file and the output is
+// assembled on Close.
+type concatWriter struct {
+	filename  string
+	separator string
+	fs        FS
+	spoolName string
+	spool     io.WriteCloser
+	w         *bufio.Writer
+	chunks    []concatEntry
+}
+
+type concatEntry struct {
+	index  int
+	source string
+	start  int
+	end    int
+	length int64
+}
+
+func newConcatWriter(fsys FS, filename, separator string) (*concatWriter, error) {
+	spoolName := filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".spool")
+	spool, err := fsys.Create(spoolName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating concat spool file: %v", err)
+	}
+	return &concatWriter{
+		filename:  filename,
+		separator: separator,
+		fs:        fsys,
+		spoolName: spoolName,
+		spool:     spool,
+		w:         bufio.NewWriter(spool),
+	}, nil
+}
+
+func (w *concatWriter) WriteChunk(chunk *Chunk) error {
+	content := chunk.Content
+	// Keep the next separator on its own line
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content += "\n"
+	}
+	if _, err := w.w.WriteString(content); err != nil {
+		return fmt.Errorf("error writing concat spool file: %v", err)
+	}
+
+	w.chunks = append(w.chunks, concatEntry{
+		index:  chunk.Index,
+		source: chunk.Source,
+		start:  chunk.Start,
+		end:    chunk.End,
+		length: int64(len(content)),
+	})
+
+	logChunk(chunk, trf("section %d in %s", len(w.chunks), w.filename))
+	return nil
+}
+
+// separatorLine expands the separator placeholders {n}, {total}, {index},
+// {source}, {start} and {end}.
+func (w *concatWriter) separatorLine(n int, entry concatEntry) string {
+	return strings.NewReplacer(
+		"{n}", strconv.Itoa(n),
+		"{total}", strconv.Itoa(len(w.chunks)),
+		"{index}", strconv.Itoa(entry.index),
+		"{source}", entry.source,
+		"{start}", strconv.Itoa(entry.start),
+		"{end}", strconv.Itoa(entry.end),
+	).Replace(w.separator)
+}
+
+func (w *concatWriter) Close() error {
+	defer w.fs.Remove(w.spoolName)
+
+	flushErr := w.w.Flush()
+	if err := w.spool.Close(); err != nil || flushErr != nil {
+		return fmt.Errorf("error writing concat spool file: %v", errors.Join(flushErr, err))
+	}
+	spool, err := w.fs.Open(w.spoolName)
+	if err != nil {
+		return fmt.Errorf("error reading concat spool file: %v", err)
+	}
+	defer spool.Close()
+	r := bufio.NewReader(spool)
+
+	file, err := w.fs.Create(w.filename)
+	if err != nil {
+		return fmt.Errorf("error creating concat file: %v", err)
+	}
+	out := bufio.NewWriter(file)
+	for i, entry := range w.chunks {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(w.separatorLine(i+1, entry) + "\n\n")
+		if _, err := io.CopyN(out, r, entry.length); err != nil {
+			file.Close()
+			return fmt.Errorf("error writing concat file: %v", err)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing concat file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing concat file: %v", err)
+	}
+	return nil
+}
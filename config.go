@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configEntry is one option read from a config file. Keys are flag names;
+// list values set repeatable flags once per item.
+type configEntry struct {
+	Key    string
+	Values []string
+	Line   int
+}
+
+// applyConfigFile sets every option found in filename on fs, except those
+// already given explicitly on the command line.
+func applyConfigFile(fs *flag.FlagSet, filename string) error {
+	entries, err := loadConfigFile(filename)
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, entry := range entries {
+		if fs.Lookup(entry.Key) == nil {
+			return fmt.Errorf("%s:%d: unknown option %q", filename, entry.Line, entry.Key)
+		}
+		if explicit[entry.Key] {
+			continue
+		}
+		for _, value := range entry.Values {
+			if err := fs.Set(entry.Key, value); err != nil {
+				return fmt.Errorf("%s:%d: invalid value for %s: %v", filename, entry.Line, entry.Key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// envPrefix starts the environment variables that set options: the flag
+// name in upper case with dashes as underscores, e.g. FILECHUNKER_SIZE or
+// FILECHUNKER_QUESTIONS_API_KEY.
+const envPrefix = "FILECHUNKER_"
+
+// envFlagsSkipped are flags the environment does not set, because their
+// variable names are likely to mean something else in a CI job.
+var envFlagsSkipped = map[string]bool{"version": true}
+
+// applyEnvironment sets the options of fs found in FILECHUNKER_*
+// environment variables, except those given on the command line. It runs
+// before applyConfigFile, so the environment takes precedence over a config
+// file. Repeatable flags take a comma-separated list.
+func applyEnvironment(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	// Positional arguments are inputs given on the command line
+	if fs.NArg() > 0 {
+		explicit["input"] = true
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || envFlagsSkipped[f.Name] {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		values := []string{value}
+		if _, repeatable := f.Value.(*stringList); repeatable {
+			values = splitConfigList(value)
+		}
+		for _, value := range values {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value for %s: %v", name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// envName returns the environment variable for a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func loadConfigFile(filename string) ([]configEntry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	entries, err := parseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return entries, nil
+}
+
+// parseConfig reads the small YAML subset used by config files: flat
+// "key: value" pairs, inline lists ("key: [a, b]"), block lists of "- item"
+// lines under a key, quoted strings and "#" comments. Underscores in keys
+// are accepted in place of dashes.
+func parseConfig(text string) ([]configEntry, error) {
+	var entries []configEntry
+	var current *configEntry
+
+	for i, raw := range strings.Split(text, "\n") {
+		lineNumber := i + 1
+		line := strings.TrimRight(stripConfigComment(raw), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNumber)
+			}
+			value, err := unquoteConfigValue(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			current.Values = append(current.Values, value)
+			continue
+		}
+
+		if line != trimmed {
+			return nil, fmt.Errorf("line %d: nested options are not supported", lineNumber)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNumber)
+		}
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		value = strings.TrimSpace(value)
+
+		entries = append(entries, configEntry{Key: key, Line: lineNumber})
+		current = &entries[len(entries)-1]
+
+		switch {
+		case value == "":
+			// Block list follows on the next lines
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range splitConfigList(value[1 : len(value)-1]) {
+				item, err := unquoteConfigValue(item)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				current.Values = append(current.Values, item)
+			}
+		default:
+			value, err := unquoteConfigValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			current.Values = []string{value}
+		}
+	}
+
+	return entries, nil
+}
+
+// stripConfigComment drops a trailing "# comment" that is not inside quotes.
+func stripConfigComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func splitConfigList(text string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+func unquoteConfigValue(value string) (string, error) {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			return strconv.Unquote(value)
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+		}
+	}
+	return value, nil
+}
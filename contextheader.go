@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// previousRunes caps the sentence a context header repeats from the
+// previous chunk.
+const previousRunes = 200
+
+// sentenceEnd finds the ends of sentences, with any closing quotes or
+// brackets.
+var sentenceEnd = regexp.MustCompile(`[.!?]["')\]]*\s`)
+
+// contextTracker follows a source through its chunks to write their
+// context headers (-context-header): the Markdown headings open where each
+// chunk starts, or the file and hunk of a patch, and, unless it is code, the
+// last sentence of the chunk before it.
+type contextTracker struct {
+	markdown bool
+	code     bool              // code has no sentences to repeat
+	headings []markdownSection // open headings, outermost first
+	fenced   bool
+	partial  string      // the line the previous chunk ended in the middle of
+	prose    []string    // lines of the last paragraph outside headings and code blocks
+	ended    bool        // whether a blank line ended that paragraph
+	previous string      // last sentence of the previous chunk
+	diff     *patchIndex // of a -type diff patch
+}
+
+func newContextTracker(config ChunkConfig) *contextTracker {
+	return &contextTracker{
+		markdown: (isMarkdown(config.InputFile) || isNotebook(config.InputFile)) && config.ChunkType != "tokens",
+		code:     lspLanguages[strings.ToLower(filepath.Ext(config.InputFile))] != "" || config.Diff,
+	}
+}
+
+// header returns the context header of chunk, the next chunk of the source,
+// to prepend to its content: its source, the headings it falls under, and
+// how the previous chunk ended, followed by a blank line.
+func (t *contextTracker) header(chunk *Chunk) string {
+	own := strings.TrimPrefix(chunk.Content, overlapPrefix(chunk))
+
+	var trail []string
+	if t.markdown {
+		// A heading on the chunk's first line is the section it starts
+		lines := strings.Split(t.partial+own, "\n")
+		for i, line := range lines[:len(lines)-1] {
+			t.line(line)
+			if i == 0 {
+				trail = t.trail()
+			}
+		}
+		if len(lines) == 1 {
+			trail = t.trail()
+		}
+		t.partial = lines[len(lines)-1]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Source: %s\n", chunk.Source)
+	if len(trail) > 0 {
+		fmt.Fprintf(&b, "Section: %s\n", strings.Join(trail, " > "))
+	}
+	if t.diff != nil {
+		file, hunk := t.diff.context(chunk.Start - 1)
+		if file != "" {
+			fmt.Fprintf(&b, "File: %s\n", file)
+		}
+		if hunk != "" {
+			fmt.Fprintf(&b, "Hunk: %s\n", hunk)
+		}
+	}
+	if t.previous != "" {
+		fmt.Fprintf(&b, "Previous: %s\n", t.previous)
+	}
+	b.WriteString("\n")
+
+	// Headings and code blocks are no sentences
+	text := own
+	if t.markdown {
+		text = strings.Join(t.prose, "\n")
+	}
+	if sentence := lastSentence(text); sentence != "" && !t.code {
+		t.previous = sentence
+	}
+	return b.String()
+}
+
+// line follows one line of the source, keeping track of the headings open
+// after it the way markdownSections does, and of the last paragraph.
+func (t *contextTracker) line(line string) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		t.fenced = !t.fenced
+		return
+	}
+	m := markdownHeading.FindStringSubmatch(line)
+	switch {
+	case t.fenced:
+		return
+	case trimmed == "":
+		t.ended = true
+		return
+	case m == nil:
+		if t.ended {
+			t.prose, t.ended = nil, false
+		}
+		t.prose = append(t.prose, line)
+		return
+	}
+	level := len(m[1])
+	for len(t.headings) > 0 && t.headings[len(t.headings)-1].Level >= level {
+		t.headings = t.headings[:len(t.headings)-1]
+	}
+	t.headings = append(t.headings, markdownSection{Title: m[2], Level: level})
+}
+
+func (t *contextTracker) trail() []string {
+	var titles []string
+	for _, h := range t.headings {
+		titles = append(titles, h.Title)
+	}
+	return titles
+}
+
+// lastSentence returns the last sentence of text's last paragraph, on one
+// line, or its end if it is longer than previousRunes. Text without letters,
+// such as the end of a block of code, has none.
+func lastSentence(text string) string {
+	text = strings.TrimSpace(text)
+	if i := strings.LastIndex(text, "\n\n"); i >= 0 {
+		text = text[i+2:]
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if ends := sentenceEnd.FindAllStringIndex(text, -1); len(ends) > 0 {
+		text = text[ends[len(ends)-1][1]:]
+	}
+	if !strings.ContainsFunc(text, unicode.IsLetter) {
+		return ""
+	}
+	if runes := []rune(text); len(runes) > previousRunes {
+		text = string(runes[len(runes)-previousRunes:])
+		if i := strings.IndexByte(text, ' '); i >= 0 {
+			text = text[i+1:]
+		}
+		text = "…" + text
+	}
+	return text
+}
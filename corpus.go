@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const corpusIndexName = "index.jsonl"
+
+// corpusIndexEntry is one line of the corpus offsets index. Offset and
+// Length locate the chunk content (without markers) in the corpus file.
+type corpusIndexEntry struct {
+	Index  int    `json:"index"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// corpusWriter concatenates all chunks into one file, wrapping each in
+// boundary markers:
+//
+//	<|chunk index=3 source="src/app.js" type=lines start=81 end=120|>
+//	...content...
+//	<|/chunk index=3|>
+//
+// and writes a JSONL index with the byte offset of every chunk.
+type corpusWriter struct {
+	filename  string
+	file      io.WriteCloser
+	w         *bufio.Writer
+	indexFile io.WriteCloser
+	index     *json.Encoder
+	offset    int64
+}
+
+func newCorpusWriter(fsys FS, filename, indexFilename string) (*corpusWriter, error) {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating corpus file: %v", err)
+	}
+	indexFile, err := fsys.Create(indexFilename)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error creating corpus index: %v", err)
+	}
+
+	return &corpusWriter{
+		filename:  filename,
+		file:      file,
+		w:         bufio.NewWriter(file),
+		indexFile: indexFile,
+		index:     json.NewEncoder(indexFile),
+	}, nil
+}
+
+func (w *corpusWriter) write(s string) error {
+	n, err := w.w.WriteString(s)
+	w.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing corpus file: %v", err)
+	}
+	return nil
+}
+
+func (w *corpusWriter) WriteChunk(chunk *Chunk) error {
+	open := fmt.Sprintf("<|chunk index=%d source=%s type=%s start=%d end=%d|>\n",
+		chunk.Index, strconv.Quote(chunk.Source), chunk.Type, chunk.Start, chunk.End)
+	if err := w.write(open); err != nil {
+		return err
+	}
+
+	entry := corpusIndexEntry{
+		Index:  chunk.Index,
+		Source: chunk.Source,
+		Type:   chunk.Type,
+		Start:  chunk.Start,
+		End:    chunk.End,
+		Offset: w.offset,
+		Length: len(chunk.Content),
+	}
+
+	if err := w.write(chunk.Content); err != nil {
+		return err
+	}
+	// Keep the closing marker on its own line
+	if len(chunk.Content) > 0 && chunk.Content[len(chunk.Content)-1] != '\n' {
+		if err := w.write("\n"); err != nil {
+			return err
+		}
+	}
+	if err := w.write(fmt.Sprintf("<|/chunk index=%d|>\n", chunk.Index)); err != nil {
+		return err
+	}
+
+	if err := w.index.Encode(entry); err != nil {
+		return fmt.Errorf("error writing corpus index: %v", err)
+	}
+
+	logChunk(chunk, trf("offset %d in %s", entry.Offset, w.filename))
+	return nil
+}
+
+func (w *corpusWriter) Close() error {
+	flushErr := w.w.Flush()
+	closeErr := w.file.Close()
+	indexErr := w.indexFile.Close()
+	switch {
+	case flushErr != nil:
+		return fmt.Errorf("error writing corpus file: %v", flushErr)
+	case closeErr != nil:
+		return fmt.Errorf("error closing corpus file: %v", closeErr)
+	case indexErr != nil:
+		return fmt.Errorf("error closing corpus index: %v", indexErr)
+	}
+	return nil
+}
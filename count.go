@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// sizeDistribution summarizes chunk sizes in one unit.
+type sizeDistribution struct {
+	Total int     `json:"total"`
+	Min   int     `json:"min"`
+	P50   int     `json:"p50"`
+	P90   int     `json:"p90"`
+	Max   int     `json:"max"`
+	Avg   float64 `json:"avg"`
+}
+
+type countReport struct {
+	Files        int              `json:"files"`
+	ChunkType    string           `json:"chunk_type"`
+	ChunkSize    int              `json:"chunk_size"`
+	Overlap      int              `json:"overlap"`
+	Chunks       int              `json:"chunks"`
+	SourceBytes  int64            `json:"source_bytes"`
+	SourceTokens int              `json:"source_tokens"`
+	Bytes        sizeDistribution `json:"bytes"`
+	Tokens       sizeDistribution `json:"tokens"`
+	Stats        RunStats         `json:"stats"`
+}
+
+func runCount(args []string) error {
+	fs := flag.NewFlagSet("count", flag.ExitOnError)
+
+	var config ChunkConfig
+	defineChunkFlags(fs, &config)
+	configFile := fs.String("config", "", "YAML config file with default option values (command-line flags and FILECHUNKER_* variables take precedence)")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s count [options] [input ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Report how many chunks the chunk options would produce, and their sizes, without writing anything.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := applyEnvironment(fs); err != nil {
+		return err
+	}
+	if *configFile != "" {
+		if err := applyConfigFile(fs, *configFile); err != nil {
+			return err
+		}
+	}
+	config.Inputs = append(config.Inputs, fs.Args()...)
+	config.resolveOverlap()
+	if len(config.Inputs) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if !validChunkTypes[config.ChunkType] {
+		return fmt.Errorf("unsupported chunk type: %s", config.ChunkType)
+	}
+	if config.Encoding = normalizeEncoding(config.Encoding); config.Encoding == "" {
+		return fmt.Errorf("unsupported encoding: %s", fs.Lookup("encoding").Value)
+	}
+	// Counting must not call out to an LLM or embed the chunks
+	config.Questions = 0
+	config.Embed = ""
+
+	files, err := resolveInputs(config)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no input files matched in %s", strings.Join(config.Inputs, ", "))
+	}
+
+	if config.MergeLogs {
+		if config, files, err = mergeLogInputs(config, files); err != nil {
+			return err
+		}
+	}
+
+	writer := &memoryWriter{}
+	manifest := NewManifest(config)
+	if err := chunkInputs(config, files, writer, manifest); err != nil {
+		return err
+	}
+
+	report := countReport{
+		Files:     len(files),
+		ChunkType: config.ChunkType,
+		ChunkSize: config.ChunkSize,
+		Overlap:   config.OverlapSize,
+		Chunks:    len(writer.chunks),
+		Stats:     manifest.Stats,
+	}
+	var bytes, tokens []int
+	for _, chunk := range writer.chunks {
+		bytes = append(bytes, len(chunk.Content))
+		tokens = append(tokens, chunk.Tokens)
+	}
+	report.Bytes = distribution(bytes)
+	report.Tokens = distribution(tokens)
+	for _, file := range manifest.Files {
+		report.SourceBytes += file.Bytes
+	}
+	report.SourceTokens = manifest.Stats.Tokens - manifest.Stats.OverlapTokens
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Printf("%d file(s), %d bytes, about %d tokens\n", report.Files, report.SourceBytes, report.SourceTokens)
+	fmt.Printf("%s chunks of %d with overlap %d: %d chunks\n\n", report.ChunkType, report.ChunkSize, report.Overlap, report.Chunks)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tTOTAL\tMIN\tP50\tP90\tMAX\tAVG")
+	for _, row := range []struct {
+		name string
+		d    sizeDistribution
+	}{{"bytes", report.Bytes}, {"tokens", report.Tokens}} {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f\n", row.name, row.d.Total, row.d.Min, row.d.P50, row.d.P90, row.d.Max, row.d.Avg)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nOverlap duplicates %d tokens (%.1f%%)\n", report.Stats.OverlapTokens,
+		overheadPercent(report.Stats.OverlapTokens, report.Stats.Tokens))
+	return nil
+}
+
+// distribution returns nearest-rank percentiles of sizes.
+func distribution(sizes []int) sizeDistribution {
+	var d sizeDistribution
+	if len(sizes) == 0 {
+		return d
+	}
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+	percentile := func(p int) int {
+		return sorted[(len(sorted)*p+99)/100-1]
+	}
+	for _, size := range sorted {
+		d.Total += size
+	}
+	d.Min, d.Max = sorted[0], sorted[len(sorted)-1]
+	d.P50, d.P90 = percentile(50), percentile(90)
+	d.Avg = float64(d.Total) / float64(len(sorted))
+	return d
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var csvHeader = []string{"index", "source", "type", "start", "end", "tokens", "content"}
+
+// csvWriter writes one row per chunk to a single CSV file.
+type csvWriter struct {
+	filename string
+	file     io.WriteCloser
+	w        *csv.Writer
+}
+
+func newCSVWriter(fsys FS, filename string) (*csvWriter, error) {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating CSV file: %v", err)
+	}
+
+	w := csv.NewWriter(file)
+	if err := w.Write(csvHeader); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error writing CSV file: %v", err)
+	}
+
+	return &csvWriter{filename: filename, file: file, w: w}, nil
+}
+
+func (w *csvWriter) WriteChunk(chunk *Chunk) error {
+	record := []string{
+		strconv.Itoa(chunk.Index),
+		chunk.Source,
+		chunk.Type,
+		strconv.Itoa(chunk.Start),
+		strconv.Itoa(chunk.End),
+		strconv.Itoa(chunk.Tokens),
+		chunk.Content,
+	}
+	if err := w.w.Write(record); err != nil {
+		return fmt.Errorf("error writing CSV file: %v", err)
+	}
+
+	logChunk(chunk, trf("row in %s", w.filename))
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error writing CSV file: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error closing CSV file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// MinHash signatures have dedupeHashes values, split into dedupeBands
+// bands for locality-sensitive hashing: chunks are only compared when a
+// band of their signatures matches, which near-identical chunks almost
+// always have and unrelated ones almost never.
+const (
+	dedupeHashes  = 128
+	dedupeBands   = 32
+	dedupeRows    = dedupeHashes / dedupeBands
+	dedupeShingle = 3 // tokens per shingle
+)
+
+// dedupeReport records what -dedupe-fuzzy found: the chunks it dropped or,
+// with -dedupe-action flag, how many it flagged.
+type dedupeReport struct {
+	Threshold float64       `json:"threshold"`
+	Action    string        `json:"action"`
+	Flagged   int           `json:"flagged,omitempty"`
+	Dropped   []droppedDupe `json:"dropped,omitempty"`
+}
+
+type droppedDupe struct {
+	Index       int     `json:"index"`
+	Source      string  `json:"source"`
+	Start       int     `json:"start"`
+	End         int     `json:"end"`
+	Overlap     int     `json:"overlap,omitempty"`
+	DuplicateOf int     `json:"duplicate_of"`
+	Similarity  float64 `json:"similarity"`
+}
+
+// dedupeIndex holds the MinHash signatures of the chunks of a run that are
+// not duplicates themselves, to find the near-duplicates of later chunks
+// (-dedupe-fuzzy).
+type dedupeIndex struct {
+	report     *dedupeReport
+	signatures map[int][]uint64 // by chunk index
+	buckets    map[uint64][]int // chunk indices by band hash
+}
+
+func newDedupeIndex(threshold float64, action string) *dedupeIndex {
+	return &dedupeIndex{
+		report:     &dedupeReport{Threshold: threshold, Action: action},
+		signatures: map[int][]uint64{},
+		buckets:    map[uint64][]int{},
+	}
+}
+
+// check returns the earlier chunk that chunk is a near-duplicate of, with
+// their estimated Jaccard similarity over word shingles, or ok false, in
+// which case chunk is indexed for the chunks after it.
+func (d *dedupeIndex) check(chunk *Chunk) (of int, similarity float64, ok bool) {
+	signature := minHash(chunk.Content)
+	if signature == nil {
+		return 0, 0, false
+	}
+	bands := make([]uint64, dedupeBands)
+	compared := map[int]bool{}
+	for b := range bands {
+		bands[b] = bandHash(b, signature[b*dedupeRows:(b+1)*dedupeRows])
+		for _, candidate := range d.buckets[bands[b]] {
+			if compared[candidate] {
+				continue
+			}
+			compared[candidate] = true
+			if s := signatureSimilarity(signature, d.signatures[candidate]); s >= d.report.Threshold && (!ok || s > similarity) {
+				of, similarity, ok = candidate, s, true
+			}
+		}
+	}
+	if ok {
+		return of, similarity, true
+	}
+	d.signatures[chunk.Index] = signature
+	for _, band := range bands {
+		d.buckets[band] = append(d.buckets[band], chunk.Index)
+	}
+	return 0, 0, false
+}
+
+// drop records a duplicate chunk that is not written.
+func (d *dedupeIndex) drop(chunk *Chunk, of int, similarity float64) {
+	d.report.Dropped = append(d.report.Dropped, droppedDupe{
+		Index: chunk.Index, Source: chunk.Source, Start: chunk.Start, End: chunk.End, Overlap: chunk.Overlap,
+		DuplicateOf: of, Similarity: similarity,
+	})
+}
+
+// minHash returns the MinHash signature of the shingles of content's
+// lowercased tokens, or nil if it has no tokens.
+func minHash(content string) []uint64 {
+	tokens := tokenize(strings.ToLower(content))
+	if len(tokens) == 0 {
+		return nil
+	}
+	signature := make([]uint64, dedupeHashes)
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for i := 0; i+dedupeShingle <= len(tokens) || i == 0; i++ {
+		h := fnv.New64a()
+		for _, token := range tokens[i:min(len(tokens), i+dedupeShingle)] {
+			h.Write([]byte(token))
+			h.Write([]byte{0})
+		}
+		x := h.Sum64()
+		for j := range signature {
+			if v := permute(x, j); v < signature[j] {
+				signature[j] = v
+			}
+		}
+	}
+	return signature
+}
+
+// permute is the j-th hash function of the signature: a seeded mix of the
+// shingle hash x.
+func permute(x uint64, j int) uint64 {
+	x ^= uint64(j+1) * 0x9e3779b97f4a7c15
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func bandHash(band int, rows []uint64) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range append([]uint64{uint64(band)}, rows...) {
+		for i := range buf {
+			buf[i] = byte(v >> (8 * i))
+		}
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// signatureSimilarity estimates the Jaccard similarity of two shingle sets
+// as the share of their signatures' values that agree.
+func signatureSimilarity(a, b []uint64) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader matches the header of a unified diff hunk, with the line
+// counts of its old and new side, each 1 if left out.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// patchStart matches the first line of a patch in git format-patch or
+// git log -p output, whose commit message goes with its first file.
+var patchStart = regexp.MustCompile(`^(From|commit) [0-9a-f]{40}\b`)
+
+// patchFile is where the diff of a file starts in a patch, and the path it
+// changes, empty for the message of a patch.
+type patchFile struct {
+	line int // from 0
+	path string
+}
+
+// patchHunk is a hunk of a patch: the lines from its header to its last.
+type patchHunk struct {
+	line, end int // from 0, end exclusive
+	header    string
+}
+
+// patchIndex is what -type diff found in a patch: where chunks may start,
+// at patches, files and hunks, and the files and hunks the lines are in,
+// for the context headers of chunks that start inside them.
+type patchIndex struct {
+	boundaries []int
+	files      []patchFile
+	hunks      []patchHunk
+}
+
+// The levels of what a diff boundary starts: a patch holds files, and a
+// file hunks. The headers of a file go with its first hunk, and a patch's
+// commit message with its first file, so a boundary starts a chunk only
+// where the last one started something already under way.
+const (
+	diffNone = iota
+	diffPatch
+	diffFileHeader
+)
+
+// parseDiff finds the patches, file diffs and hunks of a unified diff, in
+// the form of diff -u, git diff, git format-patch or svn diff. The lines of a
+// hunk are counted from its header, so removed lines that look like headers
+// stay in it.
+func parseDiff(lines []string) patchIndex {
+	var index patchIndex
+	pending := diffNone // what the last boundary started, until a hunk does
+	start := func(i, level int) {
+		if pending == diffNone || pending >= level {
+			index.boundaries = append(index.boundaries, i)
+		}
+		pending = level
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case patchStart.MatchString(line):
+			start(i, diffPatch)
+			index.files = append(index.files, patchFile{i, ""}) // its message is in no file
+		case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "Index: "):
+			start(i, diffFileHeader)
+			if path := diffGitPath(line); path != "" {
+				index.files = append(index.files, patchFile{i, path})
+			}
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			// The --- and +++ lines of a diff line or an Index: line are part
+			// of its header; alone, they start the file
+			if pending != diffFileHeader {
+				start(i, diffFileHeader)
+			}
+			path := diffHeaderPath(lines[i+1])
+			if path == "" {
+				path = diffHeaderPath(line)
+			}
+			if n := len(index.files); n > 0 && index.files[n-1].line >= index.lastBoundary() {
+				index.files[n-1].path = path
+			} else {
+				index.files = append(index.files, patchFile{index.lastBoundary(), path})
+			}
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if pending == diffNone {
+				index.boundaries = append(index.boundaries, i)
+			}
+			pending = diffNone
+			end := hunkEnd(lines, i)
+			index.hunks = append(index.hunks, patchHunk{i, end, line})
+			i = end - 1
+		}
+	}
+	return index
+}
+
+func (index patchIndex) lastBoundary() int {
+	if len(index.boundaries) == 0 {
+		return 0
+	}
+	return index.boundaries[len(index.boundaries)-1]
+}
+
+// hunkEnd returns the line after the hunk whose header is line i: the
+// header's counts of old and new lines tell where it ends. A "\ No newline
+// at end of file" marker after a line belongs to the hunk.
+func hunkEnd(lines []string, i int) int {
+	m := hunkHeader.FindStringSubmatch(lines[i])
+	if m == nil {
+		return i + 1
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	removed, added := count(m[1]), count(m[2])
+	j := i + 1
+	for ; j < len(lines) && (removed > 0 || added > 0); j++ {
+		switch line := lines[j]; {
+		case strings.HasPrefix(line, "\\"):
+		case strings.HasPrefix(line, "-"):
+			removed--
+		case strings.HasPrefix(line, "+"):
+			added--
+		case strings.HasPrefix(line, " ") || line == "":
+			removed--
+			added--
+		default:
+			// A hunk cut short, such as by hand
+			return j
+		}
+	}
+	for j < len(lines) && strings.HasPrefix(lines[j], "\\") {
+		j++
+	}
+	return j
+}
+
+// diffGitPath returns the new path of a diff --git line, or the path of an
+// Index: line.
+func diffGitPath(line string) string {
+	if path, ok := strings.CutPrefix(line, "Index: "); ok {
+		return strings.TrimSpace(path)
+	}
+	if _, path, ok := strings.Cut(line, " b/"); ok && strings.HasPrefix(line, "diff --git ") {
+		return path
+	}
+	return ""
+}
+
+// diffHeaderPath returns the path of a --- or +++ line, without its a/ or
+// b/ prefix and the timestamp diff -u adds after a tab, or "" for
+// /dev/null.
+func diffHeaderPath(line string) string {
+	path := line[4:]
+	if i := strings.IndexByte(path, '\t'); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// context returns what a chunk starting at line, from 0, needs to be read
+// alone: the file it starts in, unless it starts with the file's headers,
+// and the header of the hunk it starts in, unless it starts with it.
+func (index patchIndex) context(line int) (file, hunk string) {
+	i := sort.Search(len(index.files), func(i int) bool { return index.files[i].line > line }) - 1
+	if i >= 0 && index.files[i].line < line {
+		file = index.files[i].path
+	}
+	j := sort.Search(len(index.hunks), func(j int) bool { return index.hunks[j].line > line }) - 1
+	if j >= 0 && index.hunks[j].line < line && line < index.hunks[j].end {
+		hunk = index.hunks[j].header
+	}
+	return file, hunk
+}
+
+// chunkDiff implements -type diff: line chunks of a patch that start at its
+// patches, files and hunks, each holding as many whole hunks as fit in -size
+// lines, with the headers of a file kept with its first hunk. A hunk longer
+// than that is split every -size lines.
+func (c *Chunker) chunkDiff() error {
+	lines, err := c.readLines()
+	if err != nil {
+		return err
+	}
+
+	index := parseDiff(lines)
+	if len(index.hunks) == 0 && len(lines) > 0 {
+		logWarning(trf("%s has no diff hunks, so it is chunked every -size lines", c.config.InputFile), map[string]any{"source": c.config.InputFile})
+	}
+	logDebug("diff_parsed", fmt.Sprintf("%s: %d files and %d hunks", c.config.InputFile, len(index.files), len(index.hunks)), map[string]any{"source": c.config.InputFile, "files": len(index.files), "hunks": len(index.hunks)})
+	if c.context != nil {
+		c.context.diff = &index
+	}
+	return c.chunkLinesPacked(lines, index.boundaries)
+}
@@ -0,0 +1,119 @@
+package main
+
+// dryRunWriter takes the place of the output sinks under -dry-run: it
+// reports every chunk the run would write, with the size of its chunk file,
+// and writes nothing.
+type dryRunWriter struct {
+	config ChunkConfig
+	names  chunkNames
+}
+
+func (w *dryRunWriter) WriteChunk(chunk *Chunk) error {
+	// Colliding names would make the real run fail halfway
+	if err := w.names.add(chunk.Filename); err != nil {
+		return err
+	}
+
+	var size countingWriter
+	writeChunkFile(&size, chunk, w.config.metadataHeader(), w.config.ChecksumHeader)
+
+	var message string
+	if chunk.Type == "lines" {
+		message = trf("Would create chunk %d: %s (lines %d-%d, %d bytes)", chunk.Index, chunk.Filename, chunk.Start, chunk.End, size)
+	} else {
+		message = trf("Would create chunk %d: %s (%s %d-%d, %d bytes)", chunk.Index, chunk.Filename, chunk.Type, chunk.Start, chunk.End, size)
+	}
+	logEvent("chunk_planned", message, map[string]any{
+		"index":  chunk.Index,
+		"source": chunk.Source,
+		"file":   chunk.Filename,
+		"type":   chunk.Type,
+		"start":  chunk.Start,
+		"end":    chunk.End,
+		"bytes":  int(size),
+	})
+	return nil
+}
+
+func (w *dryRunWriter) Close() error {
+	return nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// plannedOutput is a file or, for the files format, a directory of chunk
+// files that a run would create.
+type plannedOutput struct {
+	Path   string `json:"path"`
+	Chunks int    `json:"chunks,omitempty"` // chunk files in the directory
+}
+
+// plannedOutputs lists what a run would create, for -dry-run.
+func plannedOutputs(config ChunkConfig, chunks int, questions bool) []plannedOutput {
+	if outputIsStdout(config) {
+		return []plannedOutput{{Path: "-"}}
+	}
+
+	var outputs []plannedOutput
+	for _, format := range config.formats() {
+		switch format {
+		case "files":
+			outputs = append(outputs, plannedOutput{Path: config.OutputDir, Chunks: chunks})
+		case "corpus":
+			outputs = append(outputs, plannedOutput{Path: formatOutputPath(config, format)}, plannedOutput{Path: auxiliaryPath(config, corpusIndexName)})
+		default:
+			outputs = append(outputs, plannedOutput{Path: formatOutputPath(config, format)})
+		}
+	}
+	if config.WriteManifest {
+		outputs = append(outputs, plannedOutput{Path: auxiliaryPath(config, manifestFilename)})
+	}
+	if questions {
+		outputs = append(outputs, plannedOutput{Path: auxiliaryPath(config, questionsFilename)})
+	}
+	if config.RedactSecrets {
+		outputs = append(outputs, plannedOutput{Path: auxiliaryPath(config, redactionsFilename)})
+	}
+	return outputs
+}
+
+// dryRun runs the chunking for -dry-run and reports what would be written.
+func dryRun(config ChunkConfig, inputs []inputFile) {
+	// Questions would call the LLM once per chunk, and -embed embed each
+	questions := config.Questions > 0
+	config.Questions = 0
+	config.Embed = ""
+	if config.MaxChunks > 0 && config.MaxChunksAction == "error" {
+		if err := checkChunkLimit(config, inputs); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	manifest := NewManifest(config)
+	if err := chunkInputs(config, inputs, &dryRunWriter{config: config}, manifest); err != nil {
+		fatalf("%v", err)
+	}
+	textf("\n")
+	manifest.Stats.Print()
+
+	outputs := plannedOutputs(config, len(manifest.Chunks), questions)
+	textf("\nWould write:\n")
+	for _, output := range outputs {
+		switch {
+		case output.Path == "-":
+			textf("  stdout\n")
+		case output.Chunks > 0:
+			textf("  %d chunk files in %s\n", output.Chunks, output.Path)
+		default:
+			textf("  %s\n", output.Path)
+		}
+	}
+	textf("\n")
+	logEvent("dry_run_completed", tr("Dry run: nothing was written."), map[string]any{"outputs": outputs})
+}
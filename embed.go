@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const embedBatch = 96 // texts per request
+
+// embedProvider is an -embed provider: the endpoint and model used unless
+// -embed-endpoint and -embed-model say otherwise, and the environment
+// variable the API key defaults to, if it needs one.
+type embedProvider struct {
+	endpoint string
+	model    string
+	keyEnv   string
+}
+
+// embedProviders are the -embed providers. Ollama serves the OpenAI
+// embeddings API as well, locally and without a key, so nothing leaves the
+// machine.
+var embedProviders = map[string]embedProvider{
+	"openai": {endpoint: "https://api.openai.com/v1/embeddings", model: "text-embedding-3-small", keyEnv: "OPENAI_API_KEY"},
+	"ollama": {endpoint: "http://localhost:11434/v1/embeddings", model: "nomic-embed-text"},
+}
+
+// embedding returns the provider, endpoint and model of a run's embeddings:
+// those of -embed, or for -type semantic alone openai's, unless
+// -embed-endpoint and -embed-model are set. An ollama endpoint follows
+// $OLLAMA_HOST, as the ollama command does.
+func (config ChunkConfig) embedding() (provider, endpoint, model string) {
+	provider = config.Embed
+	if provider == "" {
+		provider = "openai"
+	}
+	p := embedProviders[provider]
+	endpoint, model = config.EmbedEndpoint, config.EmbedModel
+	if endpoint == "" {
+		endpoint = p.endpoint
+		if host := os.Getenv("OLLAMA_HOST"); provider == "ollama" && host != "" {
+			if !strings.Contains(host, "://") {
+				host = "http://" + host
+			}
+			endpoint = strings.TrimSuffix(host, "/") + "/v1/embeddings"
+		}
+	}
+	if model == "" {
+		model = p.model
+	}
+	return provider, endpoint, model
+}
+
+// embeddingInfo describes the chunk embeddings of a run (-embed).
+type embeddingInfo struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions,omitempty"`
+}
+
+// embeddingClient talks to an OpenAI-compatible embeddings endpoint. It
+// keeps the vectors it was sent, as the passes of a run over its inputs
+// embed the same texts.
+type embeddingClient struct {
+	endpoint string
+	model    string
+	apiKey   string
+	client   *http.Client
+	retries  int
+	vectors  map[string][]float32
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// embedProviderNames returns the names of the -embed providers, sorted.
+func embedProviderNames() []string {
+	var names []string
+	for name := range embedProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newEmbeddingClient(config ChunkConfig) *embeddingClient {
+	provider, endpoint, model := config.embedding()
+	apiKey := config.EmbedAPIKey
+	if env := embedProviders[provider].keyEnv; apiKey == "" && env != "" {
+		apiKey = os.Getenv(env)
+	}
+	return &embeddingClient{
+		endpoint: endpoint,
+		model:    model,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: 2 * time.Minute},
+		retries:  config.Retries,
+		vectors:  map[string][]float32{},
+	}
+}
+
+// Embed returns the embedding of each text, asking the endpoint for those
+// it has not seen, embedBatch at a time. Chunks, embedded once each, go to
+// embedBatch directly.
+func (c *embeddingClient) Embed(texts []string) ([][]float32, error) {
+	var missing []string
+	for _, text := range texts {
+		if _, ok := c.vectors[text]; !ok {
+			missing = append(missing, text)
+			c.vectors[text] = nil
+		}
+	}
+	for start := 0; start < len(missing); start += embedBatch {
+		batch := missing[start:min(start+embedBatch, len(missing))]
+		vectors, err := c.embedBatch(batch)
+		if err != nil {
+			for _, text := range missing {
+				delete(c.vectors, text)
+			}
+			return nil, err
+		}
+		for i, text := range batch {
+			c.vectors[text] = vectors[i]
+		}
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = c.vectors[text]
+	}
+	return vectors, nil
+}
+
+func (c *embeddingClient) embedBatch(texts []string) ([][]float32, error) {
+	if err := activePolicy.allowURL(c.endpoint); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(embeddingRequest{Model: c.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding embeddings request: %v", err)
+	}
+
+	tokens := 0
+	for _, text := range texts {
+		tokens += len(tokenSpans(text))
+	}
+	var parsed embeddingResponse
+	_, err = withRetries("embeddings", c.retries, tokens, func() (int, time.Duration, error) {
+		var status int
+		var wait time.Duration
+		parsed, status, wait, err = c.send(body)
+		return status, wait, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings endpoint returned %d embeddings for %d texts", len(parsed.Data), len(texts))
+	}
+
+	// The data may come in any order; index says which text each is of
+	vectors := make([][]float32, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(texts) || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("embeddings endpoint returned an invalid embedding")
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for _, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("embeddings endpoint returned an invalid embedding")
+		}
+	}
+	return vectors, nil
+}
+
+// send makes one embeddings request, returning the answer, or the HTTP
+// status and how long the endpoint asked to wait before trying again.
+func (c *embeddingClient) send(body []byte) (parsed embeddingResponse, status int, wait time.Duration, err error) {
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return parsed, 0, 0, fmt.Errorf("error creating embeddings request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return parsed, 0, 0, fmt.Errorf("error calling embeddings endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return parsed, 0, 0, fmt.Errorf("error reading embeddings response: %v", err)
+	}
+
+	status, wait = resp.StatusCode, retryAfter(resp)
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return parsed, status, wait, fmt.Errorf("error decoding embeddings response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if parsed.Error != nil {
+		return parsed, status, wait, fmt.Errorf("embeddings endpoint returned an error: %s", parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parsed, status, wait, fmt.Errorf("embeddings endpoint returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return parsed, status, 0, nil
+}
+
+// embedChunk sets the embedding of chunk's content (-embed).
+func (c *embeddingClient) embedChunk(chunk *Chunk) error {
+	vectors, err := c.embedBatch([]string{chunk.Content})
+	if err != nil {
+		return fmt.Errorf("error embedding chunk %d: %v", chunk.Index, err)
+	}
+	chunk.Embedding = vectors[0]
+	return nil
+}
+
+// cosineDistance is 1 minus the cosine similarity of a and b: 0 for vectors
+// pointing the same way, up to 2 for opposite ones.
+func cosineDistance(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+	return 1 - dot/(math.Sqrt(na)*math.Sqrt(nb))
+}
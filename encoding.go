@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encodings are the -encoding values. Inputs in any of them are transcoded
+// to UTF-8 before chunking; auto detects the encoding of each input.
+var encodings = []string{"auto", "utf-8", "utf-16le", "utf-16be", "latin1", "windows-1252", "shift-jis"}
+
+var encodingAliases = map[string]string{
+	"utf8": "utf-8", "utf16le": "utf-16le", "utf16be": "utf-16be",
+	"latin-1": "latin1", "iso-8859-1": "latin1", "cp1252": "windows-1252",
+	"sjis": "shift-jis", "shift_jis": "shift-jis", "cp932": "shift-jis",
+}
+
+// encodingSample is how much of an input auto detection looks at.
+const encodingSample = 64 << 10
+
+// normalizeEncoding returns the -encoding value for name, or "" if it is
+// not supported.
+func normalizeEncoding(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := encodingAliases[name]; ok {
+		name = alias
+	}
+	for _, encoding := range encodings {
+		if name == encoding {
+			return name
+		}
+	}
+	return ""
+}
+
+// detectEncoding guesses the encoding of an input from its first bytes:
+// UTF-16 by its byte order mark or by the zero bytes of mostly ASCII text,
+// then UTF-8 if the sample is valid UTF-8, Shift-JIS if it is valid
+// Shift-JIS with kana in it, and otherwise Latin-1, or Windows-1252 when
+// the sample uses the characters Windows-1252 puts in 0x80-0x9f.
+func detectEncoding(sample []byte, eof bool) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(sample, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	}
+
+	var zeros [2]int
+	for i, b := range sample {
+		if b == 0 {
+			zeros[i%2]++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case pairs > 0 && zeros[1] > pairs/4 && zeros[0] < pairs/16:
+		return "utf-16le"
+	case pairs > 0 && zeros[0] > pairs/4 && zeros[1] < pairs/16:
+		return "utf-16be"
+	}
+
+	// A sample cut short may end in the middle of a character
+	for i := len(sample) - 1; !eof && i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(sample) {
+		return "utf-8"
+	}
+	if isShiftJIS(sample, eof) {
+		return "shift-jis"
+	}
+	for _, b := range sample {
+		if b >= 0x80 && b <= 0x9f && windows1252[b-0x80] != 0 {
+			return "windows-1252"
+		}
+	}
+	return "latin1"
+}
+
+// isShiftJIS reports whether sample is valid Shift-JIS that contains kana,
+// which Japanese text always does and Latin-1 text, which can look like
+// valid Shift-JIS, almost never does.
+func isShiftJIS(sample []byte, eof bool) bool {
+	kana := false
+	for i := 0; i < len(sample); i++ {
+		b := sample[i]
+		switch {
+		case b < 0x80 || (b >= 0xa1 && b <= 0xdf):
+			continue
+		case i+1 == len(sample):
+			return !eof && kana
+		}
+		index := shiftJISIndex(b, sample[i+1])
+		if index < 0 || shiftJISTable[index] == 0 {
+			return false
+		}
+		if r := shiftJISTable[index]; r >= 0x3041 && r <= 0x30ff {
+			kana = true
+		}
+		i++
+	}
+	return kana
+}
+
+// shiftJISIndex returns the position of a double-byte character in
+// shiftJISTable, or -1 if lead and trail cannot form one.
+func shiftJISIndex(lead, trail byte) int {
+	var row int
+	switch {
+	case lead >= 0x81 && lead <= 0x9f:
+		row = int(lead) - 0x81
+	case lead >= 0xe0 && lead <= 0xfc:
+		row = int(lead) - 0xe0 + 0x1f
+	default:
+		return -1
+	}
+	switch {
+	case trail >= 0x40 && trail <= 0x7e:
+		return row*188 + int(trail) - 0x40
+	case trail >= 0x80 && trail <= 0xfc:
+		return row*188 + int(trail) - 0x41
+	}
+	return -1
+}
+
+// windows1252 maps the bytes 0x80-0x9f of Windows-1252, where it differs
+// from Latin-1; 0 marks the five bytes it leaves undefined.
+var windows1252 = [32]rune{
+	0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021, 0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+	0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014, 0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+// decodeInput returns r transcoded from encoding to UTF-8, and the encoding
+// it is in, detected for auto. A UTF-16 byte order mark is dropped; a
+// UTF-8 one is kept, as it is for inputs that need no transcoding.
+func decodeInput(r io.Reader, encoding string) (io.Reader, string) {
+	if encoding == "auto" || encoding == "" {
+		in := bufio.NewReaderSize(r, encodingSample)
+		sample, err := in.Peek(encodingSample)
+		encoding = detectEncoding(sample, err != nil)
+		r = in
+	}
+	decode := decoder(encoding)
+	if decode == nil {
+		return r, encoding
+	}
+	return &decodingReader{in: r, decode: decode}, encoding
+}
+
+// decodeBytes transcodes a whole input held in memory, like decodeInput.
+func decodeBytes(data []byte, encoding string) ([]byte, string) {
+	if encoding == "auto" || encoding == "" {
+		sample := data[:min(len(data), encodingSample)]
+		encoding = detectEncoding(sample, len(sample) == len(data))
+	}
+	decode := decoder(encoding)
+	if decode == nil {
+		return data, encoding
+	}
+	var out bytes.Buffer
+	out.Grow(len(data))
+	decode(&out, data, true)
+	return out.Bytes(), encoding
+}
+
+// isBinary reports whether decoded input is binary rather than text: like
+// git, by a zero byte near the start. UTF-16 text decodes without them.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// decoder returns the function that transcodes encoding to UTF-8, or nil
+// for UTF-8. It writes what src decodes to into dst and returns how many
+// bytes of src it used: a character split across reads is left for the
+// next call, unless eof is set.
+func decoder(encoding string) func(dst *bytes.Buffer, src []byte, eof bool) int {
+	switch encoding {
+	case "utf-16le":
+		return utf16Decoder(binary.LittleEndian)
+	case "utf-16be":
+		return utf16Decoder(binary.BigEndian)
+	case "latin1":
+		return func(dst *bytes.Buffer, src []byte, eof bool) int {
+			for _, b := range src {
+				dst.WriteRune(rune(b))
+			}
+			return len(src)
+		}
+	case "windows-1252":
+		return func(dst *bytes.Buffer, src []byte, eof bool) int {
+			for _, b := range src {
+				if b >= 0x80 && b <= 0x9f && windows1252[b-0x80] != 0 {
+					dst.WriteRune(windows1252[b-0x80])
+				} else {
+					dst.WriteRune(rune(b))
+				}
+			}
+			return len(src)
+		}
+	case "shift-jis":
+		return decodeShiftJIS
+	}
+	return nil
+}
+
+func utf16Decoder(order binary.ByteOrder) func(dst *bytes.Buffer, src []byte, eof bool) int {
+	start := true
+	return func(dst *bytes.Buffer, src []byte, eof bool) int {
+		i := 0
+		for ; i+2 <= len(src); i += 2 {
+			unit := rune(order.Uint16(src[i:]))
+			if start && unit == 0xfeff {
+				start = false
+				continue
+			}
+			start = false
+			if utf16.IsSurrogate(unit) {
+				if i+4 > len(src) && !eof {
+					break
+				}
+				if i+4 <= len(src) {
+					if r := utf16.DecodeRune(unit, rune(order.Uint16(src[i+2:]))); r != utf8.RuneError {
+						dst.WriteRune(r)
+						i += 2
+						continue
+					}
+				}
+				unit = utf8.RuneError
+			}
+			dst.WriteRune(unit)
+		}
+		if eof && i < len(src) {
+			dst.WriteRune(utf8.RuneError)
+			i = len(src)
+		}
+		return i
+	}
+}
+
+func decodeShiftJIS(dst *bytes.Buffer, src []byte, eof bool) int {
+	i := 0
+	for ; i < len(src); i++ {
+		b := src[i]
+		switch {
+		case b < 0x80:
+			dst.WriteByte(b)
+			continue
+		case b >= 0xa1 && b <= 0xdf:
+			// Half-width katakana
+			dst.WriteRune(rune(b) - 0xa1 + 0xff61)
+			continue
+		case i+1 == len(src) && !eof:
+			return i
+		case i+1 == len(src):
+			dst.WriteRune(utf8.RuneError)
+			continue
+		}
+		if index := shiftJISIndex(b, src[i+1]); index >= 0 && shiftJISTable[index] != 0 {
+			dst.WriteRune(rune(shiftJISTable[index]))
+			i++
+		} else {
+			dst.WriteRune(utf8.RuneError)
+		}
+	}
+	return i
+}
+
+// decodingReader streams its input through a decoder.
+type decodingReader struct {
+	in      io.Reader
+	decode  func(dst *bytes.Buffer, src []byte, eof bool) int
+	pending []byte // input bytes not decoded yet
+	buf     [32 << 10]byte
+	out     bytes.Buffer
+	err     error
+}
+
+func (r *decodingReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 && r.err == nil {
+		n, err := r.in.Read(r.buf[:])
+		r.pending = append(r.pending, r.buf[:n]...)
+		used := r.decode(&r.out, r.pending, err != nil)
+		r.pending = r.pending[:copy(r.pending, r.pending[used:])]
+		r.err = err
+	}
+	if r.out.Len() > 0 {
+		return r.out.Read(p)
+	}
+	return 0, r.err
+}
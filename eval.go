@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// evalPair is one line of the -queries file: a query and the passage a good
+// retriever should surface for it.
+type evalPair struct {
+	Query    string `json:"query"`
+	Question string `json:"question"` // accepted as an alias for query
+	Expected string `json:"expected"`
+}
+
+type evalResult struct {
+	ChunkType string          `json:"chunk_type"`
+	ChunkSize int             `json:"chunk_size"`
+	Overlap   int             `json:"overlap"`
+	Chunks    int             `json:"chunks"`
+	Findable  float64         `json:"findable"` // share of expected passages contained in a single chunk
+	Recall    map[int]float64 `json:"recall"`
+	MRR       float64         `json:"mrr"`
+}
+
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+
+	var inputs stringList
+	fs.Var(&inputs, "input", "Corpus file or directory (repeatable; positional arguments are also accepted)")
+	queriesFile := fs.String("queries", "", "JSONL file of {\"query\": ..., \"expected\": ...} pairs (required)")
+	chunkType := fs.String("type", "tokens", "Chunk type: lines, chars, or tokens")
+	sizes := fs.String("sizes", "256,512,1024", "Comma-separated chunk sizes to try")
+	overlaps := fs.String("overlaps", "0,50", "Comma-separated overlaps to try, as sizes or percentages of the chunk size such as 10%")
+	ks := fs.String("k", "1,5,10", "Comma-separated cutoffs to report recall@k for")
+	retrieverName := fs.String("retriever", "bm25", "Retriever: bm25, or exec:<command> for an external retriever")
+	asJSON := fs.Bool("json", false, "Print results as JSON instead of a table")
+	var include, exclude stringList
+	fs.Var(&include, "include", "Glob of files to include when input is a directory (repeatable)")
+	fs.Var(&exclude, "exclude", "Glob of files or directories to skip (repeatable)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s eval [options] [input ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Chunk a corpus under several configurations and report retrieval recall@k.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExternal retrievers receive {\"k\", \"chunks\": [{\"id\", \"text\"}], \"queries\"} as JSON on stdin\n")
+		fmt.Fprintf(os.Stderr, "and must print {\"results\": [[chunk id, ...], ...]} with one ranked list per query.\n")
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  %s eval -input ./docs -queries pairs.jsonl -sizes 200,400,800 -overlaps 0,40\n", os.Args[0])
+	}
+	fs.Parse(args)
+
+	inputs = append(inputs, fs.Args()...)
+	if len(inputs) == 0 || *queriesFile == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	pairs, err := readEvalPairs(*queriesFile)
+	if err != nil {
+		return err
+	}
+	sizeList, err := parseIntList(*sizes)
+	if err != nil {
+		return fmt.Errorf("invalid -sizes: %v", err)
+	}
+	var overlapList []overlapSetting
+	for _, field := range strings.Split(*overlaps, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		overlap, err := parseOverlap(field)
+		if err == nil && overlap.size < 0 {
+			err = fmt.Errorf("negative value %d", overlap.size)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid -overlaps: %v", err)
+		}
+		overlapList = append(overlapList, overlap)
+	}
+	kList, err := parseIntList(*ks)
+	if err != nil {
+		return fmt.Errorf("invalid -k: %v", err)
+	}
+	retriever, err := newRetriever(*retrieverName)
+	if err != nil {
+		return err
+	}
+
+	base := ChunkConfig{
+		StartIndex: 1,
+		Inputs:     inputs,
+		ChunkType:  *chunkType,
+		Include:    include,
+		Exclude:    exclude,
+	}
+	files, err := resolveInputs(base)
+	if err != nil {
+		return err
+	}
+
+	var results []evalResult
+	for _, size := range sizeList {
+		if size == 0 {
+			return fmt.Errorf("invalid -sizes: chunk size must be positive")
+		}
+		for _, setting := range overlapList {
+			overlap := setting.forSize(size)
+			if overlap >= size {
+				continue
+			}
+			config := base
+			config.ChunkSize = size
+			config.OverlapSize = overlap
+
+			result, err := evaluateConfig(config, files, pairs, retriever, kList)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "TYPE\tSIZE\tOVERLAP\tCHUNKS\tFINDABLE")
+	for _, k := range kList {
+		fmt.Fprintf(tw, "\tRECALL@%d", k)
+	}
+	fmt.Fprintf(tw, "\tMRR\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.3f", r.ChunkType, r.ChunkSize, r.Overlap, r.Chunks, r.Findable)
+		for _, k := range kList {
+			fmt.Fprintf(tw, "\t%.3f", r.Recall[k])
+		}
+		fmt.Fprintf(tw, "\t%.3f\n", r.MRR)
+	}
+	return tw.Flush()
+}
+
+func evaluateConfig(config ChunkConfig, files []inputFile, pairs []evalPair, retriever Retriever, kList []int) (evalResult, error) {
+	result := evalResult{
+		ChunkType: config.ChunkType,
+		ChunkSize: config.ChunkSize,
+		Overlap:   config.OverlapSize,
+		Recall:    make(map[int]float64),
+	}
+
+	writer := &memoryWriter{}
+	if err := chunkInputs(config, files, writer, NewManifest(config)); err != nil {
+		return result, err
+	}
+	chunks := writer.chunks
+	result.Chunks = len(chunks)
+
+	maxK := 0
+	for _, k := range kList {
+		maxK = max(maxK, k)
+	}
+
+	queries := make([]string, len(pairs))
+	for i, pair := range pairs {
+		queries[i] = pair.Query
+	}
+	rankings, err := retriever.Retrieve(chunks, queries, maxK)
+	if err != nil {
+		return result, err
+	}
+	if len(rankings) != len(pairs) {
+		return result, fmt.Errorf("retriever returned %d rankings for %d queries", len(rankings), len(pairs))
+	}
+
+	normalized := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		normalized[i] = normalizeForMatch(chunk.Content)
+	}
+
+	findable := 0
+	for i, pair := range pairs {
+		expected := normalizeForMatch(pair.Expected)
+		for _, n := range normalized {
+			if strings.Contains(n, expected) {
+				findable++
+				break
+			}
+		}
+
+		for rank, id := range rankings[i] {
+			if rank >= maxK || id < 0 || id >= len(chunks) {
+				break
+			}
+			if !strings.Contains(normalized[id], expected) {
+				continue
+			}
+			for _, k := range kList {
+				if rank < k {
+					result.Recall[k]++
+				}
+			}
+			result.MRR += 1 / float64(rank+1)
+			break
+		}
+	}
+
+	n := float64(len(pairs))
+	result.Findable = float64(findable) / n
+	for _, k := range kList {
+		result.Recall[k] /= n
+	}
+	result.MRR /= n
+
+	return result, nil
+}
+
+// normalizeForMatch lowercases text and reduces it to single-space separated
+// tokens, so passages match regardless of how a chunk type rejoined them.
+func normalizeForMatch(text string) string {
+	return " " + strings.Join(tokenize(strings.ToLower(text)), " ") + " "
+}
+
+func readEvalPairs(filename string) ([]evalPair, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening queries file: %v", err)
+	}
+	defer file.Close()
+
+	var pairs []evalPair
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var pair evalPair
+		if err := json.Unmarshal([]byte(line), &pair); err != nil {
+			return nil, fmt.Errorf("error parsing queries file line %d: %v", lineNumber, err)
+		}
+		if pair.Query == "" {
+			pair.Query = pair.Question
+		}
+		if pair.Query == "" || pair.Expected == "" {
+			return nil, fmt.Errorf("queries file line %d: both query and expected are required", lineNumber)
+		}
+		pairs = append(pairs, pair)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading queries file: %v", err)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("queries file %s contains no pairs", filename)
+	}
+
+	return pairs, nil
+}
+
+func parseIntList(value string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("negative value %d", n)
+		}
+		values = append(values, n)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values given")
+	}
+	return values, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const repositoryDocument = "repository.md"
+
+// fenceLanguages adds the info strings of common non-code files to those
+// of lspLanguages.
+var fenceLanguages = map[string]string{
+	".md": "markdown", ".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".sh": "sh", ".bash": "bash", ".html": "html", ".css": "css", ".sql": "sql", ".xml": "xml",
+	".jsx": "jsx", ".tsx": "tsx", ".proto": "protobuf", ".mod": "go-mod",
+}
+
+func runExportRepo(args []string) error {
+	fs := flag.NewFlagSet("export-repo", flag.ExitOnError)
+
+	var config ChunkConfig
+	defineChunkFlags(fs, &config)
+	configFile := fs.String("config", "", "YAML config file with default option values (command-line flags and FILECHUNKER_* variables take precedence)")
+	document := fs.String("document", "", "Where to write the repository document (defaults to "+repositoryDocument+" in the output directory)")
+	documentOnly := fs.Bool("document-only", false, "Write the repository document without chunking it")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export-repo [options] [directory ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Render a repository as one Markdown document, a file tree followed by every file in a fenced block, then chunk it in line chunks that start at file boundaries.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := applyEnvironment(fs); err != nil {
+		return err
+	}
+	if *configFile != "" {
+		if err := applyConfigFile(fs, *configFile); err != nil {
+			return err
+		}
+	}
+	config.Inputs = append(config.Inputs, fs.Args()...)
+	config.resolveOverlap()
+	if len(config.Inputs) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := setLang(config.Lang); err != nil {
+		return err
+	}
+	logJSON = config.LogFormat == "json"
+	if err := setLogLevel(config.LogLevel, config.Quiet, config.Verbose); err != nil {
+		return err
+	}
+	if config.ChunkType != "lines" {
+		return fmt.Errorf("export-repo chunks the document in lines, got -type %s", config.ChunkType)
+	}
+	if config.Boundaries != "" || config.TimeWindow > 0 || config.LSP != "" || config.MergeLogs {
+		return fmt.Errorf("export-repo chooses its own chunk boundaries, so it cannot be combined with -boundaries, -time-window, -lsp or -merge-logs")
+	}
+	if outputIsStdout(config) {
+		return fmt.Errorf("export-repo needs an output directory or file")
+	}
+	if config.Encoding = normalizeEncoding(config.Encoding); config.Encoding == "" {
+		return fmt.Errorf("unsupported encoding: %s", fs.Lookup("encoding").Value)
+	}
+	if *document == "" {
+		*document = auxiliaryPath(config, repositoryDocument)
+	}
+
+	inputs, err := resolveInputs(config)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input files matched in %s", strings.Join(config.Inputs, ", "))
+	}
+
+	text, sections, err := renderRepository(config, inputs)
+	if err != nil {
+		return err
+	}
+	fsys := config.filesystem()
+	if err := fsys.MkdirAll(filepath.Dir(*document)); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+	file, err := fsys.Create(*document)
+	if err != nil {
+		return fmt.Errorf("error creating repository document: %v", err)
+	}
+	if _, err := io.WriteString(file, text); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing repository document: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing repository document: %v", err)
+	}
+	fmt.Printf("Wrote %s: %d files, %d lines\n", *document, len(sections)-1, strings.Count(text, "\n"))
+	if *documentOnly {
+		return nil
+	}
+
+	config.Inputs = []string{*document}
+	config.SectionStarts = sections
+	config.Encoding = "utf-8"
+	config.Include, config.Exclude, config.Priority = nil, nil, nil
+	_, err = chunkRun(config, []inputFile{{Path: *document, Prefix: "repository"}}, false)
+	return err
+}
+
+// renderRepository renders the inputs as one Markdown document and returns
+// it with the lines its sections start at: the file tree, then each file.
+// Binary files are left out.
+func renderRepository(config ChunkConfig, inputs []inputFile) (string, []int, error) {
+	var files []string
+	contents := map[string]string{}
+	for _, input := range inputs {
+		data, err := config.filesystem().ReadFile(input.Path)
+		if err != nil {
+			return "", nil, fmt.Errorf("error reading %s: %v", input.Path, err)
+		}
+		if data, _ = decodeBytes(data, config.Encoding); isBinary(data) {
+			logSkipped(input.Path, "binary")
+			continue
+		}
+		name := repositoryPath(config.Inputs, input.Path)
+		files = append(files, name)
+		contents[name] = string(data)
+	}
+
+	var doc strings.Builder
+	line := 1
+	write := func(s string) {
+		doc.WriteString(s)
+		line += strings.Count(s, "\n")
+	}
+	write(fmt.Sprintf("# Repository: %s\n\n", repositoryName(config.Inputs)))
+	sections := []int{line}
+	write("## File tree\n\n```\n" + fileTree(files) + "```\n\n## Files\n\n")
+
+	for _, name := range files {
+		content := contents[name]
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		fence := codeFence(content)
+		sections = append(sections, line)
+		write(fmt.Sprintf("### %s\n\n%s%s\n%s%s\n\n", name, fence, fenceLanguage(name), content, fence))
+	}
+	return doc.String(), sections, nil
+}
+
+// fenceLanguage returns the info string of a file's code block.
+func fenceLanguage(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if language, ok := fenceLanguages[ext]; ok {
+		return language
+	}
+	return lspLanguages[ext]
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in
+// content, so that content cannot close it.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// repositoryPath returns a file's path relative to the input directory it
+// was found in, with slashes.
+func repositoryPath(roots []string, p string) string {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, p); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(p)
+}
+
+func repositoryName(roots []string) string {
+	if abs, err := filepath.Abs(roots[0]); err == nil && len(roots) == 1 {
+		return filepath.Base(abs)
+	}
+	return strings.Join(roots, ", ")
+}
+
+// fileTree draws slash-separated paths as an indented tree.
+func fileTree(files []string) string {
+	type node struct {
+		children map[string]*node
+	}
+	root := &node{children: map[string]*node{}}
+	for _, file := range files {
+		n := root
+		for _, part := range strings.Split(file, "/") {
+			child, ok := n.children[part]
+			if !ok {
+				child = &node{children: map[string]*node{}}
+				n.children[part] = child
+			}
+			n = child
+		}
+	}
+
+	var out strings.Builder
+	var draw func(n *node, indent string)
+	draw = func(n *node, indent string) {
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			branch, next := "├── ", "│   "
+			if i == len(names)-1 {
+				branch, next = "└── ", "    "
+			}
+			child := n.children[name]
+			if len(child.children) > 0 {
+				name += "/"
+			}
+			out.WriteString(indent + branch + name + "\n")
+			draw(child, indent+next)
+		}
+	}
+	draw(root, "")
+	return out.String()
+}
+
+// chunkLinesBySections implements the file-boundary awareness of
+// export-repo: line chunks end where sections of the document start, each
+// holding as many whole sections as fit in -size lines. A section longer
+// than that is split every -size lines.
+func (c *Chunker) chunkLinesBySections() error {
+	lines, err := c.readLines()
+	if err != nil {
+		return err
+	}
+
+	// Line n starts at index n-1
+	starts := make([]int, len(c.config.SectionStarts))
+	for i, line := range c.config.SectionStarts {
+		starts[i] = line - 1
+	}
+	return c.chunkLinesPacked(lines, starts)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatExtensions lists the supported output formats. Formats with an
+// extension write every chunk into a single file; "files" writes one file
+// per chunk.
+var formatExtensions = map[string]string{
+	"files":      "",
+	"csv":        ".csv",
+	"jsonl":      ".jsonl",
+	"langchain":  ".jsonl",
+	"llamaindex": ".jsonl",
+	"corpus":     ".txt",
+	"concat":     ".txt",
+	"zip":        ".zip",
+	"parquet":    ".parquet",
+	"sqlite":     ".db",
+}
+
+// formats returns the configured output formats; -format takes a
+// comma-separated list to write to several sinks in one run.
+func (config ChunkConfig) formats() []string {
+	var formats []string
+	for _, format := range strings.Split(config.Format, ",") {
+		if format = strings.TrimSpace(format); format != "" {
+			formats = append(formats, format)
+		}
+	}
+	if len(formats) == 0 {
+		return []string{"files"}
+	}
+	return formats
+}
+
+func validFormat(format string) bool {
+	_, ok := formatExtensions[format]
+	return ok
+}
+
+// outputIsFile reports whether -output names the single output file itself
+// rather than the directory to put it in. That is only the case when one
+// single-file format is configured and -output carries its extension.
+func outputIsFile(config ChunkConfig) bool {
+	formats := config.formats()
+	if len(formats) != 1 {
+		return false
+	}
+	ext := formatExtensions[formats[0]]
+	return ext != "" && strings.EqualFold(filepath.Ext(config.OutputDir), ext)
+}
+
+// outputIsStdout reports whether chunks are streamed to stdout (-output -).
+func outputIsStdout(config ChunkConfig) bool {
+	return config.OutputDir == "-"
+}
+
+// streamFormats can be written to stdout: they produce one sequential stream
+// and need no auxiliary files.
+var streamFormats = map[string]bool{"files": true, "csv": true, "jsonl": true, "langchain": true, "llamaindex": true, "parquet": true, "zip": true}
+
+// formatOutputPath returns the file a single-file format writes to. When
+// another configured format shares the extension, the format name is added
+// to keep the files apart (chunks.concat.txt next to chunks.corpus.txt),
+// unless it is the extension's own (chunks.jsonl next to
+// chunks.langchain.jsonl).
+func formatOutputPath(config ChunkConfig, format string) string {
+	if outputIsStdout(config) {
+		return "stdout"
+	}
+	if outputIsFile(config) {
+		return config.OutputDir
+	}
+	ext := formatExtensions[format]
+	if ext == "."+format {
+		return filepath.Join(config.OutputDir, "chunks"+ext)
+	}
+	for _, other := range config.formats() {
+		if other != format && formatExtensions[other] == ext {
+			return filepath.Join(config.OutputDir, "chunks."+format+ext)
+		}
+	}
+	return filepath.Join(config.OutputDir, "chunks"+ext)
+}
+
+// outputDir returns the directory that receives the run's output.
+func outputDir(config ChunkConfig) string {
+	if outputIsFile(config) {
+		return filepath.Dir(config.OutputDir)
+	}
+	return config.OutputDir
+}
+
+// auxiliaryPath returns where a run-level file such as the manifest goes:
+// inside the output directory, or next to a single output file
+// (chunks.csv gets chunks.manifest.json).
+func auxiliaryPath(config ChunkConfig, name string) string {
+	if outputIsFile(config) {
+		return strings.TrimSuffix(config.OutputDir, filepath.Ext(config.OutputDir)) + "." + name
+	}
+	return filepath.Join(config.OutputDir, name)
+}
+
+// newChunkWriter creates the writer for the configured output formats.
+// Several formats, or a format and a -sink vector store, are combined into
+// a multiWriter, in which a failing sink is reported and dropped without
+// stopping the others.
+func newChunkWriter(config ChunkConfig) (ChunkWriter, error) {
+	formats := config.formats()
+	if len(formats) == 1 && config.Sink == "" && config.Webhook == "" {
+		return newFormatWriter(config, formats[0])
+	}
+
+	multi := &multiWriter{}
+	for _, format := range formats {
+		w, err := newFormatWriter(config, format)
+		if err != nil {
+			multi.fail(format, err)
+			continue
+		}
+		multi.sinks = append(multi.sinks, &sink{name: format, writer: w})
+	}
+	if config.Sink != "" {
+		if w, err := newVectorStoreWriter(config); err != nil {
+			multi.fail(config.Sink, err)
+		} else {
+			multi.sinks = append(multi.sinks, &sink{name: config.Sink, writer: w})
+		}
+	}
+	if config.Webhook != "" {
+		multi.sinks = append(multi.sinks, &sink{name: "webhook", writer: newWebhookWriter(config)})
+	}
+	if len(multi.sinks) == 0 {
+		return nil, fmt.Errorf("no output sink could be opened: %v", multi.failures())
+	}
+	return multi, nil
+}
+
+func newFormatWriter(config ChunkConfig, format string) (ChunkWriter, error) {
+	fsys := config.filesystem()
+	if outputIsStdout(config) {
+		if !streamFormats[format] {
+			return nil, fmt.Errorf("the %s format cannot be streamed to stdout", format)
+		}
+		if format == "files" {
+			return newStreamWriter(os.Stdout, config), nil
+		}
+		fsys = stdoutFS{}
+	}
+
+	switch format {
+	case "files":
+		if config.Workers > 1 {
+			return newParallelWriter(newFileWriter(config), config.Workers), nil
+		}
+		return newFileWriter(config), nil
+	case "csv":
+		return newCSVWriter(fsys, formatOutputPath(config, format))
+	case "jsonl":
+		return newJSONLWriter(fsys, formatOutputPath(config, format))
+	case "langchain":
+		return newLangChainWriter(fsys, formatOutputPath(config, format))
+	case "llamaindex":
+		return newLlamaIndexWriter(fsys, formatOutputPath(config, format))
+	case "parquet":
+		return newParquetWriter(fsys, formatOutputPath(config, format))
+	case "sqlite":
+		return newSQLiteWriter(formatOutputPath(config, format))
+	case "zip":
+		return newZipWriter(fsys, formatOutputPath(config, format), config)
+	case "concat":
+		return newConcatWriter(config.filesystem(), formatOutputPath(config, format), config.Separator)
+	case "corpus":
+		return newCorpusWriter(config.filesystem(), formatOutputPath(config, format), auxiliaryPath(config, corpusIndexName))
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", format)
+	}
+}
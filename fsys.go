@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// FS is the filesystem a Chunker reads its inputs from and writes its output
+// to. The read side is io/fs, so an FS also works with fs.WalkDir, fs.Glob
+// and friends; the write side covers what the output formats need.
+//
+// Set ChunkConfig.FS to run entirely in memory with newMemFS; a nil FS uses
+// the operating system. The sqlite format drives an external process and
+// always writes to the real filesystem.
+type FS interface {
+	fs.StatFS
+	fs.ReadFileFS
+	fs.ReadDirFS
+	Create(name string) (io.WriteCloser, error)
+	MkdirAll(name string) error
+	Remove(name string) error
+}
+
+// osFS is the operating system filesystem. Unlike os.DirFS it takes
+// ordinary OS paths, absolute or relative to the working directory.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+func (osFS) MkdirAll(name string) error                 { return os.MkdirAll(name, 0755) }
+func (osFS) Remove(name string) error                   { return os.Remove(name) }
+
+// memFS is an in-memory FS for embedding and tests. Paths are cleaned and
+// treated as relative to one root, so "/docs/a.md", "docs/a.md" and
+// "./docs/a.md" name the same file.
+type memFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+	now   func() time.Time
+}
+
+// newMemFS returns an in-memory filesystem holding files, keyed by path.
+func newMemFS(files map[string]string) *memFS {
+	m := &memFS{files: fstest.MapFS{}, now: time.Now}
+	for name, data := range files {
+		m.files[memPath(name)] = &fstest.MapFile{Data: []byte(data), Mode: 0644, ModTime: m.now()}
+	}
+	return m
+}
+
+func memPath(name string) string {
+	name = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(memPath(name))
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Stat(memPath(name))
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadFile(memPath(name))
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadDir(memPath(name))
+}
+
+// Create returns a writer whose content becomes visible on Close.
+func (m *memFS) Create(name string) (io.WriteCloser, error) {
+	return &memFile{fs: m, name: memPath(name)}, nil
+}
+
+func (m *memFS) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := memPath(name); p != "."; p = filepath.ToSlash(filepath.Dir(p)) {
+		if f, ok := m.files[p]; ok {
+			if !f.Mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+			}
+			continue
+		}
+		m.files[p] = &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: m.now()}
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	if _, ok := m.files[p]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, p)
+	return nil
+}
+
+type memFile struct {
+	fs   *memFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.fs.files[f.name] = &fstest.MapFile{Data: f.buf.Bytes(), Mode: 0644, ModTime: f.fs.now()}
+	return nil
+}
+
+// filesystem returns the configured FS, defaulting to the operating system.
+func (config ChunkConfig) filesystem() FS {
+	if config.FS != nil {
+		return config.FS
+	}
+	return osFS{}
+}
+
+// now returns the current time from the configured clock, so that runs can
+// produce reproducible manifests.
+func (config ChunkConfig) now() time.Time {
+	if config.Now != nil {
+		return config.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uncommittedCommit is the commit git blame gives lines not committed yet.
+const uncommittedCommit = "0000000000000000000000000000000000000000"
+
+// chunkGit records where a chunk, or a source, is in git (-git): the commit
+// checked out, the path in the repository, and for a chunk the commit that
+// last changed its lines. LastCommit is empty if some of them are not
+// committed yet, which Uncommitted says.
+type chunkGit struct {
+	Commit       string `json:"commit"`
+	Path         string `json:"path"` // relative to the repository root, with forward slashes
+	LastCommit   string `json:"last_commit,omitempty"`
+	LastModified string `json:"last_modified,omitempty"` // committer date of LastCommit, RFC 3339
+	Uncommitted  bool   `json:"uncommitted,omitempty"`
+}
+
+// gitSource is the git history of an input (-git): the commit of every
+// line, from git blame. Ranges of char and token chunks go through the
+// offsets at which lines start.
+type gitSource struct {
+	commit, path string
+	untracked    bool                 // git blame failed, as it does for files never committed
+	lines        []string             // commit of each line, from line 1
+	times        map[string]time.Time // committer date of each commit
+	content      string               // the input, for the offsets of char and token chunks
+	lineStarts   []int
+	spans        [][2]int // of the tokens of content
+}
+
+// loadGitSource returns the git history of the input at path, or nil if it
+// is not inside a git repository, keeping its content with offsets for the
+// ranges of char and token chunks. Inputs outside a repository chunk as
+// usual.
+func loadGitSource(path string, offsets bool) *gitSource {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	dir := filepath.Dir(abs)
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel", "HEAD").Output()
+	if err != nil {
+		logDebug("git_skipped", fmt.Sprintf("%s is not in a git repository with commits", path), map[string]any{"source": path})
+		return nil
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return nil
+	}
+	rel, err := filepath.Rel(fields[0], abs)
+	if err != nil {
+		return nil
+	}
+	g := &gitSource{commit: fields[1], path: filepath.ToSlash(rel), times: map[string]time.Time{}}
+
+	// Untracked files have no blame, only the commit they sit on
+	out, err = exec.Command("git", "-C", dir, "blame", "--porcelain", "--", filepath.Base(abs)).Output()
+	if err != nil {
+		logWarning(trf("git blame of %s failed, so its chunks are recorded as uncommitted: %v", path, err), map[string]any{"source": path})
+		g.untracked = true
+		return g
+	}
+	g.parseBlame(out)
+	if offsets {
+		if data, err := os.ReadFile(abs); err == nil {
+			g.content = string(data)
+		}
+	}
+	return g
+}
+
+// parseBlame reads the commit of every line from git blame --porcelain
+// output: a header line per line of the file, "<commit> <original line>
+// <final line> [<lines in group>]", followed the first time a commit
+// appears by lines such as "committer-time <unix time>", and then by the
+// line itself after a tab.
+func (g *gitSource) parseBlame(out []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var commit string
+	header := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			g.lines = append(g.lines, commit)
+			header = true
+		case header:
+			commit, _, _ = strings.Cut(line, " ")
+			header = false
+		case strings.HasPrefix(line, "committer-time "):
+			if seconds, err := strconv.ParseInt(strings.TrimPrefix(line, "committer-time "), 10, 64); err == nil {
+				g.times[commit] = time.Unix(seconds, 0).UTC()
+			}
+		}
+	}
+}
+
+// source returns what the manifest records of the input.
+func (g *gitSource) source() *chunkGit {
+	return &chunkGit{Commit: g.commit, Path: g.path}
+}
+
+// chunk returns the git metadata of chunk, with the latest commit to change
+// its lines, found for the line, char or token range it covers by lineRange,
+// if its range is mapped to the lines of the file in git. The ranges of
+// chunks of transformed inputs, and the offsets of transcoded ones, are not,
+// so their chunks only have the commit and path.
+func (g *gitSource) chunk(chunk *Chunk, mapped bool) *chunkGit {
+	info := g.source()
+	if g.untracked {
+		info.Uncommitted = true
+		return info
+	}
+	if !mapped || len(g.lines) == 0 {
+		return info
+	}
+	first, last, ok := g.lineRange(chunk)
+	if !ok {
+		return info
+	}
+	var latest time.Time
+	for _, commit := range g.lines[first-1 : last] {
+		if commit == uncommittedCommit {
+			info.LastCommit, info.LastModified, info.Uncommitted = "", "", true
+			return info
+		}
+		if t := g.times[commit]; info.LastCommit == "" || t.After(latest) {
+			info.LastCommit, latest = commit, t
+		}
+	}
+	if !latest.IsZero() {
+		info.LastModified = latest.Format(time.RFC3339)
+	}
+	return info
+}
+
+// lineRange returns the first and last line, from 1, of a chunk: its range
+// for line chunks, and the lines its offsets fall on for char and token
+// chunks.
+func (g *gitSource) lineRange(chunk *Chunk) (first, last int, ok bool) {
+	start, end := chunk.Start, chunk.End
+	switch chunk.Type {
+	case "lines":
+	case "tokens":
+		if g.spans == nil {
+			g.spans = tokenSpans(g.content)
+		}
+		if start >= len(g.spans) || end < 1 || end > len(g.spans) {
+			return 0, 0, false
+		}
+		start, end = g.lineAt(g.spans[start][0]), g.lineAt(g.spans[end-1][1]-1)
+	case "chars":
+		start, end = g.lineAt(start), g.lineAt(max(start, end-1))
+	default:
+		return 0, 0, false
+	}
+	if start < 1 || end < start || end > len(g.lines) {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// lineAt returns the line, from 1, that the byte at offset is on.
+func (g *gitSource) lineAt(offset int) int {
+	if g.lineStarts == nil {
+		g.lineStarts = []int{0}
+		for i := 0; i < len(g.content); i++ {
+			if g.content[i] == '\n' {
+				g.lineStarts = append(g.lineStarts, i+1)
+			}
+		}
+	}
+	return sort.SearchInts(g.lineStarts, offset+1)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// chunkGraph links the documents, sections and chunks of a chunk set:
+// parent edges go from a chunk to the section it starts in (or its
+// document) and from a section to the enclosing one; next and prev edges
+// join consecutive chunks of a document.
+type chunkGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// graphNode is a document, section or chunk. Start and End are the
+// manifest's for chunks and 1-based lines for sections.
+type graphNode struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Label  string `json:"label"`
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"`
+	Index  int    `json:"index,omitempty"`
+	Level  int    `json:"level,omitempty"`
+	Start  int    `json:"start,omitempty"`
+	End    int    `json:"end,omitempty"`
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"` // parent, next or prev
+}
+
+func runGraph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory of chunk files with a manifest (required)")
+	manifestPath := fs.String("manifest", "", "Manifest describing the chunks (default: manifest.json in the input directory)")
+	format := fs.String("format", "json", "Graph format: json, or dot for Graphviz")
+	output := fs.String("output", "-", "File to write the graph to, or - for stdout")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s graph -input ./chunks [-format json|dot] [-output graph.json]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Export the documents, Markdown sections and chunks of a chunk set as a graph with\n")
+		fmt.Fprintf(os.Stderr, "parent, next and prev edges.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *input == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *format != "json" && *format != "dot" {
+		return fmt.Errorf("unsupported graph format: %s", *format)
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*input, manifestFilename)
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	graph := buildChunkGraph(m)
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating graph file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "dot" {
+		return graph.writeDOT(w)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graph)
+}
+
+func buildChunkGraph(m *Manifest) *chunkGraph {
+	g := &chunkGraph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+
+	bySource := map[string][]ManifestChunk{}
+	for _, chunk := range m.Chunks {
+		bySource[chunk.Source] = append(bySource[chunk.Source], chunk)
+	}
+
+	for _, source := range m.Sources {
+		docID := "doc:" + source
+		g.Nodes = append(g.Nodes, graphNode{ID: docID, Type: "document", Label: source, Source: source})
+
+		// Sections come from the source as it is now, which only matches the
+		// chunks if it was chunked as is
+		var sections []markdownSection
+		if isMarkdown(source) && len(m.Transforms) == 0 {
+			if content, err := m.readSource(source); err == nil {
+				sections = markdownSections(string(content))
+			} else {
+				fmt.Fprintf(os.Stderr, "Note: %s cannot be read, so its chunks are linked to the document without sections\n", source)
+			}
+		}
+		sectionIDs := make([]string, len(sections))
+		for i, section := range sections {
+			sectionIDs[i] = fmt.Sprintf("section:%s#%d", source, section.Line)
+			parent := docID
+			if section.Parent >= 0 {
+				parent = sectionIDs[section.Parent]
+			}
+			g.Nodes = append(g.Nodes, graphNode{ID: sectionIDs[i], Type: "section", Label: section.Title, Source: source, Level: section.Level, Start: section.Line, End: section.End})
+			g.Edges = append(g.Edges, graphEdge{From: sectionIDs[i], To: parent, Type: "parent"})
+		}
+
+		chunks := bySource[source]
+		sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+		var lines *lineIndex
+		if len(sections) > 0 && m.ChunkType != "lines" {
+			content, _ := m.readSource(source)
+			lines = newLineIndex(string(content))
+		}
+		for i, chunk := range chunks {
+			id := fmt.Sprintf("chunk:%d", chunk.Index)
+			g.Nodes = append(g.Nodes, graphNode{ID: id, Type: "chunk", Label: chunk.File, Source: source, File: chunk.File, Index: chunk.Index, Start: chunk.Start, End: chunk.End})
+
+			parent := docID
+			if section := innermostSection(sections, chunkStartLine(m.ChunkType, chunk, lines)); section >= 0 {
+				parent = sectionIDs[section]
+			}
+			g.Edges = append(g.Edges, graphEdge{From: id, To: parent, Type: "parent"})
+			if i > 0 {
+				prev := fmt.Sprintf("chunk:%d", chunks[i-1].Index)
+				g.Edges = append(g.Edges, graphEdge{From: prev, To: id, Type: "next"}, graphEdge{From: id, To: prev, Type: "prev"})
+			}
+		}
+	}
+	return g
+}
+
+func isMarkdown(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".mdx":
+		return true
+	}
+	return false
+}
+
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// markdownSection is an ATX heading and the lines up to the next heading of
+// the same or a higher level. Parent is the index of the enclosing section,
+// or -1.
+type markdownSection struct {
+	Title  string
+	Level  int
+	Line   int
+	End    int
+	Parent int
+}
+
+// markdownSections finds the headings of a Markdown document, skipping
+// fenced code blocks, whose # lines are often comments.
+func markdownSections(content string) []markdownSection {
+	var sections []markdownSection
+	var open []int // enclosing sections, outermost first
+	fenced := false
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		m := markdownHeading.FindStringSubmatch(line)
+		if fenced || m == nil {
+			continue
+		}
+		level := len(m[1])
+		for len(open) > 0 && sections[open[len(open)-1]].Level >= level {
+			sections[open[len(open)-1]].End = i
+			open = open[:len(open)-1]
+		}
+		parent := -1
+		if len(open) > 0 {
+			parent = open[len(open)-1]
+		}
+		open = append(open, len(sections))
+		sections = append(sections, markdownSection{Title: m[2], Level: level, Line: i + 1, Parent: parent})
+	}
+	for _, s := range open {
+		sections[s].End = len(lines)
+	}
+	return sections
+}
+
+// innermostSection returns the deepest section containing line, or -1.
+func innermostSection(sections []markdownSection, line int) int {
+	found := -1
+	for i, s := range sections {
+		if s.Line <= line && line <= s.End {
+			found = i
+		}
+	}
+	return found
+}
+
+// chunkStartLine returns the source line where the chunk's own content
+// starts, after the overlap it repeats from the previous chunk.
+func chunkStartLine(chunkType string, chunk ManifestChunk, lines *lineIndex) int {
+	start := chunk.Start + chunk.Overlap
+	switch {
+	case chunkType == "lines":
+		return start
+	case lines == nil:
+		return 0
+	case chunkType == "tokens":
+		return lines.lineOfToken(start)
+	default:
+		return lines.lineOf(start)
+	}
+}
+
+// lineIndex maps byte offsets and token indices of a text to line numbers.
+type lineIndex struct {
+	starts []int // byte offset of each line
+	spans  [][2]int
+}
+
+func newLineIndex(text string) *lineIndex {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineIndex{starts: starts, spans: tokenSpans(text)}
+}
+
+func (l *lineIndex) lineOf(offset int) int {
+	return sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > offset })
+}
+
+func (l *lineIndex) lineOfToken(index int) int {
+	if index >= len(l.spans) {
+		return len(l.starts)
+	}
+	return l.lineOf(l.spans[index][0])
+}
+
+// writeDOT writes the graph for Graphviz: documents are boxes, sections
+// folders and chunks ellipses.
+func (g *chunkGraph) writeDOT(w io.Writer) error {
+	shapes := map[string]string{"document": "box", "section": "folder", "chunk": "ellipse"}
+	var b strings.Builder
+	b.WriteString("digraph chunks {\n  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", dotQuote(n.ID), dotQuote(n.Label), shapes[n.Type])
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Type != "parent" {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s%s];\n", dotQuote(e.From), dotQuote(e.To), e.Type, style)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// isGraphemeBoundary reports whether offset i of text, a rune boundary,
+// falls between two user-perceived characters (-graphemes). It follows the
+// Unicode extended grapheme cluster rules that matter for real text:
+// CR LF, combining marks, zero-width joiner sequences, variation selectors,
+// emoji modifiers and tags, regional indicator pairs (flags) and Hangul
+// jamo. It errs on the side of breaking for rarer cases.
+func isGraphemeBoundary(text string, i int) bool {
+	if i <= 0 || i >= len(text) {
+		return true
+	}
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	next, _ := utf8.DecodeRuneInString(text[i:])
+
+	switch {
+	case prev == '\r' && next == '\n':
+		return false
+	case prev == '\r' || prev == '\n' || next == '\r' || next == '\n':
+		return true
+	case extendsGrapheme(next):
+		return false
+	case prev == '\u200d':
+		// ZWJ sequences such as 👩‍💻 join the next pictograph
+		return false
+	case isRegionalIndicator(prev) && isRegionalIndicator(next):
+		// Flags pair regional indicators from the start of the run
+		run := 0
+		for j := i; j > 0; {
+			r, size := utf8.DecodeLastRuneInString(text[:j])
+			if !isRegionalIndicator(r) {
+				break
+			}
+			run++
+			j -= size
+		}
+		return run%2 == 0
+	case isHangulLeading(prev) && (isHangulLeading(next) || isHangulVowel(next) || isHangulSyllable(next)):
+		return false
+	case (isHangulVowel(prev) || isHangulSyllable(prev)) && (isHangulVowel(next) || isHangulTrailing(next)):
+		return false
+	case isHangulTrailing(prev) && isHangulTrailing(next):
+		return false
+	}
+	return true
+}
+
+// extendsGrapheme reports whether r attaches to the character before it.
+func extendsGrapheme(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == '\u200d' || // zero-width joiner
+		(r >= 0xfe00 && r <= 0xfe0f) || (r >= 0xe0100 && r <= 0xe01ef) || // variation selectors
+		(r >= 0x1f3fb && r <= 0x1f3ff) || // emoji skin tone modifiers
+		(r >= 0xe0020 && r <= 0xe007f) // emoji tags
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1f1e6 && r <= 0x1f1ff }
+func isHangulLeading(r rune) bool     { return r >= 0x1100 && r <= 0x115f }
+func isHangulVowel(r rune) bool       { return r >= 0x1160 && r <= 0x11a7 }
+func isHangulTrailing(r rune) bool    { return r >= 0x11a8 && r <= 0x11ff }
+func isHangulSyllable(r rune) bool    { return r >= 0xac00 && r <= 0xd7a3 }
+
+// graphemeBack moves i, a rune boundary, back to the start of its grapheme
+// cluster, but not before floor.
+func graphemeBack(text string, i, floor int) int {
+	for i > floor && !isGraphemeBoundary(text, i) {
+		_, size := utf8.DecodeLastRuneInString(text[:i])
+		i -= size
+	}
+	return i
+}
+
+// graphemeEnd moves a chunk end back to the start of the grapheme cluster it
+// falls in, or, if that would leave nothing after floor, forward past it.
+func graphemeEnd(text string, floor, end int) int {
+	if back := graphemeBack(text, end, floor); back > floor {
+		return back
+	}
+	return graphemeForward(text, end)
+}
+
+// graphemeForward moves i, a rune boundary, forward to the end of its
+// grapheme cluster.
+func graphemeForward(text string, i int) int {
+	for i < len(text) && !isGraphemeBoundary(text, i) {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// regexpList is a repeatable flag of regular expressions, checked as they
+// are set so that a bad pattern fails before anything is read.
+type regexpList []string
+
+func (l *regexpList) String() string {
+	return (*stringList)(l).String()
+}
+
+func (l *regexpList) Set(value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", value, err)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// filterLines keeps the lines matching any of the grep patterns, or every
+// line if there are none, and drops those matching any of the grepV
+// patterns (-grep, -grep-v), like grep -e and grep -v -e. The dropped lines
+// count as changed.
+func filterLines(grep, grepV []string) func(r io.Reader, count func(lines int)) io.Reader {
+	keep, drop := compilePatterns(grep), compilePatterns(grepV)
+	return func(r io.Reader, count func(lines int)) io.Reader {
+		return newLineReader(r, func(out *bytes.Buffer, line string, eof bool) {
+			if eof {
+				return
+			}
+			if (len(keep) > 0 && !matchesAny(keep, line)) || matchesAny(drop, line) {
+				count(1)
+				return
+			}
+			out.WriteString(line)
+			out.WriteByte('\n')
+		})
+	}
+}
+
+// compilePatterns compiles patterns a regexpList has already checked.
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = regexp.MustCompile(pattern)
+	}
+	return compiled
+}
+
+func matchesAny(patterns []*regexp.Regexp, line string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
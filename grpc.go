@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gRPC status codes.
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcFailedPrecondition = 9
+	grpcResourceExhausted  = 8
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+)
+
+// grpcError is an error with the gRPC status it ends a call with.
+type grpcError struct {
+	code int
+	err  error
+}
+
+func (e *grpcError) Error() string {
+	return e.err.Error()
+}
+
+// handleGRPC serves the Chunker service of chunker.proto. It speaks the
+// gRPC protocol over HTTP/2 itself: length-prefixed protobuf messages each
+// way, and the status of the call in the trailers.
+func (s *chunkServer) handleGRPC(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/grpc" && contentType != "application/grpc+proto" {
+		http.Error(w, "expected application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "gzip")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	name, chunks, err := s.chunkGRPC(w, r)
+	if err != nil {
+		status := &grpcError{code: grpcInternal, err: err}
+		errors.As(err, &status)
+		w.Header().Set("Grpc-Status", strconv.Itoa(status.code))
+		w.Header().Set("Grpc-Message", grpcEscape(status.err.Error()))
+		s.log(r, http.StatusOK, fmt.Sprintf("grpc status %d: %v", status.code, status.err), map[string]any{"grpc_status": status.code, "error": status.err.Error()})
+		return
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(grpcOK))
+	s.log(r, http.StatusOK, fmt.Sprintf("%s: %d chunks", name, chunks), map[string]any{"file": name, "chunks": chunks, "ms": time.Since(start).Milliseconds()})
+}
+
+// chunkGRPC reads the requests of a Chunk call and streams back the chunks
+// of their file, returning its name and how many chunks it sent.
+func (s *chunkServer) chunkGRPC(w http.ResponseWriter, r *http.Request) (string, int, error) {
+	if r.URL.Path != "/filechunker.v1.Chunker/Chunk" {
+		return "", 0, &grpcError{grpcUnimplemented, fmt.Errorf("unknown method %s", r.URL.Path)}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.flags.maxUpload)+1<<20)
+	gzipped := r.Header.Get("Grpc-Encoding") == "gzip"
+
+	var name string
+	var data bytes.Buffer
+	params := url.Values{}
+	for first := true; ; first = false {
+		message, err := readGRPCMessage(r.Body, gzipped)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return "", 0, &grpcError{grpcResourceExhausted, fmt.Errorf("the file is larger than -max-upload")}
+			}
+			return "", 0, &grpcError{grpcInvalidArgument, err}
+		}
+		err = decodeProto(message, func(field, wireType int, _ uint64, b []byte) error {
+			switch {
+			case wireType != protoBytes:
+			case field == 1 && first:
+				name = string(b)
+			case field == 2 && first:
+				var key, value string
+				err := decodeProto(b, func(field, wireType int, _ uint64, b []byte) error {
+					switch {
+					case wireType == protoBytes && field == 1:
+						key = string(b)
+					case wireType == protoBytes && field == 2:
+						value = string(b)
+					}
+					return nil
+				})
+				if key == "filename" || key == "format" {
+					return fmt.Errorf("option %q cannot be set by a request", key)
+				}
+				params.Add(key, value)
+				return err
+			case field == 3:
+				data.Write(b)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", 0, &grpcError{grpcInvalidArgument, err}
+		}
+		if data.Len() > int(s.flags.maxUpload) {
+			return "", 0, &grpcError{grpcResourceExhausted, fmt.Errorf("the file is larger than -max-upload")}
+		}
+	}
+
+	name = uploadName(name)
+	config, err := s.config(params)
+	if err != nil {
+		return name, 0, &grpcError{grpcInvalidArgument, err}
+	}
+	config, _, inputs, err := uploaded(config, name, data.Bytes())
+	if err != nil {
+		return name, 0, err
+	}
+	writer := &grpcChunkWriter{w: w, rc: http.NewResponseController(w)}
+	if err := chunkInputs(config, inputs, writer, NewManifest(config)); err != nil {
+		return name, writer.sent, &grpcError{grpcFailedPrecondition, err}
+	}
+	return name, writer.sent, nil
+}
+
+// readGRPCMessage reads the next length-prefixed message of a gRPC stream,
+// or io.EOF at its end.
+func readGRPCMessage(r io.Reader, gzipped bool) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errProtoTruncated
+		}
+		return nil, err
+	}
+	message := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(r, message); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errProtoTruncated
+		}
+		return nil, err
+	}
+	switch {
+	case prefix[0] == 0:
+		return message, nil
+	case !gzipped:
+		return nil, fmt.Errorf("compressed message without grpc-encoding")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing message: %v", err)
+	}
+	return io.ReadAll(zr)
+}
+
+// grpcChunkWriter streams chunks to a gRPC client as Chunk messages, each
+// as soon as it is cut.
+type grpcChunkWriter struct {
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	sent int
+}
+
+func (g *grpcChunkWriter) WriteChunk(chunk *Chunk) error {
+	message := encodeChunkMessage(chunk)
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(message)))
+	if _, err := g.w.Write(append(frame, message...)); err != nil {
+		return fmt.Errorf("error sending chunk %d: %v", chunk.Index, err)
+	}
+	if err := g.rc.Flush(); err != nil {
+		return fmt.Errorf("error sending chunk %d: %v", chunk.Index, err)
+	}
+	g.sent++
+	logChunk(chunk, chunk.Filename)
+	return nil
+}
+
+func (g *grpcChunkWriter) Close() error {
+	return nil
+}
+
+// encodeChunkMessage encodes chunk as the Chunk message of chunker.proto.
+func encodeChunkMessage(chunk *Chunk) []byte {
+	record := newJSONLRecord(chunk)
+	var e protoEncoder
+	e.int(1, record.Index)
+	e.string(2, record.Source)
+	e.string(3, record.File)
+	e.string(4, record.Type)
+	e.int(5, record.Start)
+	e.int(6, record.End)
+	e.int(7, record.Overlap)
+	e.int(8, record.Tokens)
+	e.string(9, record.Content)
+	e.string(10, record.TimeStart)
+	e.string(11, record.TimeEnd)
+	for _, ref := range record.References {
+		var re protoEncoder
+		re.string(1, ref.File)
+		re.string(2, ref.Symbol)
+		re.string(3, ref.Import)
+		e.message(12, re.buf)
+	}
+	for _, question := range record.Questions {
+		e.message(13, []byte(question))
+	}
+	e.int(14, record.DuplicateOf)
+	e.double(15, record.Similarity)
+	e.floats(16, record.Embedding)
+	return e.buf
+}
+
+// grpcEscape percent-encodes a grpc-message value.
+func grpcEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// checkChunk verifies the range invariants every chunking mode must hold
+// before a chunk is written. A violation is a bug in the boundary logic;
+// failing loudly beats writing chunks with inconsistent offsets into an
+// index that is trusted downstream.
+func checkChunk(chunk *Chunk) error {
+	size := chunk.End - chunk.Start
+	switch chunk.Type {
+	case "lines":
+		// Lines are 1-based and inclusive
+		size = chunk.End - chunk.Start + 1
+		if chunk.Start < 1 || size != chunk.LineCount {
+			return chunkInvariantError(chunk, "line range %d-%d does not hold %d lines", chunk.Start, chunk.End, chunk.LineCount)
+		}
+	case "chars":
+		if chunk.Start < 0 || size != len(chunk.Content) {
+			return chunkInvariantError(chunk, "byte range %d-%d does not match %d content bytes", chunk.Start, chunk.End, len(chunk.Content))
+		}
+	case "tokens":
+		if chunk.Start < 0 {
+			return chunkInvariantError(chunk, "negative token offset %d", chunk.Start)
+		}
+	}
+
+	if size <= 0 {
+		return chunkInvariantError(chunk, "empty range %d-%d", chunk.Start, chunk.End)
+	}
+	if chunk.Overlap < 0 || chunk.Overlap >= size {
+		return chunkInvariantError(chunk, "overlap %d is not smaller than the chunk (%d)", chunk.Overlap, size)
+	}
+	return nil
+}
+
+func chunkInvariantError(chunk *Chunk, format string, args ...any) error {
+	return fmt.Errorf("internal error: chunk %d of %s: "+format, append([]any{chunk.Index, chunk.Source}, args...)...)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzChunks chunks text as the file input.txt with the chunk options args,
+// in memory, and returns its chunks and config. Options the chunker refuses
+// skip the input.
+func fuzzChunks(t *testing.T, text string, files map[string]string, args ...string) ([]Chunk, ChunkConfig) {
+	console, consoleLevel = io.Discard, levelError
+
+	fs := flag.NewFlagSet("fuzz", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var config ChunkConfig
+	defineChunkFlags(fs, &config)
+	if err := fs.Parse(append([]string{"-encoding", "utf-8", "-metadata=false"}, args...)); err != nil {
+		t.Skip(err)
+	}
+	config.resolveOverlap()
+	if err := config.validate(); err != nil {
+		t.Skip(err)
+	}
+
+	config, fsys, inputs, err := uploaded(config, "input.txt", []byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		w, _ := fsys.Create(name)
+		io.WriteString(w, data)
+		w.Close()
+	}
+	writer := &memoryWriter{}
+	if err := chunkInputs(config, inputs, writer, NewManifest(config)); err != nil {
+		t.Fatalf("chunking %q with %s: %v", text, strings.Join(args, " "), err)
+	}
+	return writer.chunks, config
+}
+
+// FuzzChunkBoundaries checks the invariants of checkChunk across whole runs
+// of line, char and token chunking, every -size units or at -boundaries:
+// chunks cover the input in order, each overlapping only the end of the one
+// before by at most -overlap, and char chunks never split a rune.
+func FuzzChunkBoundaries(f *testing.F) {
+	f.Add("one two three\nfour five six\nseven\n", uint8(0), uint8(2), uint8(1), []byte{})
+	f.Add("héllo wörld, ünïcode text\n", uint8(1), uint8(4), uint8(2), []byte{3, 9})
+	f.Add("éé 👍🏽 x", uint8(2), uint8(3), uint8(1), []byte{})
+	f.Add("a.b,c;d e f g", uint8(3), uint8(2), uint8(5), []byte{1, 4})
+	f.Add("x", uint8(1), uint8(1), uint8(9), []byte{0})
+	f.Add("", uint8(4), uint8(3), uint8(1), []byte{2})
+	f.Add("\u0301\u0301", uint8(2), uint8(0), uint8(0), []byte{})
+
+	f.Fuzz(func(t *testing.T, text string, mode, size, overlap uint8, cuts []byte) {
+		if !utf8.ValidString(text) {
+			return
+		}
+		chunkType := []string{"lines", "chars", "chars", "tokens"}[mode%4]
+		args := []string{"-type", chunkType, "-size", fmt.Sprint(1 + int(size)%32), "-overlap", fmt.Sprint(int(overlap) % 40)}
+		if mode%4 == 2 {
+			args = append(args, "-graphemes")
+		}
+		files := map[string]string{}
+		boundaries := mode&4 != 0
+		if boundaries {
+			var positions []string
+			for _, b := range cuts {
+				positions = append(positions, fmt.Sprint(int(b)%(len(text)+2)))
+			}
+			files["boundaries.txt"] = strings.Join(positions, "\n")
+			args = append(args, "-boundaries", "boundaries.txt")
+		}
+
+		chunks, config := fuzzChunks(t, text, files, args...)
+		tokens := tokenize(text)
+		first, next := 0, 0 // where the first chunk starts, and each next one's own part
+		total := len(text)
+		if chunkType == "lines" {
+			first, next = 1, 1
+			total = strings.Count(text, "\n")
+			if text != "" && !strings.HasSuffix(text, "\n") {
+				total++
+			}
+		} else if chunkType == "tokens" {
+			total = len(tokens)
+		}
+		if total == 0 {
+			if len(chunks) > 0 {
+				t.Fatalf("%d chunks of empty input", len(chunks))
+			}
+			return
+		}
+		if len(chunks) == 0 {
+			t.Fatalf("no chunks of %d %s", total, chunkType)
+		}
+		if chunks[0].Start != first {
+			t.Fatalf("first chunk starts at %d", chunks[0].Start)
+		}
+
+		for i := range chunks {
+			chunk := &chunks[i]
+			if err := checkChunk(chunk); err != nil {
+				t.Fatal(err)
+			}
+			if chunk.Start+chunk.Overlap != next {
+				t.Fatalf("chunk %d starts at %d with overlap %d, after the previous chunk ended at %d", chunk.Index, chunk.Start, chunk.Overlap, next)
+			}
+			size := chunk.End - chunk.Start
+			switch chunkType {
+			case "lines":
+				size = chunk.LineCount
+				next = chunk.End + 1
+				if chunk.Overlap > config.OverlapSize && !boundaries {
+					t.Fatalf("chunk %d repeats %d lines, more than -overlap %d", chunk.Index, chunk.Overlap, config.OverlapSize)
+				}
+			case "chars":
+				next = chunk.End
+				if chunk.Content != text[chunk.Start:chunk.End] {
+					t.Fatalf("chunk %d holds %q, not bytes %d-%d of the input", chunk.Index, chunk.Content, chunk.Start, chunk.End)
+				}
+				if !utf8.ValidString(chunk.Content) {
+					t.Fatalf("chunk %d splits a rune: %q", chunk.Index, chunk.Content)
+				}
+				size = utf8.RuneCountInString(chunk.Content)
+				if n := utf8.RuneCountInString(chunk.Content[:chunk.Overlap]); n > config.OverlapSize {
+					t.Fatalf("chunk %d repeats %d chars, more than -overlap %d", chunk.Index, n, config.OverlapSize)
+				}
+			case "tokens":
+				next = chunk.End
+				if want := strings.Join(tokens[chunk.Start:chunk.End], " "); chunk.Content != want {
+					t.Fatalf("chunk %d holds %q, not tokens %d-%d of the input", chunk.Index, chunk.Content, chunk.Start, chunk.End)
+				}
+				if chunk.Overlap > config.OverlapSize {
+					t.Fatalf("chunk %d repeats %d tokens, more than -overlap %d", chunk.Index, chunk.Overlap, config.OverlapSize)
+				}
+			}
+			// -graphemes takes a cluster longer than -size whole
+			if !boundaries && size > config.ChunkSize && !(config.Graphemes && oneGrapheme(text, chunk.Start+chunk.Overlap, chunk.End)) {
+				t.Fatalf("chunk %d holds %d %s, more than -size %d", chunk.Index, size, chunkType, config.ChunkSize)
+			}
+		}
+		if end := chunks[len(chunks)-1].End; end != total {
+			t.Fatalf("last chunk ends at %d of %d %s", end, total, chunkType)
+		}
+
+		// The sections of export-repo, notebooks and diffs are packed into
+		// chunks of at most -size lines
+		var starts []int
+		for _, b := range cuts {
+			starts = append(starts, int(b)%(total+1))
+		}
+		sort.Ints(starts)
+		last := 0
+		for _, cut := range append(packBoundaries(starts, total, config.ChunkSize), total) {
+			if cut <= last || cut > total || cut-last > config.ChunkSize {
+				t.Fatalf("packBoundaries(%v, %d, %d) cuts at %d after %d", starts, total, config.ChunkSize, cut, last)
+			}
+			last = cut
+		}
+	})
+}
+
+// oneGrapheme reports whether text[start:end] is a single grapheme cluster.
+func oneGrapheme(text string, start, end int) bool {
+	_, size := utf8.DecodeRuneInString(text[start:end])
+	return graphemeForward(text, start+size) >= end
+}
+
+// FuzzTokenSpans checks that tokenSpans covers every character but
+// whitespace with tokens in order, each whole runes of valid UTF-8, and that
+// punctuation marks are tokens of their own.
+func FuzzTokenSpans(f *testing.F) {
+	f.Add("Hello, world! (x) [y] {z}")
+	f.Add("tabs\tand\nnewlines  double")
+	f.Add("ünïcødé… 👍🏽, done.")
+	f.Add("\xff\xfe broken \xc3")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		spans := tokenSpans(text)
+		valid := utf8.ValidString(text)
+		last := 0
+		for _, span := range spans {
+			start, end := span[0], span[1]
+			if start < last || end <= start || end > len(text) {
+				t.Fatalf("span %v after %d in %d bytes", span, last, len(text))
+			}
+			if gap := text[last:start]; strings.Trim(gap, " \t\n") != "" {
+				t.Fatalf("%q between tokens is not whitespace", gap)
+			}
+			if valid && (!utf8.RuneStart(text[start]) || (end < len(text) && !utf8.RuneStart(text[end]))) {
+				t.Fatalf("span %v splits a rune of %q", span, text)
+			}
+			token := text[start:end]
+			if strings.ContainsAny(token, " \t\n") {
+				t.Fatalf("token %q holds whitespace", token)
+			}
+			if strings.ContainsAny(token, ".,;:!?()[]{}") && len(token) != 1 {
+				t.Fatalf("token %q holds punctuation", token)
+			}
+			last = end
+		}
+		if rest := text[last:]; strings.Trim(rest, " \t\n") != "" {
+			t.Fatalf("%q after the last token is not whitespace", rest)
+		}
+		if tokens := tokenize(text); len(tokens) != len(spans) {
+			t.Fatalf("tokenize returns %d tokens for %d spans", len(tokens), len(spans))
+		}
+	})
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lang is the language of console messages, set by -lang or the locale.
+var lang = "en"
+
+// supportedLangs lists the languages with a message catalog; English is the
+// source language and needs none.
+var supportedLangs = map[string]bool{"en": true, "es": true, "fa": true}
+
+// messages holds the translations of user-facing messages, keyed by the
+// English format string. Messages without a translation are shown in
+// English. Keep the verbs of a translation in the same order.
+var messages = map[string]map[string]string{
+	"es": {
+		"Error: %s":   "Error: %s",
+		"Warning: %s": "Advertencia: %s",
+
+		"Input file is required":        "Se requiere un archivo de entrada",
+		"Input file does not exist: %s": "El archivo de entrada no existe: %s",
+		"Invalid chunk type. Must be: lines, chars, tokens, diff, subtitles, or semantic": "Tipo de fragmento no válido. Debe ser: lines, chars, tokens, diff, subtitles o semantic",
+		"Chunk size must be positive":            "El tamaño del fragmento debe ser positivo",
+		"Overlap must not be negative":           "El solapamiento no puede ser negativo",
+		"-max-line must not be negative":         "-max-line no puede ser negativo",
+		"-max-line-type must be chars or tokens": "-max-line-type debe ser chars o tokens",
+		"-lsp needs -type lines and cannot be combined with -boundaries or -time-window":                                "-lsp necesita -type lines y no se puede combinar con -boundaries ni -time-window",
+		"%s: no symbols from the language server, chunking every %d lines: %v":                                          "%s: el servidor de lenguaje no devolvió símbolos, se divide cada %d líneas: %v",
+		"-min-size must not be negative":                                                                                "-min-size no puede ser negativo",
+		"-max-chunks must not be negative":                                                                              "-max-chunks no puede ser negativo",
+		"-max-chunks-action must be stop or error":                                                                      "-max-chunks-action debe ser stop o error",
+		"the inputs make more than %d chunks (-max-chunks); raise -size or -max-chunks, or use -max-chunks-action stop": "las entradas generan más de %d fragmentos (-max-chunks); aumente -size o -max-chunks, o use -max-chunks-action stop",
+		"stopped at the -max-chunks limit of %d chunks in %s; %d more input(s) not chunked":                             "se detuvo en el límite de -max-chunks de %d fragmentos en %s; %d entrada(s) más sin fragmentar",
+		"stopped at the -max-chunks limit of %d chunks; %d more input(s) not chunked":                                   "se detuvo en el límite de -max-chunks de %d fragmentos; %d entrada(s) más sin fragmentar",
+		"-tab-width must not be negative":                                                                               "-tab-width no puede ser negativo",
+		"-dedupe-fuzzy must be between 0 and 1":                                                                         "-dedupe-fuzzy debe estar entre 0 y 1",
+		"-dedupe-action must be drop or flag":                                                                           "-dedupe-action debe ser drop o flag",
+		"Dropped %d near-duplicate chunk(s)":                                                                            "Se descartaron %d fragmento(s) casi duplicados",
+		"Flagged %d near-duplicate chunk(s)":                                                                            "Se marcaron %d fragmento(s) casi duplicados",
+		"Redacted %d secret(s): %s":                                                                                     "Se ocultaron %d secreto(s): %s",
+		"-prompt-template cannot be combined with -budget, which would cut prompts short":                               "-prompt-template no se puede combinar con -budget, que recortaría los prompts",
+		"-type semantic finds its own boundaries, so it cannot be combined with -boundaries":                            "-type semantic encuentra sus propios límites, así que no se puede combinar con -boundaries",
+		"-semantic-percentile must be between 0 and 100":                                                                "-semantic-percentile debe estar entre 0 y 100",
+		"Invalid -embed provider %q. Must be: %s":                                                                       "Proveedor de -embed no válido %q. Debe ser: %s",
+		"Invalid -sink %q. Must be: %s":                                                                                 "-sink %q no válido. Debe ser: %s",
+		"-sink %s stores the -embed vectors of the chunks, so it needs -embed":                                          "-sink %s guarda los vectores -embed de los fragmentos, así que necesita -embed",
+		"point in Qdrant collection %s":                                                                                 "punto en la colección de Qdrant %s",
+		"Created Qdrant collection %s (%d dimensions)":                                                                  "Se creó la colección de Qdrant %s (%d dimensiones)",
+		"-sink %s needs -sink-url":                                                                                      "-sink %s necesita -sink-url",
+		"%s request failed, retrying in %s: %v":                                                                         "falló la solicitud a %s, se reintenta en %s: %v",
+		"vector in Pinecone namespace %q":                                                                               "vector en el espacio de nombres de Pinecone %q",
+		"-chroma-path needs -sink chroma":                                                                               "-chroma-path necesita -sink chroma",
+		"document in Chroma collection %s":                                                                              "documento en la colección de Chroma %s",
+		"-sink pgvector needs -dsn, and -dsn needs -sink pgvector":                                                      "-sink pgvector necesita -dsn, y -dsn necesita -sink pgvector",
+		"row in Postgres table %s":                                                                                      "fila en la tabla de Postgres %s",
+		"node in %s":                                                                                                    "nodo en %s",
+		"Listening on %s":                                                                                               "Escuchando en %s",
+		"-webhook must be an http or https URL, got %q":                                                                 "-webhook debe ser una URL http o https, se recibió %q",
+		"-webhook-secret needs -webhook":                                                                                "-webhook-secret necesita -webhook",
+		"-webhook-concurrency must be at least 1":                                                                       "-webhook-concurrency debe ser al menos 1",
+		"webhook delivery to %s":                                                                                        "entrega de webhook a %s",
+		"Processing: %d chunk(s) of %d file(s) with %s\n\n":                                                             "Procesando: %d fragmento(s) de %d archivo(s) con %s\n\n",
+		"chunk %d of %s failed: %v":                                                                                     "el fragmento %d de %s falló: %v",
+		"Processed chunk %d: %s":                                                                                        "Fragmento %d procesado: %s",
+		"Skipped chunk %d: %s has its response":                                                                         "Fragmento %d omitido: %s ya tiene su respuesta",
+		"\nResponses: %d sent, %d skipped, %d failed, in %s\n":                                                          "\nRespuestas: %d enviadas, %d omitidas, %d fallidas, en %s\n",
+		"%d of %d chunks failed; run process again to retry them":                                                       "%d de %d fragmentos fallaron; ejecute process de nuevo para reintentarlos",
+		"ignoring %s: %v":                                                                                               "se ignora %s: %v",
+		"the response was cut off at -max-tokens %d":                                                                    "la respuesta se cortó en -max-tokens %d",
+		"-retries must not be negative":                                                                                 "-retries no debe ser negativo",
+		"-metadata-mode must be header or sidecar, got %q":                                                              "-metadata-mode debe ser header o sidecar, se recibió %q",
+		"-metadata-mode sidecar writes a file next to each chunk file, so it needs an -output directory, not stdout":                       "-metadata-mode sidecar escribe un archivo junto a cada archivo de fragmento, así que necesita un directorio -output, no stdout",
+		"git blame of %s failed, so its chunks are recorded as uncommitted: %v":                                                            "git blame de %s falló, así que sus fragmentos se registran como sin confirmar: %v",
+		"%s has no diff hunks, so it is chunked every -size lines":                                                                         "%s no tiene bloques de diff, así que se fragmenta cada -size líneas",
+		"-type diff finds its own boundaries, so it cannot be combined with -boundaries, -time-window or -lsp":                             "-type diff encuentra sus propios límites, así que no se puede combinar con -boundaries, -time-window ni -lsp",
+		"-type subtitles finds its own boundaries and times, so it cannot be combined with -boundaries, -time-window, -lsp or -timestamps": "-type subtitles encuentra sus propios límites y tiempos, así que no se puede combinar con -boundaries, -time-window, -lsp ni -timestamps",
+		"-budget must not be negative":                                                                                         "-budget no puede ser negativo",
+		"-budget cannot be combined with -resume, -watch, -dry-run or -tiers":                                                  "-budget no se puede combinar con -resume, -watch, -dry-run ni -tiers",
+		"Budget: kept %d chunks with %d of %d tokens, dropped %d":                                                              "Presupuesto: se conservaron %d fragmentos con %d de %d tokens, se descartaron %d",
+		"  dropped %d chunk(s) of %s (%d tokens)\n":                                                                            "  se descartaron %d fragmento(s) de %s (%d tokens)\n",
+		"Invalid encoding %q. Must be: auto, utf-8, utf-16le, utf-16be, latin1, windows-1252, or shift-jis":                    "Codificación %q no válida. Debe ser: auto, utf-8, utf-16le, utf-16be, latin1, windows-1252 o shift-jis",
+		"-sample-rate must be between 0 and 1":                                                                                 "-sample-rate debe estar entre 0 y 1",
+		"Index width and start index must not be negative":                                                                     "El ancho del índice y el índice inicial no pueden ser negativos",
+		"Invalid output format %q. Must be: files, csv, jsonl, langchain, llamaindex, parquet, sqlite, corpus, concat, or zip": "Formato de salida %q no válido. Debe ser: files, csv, jsonl, langchain, llamaindex, parquet, sqlite, corpus, concat o zip",
+		"Invalid log format %q. Must be: text or json":                                                                         "Formato de registro %q no válido. Debe ser: text o json",
+		"Invalid language %q. Must be: en, es, or fa":                                                                          "Idioma %q no válido. Debe ser: en, es o fa",
+		"-output - streams a single format, got %s":                                                                            "-output - transmite un solo formato, se recibió %s",
+		"the %s format cannot be streamed to stdout":                                                                           "el formato %s no se puede transmitir por la salida estándar",
+		"No input files matched in %s":                                                                                         "Ningún archivo de entrada coincide en %s",
+		"-boundaries applies to a single input file, got %d":                                                                   "-boundaries se aplica a un solo archivo de entrada, se recibieron %d",
+		"error creating output directory: %v":                                                                                  "error al crear el directorio de salida: %v",
+		"%d of %d sink checks failed":                                                                                          "fallaron %d de %d comprobaciones de destino",
+		"Sink check %s: ok":                                                                                                    "Comprobación del destino %s: correcto",
+		"Sink check %s: FAILED: %v":                                                                                            "Comprobación del destino %s: FALLÓ: %v",
+		"sink %s failed and is disabled for the rest of the run: %v":                                                           "el destino %s falló y queda desactivado durante el resto de la ejecución: %v",
+
+		"Chunking: %s (%d file(s))\n":      "Fragmentando: %s (%d archivo(s))\n",
+		"Chunk type: %s\n":                 "Tipo de fragmento: %s\n",
+		"Chunk size: %d\n":                 "Tamaño de fragmento: %d\n",
+		"Boundaries: %s\n":                 "Límites: %s\n",
+		"Overlap: %d\n":                    "Solapamiento: %d\n",
+		"Output: stdout\n":                 "Salida: salida estándar\n",
+		"Output file: %s\n":                "Archivo de salida: %s\n",
+		"Output directory: %s\n":           "Directorio de salida: %s\n",
+		"Chunking completed successfully!": "¡Fragmentación completada con éxito!",
+
+		"Summary: %d chunks, %d bytes, %d tokens\n":                                          "Resumen: %d fragmentos, %d bytes, %d tokens\n",
+		"Overlap overhead: %d bytes (%.1f%%), %d tokens (%.1f%%) duplicated across chunks\n": "Costo del solapamiento: %d bytes (%.1f%%), %d tokens (%.1f%%) duplicados entre fragmentos\n",
+
+		"%d chunks":                              "%d fragmentos",
+		"ETA %s":                                 "Tiempo restante %s",
+		"done in %s":                             "terminado en %s",
+		"-quiet and -verbose cannot be combined": "-quiet y -verbose no se pueden combinar",
+		"Invalid log level %q. Must be: debug, info, warn, or error": "Nivel de registro %q no válido. Debe ser: debug, info, warn o error",
+		"Created chunk %d: %s": "Fragmento %d creado: %s",
+		"%s (lines %d-%d)":     "%s (líneas %d-%d)",
+		"row in %s":            "fila en %s",
+		"line in %s":           "línea en %s",
+		"section %d in %s":     "sección %d en %s",
+		"offset %d in %s":      "desplazamiento %d en %s",
+		"%s on stdout":         "%s en la salida estándar",
+		"%s in %s":             "%s en %s",
+
+		"Would create chunk %d: %s (lines %d-%d, %d bytes)": "Se crearía el fragmento %d: %s (líneas %d-%d, %d bytes)",
+		"Would create chunk %d: %s (%s %d-%d, %d bytes)":    "Se crearía el fragmento %d: %s (%s %d-%d, %d bytes)",
+		"\nWould write:\n":              "\nSe escribiría:\n",
+		"  %d chunk files in %s\n":      "  %d archivos de fragmento en %s\n",
+		"  stdout\n":                    "  salida estándar\n",
+		"Dry run: nothing was written.": "Simulación: no se escribió nada.",
+
+		"-resume needs the files format and an output directory": "-resume requiere el formato files y un directorio de salida",
+		"no checkpoint in %s; starting from the beginning":       "no hay punto de control en %s; se empieza desde el principio",
+		"Resuming after chunk %d (%s)":                           "Reanudando después del fragmento %d (%s)",
+		"error removing checkpoint: %v":                          "error al eliminar el punto de control: %v",
+		"Transform %s changed %d line(s)":                        "La transformación %s cambió %d línea(s)",
+
+		"-watch needs an output directory or file, and cannot be combined with -dry-run": "-watch requiere un directorio o archivo de salida y no se puede combinar con -dry-run",
+		"-watch-interval must be positive":                                               "-watch-interval debe ser positivo",
+		"Watching %d file(s) for changes every %s":                                       "Vigilando cambios en %d archivo(s) cada %s",
+		"Changed: %s":            "Cambiado: %s",
+		"Removed stale chunk %s": "Fragmento obsoleto eliminado: %s",
+	},
+	"fa": {
+		"Error: %s":   "خطا: %s",
+		"Warning: %s": "هشدار: %s",
+
+		"Input file is required":        "فایل ورودی الزامی است",
+		"Input file does not exist: %s": "فایل ورودی وجود ندارد: %s",
+		"Invalid chunk type. Must be: lines, chars, tokens, diff, subtitles, or semantic": "نوع قطعه نامعتبر است. باید یکی از lines، chars، tokens، diff، subtitles یا semantic باشد",
+		"Chunk size must be positive":            "اندازه قطعه باید مثبت باشد",
+		"Overlap must not be negative":           "همپوشانی نباید منفی باشد",
+		"-max-line must not be negative":         "-max-line نباید منفی باشد",
+		"-max-line-type must be chars or tokens": "-max-line-type باید chars یا tokens باشد",
+		"-lsp needs -type lines and cannot be combined with -boundaries or -time-window":                                "-lsp به -type lines نیاز دارد و با -boundaries یا -time-window ترکیب نمی‌شود",
+		"%s: no symbols from the language server, chunking every %d lines: %v":                                          "%s: سرور زبان نمادی برنگرداند، تقسیم هر %d خط: %v",
+		"-min-size must not be negative":                                                                                "-min-size نباید منفی باشد",
+		"-max-chunks must not be negative":                                                                              "-max-chunks نباید منفی باشد",
+		"-max-chunks-action must be stop or error":                                                                      "-max-chunks-action باید stop یا error باشد",
+		"the inputs make more than %d chunks (-max-chunks); raise -size or -max-chunks, or use -max-chunks-action stop": "ورودی‌ها بیش از %d قطعه می‌سازند (-max-chunks)؛ -size یا -max-chunks را افزایش دهید یا از -max-chunks-action stop استفاده کنید",
+		"stopped at the -max-chunks limit of %d chunks in %s; %d more input(s) not chunked":                             "در حد -max-chunks برابر %d قطعه در %s متوقف شد؛ %d ورودی دیگر قطعه‌بندی نشد",
+		"stopped at the -max-chunks limit of %d chunks; %d more input(s) not chunked":                                   "در حد -max-chunks برابر %d قطعه متوقف شد؛ %d ورودی دیگر قطعه‌بندی نشد",
+		"-tab-width must not be negative":                                                                               "-tab-width نباید منفی باشد",
+		"-dedupe-fuzzy must be between 0 and 1":                                                                         "-dedupe-fuzzy باید بین 0 و 1 باشد",
+		"-dedupe-action must be drop or flag":                                                                           "-dedupe-action باید drop یا flag باشد",
+		"Dropped %d near-duplicate chunk(s)":                                                                            "%d قطعه تقریباً تکراری حذف شد",
+		"Flagged %d near-duplicate chunk(s)":                                                                            "%d قطعه تقریباً تکراری علامت‌گذاری شد",
+		"Redacted %d secret(s): %s":                                                                                     "%d راز پنهان شد: %s",
+		"-prompt-template cannot be combined with -budget, which would cut prompts short":                               "-prompt-template را نمی‌توان با -budget ترکیب کرد، چون promptها را کوتاه می‌کند",
+		"-type semantic finds its own boundaries, so it cannot be combined with -boundaries":                            "-type semantic مرزهای خود را پیدا می‌کند، پس نمی‌توان آن را با -boundaries ترکیب کرد",
+		"-semantic-percentile must be between 0 and 100":                                                                "-semantic-percentile باید بین 0 و 100 باشد",
+		"Invalid -embed provider %q. Must be: %s":                                                                       "ارائه‌دهندهٔ -embed نامعتبر %q. باید یکی از این‌ها باشد: %s",
+		"Invalid -sink %q. Must be: %s":                                                                                 "-sink %q نامعتبر است. باید یکی از این‌ها باشد: %s",
+		"-sink %s stores the -embed vectors of the chunks, so it needs -embed":                                          "-sink %s بردارهای -embed قطعه‌ها را ذخیره می‌کند، پس به -embed نیاز دارد",
+		"point in Qdrant collection %s":                                                                                 "نقطه‌ای در مجموعهٔ Qdrant به نام %s",
+		"Created Qdrant collection %s (%d dimensions)":                                                                  "مجموعهٔ Qdrant به نام %s ساخته شد (%d بُعد)",
+		"-sink %s needs -sink-url":                                                                                      "-sink %s به -sink-url نیاز دارد",
+		"%s request failed, retrying in %s: %v":                                                                         "درخواست به %s ناموفق بود، تلاش دوباره پس از %s: %v",
+		"vector in Pinecone namespace %q":                                                                               "برداری در فضای نام Pinecone به نام %q",
+		"-chroma-path needs -sink chroma":                                                                               "-chroma-path به -sink chroma نیاز دارد",
+		"document in Chroma collection %s":                                                                              "سندی در مجموعهٔ Chroma به نام %s",
+		"-sink pgvector needs -dsn, and -dsn needs -sink pgvector":                                                      "-sink pgvector به -dsn نیاز دارد و -dsn به -sink pgvector",
+		"row in Postgres table %s":                                                                                      "ردیفی در جدول Postgres به نام %s",
+		"node in %s":                                                                                                    "گره‌ای در %s",
+		"Listening on %s":                                                                                               "در حال گوش دادن روی %s",
+		"-webhook must be an http or https URL, got %q":                                                                 "-webhook باید یک نشانی http یا https باشد، دریافت شد %q",
+		"-webhook-secret needs -webhook":                                                                                "-webhook-secret به -webhook نیاز دارد",
+		"-webhook-concurrency must be at least 1":                                                                       "-webhook-concurrency باید دست‌کم ۱ باشد",
+		"webhook delivery to %s":                                                                                        "تحویل webhook به %s",
+		"Processing: %d chunk(s) of %d file(s) with %s\n\n":                                                             "در حال پردازش: %d قطعه از %d پرونده با %s\n\n",
+		"chunk %d of %s failed: %v":                                                                                     "قطعهٔ %d از %s ناموفق بود: %v",
+		"Processed chunk %d: %s":                                                                                        "قطعهٔ %d پردازش شد: %s",
+		"Skipped chunk %d: %s has its response":                                                                         "قطعهٔ %d رد شد: %s پاسخ خود را دارد",
+		"\nResponses: %d sent, %d skipped, %d failed, in %s\n":                                                          "\nپاسخ‌ها: %d ارسال‌شده، %d ردشده، %d ناموفق، در %s\n",
+		"%d of %d chunks failed; run process again to retry them":                                                       "%d از %d قطعه ناموفق بود؛ برای تلاش دوباره process را دوباره اجرا کنید",
+		"ignoring %s: %v":                                                                                               "%s نادیده گرفته شد: %v",
+		"the response was cut off at -max-tokens %d":                                                                    "پاسخ در -max-tokens %d بریده شد",
+		"-retries must not be negative":                                                                                 "-retries نباید منفی باشد",
+		"-metadata-mode must be header or sidecar, got %q":                                                              "-metadata-mode باید header یا sidecar باشد، دریافت شد %q",
+		"-metadata-mode sidecar writes a file next to each chunk file, so it needs an -output directory, not stdout":                       "-metadata-mode sidecar کنار هر فایل قطعه یک فایل می‌نویسد، پس به یک پوشه -output نیاز دارد، نه stdout",
+		"git blame of %s failed, so its chunks are recorded as uncommitted: %v":                                                            "git blame برای %s ناموفق بود، پس قطعه‌های آن ثبت‌نشده ثبت می‌شوند: %v",
+		"%s has no diff hunks, so it is chunked every -size lines":                                                                         "%s هیچ بخش diff ندارد، پس هر -size خط قطعه‌بندی می‌شود",
+		"-type diff finds its own boundaries, so it cannot be combined with -boundaries, -time-window or -lsp":                             "-type diff مرزهای خود را پیدا می‌کند، پس نمی‌توان آن را با -boundaries، -time-window یا -lsp ترکیب کرد",
+		"-type subtitles finds its own boundaries and times, so it cannot be combined with -boundaries, -time-window, -lsp or -timestamps": "-type subtitles مرزها و زمان‌های خود را پیدا می‌کند، پس نمی‌توان آن را با -boundaries، -time-window، -lsp یا -timestamps ترکیب کرد",
+		"-budget must not be negative":                                                                                         "-budget نباید منفی باشد",
+		"-budget cannot be combined with -resume, -watch, -dry-run or -tiers":                                                  "-budget با -resume، -watch، -dry-run یا -tiers ترکیب نمی‌شود",
+		"Budget: kept %d chunks with %d of %d tokens, dropped %d":                                                              "بودجه: %d قطعه با %d از %d توکن نگه داشته شد، %d حذف شد",
+		"  dropped %d chunk(s) of %s (%d tokens)\n":                                                                            "  %d قطعه از %s حذف شد (%d توکن)\n",
+		"Invalid encoding %q. Must be: auto, utf-8, utf-16le, utf-16be, latin1, windows-1252, or shift-jis":                    "کدگذاری %q نامعتبر است. باید یکی از auto، utf-8، utf-16le، utf-16be، latin1، windows-1252 یا shift-jis باشد",
+		"-sample-rate must be between 0 and 1":                                                                                 "-sample-rate باید بین ۰ و ۱ باشد",
+		"Index width and start index must not be negative":                                                                     "عرض شماره و شماره شروع نباید منفی باشند",
+		"Invalid output format %q. Must be: files, csv, jsonl, langchain, llamaindex, parquet, sqlite, corpus, concat, or zip": "قالب خروجی %q نامعتبر است. باید یکی از files، csv، jsonl، langchain، llamaindex، parquet، sqlite، corpus، concat یا zip باشد",
+		"Invalid log format %q. Must be: text or json":                                                                         "قالب گزارش %q نامعتبر است. باید text یا json باشد",
+		"Invalid language %q. Must be: en, es, or fa":                                                                          "زبان %q نامعتبر است. باید یکی از en، es یا fa باشد",
+		"-output - streams a single format, got %s":                                                                            "با -output - فقط یک قالب قابل ارسال است، اما %s داده شد",
+		"the %s format cannot be streamed to stdout":                                                                           "قالب %s را نمی‌توان به خروجی استاندارد فرستاد",
+		"No input files matched in %s":                                                                                         "هیچ فایل ورودی در %s پیدا نشد",
+		"-boundaries applies to a single input file, got %d":                                                                   "-boundaries فقط برای یک فایل ورودی است، اما %d فایل داده شد",
+		"error creating output directory: %v":                                                                                  "خطا در ساخت پوشه خروجی: %v",
+		"%d of %d sink checks failed":                                                                                          "%d مورد از %d بررسی مقصد ناموفق بود",
+		"Sink check %s: ok":                                                                                                    "بررسی مقصد %s: سالم",
+		"Sink check %s: FAILED: %v":                                                                                            "بررسی مقصد %s: ناموفق: %v",
+		"sink %s failed and is disabled for the rest of the run: %v":                                                           "مقصد %s با خطا مواجه شد و تا پایان اجرا غیرفعال است: %v",
+
+		"Chunking: %s (%d file(s))\n":      "در حال قطعه‌بندی: %s (%d فایل)\n",
+		"Chunk type: %s\n":                 "نوع قطعه: %s\n",
+		"Chunk size: %d\n":                 "اندازه قطعه: %d\n",
+		"Boundaries: %s\n":                 "مرزها: %s\n",
+		"Overlap: %d\n":                    "همپوشانی: %d\n",
+		"Output: stdout\n":                 "خروجی: خروجی استاندارد\n",
+		"Output file: %s\n":                "فایل خروجی: %s\n",
+		"Output directory: %s\n":           "پوشه خروجی: %s\n",
+		"Chunking completed successfully!": "قطعه‌بندی با موفقیت انجام شد!",
+
+		"Summary: %d chunks, %d bytes, %d tokens\n":                                          "خلاصه: %d قطعه، %d بایت، %d توکن\n",
+		"Overlap overhead: %d bytes (%.1f%%), %d tokens (%.1f%%) duplicated across chunks\n": "سربار همپوشانی: %d بایت (%.1f%%) و %d توکن (%.1f%%) بین قطعه‌ها تکرار شده است\n",
+
+		"%d chunks":                              "%d قطعه",
+		"ETA %s":                                 "زمان باقی‌مانده %s",
+		"done in %s":                             "پایان در %s",
+		"-quiet and -verbose cannot be combined": "-quiet و -verbose را نمی‌توان با هم به کار برد",
+		"Invalid log level %q. Must be: debug, info, warn, or error": "سطح گزارش %q نامعتبر است. باید یکی از این‌ها باشد: debug، info، warn یا error",
+		"Created chunk %d: %s": "قطعه %d ساخته شد: %s",
+		"%s (lines %d-%d)":     "%s (خطوط %d-%d)",
+		"row in %s":            "ردیفی در %s",
+		"line in %s":           "خطی در %s",
+		"section %d in %s":     "بخش %d در %s",
+		"offset %d in %s":      "موقعیت %d در %s",
+		"%s on stdout":         "%s در خروجی استاندارد",
+		"%s in %s":             "%s در %s",
+
+		"Would create chunk %d: %s (lines %d-%d, %d bytes)": "قطعه %d ساخته می‌شد: %s (خطوط %d-%d، %d بایت)",
+		"Would create chunk %d: %s (%s %d-%d, %d bytes)":    "قطعه %d ساخته می‌شد: %s (%s %d-%d، %d بایت)",
+		"\nWould write:\n":              "\nنوشته می‌شد:\n",
+		"  %d chunk files in %s\n":      "  %d فایل قطعه در %s\n",
+		"  stdout\n":                    "  خروجی استاندارد\n",
+		"Dry run: nothing was written.": "اجرای آزمایشی: چیزی نوشته نشد.",
+
+		"-resume needs the files format and an output directory": "-resume به قالب files و یک پوشه خروجی نیاز دارد",
+		"no checkpoint in %s; starting from the beginning":       "نقطه بازیابی در %s نیست؛ از ابتدا شروع می‌شود",
+		"Resuming after chunk %d (%s)":                           "ادامه پس از قطعه %d (%s)",
+		"error removing checkpoint: %v":                          "خطا در حذف نقطه بازیابی: %v",
+		"Transform %s changed %d line(s)":                        "تبدیل %s تعداد %d خط را تغییر داد",
+
+		"-watch needs an output directory or file, and cannot be combined with -dry-run": "-watch به یک پوشه یا فایل خروجی نیاز دارد و با -dry-run ترکیب نمی‌شود",
+		"-watch-interval must be positive":                                               "-watch-interval باید مثبت باشد",
+		"Watching %d file(s) for changes every %s":                                       "پایش تغییرات %d فایل هر %s",
+		"Changed: %s":            "تغییر کرد: %s",
+		"Removed stale chunk %s": "قطعه منسوخ حذف شد: %s",
+	},
+}
+
+// tr returns the translation of an English message format.
+func tr(format string) string {
+	if translated, ok := messages[lang][format]; ok {
+		return translated
+	}
+	return format
+}
+
+// trf formats a translated message.
+func trf(format string, args ...any) string {
+	return fmt.Sprintf(tr(format), args...)
+}
+
+// setLang selects the message language from -lang, or from the locale
+// environment when the flag is empty. Unsupported locales fall back to
+// English; an unsupported -lang is an error.
+func setLang(flagValue string) error {
+	if flagValue != "" {
+		if !supportedLangs[flagValue] {
+			return fmt.Errorf(tr("Invalid language %q. Must be: en, es, or fa"), flagValue)
+		}
+		lang = flagValue
+		return nil
+	}
+
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(env); value != "" {
+			// es_ES.UTF-8 -> es
+			code, _, _ := strings.Cut(strings.ToLower(value), "_")
+			code, _, _ = strings.Cut(code, ".")
+			if supportedLangs[code] {
+				lang = code
+			}
+			return nil
+		}
+	}
+	return nil
+}
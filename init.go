@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// initChoice is one answer offered by the init wizard.
+type initChoice struct {
+	key   string
+	label string
+}
+
+var (
+	initContentChoices = []initChoice{
+		{"code", "Source code"},
+		{"prose", "Documentation or other prose"},
+		{"logs", "Log files"},
+		{"mixed", "A mix of the above"},
+	}
+	initModelChoices = []initChoice{
+		{"128000", "GPT-4o or another 128k-context model"},
+		{"200000", "Claude (200k context)"},
+		{"32000", "A 32k-context model"},
+		{"8192", "Llama 3 or another 8k-context local model"},
+	}
+	initGoalChoices = []initChoice{
+		{"rag", "RAG: embed chunks for retrieval"},
+		{"review", "Review: read or summarize chunks with an LLM"},
+		{"training", "Training: build a fine-tuning or pretraining dataset"},
+	}
+)
+
+// initConfig is the recommendation the wizard writes out.
+type initConfig struct {
+	input    string
+	content  string
+	context  int
+	goal     string
+	origin   string // what wrote the config, for its header
+	typ      string
+	size     int
+	overlap  int
+	format   string
+	include  []string
+	exclude  []string
+	comments []string
+}
+
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	output := fs.String("output", "filechunker.yaml", "Config file to write")
+	force := fs.Bool("force", false, "Overwrite an existing config file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s init [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Ask a few questions and write a recommended config file.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", *output)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	fmt.Println("This wizard writes a config file with recommended chunking options.")
+	fmt.Println("Press Enter to accept the default shown in brackets.")
+	fmt.Println()
+
+	content := askChoice(in, "What are you chunking?", initContentChoices, 0)
+	model := askChoice(in, "Which model will read the chunks?", initModelChoices, 0)
+	goal := askChoice(in, "What is the goal?", initGoalChoices, 0)
+	input := askLine(in, "Input file or directory (Enter to give it on the command line later)")
+
+	context, _ := strconv.Atoi(model)
+	rec := recommendConfig(content, context, goal, 0)
+	rec.input = input
+
+	if err := os.WriteFile(*output, []byte(rec.yaml()), 0644); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+
+	fmt.Printf("\nWrote %s: %s chunks of %d with overlap %d, %s output.\n", *output, rec.typ, rec.size, rec.overlap, rec.format)
+	if input == "" {
+		fmt.Printf("Run: %s -config %s -input <path>\n", os.Args[0], *output)
+	} else {
+		fmt.Printf("Run: %s -config %s\n", os.Args[0], *output)
+	}
+	return nil
+}
+
+// askChoice prints a numbered menu and returns the key of the chosen
+// answer. An empty answer, or end of input, picks the default.
+func askChoice(in *bufio.Reader, question string, choices []initChoice, def int) string {
+	for {
+		fmt.Println(question)
+		for i, choice := range choices {
+			fmt.Printf("  %d) %s\n", i+1, choice.label)
+		}
+		fmt.Printf("Choice [%d]: ", def+1)
+
+		answer, err := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			fmt.Println()
+			return choices[def].key
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(choices) {
+			fmt.Println()
+			return choices[n-1].key
+		}
+		if err == io.EOF {
+			fmt.Println()
+			return choices[def].key
+		}
+		fmt.Printf("Please enter a number from 1 to %d.\n\n", len(choices))
+	}
+}
+
+func askLine(in *bufio.Reader, question string) string {
+	fmt.Printf("%s: ", question)
+	answer, _ := in.ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// recommendConfig turns the wizard answers into chunking options. RAG wants
+// small, focused chunks whatever the model; review and training scale with
+// the model's context window. tokensPerLine, when known, expresses token
+// budgets as line counts; 0 uses a rough figure for the content.
+func recommendConfig(content string, context int, goal string, tokensPerLine int) initConfig {
+	rec := initConfig{content: content, context: context, goal: goal, origin: "init wizard"}
+
+	if tokensPerLine <= 0 {
+		tokensPerLine = 10
+		if content == "logs" || content == "jsonl" {
+			tokensPerLine = 25
+		}
+	}
+	byLines := content == "code" || content == "logs" || content == "jsonl"
+
+	switch goal {
+	case "rag":
+		rec.format = "jsonl"
+		if byLines {
+			rec.typ, rec.size, rec.overlap = "lines", max(1, 400/tokensPerLine), 40/tokensPerLine
+		} else {
+			rec.typ, rec.size, rec.overlap = "tokens", 400, 50
+		}
+		rec.comments = append(rec.comments, "Small chunks keep each embedding focused on one topic.")
+	case "review":
+		rec.format = "files"
+		budget := context * 2 / 5
+		if byLines {
+			rec.typ, rec.size, rec.overlap = "lines", max(1, budget/tokensPerLine), budget/tokensPerLine/20
+		} else {
+			rec.typ, rec.size, rec.overlap = "tokens", budget, budget/20
+		}
+		rec.comments = append(rec.comments, "Chunks use about 40% of the context window, leaving room for instructions and the answer.")
+	case "training":
+		rec.format = "jsonl"
+		rec.typ, rec.size, rec.overlap = "tokens", min(2048, context/4), 0
+		rec.comments = append(rec.comments, "No overlap, so no text is seen twice per epoch.")
+	}
+
+	switch content {
+	case "code":
+		rec.exclude = []string{"vendor/**", "node_modules/**", ".git/**", "**/*.min.js"}
+	case "prose":
+		rec.include = []string{"**/*.md", "**/*.txt", "**/*.rst"}
+	case "logs":
+		rec.include = []string{"**/*.log"}
+	case "jsonl":
+		// Records stand alone, so they need no context from their neighbours
+		rec.include = []string{"**/*.jsonl", "**/*.ndjson"}
+		rec.overlap = 0
+	}
+	return rec
+}
+
+func (rec initConfig) yaml() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Written by the file-chunker %s\n", rec.origin)
+	fmt.Fprintf(&b, "# content: %s, context window: %d tokens, goal: %s\n", rec.content, rec.context, rec.goal)
+	for _, comment := range rec.comments {
+		fmt.Fprintf(&b, "# %s\n", comment)
+	}
+	b.WriteString("\n")
+
+	if rec.input != "" {
+		fmt.Fprintf(&b, "input: %s\n", strconv.Quote(rec.input))
+	}
+	fmt.Fprintf(&b, "type: %s\n", rec.typ)
+	fmt.Fprintf(&b, "size: %d\n", rec.size)
+	fmt.Fprintf(&b, "overlap: %d\n", rec.overlap)
+	fmt.Fprintf(&b, "format: %s\n", rec.format)
+	writeYAMLList(&b, "include", rec.include)
+	writeYAMLList(&b, "exclude", rec.exclude)
+	return b.String()
+}
+
+func writeYAMLList(b *strings.Builder, key string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", key)
+	for _, item := range items {
+		fmt.Fprintf(b, "  - %s\n", strconv.Quote(item))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type inputFile struct {
+	Path   string
+	Prefix string
+}
+
+// resolveInputs expands the configured inputs into the list of files to chunk.
+// Plain files are used as-is; directories are walked recursively and
+// filtered through the include/exclude globs. Every file gets a distinct
+// output prefix so that chunks from different inputs never collide.
+func resolveInputs(config ChunkConfig) ([]inputFile, error) {
+	var inputs []inputFile
+	seen := make(map[string]bool)
+	usedPrefixes := make(map[string]bool)
+	multiple := len(config.Inputs) > 1
+
+	add := func(p, prefix string) {
+		if seen[filepath.Clean(p)] {
+			logSkipped(p, "duplicate")
+			return
+		}
+		seen[filepath.Clean(p)] = true
+
+		// Files that differ only by extension would otherwise overwrite each other
+		if usedPrefixes[prefix] {
+			prefix += "_" + strings.TrimPrefix(filepath.Ext(p), ".")
+		}
+		for base, n := prefix, 2; usedPrefixes[prefix]; n++ {
+			prefix = fmt.Sprintf("%s_%d", base, n)
+		}
+		usedPrefixes[prefix] = true
+
+		inputs = append(inputs, inputFile{Path: p, Prefix: prefix})
+	}
+
+	for _, input := range config.Inputs {
+		info, err := config.filesystem().Stat(input)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input: %v", err)
+		}
+
+		if info.IsDir() {
+			if err := walkInputDir(config, input, add); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Set default prefix to input filename without extension
+		base := filepath.Base(input)
+		prefix := strings.TrimSuffix(base, filepath.Ext(base))
+		if config.Prefix != "" {
+			prefix = config.Prefix
+			if multiple {
+				prefix += "_" + strings.TrimSuffix(base, filepath.Ext(base))
+			}
+		}
+		add(input, prefix)
+	}
+
+	rules, err := parsePriorities(config.Priority)
+	if err != nil {
+		return nil, err
+	}
+	sortByPriority(inputs, rules)
+	return inputs, nil
+}
+
+func walkInputDir(config ChunkConfig, root string, add func(p, prefix string)) error {
+	// Never feed our own output back in when it lives inside the input tree
+	outputAbs, _ := filepath.Abs(config.OutputDir)
+
+	err := fs.WalkDir(config.filesystem(), root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if abs, _ := filepath.Abs(p); abs == outputAbs {
+				logSkipped(p, "output directory")
+				return fs.SkipDir
+			}
+			if matchAnyGlob(config.Exclude, rel) {
+				logSkipped(p, "excluded")
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			logSkipped(p, "not a regular file")
+			return nil
+		}
+		if len(config.Include) > 0 && !matchAnyGlob(config.Include, rel) {
+			logSkipped(p, "not included")
+			return nil
+		}
+		if matchAnyGlob(config.Exclude, rel) {
+			logSkipped(p, "excluded")
+			return nil
+		}
+
+		prefix := strings.ReplaceAll(strings.TrimSuffix(rel, path.Ext(rel)), "/", "_")
+		if config.Prefix != "" {
+			prefix = config.Prefix + "_" + prefix
+		}
+		add(p, prefix)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking input directory: %v", err)
+	}
+
+	return nil
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the slash-separated name matches pattern.
+// It extends path.Match with "**", which matches zero or more path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated "**" and try every possible split point
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
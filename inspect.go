@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// inspectSource summarizes the chunks of one source in a manifest.
+type inspectSource struct {
+	Path     string `json:"path"`
+	Chunks   int    `json:"chunks"`
+	Bytes    int    `json:"bytes"`
+	MinBytes int    `json:"min_bytes"`
+	MaxBytes int    `json:"max_bytes"`
+	First    int    `json:"first_chunk"`
+	Last     int    `json:"last_chunk"`
+}
+
+type inspectReport struct {
+	Build       BuildInfo       `json:"build"`
+	CreatedAt   string          `json:"created_at"`
+	ChunkType   string          `json:"chunk_type"`
+	ChunkSize   int             `json:"chunk_size"`
+	OverlapSize int             `json:"overlap"`
+	Stats       RunStats        `json:"stats"`
+	Sources     []inspectSource `json:"sources"`
+}
+
+// inspectChunk is one chunk with its manifest entry.
+type inspectChunk struct {
+	ManifestChunk
+	Content string `json:"content"`
+}
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory of chunk files with a manifest (required)")
+	manifestPath := fs.String("manifest", "", "Manifest describing the chunks (default: manifest.json in the input directory)")
+	index := fs.Int("chunk", -1, "Show this chunk's manifest entry and content instead of a summary")
+	asJSON := fs.Bool("json", false, "Print as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s inspect -input ./chunks [-chunk N] [-json]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Summarize a chunk set from its manifest, or show one chunk.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *input == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*input, manifestFilename)
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+
+	if *index >= 0 {
+		return inspectOneChunk(*input, m, *index, *asJSON)
+	}
+
+	report := summarizeManifest(m)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Printf("Manifest: %s\n", *manifestPath)
+	fmt.Printf("Written by: %s\n", report.Build)
+	fmt.Printf("Created: %s\n", report.CreatedAt)
+	fmt.Printf("Chunking: %s, size %d, overlap %d\n", report.ChunkType, report.ChunkSize, report.OverlapSize)
+	fmt.Printf("Summary: %d chunks, %d bytes, %d tokens (%d overlap tokens)\n\n",
+		report.Stats.Chunks, report.Stats.Bytes, report.Stats.Tokens, report.Stats.OverlapTokens)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tCHUNKS\tINDEXES\tBYTES\tMIN\tMAX")
+	for _, s := range report.Sources {
+		fmt.Fprintf(tw, "%s\t%d\t%d-%d\t%d\t%d\t%d\n", s.Path, s.Chunks, s.First, s.Last, s.Bytes, s.MinBytes, s.MaxBytes)
+	}
+	return tw.Flush()
+}
+
+func summarizeManifest(m *Manifest) inspectReport {
+	report := inspectReport{
+		Build:       m.Build,
+		CreatedAt:   m.CreatedAt.Format("2006-01-02 15:04:05 MST"),
+		ChunkType:   m.ChunkType,
+		ChunkSize:   m.ChunkSize,
+		OverlapSize: m.OverlapSize,
+		Stats:       m.Stats,
+		Sources:     []inspectSource{},
+	}
+	if report.Build.Version == "" {
+		report.Build.Version = "unknown"
+	}
+
+	bySource := map[string]int{}
+	for _, source := range m.Sources {
+		bySource[source] = len(report.Sources)
+		report.Sources = append(report.Sources, inspectSource{Path: source})
+	}
+	for _, chunk := range m.Chunks {
+		i, ok := bySource[chunk.Source]
+		if !ok {
+			i = len(report.Sources)
+			bySource[chunk.Source] = i
+			report.Sources = append(report.Sources, inspectSource{Path: chunk.Source})
+		}
+		s := &report.Sources[i]
+		if s.Chunks == 0 {
+			s.First, s.MinBytes = chunk.Index, chunk.Bytes
+		}
+		s.Chunks++
+		s.Bytes += chunk.Bytes
+		s.MinBytes = min(s.MinBytes, chunk.Bytes)
+		s.MaxBytes = max(s.MaxBytes, chunk.Bytes)
+		s.Last = chunk.Index
+	}
+	return report
+}
+
+func inspectOneChunk(dir string, m *Manifest, index int, asJSON bool) error {
+	for _, chunk := range m.Chunks {
+		if chunk.Index != index {
+			continue
+		}
+		content, err := readChunkContent(dir, chunk)
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(inspectChunk{ManifestChunk: chunk, Content: content})
+		}
+		fmt.Printf("Chunk %d: %s\n", chunk.Index, chunk.File)
+		fmt.Printf("Source: %s\n", chunk.Source)
+		fmt.Printf("Range: %d-%d (%s), overlap %d\n", chunk.Start, chunk.End, m.ChunkType, chunk.Overlap)
+		fmt.Printf("Size: %d bytes, %d tokens\n", chunk.Bytes, len(tokenSpans(content)))
+		fmt.Printf("SHA-256: %s\n", chunk.SHA256)
+		if len(chunk.Questions) > 0 {
+			fmt.Printf("Questions:\n- %s\n", strings.Join(chunk.Questions, "\n- "))
+		}
+		fmt.Printf("\n%s", content)
+		if !strings.HasSuffix(content, "\n") {
+			fmt.Println()
+		}
+		return nil
+	}
+	return fmt.Errorf("the manifest has no chunk %d", index)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonlRecord is one line of JSONL output.
+type jsonlRecord struct {
+	Index      int             `json:"index"`
+	Source     string          `json:"source"`
+	File       string          `json:"file"`
+	Type       string          `json:"type"`
+	Start      int             `json:"start"`
+	End        int             `json:"end"`
+	Overlap    int             `json:"overlap"`
+	Tokens     int             `json:"tokens"`
+	Content    string          `json:"content"`
+	TimeStart  string          `json:"time_start,omitempty"`
+	TimeEnd    string          `json:"time_end,omitempty"`
+	References []codeReference `json:"references,omitempty"`
+	Questions  []string        `json:"questions,omitempty"`
+
+	DuplicateOf int     `json:"duplicate_of,omitempty"`
+	Similarity  float64 `json:"similarity,omitempty"`
+
+	Embedding []float32 `json:"embedding,omitempty"`
+
+	Meta  map[string]string `json:"meta,omitempty"`
+	Git   *chunkGit         `json:"git,omitempty"`
+	Cells *cellRange        `json:"cells,omitempty"`
+}
+
+func newJSONLRecord(chunk *Chunk) jsonlRecord {
+	return jsonlRecord{
+		Index:      chunk.Index,
+		Source:     chunk.Source,
+		File:       chunk.Filename,
+		Type:       chunk.Type,
+		Start:      chunk.Start,
+		End:        chunk.End,
+		Overlap:    chunk.Overlap,
+		Tokens:     chunk.Tokens,
+		Content:    chunk.Content,
+		TimeStart:  chunk.TimeStart,
+		TimeEnd:    chunk.TimeEnd,
+		References: chunk.References,
+		Questions:  chunk.Questions,
+
+		DuplicateOf: chunk.DuplicateOf,
+		Similarity:  chunk.Similarity,
+
+		Embedding: chunk.Embedding,
+
+		Meta:  chunk.Meta,
+		Git:   chunk.Git,
+		Cells: chunk.Cells,
+	}
+}
+
+// langchainDocument is a line of -format langchain: a LangChain Document,
+// with the chunk's flat metadata.
+type langchainDocument struct {
+	PageContent string         `json:"page_content"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+func newLangChainDocument(chunk *Chunk) any {
+	metadata := flatMetadata(chunk)
+	delete(metadata, "content")
+	return langchainDocument{PageContent: chunk.Content, Metadata: metadata}
+}
+
+// jsonlWriter writes one JSON object per chunk and line, the chunk's
+// record.
+type jsonlWriter struct {
+	filename string
+	file     io.WriteCloser
+	w        *bufio.Writer
+	enc      *json.Encoder
+	record   func(chunk *Chunk) any
+}
+
+func newJSONLWriter(fsys FS, filename string) (*jsonlWriter, error) {
+	return newRecordWriter(fsys, filename, func(chunk *Chunk) any { return newJSONLRecord(chunk) })
+}
+
+// newLangChainWriter writes -format langchain, JSONL whose lines LangChain's
+// JSON loaders read as Documents.
+func newLangChainWriter(fsys FS, filename string) (*jsonlWriter, error) {
+	return newRecordWriter(fsys, filename, newLangChainDocument)
+}
+
+func newRecordWriter(fsys FS, filename string, record func(chunk *Chunk) any) (*jsonlWriter, error) {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating JSONL file: %v", err)
+	}
+	w := bufio.NewWriter(file)
+	return &jsonlWriter{filename: filename, file: file, w: w, enc: json.NewEncoder(w), record: record}, nil
+}
+
+func (w *jsonlWriter) WriteChunk(chunk *Chunk) error {
+	if err := w.enc.Encode(w.record(chunk)); err != nil {
+		return fmt.Errorf("error writing JSONL file: %v", err)
+	}
+
+	logChunk(chunk, trf("line in %s", w.filename))
+	return nil
+}
+
+func (w *jsonlWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error writing JSONL file: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error closing JSONL file: %v", err)
+	}
+	return nil
+}
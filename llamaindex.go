@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LlamaIndex's NodeRelationship and ObjectType values.
+const (
+	llamaSource   = "1"
+	llamaPrevious = "2"
+	llamaNext     = "3"
+
+	llamaText     = "1"
+	llamaDocument = "4"
+)
+
+// llamaNode is a line of -format llamaindex: a LlamaIndex TextNode as
+// TextNode.from_json reads it.
+type llamaNode struct {
+	ID                string                      `json:"id_"`
+	Embedding         []float32                   `json:"embedding"`
+	Metadata          map[string]any              `json:"metadata"`
+	ExcludedEmbedKeys []string                    `json:"excluded_embed_metadata_keys"`
+	ExcludedLLMKeys   []string                    `json:"excluded_llm_metadata_keys"`
+	Relationships     map[string]llamaRelatedNode `json:"relationships"`
+	Text              string                      `json:"text"`
+	StartCharIdx      *int                        `json:"start_char_idx"`
+	EndCharIdx        *int                        `json:"end_char_idx"`
+	TextTemplate      string                      `json:"text_template"`
+	MetadataTemplate  string                      `json:"metadata_template"`
+	MetadataSeparator string                      `json:"metadata_seperator"` // sic
+	ClassName         string                      `json:"class_name"`
+}
+
+type llamaRelatedNode struct {
+	NodeID    string         `json:"node_id"`
+	NodeType  string         `json:"node_type"`
+	Metadata  map[string]any `json:"metadata"`
+	Hash      *string        `json:"hash"`
+	ClassName string         `json:"class_name"`
+}
+
+// llamaIndexWriter writes -format llamaindex: JSONL of TextNodes whose
+// relationships link each chunk to its source document and to the chunks
+// written before and after it from the same source. A chunk is held back
+// until the next one of its source, or the end of the source, says what
+// follows it.
+type llamaIndexWriter struct {
+	filename string
+	file     io.WriteCloser
+	w        *bufio.Writer
+	enc      *json.Encoder
+	pending  *llamaNode // the last chunk, waiting for its next
+	previous string     // ID of the chunk before it from the same source
+	source   string
+}
+
+func newLlamaIndexWriter(fsys FS, filename string) (*llamaIndexWriter, error) {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating LlamaIndex file: %v", err)
+	}
+	w := bufio.NewWriter(file)
+	return &llamaIndexWriter{filename: filename, file: file, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// newLlamaNode returns the node of chunk. Only its source goes into the
+// text that is embedded or given to an LLM; the rest of the metadata is
+// excluded from both. Char chunks are in bytes, not the characters
+// start_char_idx counts, so the indices are left out.
+func newLlamaNode(chunk *Chunk) *llamaNode {
+	metadata := flatMetadata(chunk)
+	delete(metadata, "content")
+	var excluded []string
+	for key := range metadata {
+		if key != "source" {
+			excluded = append(excluded, key)
+		}
+	}
+	sort.Strings(excluded)
+	return &llamaNode{
+		ID:                chunkUUID(chunk),
+		Embedding:         chunk.Embedding,
+		Metadata:          metadata,
+		ExcludedEmbedKeys: excluded,
+		ExcludedLLMKeys:   excluded,
+		Relationships: map[string]llamaRelatedNode{
+			llamaSource: newLlamaRelatedNode(nameUUID(chunk.Source), llamaDocument, map[string]any{"source": chunk.Source}),
+		},
+		Text:              chunk.Content,
+		TextTemplate:      "{metadata_str}\n\n{content}",
+		MetadataTemplate:  "{key}: {value}",
+		MetadataSeparator: "\n",
+		ClassName:         "TextNode",
+	}
+}
+
+func newLlamaRelatedNode(id, nodeType string, metadata map[string]any) llamaRelatedNode {
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	return llamaRelatedNode{NodeID: id, NodeType: nodeType, Metadata: metadata, ClassName: "RelatedNodeInfo"}
+}
+
+func (w *llamaIndexWriter) WriteChunk(chunk *Chunk) error {
+	node := newLlamaNode(chunk)
+	if w.pending != nil && chunk.Source == w.source {
+		w.pending.Relationships[llamaNext] = newLlamaRelatedNode(node.ID, llamaText, nil)
+		w.previous = w.pending.ID
+	} else {
+		w.previous = ""
+	}
+	if err := w.writePending(); err != nil {
+		return err
+	}
+	if w.previous != "" {
+		node.Relationships[llamaPrevious] = newLlamaRelatedNode(w.previous, llamaText, nil)
+	}
+	w.pending, w.source = node, chunk.Source
+
+	logChunk(chunk, trf("node in %s", w.filename))
+	return nil
+}
+
+func (w *llamaIndexWriter) writePending() error {
+	if w.pending == nil {
+		return nil
+	}
+	if err := w.enc.Encode(w.pending); err != nil {
+		return fmt.Errorf("error writing LlamaIndex file: %v", err)
+	}
+	w.pending = nil
+	return nil
+}
+
+func (w *llamaIndexWriter) Close() error {
+	err := w.writePending()
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err != nil {
+		w.file.Close()
+		return fmt.Errorf("error writing LlamaIndex file: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error closing LlamaIndex file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultChatEndpoint = "https://api.openai.com/v1/chat/completions"
+
+// completer is a chat model that answers a prompt: chatClient or
+// anthropicClient.
+type completer interface {
+	Complete(system, prompt string) (string, error)
+}
+
+// chatProvider is a process -provider: the endpoint and model used unless
+// -endpoint and -model say otherwise.
+type chatProvider struct {
+	endpoint string
+	model    string
+}
+
+var chatProviders = map[string]chatProvider{
+	"openai":    {endpoint: defaultChatEndpoint, model: "gpt-4o-mini"},
+	"anthropic": {endpoint: "https://api.anthropic.com/v1/messages", model: "claude-sonnet-4-5"},
+}
+
+// newCompleter returns the client of a chat provider.
+func newCompleter(provider, endpoint, model, apiKey string, maxTokens, retries int) completer {
+	if provider == "anthropic" {
+		c := newAnthropicClient(endpoint, model, apiKey, maxTokens)
+		c.retries = retries
+		return c
+	}
+	c := newChatClient(endpoint, model, apiKey)
+	c.maxTokens, c.retries = maxTokens, retries
+	return c
+}
+
+// chatClient talks to an OpenAI-compatible chat completions endpoint. Local
+// servers such as Ollama, vLLM and llama.cpp expose the same API.
+type chatClient struct {
+	endpoint  string
+	model     string
+	apiKey    string
+	client    *http.Client
+	retries   int // times a request that failed with a network error, 429 or 5xx is retried
+	maxTokens int // longest answer, 0 for the endpoint's default
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model     string        `json:"model"`
+	Messages  []chatMessage `json:"messages"`
+	MaxTokens int           `json:"max_tokens,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newChatClient(endpoint, model, apiKey string) *chatClient {
+	if endpoint == "" {
+		endpoint = defaultChatEndpoint
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	return &chatClient{
+		endpoint: endpoint,
+		model:    model,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (c *chatClient) Complete(system, prompt string) (string, error) {
+	var messages []chatMessage
+	if system != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: system})
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: prompt})
+
+	if err := activePolicy.allowURL(c.endpoint); err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(chatRequest{Model: c.model, Messages: messages, MaxTokens: c.maxTokens})
+	if err != nil {
+		return "", fmt.Errorf("error encoding chat request: %v", err)
+	}
+
+	var content string
+	tokens := len(tokenize(system+"\n"+prompt)) + c.maxTokens
+	_, err = withRetries("chat", c.retries, tokens, func() (int, time.Duration, error) {
+		var status int
+		var wait time.Duration
+		content, status, wait, err = c.send(body)
+		return status, wait, err
+	})
+	return content, err
+}
+
+// send makes one chat request, returning the answer, or the HTTP status and
+// how long the endpoint asked to wait before trying again.
+func (c *chatClient) send(body []byte) (content string, status int, wait time.Duration, err error) {
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error creating chat request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error calling chat endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("error reading chat response: %v", err)
+	}
+
+	var parsed chatResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", resp.StatusCode, retryAfter(resp), fmt.Errorf("error decoding chat response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if parsed.Error != nil {
+		return "", resp.StatusCode, retryAfter(resp), fmt.Errorf("chat endpoint returned an error: %s", parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode, retryAfter(resp), fmt.Errorf("chat endpoint returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if len(parsed.Choices) == 0 {
+		return "", resp.StatusCode, 0, fmt.Errorf("chat endpoint returned no choices")
+	}
+
+	return parsed.Choices[0].Message.Content, resp.StatusCode, 0, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+)
+
+// logJSON switches console output from human-readable text to one NDJSON
+// event per line (-log-format json), so that orchestrators can follow a run
+// without scraping messages.
+var logJSON bool
+
+// consoleLevel is the least severe console output shown (-log-level,
+// -quiet, -verbose). Events and decoration are info; warnings and errors
+// have their own levels, and debug events explain the chunker's decisions.
+var consoleLevel = levelInfo
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{"debug": levelDebug, "info": levelInfo, "warn": levelWarn, "error": levelError}
+
+// applyConsole applies the console options of config: -lang, -log-format,
+// and -log-level or -quiet and -verbose.
+func (config ChunkConfig) applyConsole() error {
+	if err := setLang(config.Lang); err != nil {
+		return err
+	}
+	switch config.LogFormat {
+	case "text":
+	case "json":
+		logJSON = true
+	default:
+		return fmt.Errorf(tr("Invalid log format %q. Must be: text or json"), config.LogFormat)
+	}
+	return setLogLevel(config.LogLevel, config.Quiet, config.Verbose)
+}
+
+// setLogLevel applies -log-level, which -quiet (warn) and -verbose (debug)
+// abbreviate.
+func setLogLevel(name string, quiet, verbose bool) error {
+	switch {
+	case quiet && verbose:
+		return errors.New(tr("-quiet and -verbose cannot be combined"))
+	case quiet:
+		name = "warn"
+	case verbose:
+		name = "debug"
+	}
+	level, ok := logLevels[name]
+	if !ok {
+		return fmt.Errorf(tr("Invalid log level %q. Must be: debug, info, warn, or error"), name)
+	}
+	consoleLevel = level
+	return nil
+}
+
+// logEvent reports an event. In text mode only message is printed, and
+// events without a message stay silent; in JSON mode the event is written
+// with its fields, a timestamp and the message.
+func logEvent(name, message string, fields map[string]any) {
+	if consoleLevel > levelInfo {
+		return
+	}
+	writeEvent(name, message, fields)
+}
+
+// logDebug reports a decision of the chunker, such as where a boundary was
+// placed, for -verbose runs. Its messages are not translated.
+func logDebug(name, message string, fields map[string]any) {
+	if consoleLevel > levelDebug {
+		return
+	}
+	if logJSON {
+		fields = maps.Clone(fields)
+		if fields == nil {
+			fields = map[string]any{}
+		}
+		fields["level"] = "debug"
+	} else {
+		message = "debug: " + message
+	}
+	writeEvent(name, message, fields)
+}
+
+func writeEvent(name, message string, fields map[string]any) {
+	if !logJSON {
+		if message != "" {
+			fmt.Fprintln(console, message)
+		}
+		return
+	}
+
+	record := map[string]any{"time": time.Now().UTC().Format(time.RFC3339Nano), "event": name}
+	if message != "" {
+		record["message"] = message
+	}
+	for k, v := range fields {
+		record[k] = v
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{"event": name, "message": message, "error": err.Error()})
+	}
+	fmt.Fprintf(console, "%s\n", data)
+}
+
+// textf prints decoration that only makes sense to people, such as the run
+// header and blank separator lines; JSON mode drops it.
+func textf(format string, args ...any) {
+	if !logJSON && consoleLevel <= levelInfo {
+		fmt.Fprintf(console, tr(format), args...)
+	}
+}
+
+// logChunk reports a chunk written by a sink; detail says where it went.
+func logChunk(chunk *Chunk, detail string) {
+	if runProgress != nil {
+		return
+	}
+	logEvent("chunk_created", trf("Created chunk %d: %s", chunk.Index, detail), map[string]any{
+		"index":  chunk.Index,
+		"source": chunk.Source,
+		"file":   chunk.Filename,
+		"type":   chunk.Type,
+		"start":  chunk.Start,
+		"end":    chunk.End,
+	})
+}
+
+// logSkipped reports an input that is not chunked. Skips are routine, so
+// text mode keeps quiet about them.
+func logSkipped(path, reason string) {
+	logEvent("file_skipped", "", map[string]any{"path": path, "reason": reason})
+}
+
+// logWarning reports a problem that does not stop the run. Text warnings go
+// to stderr.
+func logWarning(message string, fields map[string]any) {
+	runReport.warning(message)
+	if consoleLevel > levelWarn {
+		return
+	}
+	if !logJSON {
+		fmt.Fprintln(os.Stderr, trf("Warning: %s", message))
+		return
+	}
+	writeEvent("warning", message, fields)
+}
+
+// fatalf reports a translated error and exits.
+func fatalf(format string, args ...any) {
+	message := trf(format, args...)
+	if logJSON {
+		writeEvent("error", message, nil)
+	} else {
+		fmt.Fprintln(os.Stderr, trf("Error: %s", message))
+	}
+	os.Exit(1)
+}
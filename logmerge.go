@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// mergedLogSource is the path of the merged stream -merge-logs chunks in
+// place of its inputs. It exists only in the mergedLogFS.
+const mergedLogSource = "merged.log"
+
+// mergeLogInputs implements -merge-logs: it replaces the inputs with one
+// stream of all their lines in timestamp order, read through a mergedLogFS
+// installed in the returned config.
+func mergeLogInputs(config ChunkConfig, inputs []inputFile) (ChunkConfig, []inputFile, error) {
+	parser, err := newTimestampParser(config)
+	if err != nil {
+		return config, nil, err
+	}
+
+	// A watch merges again on every change
+	base := config.filesystem()
+	if merged, ok := base.(*mergedLogFS); ok {
+		base = merged.FS
+	}
+	config.FS = &mergedLogFS{FS: base, sources: inputs, tags: logTags(inputs), parser: parser, encoding: config.Encoding}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = "merged"
+	}
+	return config, []inputFile{{Path: mergedLogSource, Prefix: prefix}}, nil
+}
+
+// chunkLinesByTime implements -time-window: line chunks start wherever a
+// log timestamp enters a new window, and within a window every -size lines.
+// Windows are aligned to the wall clock in the -timezone, so 1h windows
+// start on the hour. Lines without a timestamp stay in the window above.
+func (c *Chunker) chunkLinesByTime() error {
+	parser, err := newTimestampParser(c.config)
+	if err != nil {
+		return err
+	}
+	file, err := c.openInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file, int64(c.config.MaxMemory))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var cuts []int
+	var window time.Time
+	last := 0
+	for i, line := range lines {
+		if t, ok := parser.parse(line); ok {
+			_, offset := t.In(parser.outputZone).Zone()
+			if start := t.Add(time.Duration(offset) * time.Second).Truncate(c.config.TimeWindow); !start.Equal(window) {
+				window = start
+				logDebug("window_started", fmt.Sprintf("line %d starts the window at %s", i+1, parser.format(start.Add(-time.Duration(offset)*time.Second))), map[string]any{"line": i + 1})
+				if i > last {
+					cuts, last = append(cuts, i), i
+				}
+			}
+		}
+		if i-last >= c.config.ChunkSize {
+			cuts, last = append(cuts, i), i
+		}
+	}
+	return c.chunkAtCuts(boundaryCuts(cuts, len(lines)), unitsBack, func(number, start, end, overlap int) error {
+		return c.writeChunk(lines[start:end], number, start+1, end, overlap)
+	})
+}
+
+// logTags names each input in the [tag] before its merged lines: the file
+// name, or the whole path where file names repeat.
+func logTags(inputs []inputFile) []string {
+	bases := map[string]int{}
+	for _, input := range inputs {
+		bases[filepath.Base(input.Path)]++
+	}
+	tags := make([]string, len(inputs))
+	for i, input := range inputs {
+		tags[i] = filepath.Base(input.Path)
+		if bases[tags[i]] > 1 {
+			tags[i] = input.Path
+		}
+	}
+	return tags
+}
+
+// mergedLogFS serves the merged stream of its sources at mergedLogSource
+// and passes every other path on to the underlying FS. The stream is merged
+// as it is read, so the sources are never held in memory whole.
+type mergedLogFS struct {
+	FS
+	sources  []inputFile
+	tags     []string
+	parser   *timestampParser
+	encoding string
+}
+
+func (m *mergedLogFS) Open(name string) (fs.File, error) {
+	if name != mergedLogSource {
+		return m.FS.Open(name)
+	}
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &mergedLog{info: info}
+	for i, source := range m.sources {
+		file, err := m.FS.Open(source.Path)
+		if err != nil {
+			merged.Close()
+			return nil, err
+		}
+		decoded, _ := decodeInput(file, m.encoding)
+		s := &logSource{tag: m.tags[i], order: i, in: bufio.NewReader(decoded), parser: m.parser}
+		merged.files = append(merged.files, file)
+		if err := s.advance(); err != nil {
+			merged.Close()
+			return nil, err
+		}
+		if len(s.entry) > 0 {
+			heap.Push(&merged.queue, s)
+		}
+	}
+	return merged, nil
+}
+
+// Stat describes the merged stream by the total size and latest
+// modification of its sources, so that it changes whenever one of them does.
+func (m *mergedLogFS) Stat(name string) (fs.FileInfo, error) {
+	if name != mergedLogSource {
+		return m.FS.Stat(name)
+	}
+	info := mergedLogInfo{}
+	for _, source := range m.sources {
+		sourceInfo, err := m.FS.Stat(source.Path)
+		if err != nil {
+			return nil, err
+		}
+		info.size += sourceInfo.Size()
+		if sourceInfo.ModTime().After(info.modTime) {
+			info.modTime = sourceInfo.ModTime()
+		}
+	}
+	return info, nil
+}
+
+func (m *mergedLogFS) ReadFile(name string) ([]byte, error) {
+	if name != mergedLogSource {
+		return m.FS.ReadFile(name)
+	}
+	file, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+type mergedLogInfo struct {
+	size    int64
+	modTime time.Time
+}
+
+func (i mergedLogInfo) Name() string       { return mergedLogSource }
+func (i mergedLogInfo) Size() int64        { return i.size }
+func (i mergedLogInfo) Mode() fs.FileMode  { return 0444 }
+func (i mergedLogInfo) ModTime() time.Time { return i.modTime }
+func (i mergedLogInfo) IsDir() bool        { return false }
+func (i mergedLogInfo) Sys() any           { return nil }
+
+// logSource reads one input a log entry at a time: a line with a timestamp
+// and the lines without one that follow it, such as a stack trace.
+type logSource struct {
+	tag     string
+	order   int
+	in      *bufio.Reader
+	parser  *timestampParser
+	entry   []string
+	time    time.Time
+	pending *string // first line of the next entry
+	eof     bool
+	err     error
+}
+
+// advance reads the next entry into entry, which is left empty at the end
+// of the input. Lines before the first timestamp form an entry at the zero
+// time, so they come out first.
+func (s *logSource) advance() error {
+	s.entry = s.entry[:0]
+	var line string
+	if s.pending != nil {
+		line, s.pending = *s.pending, nil
+	} else {
+		var ok bool
+		if line, ok = s.readLine(); !ok {
+			return s.err
+		}
+	}
+	s.entry = append(s.entry, line)
+	s.time, _ = s.parser.parse(line)
+
+	for {
+		next, ok := s.readLine()
+		if !ok {
+			return s.err
+		}
+		if _, stamped := s.parser.parse(next); stamped {
+			s.pending = &next
+			return nil
+		}
+		s.entry = append(s.entry, next)
+	}
+}
+
+func (s *logSource) readLine() (string, bool) {
+	if s.eof || s.err != nil {
+		return "", false
+	}
+	line, err := s.in.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			s.eof = true
+		} else {
+			s.err = fmt.Errorf("error reading file: %v", err)
+		}
+		if line == "" {
+			return "", false
+		}
+	}
+	return line[:len(line)-len(lineTerminator(line))], true
+}
+
+// logQueue orders sources by the time of their next entry, then by input
+// order, so entries with equal times keep the order of the inputs.
+type logQueue []*logSource
+
+func (q logQueue) Len() int { return len(q) }
+func (q logQueue) Less(i, j int) bool {
+	if !q[i].time.Equal(q[j].time) {
+		return q[i].time.Before(q[j].time)
+	}
+	return q[i].order < q[j].order
+}
+func (q logQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *logQueue) Push(x any)   { *q = append(*q, x.(*logSource)) }
+func (q *logQueue) Pop() any {
+	old := *q
+	s := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return s
+}
+
+// mergedLog is the open merged stream. Every line is tagged with its
+// source, which counts as a change by the merge-logs transform.
+type mergedLog struct {
+	info  fs.FileInfo
+	files []io.Closer
+	queue logQueue
+	out   bytes.Buffer
+	count func(lines int)
+	err   error
+}
+
+func (m *mergedLog) Read(p []byte) (int, error) {
+	for m.out.Len() == 0 && m.err == nil {
+		if m.queue.Len() == 0 {
+			m.err = io.EOF
+			break
+		}
+		s := m.queue[0]
+		for _, line := range s.entry {
+			fmt.Fprintf(&m.out, "[%s] %s\n", s.tag, line)
+		}
+		if m.count != nil {
+			m.count(len(s.entry))
+		}
+		if err := s.advance(); err != nil {
+			m.err = err
+			break
+		}
+		if len(s.entry) > 0 {
+			heap.Fix(&m.queue, 0)
+		} else {
+			heap.Pop(&m.queue)
+		}
+	}
+	if m.out.Len() > 0 {
+		return m.out.Read(p)
+	}
+	return 0, m.err
+}
+
+func (m *mergedLog) Stat() (fs.FileInfo, error) {
+	return m.info, nil
+}
+
+func (m *mergedLog) Close() error {
+	var err error
+	for _, file := range m.files {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
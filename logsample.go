@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// logLevelPattern finds the severity of a log line: a level=... or
+// "level":"..." field, or an upper-case level word.
+var logLevelPattern = regexp.MustCompile(`(?i:\blevel"?\s*[=:]\s*"?([a-z]+))|\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|CRITICAL|PANIC)\b`)
+
+// logLevel returns the lower-case severity of a log line, or "" if it has
+// none, as continuation lines such as stack traces do.
+func logLevel(line string) string {
+	m := logLevelPattern.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	level := strings.ToLower(m[1] + m[2])
+	switch level {
+	case "warning":
+		return "warn"
+	case "err":
+		return "error"
+	}
+	return level
+}
+
+// parseSampleLevels parses -sample-levels, a comma-separated list of levels.
+func parseSampleLevels(list string) map[string]bool {
+	levels := map[string]bool{}
+	for _, level := range strings.Split(list, ",") {
+		if level = strings.ToLower(strings.TrimSpace(level)); level != "" {
+			levels[level] = true
+		}
+	}
+	return levels
+}
+
+// sampleLogLevels keeps only a fraction rate of the log entries at the given
+// levels (-sample-rate, -sample-levels) and every other entry, so ERROR and
+// WARN lines all survive while INFO and DEBUG noise is thinned out. Lines
+// without a level belong to the entry above them. Sampling is evenly spaced
+// rather than random, so a rerun produces the same chunks. The dropped lines
+// count as changed.
+func sampleLogLevels(rate float64, levels map[string]bool) func(r io.Reader, count func(lines int)) io.Reader {
+	return func(r io.Reader, count func(lines int)) io.Reader {
+		keep := true
+		seen := 0
+		return newLineReader(r, func(out *bytes.Buffer, line string, eof bool) {
+			if eof {
+				return
+			}
+			if level := logLevel(line); level != "" {
+				keep = true
+				if levels[level] {
+					// Keep entry n when the running total n*rate crosses a whole number
+					keep = int(float64(seen+1)*rate) > int(float64(seen)*rate)
+					seen++
+				}
+			}
+			if !keep {
+				count(1)
+				return
+			}
+			fmt.Fprintln(out, line)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// lineScanner reads lines like bufio.Scanner, with \n or \r\n removed, but
+// has no limit on the length of a line unless one is given (-max-memory):
+// minified code and JSONL records can be megabytes long.
+type lineScanner struct {
+	in    *bufio.Reader
+	limit int64 // longest line in bytes, 0 for no limit
+	lines int
+	line  string
+	err   error
+	eof   bool
+}
+
+func newLineScanner(r io.Reader, limit int64) *lineScanner {
+	return &lineScanner{in: bufio.NewReader(r), limit: limit}
+}
+
+func (s *lineScanner) Scan() bool {
+	if s.eof || s.err != nil {
+		return false
+	}
+	var line []byte
+	for {
+		part, err := s.in.ReadSlice('\n')
+		line = append(line, part...)
+		if s.limit > 0 && int64(len(line)) > s.limit {
+			s.err = fmt.Errorf("line %d is longer than the -max-memory of %s; -max-line splits long lines", s.lines+1, formatBytes(s.limit))
+			return false
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			s.err = err
+			return false
+		}
+		break
+	}
+	if s.eof && len(line) == 0 {
+		return false
+	}
+	s.lines++
+	text := string(line)
+	s.line = text[:len(text)-len(lineTerminator(text))]
+	return true
+}
+
+func (s *lineScanner) Text() string {
+	return s.line
+}
+
+// Err returns the first read error; the end of the input is not one.
+func (s *lineScanner) Err() error {
+	return s.err
+}
+
+// splitLongLines hard-splits lines longer than limit chars or tokens
+// (-max-line) into several lines, at whitespace where there is some near the
+// limit. Each split line counts as changed.
+func splitLongLines(limit int, unit string) func(r io.Reader, count func(lines int)) io.Reader {
+	return func(r io.Reader, count func(lines int)) io.Reader {
+		return newLineReader(r, func(out *bytes.Buffer, line string, eof bool) {
+			if eof {
+				return
+			}
+			pieces := splitLine(line, limit, unit)
+			if len(pieces) > 1 {
+				count(1)
+			}
+			for _, piece := range pieces {
+				out.WriteString(piece)
+				out.WriteByte('\n')
+			}
+		})
+	}
+}
+
+// splitLine cuts line into pieces of at most limit bytes, or limit tokens
+// for the tokens unit. A token piece runs from the start of its first token
+// to the start of the next piece, so the pieces join back into the line.
+func splitLine(line string, limit int, unit string) []string {
+	if unit == "tokens" {
+		spans := tokenSpans(line)
+		if len(spans) <= limit {
+			return []string{line}
+		}
+		var pieces []string
+		start := 0
+		for i := limit; i < len(spans); i += limit {
+			pieces = append(pieces, line[start:spans[i][0]])
+			start = spans[i][0]
+		}
+		return append(pieces, line[start:])
+	}
+
+	var pieces []string
+	for len(line) > limit {
+		end := wordBoundary(line, 0, limit)
+		pieces = append(pieces, line[:end])
+		line = line[end:]
+	}
+	return append(pieces, line)
+}
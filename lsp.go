@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lspClient is a minimal Language Server Protocol client (-lsp): just
+// enough to open a document in a server such as gopls or pyright and ask
+// for its symbols, whose ranges then decide where code chunks start.
+type lspClient struct {
+	command string
+	cmd     *exec.Cmd
+	in      io.WriteCloser
+	out     *bufio.Reader
+	nextID  int
+}
+
+// lspLanguages maps file extensions to LSP language identifiers.
+var lspLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".jsx": "javascriptreact",
+	".ts": "typescript", ".tsx": "typescriptreact", ".rs": "rust", ".java": "java",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp", ".cs": "csharp",
+	".rb": "ruby", ".php": "php", ".kt": "kotlin", ".swift": "swift", ".lua": "lua",
+}
+
+// startLSP starts the server command, e.g. "gopls" or
+// "pyright-langserver --stdio", and initializes it with the current
+// directory as the workspace.
+func startLSP(command string) (*lspClient, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty -lsp command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = io.Discard
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error starting language server: %v", err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error starting language server: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting language server %s: %v", args[0], err)
+	}
+	c := &lspClient{command: args[0], cmd: cmd, in: in, out: bufio.NewReader(out)}
+
+	root, _ := os.Getwd()
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   fileURI(root),
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"documentSymbol": map[string]any{"hierarchicalDocumentSymbolSupport": true},
+			},
+		},
+	}
+	if err := c.call("initialize", params, nil); err != nil {
+		c.close()
+		return nil, err
+	}
+	if err := c.notify("initialized", map[string]any{}); err != nil {
+		c.close()
+		return nil, err
+	}
+	logDebug("lsp_started", fmt.Sprintf("language server %s started", command), map[string]any{"command": command})
+	return c, nil
+}
+
+// lspRange is a range in a document; lines and characters are 0-based.
+type lspRange struct {
+	Start struct {
+		Line int `json:"line"`
+	} `json:"start"`
+}
+
+// lspSymbol decodes both DocumentSymbol, which has a range, and the older
+// SymbolInformation, which has a location and names its container.
+type lspSymbol struct {
+	Name          string    `json:"name"`
+	Range         *lspRange `json:"range"`
+	ContainerName string    `json:"containerName"`
+	Location      *struct {
+		Range lspRange `json:"range"`
+	} `json:"location"`
+}
+
+// symbolLines returns the 0-based lines where the top-level symbols of
+// text, the content of path, start, in order.
+func (c *lspClient) symbolLines(path, text string) ([]int, error) {
+	language, ok := lspLanguages[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("%s has no known language", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	uri := fileURI(abs)
+	document := map[string]any{"uri": uri}
+	if err := c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": language, "version": 1, "text": text},
+	}); err != nil {
+		return nil, err
+	}
+	defer c.notify("textDocument/didClose", map[string]any{"textDocument": document})
+
+	var symbols []lspSymbol
+	if err := c.call("textDocument/documentSymbol", map[string]any{"textDocument": document}, &symbols); err != nil {
+		return nil, err
+	}
+	var lines []int
+	for _, s := range symbols {
+		switch {
+		case s.Range != nil:
+			lines = append(lines, s.Range.Start.Line)
+		case s.Location != nil && s.ContainerName == "":
+			lines = append(lines, s.Location.Range.Start.Line)
+		}
+	}
+	return lines, nil
+}
+
+// call sends a request and waits for its response, answering the requests
+// the server makes in the meantime.
+func (c *lspClient) call(method string, params, result any) error {
+	c.nextID++
+	id := c.nextID
+	request := map[string]any{"jsonrpc": "2.0", "id": id, "method": method}
+	if params != nil {
+		request["params"] = params
+	}
+	if err := c.send(request); err != nil {
+		return err
+	}
+	for {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := c.receive(&msg); err != nil {
+			return fmt.Errorf("error reading %s response from %s: %v", method, c.command, err)
+		}
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			c.reply(msg.ID, msg.Method, msg.Params)
+		case msg.Method != "":
+			// Notifications such as diagnostics are not needed
+		case string(msg.ID) != strconv.Itoa(id):
+		case msg.Error != nil:
+			return fmt.Errorf("%s %s: %s", c.command, method, msg.Error.Message)
+		default:
+			if result == nil || string(msg.Result) == "null" {
+				return nil
+			}
+			return json.Unmarshal(msg.Result, result)
+		}
+	}
+}
+
+// reply answers a server request with empty results. Configuration requests
+// get one null per item, which servers read as their defaults.
+func (c *lspClient) reply(id json.RawMessage, method string, params json.RawMessage) {
+	var result any
+	if method == "workspace/configuration" {
+		var p struct {
+			Items []any `json:"items"`
+		}
+		json.Unmarshal(params, &p)
+		result = make([]any, len(p.Items))
+	}
+	c.send(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+func (c *lspClient) notify(method string, params any) error {
+	notification := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		notification["params"] = params
+	}
+	return c.send(notification)
+}
+
+func (c *lspClient) send(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("error writing to language server %s: %v", c.command, err)
+	}
+	return nil
+}
+
+func (c *lspClient) receive(msg any) error {
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return fmt.Errorf("invalid Content-Length: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.out, body); err != nil {
+		return err
+	}
+	return json.Unmarshal(body, msg)
+}
+
+// close shuts the server down, killing it if it does not exit in time.
+func (c *lspClient) close() {
+	done := make(chan error, 1)
+	go func() {
+		c.call("shutdown", nil, nil)
+		c.notify("exit", nil)
+		c.in.Close()
+		done <- c.cmd.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.cmd.Process.Kill()
+	}
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// chunkLinesBySymbols implements -lsp: line chunks end between top-level
+// symbols, each holding as many whole symbols as fit in -size lines. A
+// symbol longer than that is split every -size lines. Comments and
+// decorators right above a symbol stay with it. Without symbols, as for a
+// file the server does not support, chunks are cut every -size lines.
+func (c *Chunker) chunkLinesBySymbols() error {
+	file, err := c.openInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := newLineScanner(file, int64(c.config.MaxMemory))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// The server gets the text as chunked, after any transforms
+	starts, err := c.config.LSPClient.symbolLines(c.config.InputFile, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		logWarning(trf("%s: no symbols from the language server, chunking every %d lines: %v", c.config.InputFile, c.config.ChunkSize, err), map[string]any{"path": c.config.InputFile})
+	}
+	for i, start := range starts {
+		start = min(start, len(lines))
+		for start > 0 && isLeadingComment(lines[start-1]) {
+			start--
+		}
+		starts[i] = start
+	}
+	sort.Ints(starts)
+	logDebug("symbols_found", fmt.Sprintf("%d top-level symbols in %s", len(starts), c.config.InputFile), map[string]any{"path": c.config.InputFile, "symbols": len(starts)})
+
+	return c.chunkAtCuts(boundaryCuts(packBoundaries(starts, len(lines), c.config.ChunkSize), len(lines)), unitsBack, func(number, start, end, overlap int) error {
+		return c.writeChunk(lines[start:end], number, start+1, end, overlap)
+	})
+}
+
+func isLeadingComment(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range []string{"//", "#", "/*", "*", "@"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// packBoundaries chooses cuts among the boundaries, sorted positions in
+// [0, n), so that each chunk spans as many boundaries as fit in size units,
+// cutting every size units where no boundary does.
+func packBoundaries(boundaries []int, n, size int) []int {
+	var cuts []int
+	start, last := 0, 0
+	for _, b := range append(append([]int(nil), boundaries...), n) {
+		if b <= start || b > n {
+			continue
+		}
+		if b-start > size && last > start {
+			cuts, start = append(cuts, last), last
+		}
+		for b-start > size {
+			start += size
+			cuts = append(cuts, start)
+		}
+		last = b
+	}
+	return cuts
+}
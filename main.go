@@ -1,44 +1,265 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
-	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 type ChunkConfig struct {
-	InputFile   string
-	OutputDir   string
-	ChunkType   string // "lines", "chars", "tokens"
-	ChunkSize   int
-	OverlapSize int
-	AddMetadata bool
-	Prefix      string
+	Inputs          []string // files or directories given on the command line
+	InputFile       string   // file currently being chunked
+	OutputDir       string
+	ChunkType       string // "lines", "chars", "tokens"
+	Semantic        bool   // char chunks end where the topic shifts (-type semantic), see chunkSemantic
+	Diff            bool   // line chunks start at the files and hunks of a patch (-type diff), see chunkDiff
+	Subtitles       bool   // line chunks of whole SRT or WebVTT cues (-type subtitles), see chunkSubtitles
+	ChunkSize       int
+	SizeBytes       bool          // ChunkSize and OverlapSize of char chunks are in bytes, not runes
+	SizeDuration    time.Duration // -size of subtitle chunks as a duration, see sizeDuration
+	OverlapSize     int
+	OverlapPercent  float64 // -overlap as a percentage of ChunkSize, see resolveOverlap
+	MinSize         int     // a last chunk adding fewer units is merged into the one before it
+	Boundaries      string  // file of chunk start positions replacing ChunkSize
+	Graphemes       bool    // never split a grapheme cluster in char chunks
+	Encoding        string  // of the inputs, see encodings
+	SectionStarts   []int   // lines whole chunks start at where they fit, see export-repo
+	AddMetadata     bool
+	MetadataMode    string // "header", before the content, or "sidecar", in a JSON file next to it
+	ChecksumHeader  bool
+	Prefix          string
+	Include         []string // glob patterns for directory input
+	Exclude         []string
+	Priority        []string // glob=weight rules ordering the inputs
+	Meta            []string // key=value fields every chunk is tagged with, values templates
+	Git             bool     // record the git commit and last commit of each chunk's lines
+	WriteManifest   bool
+	StartIndex      int    // number of the first chunk; runs over several files continue numbering
+	NameTemplate    string // text/template for chunk file names, see chunkName
+	IndexWidth      int    // zero-padding width of {{.Index}}, or indexWidthAuto
+	ChunkTotal      int    // chunks the run writes, counted beforehand for {{.Total}} and -index-width auto
+	Format          string // comma-separated output formats, see formatExtensions
+	Separator       string // separator line template for the concat format
+	ContextHeader   bool   // start each chunk with its source, section and how the previous chunk ended
+	NotebookOutputs bool   // render the outputs of notebook code cells after them
+	PromptTemplate  string // file of the text/template each chunk's content is wrapped in, see promptChunk
+	Prompt          *promptWrapper
+
+	// Pre-chunk transforms, see transforms
+	CollapseRepeats     bool
+	NormalizeWhitespace bool
+	TabWidth            int // spaces per tab stop for NormalizeWhitespace, 0 keeps tabs
+	RedactSecrets       bool
+	Redactions          *redactionLog // what RedactSecrets replaced, for the audit file
+	StripComments       bool          // of code inputs in the languages of commentSyntaxes
+	Grep                []string      // regular expressions of the lines to keep, all lines if empty
+	GrepV               []string      // regular expressions of the lines to drop
+	SampleRate          float64       // fraction of log entries at SampleLevels to keep
+	SampleLevels        string
+	MaxLine             int    // hard-split longer lines, 0 disables
+	MaxLineType         string // unit of MaxLine: chars or tokens
+
+	// Log timestamps recorded per chunk
+	Timestamps    bool
+	InputTimezone string // zone of timestamps without an offset
+	Timezone      string // zone the recorded times are written in
+
+	// Log merging and time-window chunking
+	MergeLogs  bool          // chunk all inputs as one stream in timestamp order
+	TimeWindow time.Duration // start a new line chunk in every window of this length
+
+	// Cross-file references of code chunks; Symbols is built from all the
+	// inputs of a run
+	CodeRefs bool
+	Symbols  *symbolIndex
+
+	// Language server whose symbols decide where line chunks of code start,
+	// and its client during a run
+	LSP       string
+	LSPClient *lspClient
+
+	// Embeddings, and their client during a run
+	Embed              string  // provider of the chunk embeddings, see embedProviders; empty for none
+	SemanticPercentile float64 // distance percentile above which -type semantic ends a chunk
+	EmbedEndpoint      string
+	EmbedModel         string
+	EmbedAPIKey        string
+	Embedder           *embeddingClient
+
+	// Vector store the chunks are upserted into, see vectorStores; empty for none
+	Sink       string
+	SinkURL    string
+	SinkAPIKey string
+	Collection string
+	Namespace  string
+	ChromaPath string // persistent ChromaDB directory, instead of a server
+	DSN        string // Postgres connection string for pgvector
+
+	// Endpoint every chunk is POSTed to as it is written; empty for none
+	Webhook            string
+	WebhookSecret      string // HMAC-SHA256 key signing the deliveries
+	WebhookConcurrency int
+
+	// Limits on the requests of every API integration, per minute, and how
+	// often failed requests are retried
+	RPM     rateLimits
+	TPM     rateLimits // tokens sent, for the APIs that take text
+	Retries int
+
+	// Question generation for RAG eval sets
+	Questions         int // questions per chunk, 0 disables
+	QuestionsEndpoint string
+	QuestionsModel    string
+	QuestionsAPIKey   string
+	SinkCheck         bool    // validate sinks before processing
+	Strict            bool    // verify chunking invariants during the run
+	LogFormat         string  // "text" or "json" console output
+	LogLevel          string  // least severe console output shown, see setLogLevel
+	Quiet             bool    // shorthand for -log-level warn
+	Verbose           bool    // shorthand for -log-level debug
+	Progress          bool    // show a progress bar instead of a line per chunk
+	Budget            int     // total tokens of the chunks written, 0 for no limit
+	MaxChunks         int     // chunks written at most, 0 for no limit; for a Chunker, those left to the run
+	MaxChunksAction   string  // at the MaxChunks limit: stop, or error before writing anything
+	DedupeFuzzy       float64 // similarity from which chunks are near-duplicates, 0 disables
+	DedupeAction      string  // for near-duplicates: drop or flag
+	Dedupe            *dedupeIndex
+	Report            string   // HTML report of the run to write, see writeReport
+	Workers           int      // chunk files written in parallel
+	Mmap              bool     // map char and token inputs into memory instead of reading them
+	MaxMemory         byteSize // refuse inputs whose chunking needs more, 0 for no limit
+	Lang              string   // console message language; empty follows the locale
+
+	// Checkpoint of the interrupted run that -resume continues; the chunks
+	// it covers are recorded in the manifest but not written again
+	Checkpoint *checkpoint
+
+	// Inputs read once and shared by several runs over them (-tiers)
+	Cache *inputCache
+
+	// Filesystem and clock; nil uses the operating system and time.Now
+	FS  FS
+	Now func() time.Time
+}
+
+// console receives progress messages. It is switched to stderr when chunks
+// are streamed to stdout.
+var console io.Writer = os.Stdout
+
+// stringList is a flag.Value that collects every occurrence of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 type Chunker struct {
-	config ChunkConfig
+	config      ChunkConfig
+	chunks      []ManifestChunk
+	stats       RunStats
+	writer      ChunkWriter
+	questioner  *chatClient
+	strict      *strictChecker // set for the duration of Process in -strict mode
+	digest      *sourceDigest
+	transformed map[string]int // lines changed by each transform
+	timestamps  *timestampParser
+	unmap       []func() // releases the inputs mapped during Process (-mmap)
+	encoding    string   // of the input, detected for -encoding auto
+	held        []*Chunk // chunks not emitted yet, see queue
+	dropped     int      // near-duplicates not written (-dedupe-fuzzy)
+	context     *contextTracker
+
+	nameTemplate *template.Template
+	meta         []metaField   // -meta fields, parsed
+	git          *gitSource    // -git history of the input, nil outside a repository
+	notebook     *notebook     // cells of a Jupyter notebook input
+	cues         []subtitleCue // of a -type subtitles input, once chunking parsed them
 }
 
 func NewChunker(config ChunkConfig) *Chunker {
-	return &Chunker{config: config}
+	c := &Chunker{config: config, writer: newFileWriter(config)}
+	if config.Questions > 0 {
+		c.questioner = newChatClient(config.QuestionsEndpoint, config.QuestionsModel, config.QuestionsAPIKey)
+		c.questioner.retries = config.Retries
+	}
+	return c
+}
+
+func (c *Chunker) firstChunkNumber() int {
+	return c.config.StartIndex
+}
+
+// SetWriter replaces the default chunk-file writer, e.g. to keep chunks in
+// memory or to share one writer across several input files.
+func (c *Chunker) SetWriter(w ChunkWriter) {
+	c.writer = w
+}
+
+// Chunks returns the chunks written by the last call to Process.
+func (c *Chunker) Chunks() []ManifestChunk {
+	return c.chunks
+}
+
+// Stats returns size and overlap totals for the last call to Process.
+func (c *Chunker) Stats() RunStats {
+	return c.stats
+}
+
+// Source describes the input file read by the last call to Process.
+func (c *Chunker) Source() ManifestFile {
+	file := c.digest.file(c.config.InputFile)
+	if len(c.transformed) > 0 {
+		file.Transformed = c.transformed
+	}
+	if c.encoding != "utf-8" {
+		file.Encoding = c.encoding
+	}
+	if c.git != nil {
+		file.Git = c.git.source()
+	}
+	if c.notebook != nil {
+		file.Notebook = &notebookInfo{Cells: len(c.notebook.cells), Outputs: c.notebook.outputs}
+	}
+	return file
+}
+
+// gitMapped reports whether the range of chunk is one of the input in git:
+// not for transformed inputs, whose lines moved, nor for notebooks rendered
+// as text or the byte offsets in the UTF-8 text of transcoded ones.
+func (c *Chunker) gitMapped(chunk *Chunk) bool {
+	return len(c.config.transformNames()) == 0 && c.notebook == nil && (chunk.Type == "lines" || c.encoding == "utf-8")
 }
 
 func (c *Chunker) ChunkByLines() error {
-	file, err := os.Open(c.config.InputFile)
+	file, err := c.openInput(c.digest, c.transformed)
 	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
+		return err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := newLineScanner(file, int64(c.config.MaxMemory))
+	if c.config.OverlapSize >= c.config.ChunkSize {
+		logDebug("overlap_ignored", fmt.Sprintf("overlap %d is not smaller than the chunk size %d, so chunks do not overlap", c.config.OverlapSize, c.config.ChunkSize), map[string]any{"overlap": c.config.OverlapSize, "size": c.config.ChunkSize})
+	}
 
 	var currentChunk []string
 	var previousOverlap []string
-	chunkNumber := 1
+	overlap := 0
+	chunkNumber := c.firstChunkNumber()
 	lineNumber := 0
 
 	for scanner.Scan() {
@@ -48,13 +269,14 @@ func (c *Chunker) ChunkByLines() error {
 		// Start new chunk with overlap from previous chunk
 		if len(currentChunk) == 0 && len(previousOverlap) > 0 {
 			currentChunk = append(currentChunk, previousOverlap...)
+			overlap = len(previousOverlap)
 		}
 
 		currentChunk = append(currentChunk, line)
 
 		// Check if chunk is full
 		if len(currentChunk) >= c.config.ChunkSize {
-			if err := c.writeChunk(currentChunk, chunkNumber, lineNumber-len(currentChunk)+1, lineNumber); err != nil {
+			if err := c.writeChunk(currentChunk, chunkNumber, lineNumber-len(currentChunk)+1, lineNumber, overlap); err != nil {
 				return err
 			}
 
@@ -66,13 +288,14 @@ func (c *Chunker) ChunkByLines() error {
 			}
 
 			currentChunk = nil
+			overlap = 0
 			chunkNumber++
 		}
 	}
 
 	// Write remaining lines as final chunk
 	if len(currentChunk) > 0 {
-		if err := c.writeChunk(currentChunk, chunkNumber, lineNumber-len(currentChunk)+1, lineNumber); err != nil {
+		if err := c.writeChunk(currentChunk, chunkNumber, lineNumber-len(currentChunk)+1, lineNumber, overlap); err != nil {
 			return err
 		}
 	}
@@ -81,43 +304,57 @@ func (c *Chunker) ChunkByLines() error {
 }
 
 func (c *Chunker) ChunkByCharacters() error {
-	content, err := os.ReadFile(c.config.InputFile)
+	content, err := c.readInput(c.digest, c.transformed)
 	if err != nil {
-		return fmt.Errorf("error reading file: %v", err)
+		return err
 	}
 
 	text := string(content)
-	chunkNumber := 1
+	chunkNumber := c.firstChunkNumber()
 	start := 0
+	previousEnd := 0
 
 	for start < len(text) {
-		end := start + c.config.ChunkSize
-		if end > len(text) {
-			end = len(text)
+		end := runesForward(text, start, c.config.ChunkSize)
+		if c.config.SizeBytes {
+			// wordBoundary moves the end back to a character boundary
+			end = min(len(text), start+c.config.ChunkSize)
 		}
 
-		// Try to break at word boundary
+		// Try to break at word boundary, but keep some text that is not overlap
 		if end < len(text) {
-			for i := end; i > start && i > end-100; i-- {
-				if text[i] == ' ' || text[i] == '\n' || text[i] == '\t' {
-					end = i
-					break
-				}
+			limit := end
+			end = wordBoundary(text, max(start, previousEnd), end)
+			if end != limit {
+				logDebug("boundary_moved", fmt.Sprintf("chunk %d ends at byte %d instead of %d, on a word or character boundary", chunkNumber, end, limit), map[string]any{"index": chunkNumber, "end": end, "limit": limit})
+			}
+			if c.config.Graphemes {
+				end = graphemeEnd(text, max(start, previousEnd), end)
 			}
 		}
 
 		chunk := text[start:end]
 
-		if err := c.writeTextChunk(chunk, chunkNumber, start, end); err != nil {
+		if err := c.writeTextChunk(chunk, chunkNumber, start, end, max(0, previousEnd-start)); err != nil {
 			return err
 		}
+		previousEnd = end
 
-		// Move start position with overlap
-		if c.config.OverlapSize > 0 {
-			start = end - c.config.OverlapSize
-			if start < 0 {
-				start = end
-			}
+		// The last chunk reached the end of the text; overlapping back into it would loop forever
+		if end >= len(text) {
+			break
+		}
+
+		// Move start position with overlap, always making forward progress
+		next := runesBack(text, end, c.config.OverlapSize, start)
+		if c.config.SizeBytes {
+			next = runeStart(text, max(start, end-c.config.OverlapSize), end)
+		}
+		if c.config.Graphemes {
+			next = graphemeForward(text, next)
+		}
+		if c.config.OverlapSize > 0 && c.config.OverlapSize < c.config.ChunkSize && next > start {
+			start = next
 		} else {
 			start = end
 		}
@@ -128,18 +365,74 @@ func (c *Chunker) ChunkByCharacters() error {
 	return nil
 }
 
+// wordBoundary moves a character chunk's end back to the nearest whitespace
+// within 100 bytes, or failing that to the nearest rune boundary, so that
+// chunks never split a multi-byte character. The result is always > floor.
+func wordBoundary(text string, floor, end int) int {
+	for i := end; i > floor && i > end-100; i-- {
+		if text[i] == ' ' || text[i] == '\n' || text[i] == '\t' {
+			return i
+		}
+	}
+
+	i := end
+	for i > floor && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	if i > floor {
+		return i
+	}
+	// A single character is longer than the chunk size; take it whole
+	i = end
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
+// runesForward returns the byte offset n runes after offset i of text, or
+// the end of text. -size and -overlap count chars as runes, while chunk
+// ranges stay byte offsets.
+func runesForward(text string, i, n int) int {
+	for ; n > 0 && i < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return i
+}
+
+// runesBack returns the byte offset n runes before offset i of text, but
+// not before floor.
+func runesBack(text string, i, n, floor int) int {
+	for ; n > 0 && i > floor; n-- {
+		_, size := utf8.DecodeLastRuneInString(text[floor:i])
+		i -= size
+	}
+	return i
+}
+
+// runeStart moves i forward to the next rune boundary, but not past end.
+func runeStart(text string, i, end int) int {
+	for i < end && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
 func (c *Chunker) ChunkByTokens() error {
-	content, err := os.ReadFile(c.config.InputFile)
+	content, err := c.readInput(c.digest, c.transformed)
 	if err != nil {
-		return fmt.Errorf("error reading file: %v", err)
+		return err
 	}
 
 	// Simple token approximation: split by whitespace and punctuation
 	text := string(content)
-	tokens := c.tokenize(text)
+	tokens := c.config.Cache.tokenize(c.config.InputFile, text)
+	logDebug("tokenized", fmt.Sprintf("%s: %d tokens in %d bytes, split on whitespace and punctuation", c.config.InputFile, len(tokens), len(text)), map[string]any{"source": c.config.InputFile, "tokens": len(tokens), "bytes": len(text)})
 
-	chunkNumber := 1
+	chunkNumber := c.firstChunkNumber()
 	start := 0
+	previousEnd := 0
 
 	for start < len(tokens) {
 		end := start + c.config.ChunkSize
@@ -150,16 +443,19 @@ func (c *Chunker) ChunkByTokens() error {
 		chunkTokens := tokens[start:end]
 		chunk := strings.Join(chunkTokens, " ")
 
-		if err := c.writeTextChunk(chunk, chunkNumber, start, end); err != nil {
+		if err := c.writeTextChunk(chunk, chunkNumber, start, end, max(0, previousEnd-start)); err != nil {
 			return err
 		}
+		previousEnd = end
+
+		// The last chunk reached the end of the tokens; overlapping back into it would loop forever
+		if end >= len(tokens) {
+			break
+		}
 
-		// Move start position with overlap
-		if c.config.OverlapSize > 0 {
+		// Move start position with overlap, always making forward progress
+		if c.config.OverlapSize > 0 && c.config.OverlapSize < c.config.ChunkSize && end-c.config.OverlapSize > start {
 			start = end - c.config.OverlapSize
-			if start < 0 {
-				start = end
-			}
 		} else {
 			start = end
 		}
@@ -170,167 +466,1001 @@ func (c *Chunker) ChunkByTokens() error {
 	return nil
 }
 
-func (c *Chunker) tokenize(text string) []string {
+// tokenizerName names the tokenizer of tokenSpans in manifests and
+// capabilities.
+const tokenizerName = "approximate"
+
+func tokenize(text string) []string {
+	spans := tokenSpans(text)
+	tokens := make([]string, len(spans))
+	for i, span := range spans {
+		tokens[i] = text[span[0]:span[1]]
+	}
+	return tokens
+}
+
+// tokenSpans returns the byte range [start, end) of every token in text.
+func tokenSpans(text string) [][2]int {
 	// Simple tokenization - split on whitespace and keep punctuation
-	var tokens []string
-	var current strings.Builder
+	var spans [][2]int
+	current := -1
 
-	for _, char := range text {
+	for i, char := range text {
 		switch {
 		case char == ' ' || char == '\t' || char == '\n':
-			if current.Len() > 0 {
-				tokens = append(tokens, current.String())
-				current.Reset()
+			if current >= 0 {
+				spans = append(spans, [2]int{current, i})
+				current = -1
 			}
 		case char == '.' || char == ',' || char == ';' || char == ':' ||
 			char == '!' || char == '?' || char == '(' || char == ')' ||
 			char == '[' || char == ']' || char == '{' || char == '}':
-			if current.Len() > 0 {
-				tokens = append(tokens, current.String())
-				current.Reset()
+			if current >= 0 {
+				spans = append(spans, [2]int{current, i})
+				current = -1
 			}
-			tokens = append(tokens, string(char))
+			spans = append(spans, [2]int{i, i + 1})
 		default:
-			current.WriteRune(char)
+			if current < 0 {
+				current = i
+			}
 		}
 	}
 
-	if current.Len() > 0 {
-		tokens = append(tokens, current.String())
+	if current >= 0 {
+		spans = append(spans, [2]int{current, len(text)})
 	}
 
-	return tokens
+	return spans
+}
+
+// writeChunk emits a line chunk. overlap is the number of leading lines
+// repeated from the previous chunk; writeTextChunk takes it in bytes or tokens.
+func (c *Chunker) writeChunk(lines []string, chunkNumber, startLine, endLine, overlap int) error {
+	var content strings.Builder
+	for _, line := range lines {
+		content.WriteString(line)
+		content.WriteByte('\n')
+	}
+
+	return c.queue(&Chunk{
+		Index:     chunkNumber,
+		Type:      "lines",
+		Start:     startLine,
+		End:       endLine,
+		LineCount: len(lines),
+		Overlap:   overlap,
+		Content:   content.String(),
+	})
 }
 
-func (c *Chunker) writeChunk(lines []string, chunkNumber, startLine, endLine int) error {
-	filename := fmt.Sprintf("%s_chunk_%03d.txt", c.config.Prefix, chunkNumber)
-	filepath := filepath.Join(c.config.OutputDir, filename)
+func (c *Chunker) writeTextChunk(content string, chunkNumber, start, end, overlap int) error {
+	return c.queue(&Chunk{
+		Index:   chunkNumber,
+		Type:    c.config.ChunkType,
+		Start:   start,
+		End:     end,
+		Overlap: overlap,
+		Content: content,
+	})
+}
 
-	file, err := os.Create(filepath)
+func (c *Chunker) emit(chunk *Chunk) error {
+	if c.config.MaxChunks > 0 && len(c.chunks) >= c.config.MaxChunks {
+		return errChunkLimit
+	}
+	chunk.Source = c.config.InputFile
+	filename, err := c.chunkFilename(chunk)
 	if err != nil {
-		return fmt.Errorf("error creating chunk file: %v", err)
+		return err
 	}
-	defer file.Close()
+	chunk.Filename = filename
 
-	if c.config.AddMetadata {
-		fmt.Fprintf(file, "=== CHUNK %d ===\n", chunkNumber)
-		fmt.Fprintf(file, "Source: %s\n", c.config.InputFile)
-		fmt.Fprintf(file, "Lines: %d-%d\n", startLine, endLine)
-		fmt.Fprintf(file, "Total lines in chunk: %d\n", len(lines))
-		fmt.Fprintf(file, "=== CONTENT ===\n\n")
+	if err := checkChunk(chunk); err != nil {
+		return err
+	}
+	if c.strict != nil {
+		if err := c.strict.check(chunk); err != nil {
+			return err
+		}
 	}
+	c.config.Redactions.found(chunk)
 
-	for _, line := range lines {
-		fmt.Fprintln(file, line)
+	chunk.SHA256 = contentChecksum(chunk.Content)
+	if c.config.Dedupe != nil {
+		if of, similarity, ok := c.config.Dedupe.check(chunk); ok {
+			if c.config.DedupeAction == "drop" {
+				c.config.Dedupe.drop(chunk, of, similarity)
+				c.dropped++
+				logDebug("duplicate_dropped", fmt.Sprintf("chunk %d is %.0f%% similar to chunk %d, so it is dropped", chunk.Index, similarity*100, of), map[string]any{"index": chunk.Index, "duplicate_of": of, "similarity": similarity})
+				return nil
+			}
+			chunk.DuplicateOf, chunk.Similarity = of, similarity
+			c.config.Dedupe.report.Flagged++
+		}
+	}
+	if c.timestamps != nil {
+		chunk.TimeStart, chunk.TimeEnd = c.timestamps.span(chunk.Content)
+	}
+	if c.cues != nil {
+		chunk.TimeStart, chunk.TimeEnd = cueSpan(c.cues, chunk)
+	}
+	chunk.References = c.config.Symbols.references(chunk.Source, chunk.Content)
+	if chunk.Meta, err = expandMeta(c.meta, chunk); err != nil {
+		return err
+	}
+	if c.git != nil {
+		chunk.Git = c.git.chunk(chunk, c.gitMapped(chunk))
+	}
+	if c.notebook != nil && len(c.config.transformNames()) == 0 {
+		chunk.Cells = c.notebook.cellsOf(chunk)
+	}
+	questions, resumed := c.config.Checkpoint.written(chunk.Index)
+	if !resumed {
+		if questions, err = c.generateQuestions(strings.TrimSuffix(chunk.Content, "\n")); err != nil {
+			return err
+		}
+	}
+	chunk.Questions = questions
+	// The context header and the prompt are written, so the checksum is of them
+	if c.context != nil || c.config.Prompt != nil {
+		chunk.raw = chunk.Content
+	}
+	if c.context != nil {
+		chunk.Content = c.context.header(chunk) + chunk.Content
+	}
+	// What is retrieved is the chunk with its context, not the prompt
+	if c.config.Embed != "" {
+		if err := c.config.Embedder.embedChunk(chunk); err != nil {
+			return err
+		}
+	}
+	if c.config.Prompt != nil {
+		if err := c.config.Prompt.wrap(chunk, len(c.chunks)+1); err != nil {
+			return err
+		}
+	}
+	if chunk.raw != "" {
+		chunk.SHA256 = contentChecksum(chunk.Content)
+	}
+	chunk.Tokens = len(tokenSpans(chunk.Content))
+	if !resumed {
+		if err := c.writer.WriteChunk(chunk); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Created chunk %d: %s (lines %d-%d)\n", chunkNumber, filename, startLine, endLine)
+	c.chunks = append(c.chunks, ManifestChunk{
+		Index:       chunk.Index,
+		Source:      chunk.Source,
+		File:        chunk.Filename,
+		Start:       chunk.Start,
+		End:         chunk.End,
+		Overlap:     chunk.Overlap,
+		Bytes:       len(chunk.Content),
+		SHA256:      chunk.SHA256,
+		Tokens:      chunk.Tokens,
+		TimeStart:   chunk.TimeStart,
+		TimeEnd:     chunk.TimeEnd,
+		References:  chunk.References,
+		Questions:   chunk.Questions,
+		DuplicateOf: chunk.DuplicateOf,
+		Similarity:  chunk.Similarity,
+		Embedding:   chunk.Embedding,
+		Meta:        chunk.Meta,
+		Git:         chunk.Git,
+		Cells:       chunk.Cells,
+	})
+	c.stats.add(chunk)
+	runProgress.chunk(chunk.Source, c.digest.bytes)
+	runReport.chunk(chunk)
 	return nil
 }
 
-func (c *Chunker) writeTextChunk(content string, chunkNumber, start, end int) error {
-	filename := fmt.Sprintf("%s_chunk_%03d.txt", c.config.Prefix, chunkNumber)
-	filepath := filepath.Join(c.config.OutputDir, filename)
+func (c *Chunker) Process() error {
+	c.chunks = nil
+	c.stats = RunStats{}
+	c.digest = newSourceDigest()
+	c.transformed = map[string]int{}
+	c.encoding = "utf-8"
+	c.held = nil
+	c.dropped = 0
+	c.context = nil
+	if c.config.ContextHeader {
+		c.context = newContextTracker(c.config)
+	}
+	defer func() {
+		for _, unmap := range c.unmap {
+			unmap()
+		}
+		c.unmap = nil
+	}()
+
+	if c.config.ChunkSize <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", c.config.ChunkSize)
+	}
+	if c.config.SizeBytes && c.config.ChunkType != "chars" && c.config.sizeDuration() == 0 {
+		return fmt.Errorf("-size %s is a byte size, which needs -type chars", c.config.sizeString())
+	}
+	if c.config.SizeDuration > 0 && !c.config.SizeBytes && !c.config.Subtitles {
+		return fmt.Errorf("-size %s is a duration, which needs -type subtitles", c.config.sizeString())
+	}
+	if c.config.OverlapSize < 0 {
+		return fmt.Errorf("overlap must not be negative, got %d", c.config.OverlapSize)
+	}
 
-	file, err := os.Create(filepath)
+	tmpl, err := parseNameTemplate(c.config.NameTemplate)
 	if err != nil {
-		return fmt.Errorf("error creating chunk file: %v", err)
+		return err
+	}
+	c.nameTemplate = tmpl
+	if c.meta, err = parseMeta(c.config.Meta); err != nil {
+		return err
+	}
+	c.notebook = nil
+	if isNotebook(c.config.InputFile) {
+		c.notebook = &notebook{outputs: c.config.NotebookOutputs}
+	}
+	c.git = nil
+	if c.config.Git {
+		c.git = loadGitSource(c.config.InputFile, c.config.ChunkType != "lines")
 	}
-	defer file.Close()
 
-	if c.config.AddMetadata {
-		fmt.Fprintf(file, "=== CHUNK %d ===\n", chunkNumber)
-		fmt.Fprintf(file, "Source: %s\n", c.config.InputFile)
-		fmt.Fprintf(file, "Range: %d-%d\n", start, end)
-		fmt.Fprintf(file, "=== CONTENT ===\n\n")
+	c.timestamps = nil
+	c.cues = nil
+	if c.config.Timestamps {
+		if c.timestamps, err = newTimestampParser(c.config); err != nil {
+			return err
+		}
+	}
+
+	if err := c.checkMemory(); err != nil {
+		return err
+	}
+
+	c.strict = nil
+	if c.config.Strict {
+		c.strict = newStrictChecker(c.config.ChunkType)
+	}
+
+	switch {
+	case c.config.Boundaries != "":
+		err = c.chunkAtBoundaries()
+	case c.config.TimeWindow > 0:
+		err = c.chunkLinesByTime()
+	case c.config.LSPClient != nil:
+		err = c.chunkLinesBySymbols()
+	case len(c.config.SectionStarts) > 0:
+		err = c.chunkLinesBySections()
+	case c.config.Semantic:
+		err = c.chunkSemantic()
+	case c.config.Diff:
+		err = c.chunkDiff()
+	case c.config.Subtitles:
+		err = c.chunkSubtitles()
+	case c.notebook != nil && c.config.ChunkType == "lines" && len(c.config.transformNames()) == 0:
+		err = c.chunkNotebookCells()
+	case c.config.ChunkType == "lines":
+		err = c.ChunkByLines()
+	case c.config.ChunkType == "chars":
+		err = c.ChunkByCharacters()
+	case c.config.ChunkType == "tokens":
+		err = c.ChunkByTokens()
+	default:
+		return fmt.Errorf("unsupported chunk type: %s", c.config.ChunkType)
+	}
+	if err == nil {
+		err = c.flushQueue()
+	}
+	if err != nil || c.strict == nil {
+		return err
+	}
+
+	// Re-read the input to confirm nothing was lost
+	content, err := c.readInput(io.Discard, map[string]int{})
+	if err != nil {
+		return err
+	}
+	return c.strict.finish(c.config.InputFile, content)
+}
+
+var validChunkTypes = map[string]bool{"lines": true, "chars": true, "tokens": true}
+
+// defineChunkFlags registers the chunking options on fs, so that every
+// command and config file shares the same option names and defaults.
+func defineChunkFlags(fs *flag.FlagSet, config *ChunkConfig) {
+	fs.Var((*stringList)(&config.Inputs), "input", "Input file or directory to chunk (required, repeatable; positional arguments are also accepted)")
+	fs.StringVar(&config.OutputDir, "output", "chunks", "Output directory for chunks, output file for single-file formats, or - to stream to stdout")
+	fs.StringVar(&config.Format, "format", "files", "Output format: files (one file per chunk), csv, jsonl, langchain (JSONL of LangChain Documents), llamaindex (JSONL of LlamaIndex TextNodes), parquet, sqlite, corpus (one file with boundary markers and an offsets index), concat (one file with separator lines), or zip (chunk files in one archive); comma-separate several to write them all")
+	fs.StringVar(&config.Separator, "separator", defaultSeparator, "Separator line before each chunk in concat output; {n}, {total}, {index}, {source}, {start} and {end} are replaced")
+	config.ChunkType = "lines"
+	fs.Var(chunkTypeValue{&config.ChunkType, &config.Semantic, &config.Diff, &config.Subtitles}, "type", "Chunk type: lines, chars, tokens, diff for line chunks of a patch cut at its file and hunk boundaries, subtitles for line chunks of whole SRT or WebVTT cues, or semantic for char chunks that end where the topic shifts, found with embeddings")
+	fs.Float64Var(&config.SemanticPercentile, "semantic-percentile", 95, "With -type semantic, end chunks where the embedding distance between neighbouring sentences is above this percentile of the input's (0-100)")
+	fs.StringVar(&config.Embed, "embed", "", "Embed every chunk with this provider and store the vectors in the manifest and JSONL output: openai, or ollama for a local Ollama server; -type semantic uses it too")
+	fs.StringVar(&config.EmbedEndpoint, "embed-endpoint", "", "OpenAI-compatible embeddings URL used by -embed and -type semantic (defaults to the provider's, https://api.openai.com/v1/embeddings or http://localhost:11434/v1/embeddings for ollama)")
+	fs.StringVar(&config.EmbedModel, "embed-model", "", "Embedding model used by -embed and -type semantic (defaults to text-embedding-3-small, or nomic-embed-text for ollama)")
+	fs.StringVar(&config.EmbedAPIKey, "embed-api-key", "", "API key for the embeddings endpoint (defaults to $OPENAI_API_KEY; ollama needs none)")
+	fs.StringVar(&config.Sink, "sink", "", "Upsert every chunk, with its metadata and -embed vector, into this vector store as well: qdrant, pinecone, chroma or pgvector")
+	fs.StringVar(&config.SinkURL, "sink-url", "", "URL of the -sink: for qdrant and chroma, the server (defaults to http://localhost:6333 and http://localhost:8000); for pinecone, the index host")
+	fs.StringVar(&config.SinkAPIKey, "sink-api-key", "", "API key for the -sink (defaults to $QDRANT_API_KEY, $PINECONE_API_KEY or $CHROMA_API_KEY)")
+	fs.StringVar(&config.Collection, "collection", "chunks", "Qdrant or Chroma collection, or pgvector table, the -sink upserts into, created if it does not exist")
+	fs.StringVar(&config.DSN, "dsn", "", "Postgres connection string for -sink pgvector, such as postgres://user@host/db (needs psql in PATH)")
+	fs.StringVar(&config.ChromaPath, "chroma-path", "", "Persistent ChromaDB directory -sink chroma writes into instead of a server, through a chroma server run for the duration (needs chroma in PATH)")
+	fs.StringVar(&config.Webhook, "webhook", "", "POST every chunk as JSON to this URL as soon as it is written, e.g. to drive an event-based ingestion pipeline")
+	fs.StringVar(&config.WebhookSecret, "webhook-secret", "", "Sign every -webhook delivery with an HMAC-SHA256 of this key in the X-FileChunker-Signature header")
+	fs.IntVar(&config.WebhookConcurrency, "webhook-concurrency", 4, "How many -webhook deliveries to make at once")
+	config.RPM, config.TPM = rateLimits{}, rateLimits{}
+	fs.Var(config.RPM, "rpm", "Requests per minute each API integration may make, or `limits` per API such as embeddings=3000,chat=500; APIs are embeddings, chat, anthropic, webhook, qdrant, pinecone and chroma (0 for no limit)")
+	fs.Var(config.TPM, "tpm", "Tokens per minute the embeddings, chat and anthropic APIs may be sent, or `limits` per API such as embeddings=1000000 (0 for no limit)")
+	fs.IntVar(&config.Retries, "retries", 5, "How many times API requests failing with a network error, HTTP 429 or 5xx are retried, with exponential backoff or after the Retry-After the API asks for")
+	fs.StringVar(&config.Namespace, "namespace", "", "Pinecone namespace the -sink upserts into (default the index's default namespace)")
+	config.ChunkSize = 1000
+	fs.Var(sizeValue{&config.ChunkSize, &config.SizeBytes, &config.SizeDuration}, "size", "Size of each chunk, in lines, characters (runes) or tokens, for char chunks a byte `size` such as 4MB or 128KiB, or for subtitle chunks tokens or a duration such as 10m")
+	config.OverlapSize = 50
+	fs.IntVar(&config.MinSize, "min-size", 0, "Merge the last chunk of an input into the one before it when it adds less than this, in the units of -size (0 disables)")
+	fs.Var(overlapValue{&config.OverlapSize, &config.OverlapPercent}, "overlap", "Overlap `size` between chunks, in the units of -size, or a percentage of -size such as 10%")
+	fs.StringVar(&config.Encoding, "encoding", "auto", "Character encoding of the inputs, transcoded to UTF-8 before chunking: auto, utf-8, utf-16le, utf-16be, latin1, windows-1252, or shift-jis; auto detects it for each input")
+	fs.BoolVar(&config.Graphemes, "graphemes", false, "Never split a grapheme cluster, such as an emoji with modifiers or a letter with combining accents, in char chunks")
+	fs.StringVar(&config.Boundaries, "boundaries", "", "File of positions to start chunks at instead of every -size units: line numbers for lines, byte offsets for chars and tokens")
+	fs.Float64Var(&config.SampleRate, "sample-rate", 1, "Keep this fraction (0-1) of log entries at the -sample-levels and all others, e.g. 0.1 keeps every ERROR and WARN but one INFO or DEBUG entry in ten")
+	fs.StringVar(&config.SampleLevels, "sample-levels", "trace,debug,info", "Comma-separated log levels thinned out by -sample-rate")
+	fs.IntVar(&config.MaxLine, "max-line", 0, "Hard-split lines longer than this many chars (or tokens, see -max-line-type) into several lines before chunking (0 disables)")
+	fs.StringVar(&config.MaxLineType, "max-line-type", "chars", "Unit of -max-line: chars or tokens")
+	fs.BoolVar(&config.RedactSecrets, "redact-secrets", false, "Replace API keys, tokens, JWTs, AWS keys, private keys and passwords with placeholders before chunking, and list each redaction, without the secret, in "+redactionsFilename)
+	fs.Float64Var(&config.DedupeFuzzy, "dedupe-fuzzy", 0, "Treat chunks at least this similar (0-1, e.g. 0.9) to an earlier chunk, such as repeated license headers, as near-duplicates (0 disables)")
+	fs.StringVar(&config.DedupeAction, "dedupe-action", "drop", "What to do with near-duplicates found by -dedupe-fuzzy: drop them, or flag them with the chunk they repeat")
+	fs.BoolVar(&config.StripComments, "strip-comments", false, "Strip the comments of code inputs in common languages, by file extension, before chunking")
+	fs.Var((*regexpList)(&config.Grep), "grep", "Regular expression of the lines to keep before chunking, e.g. 'ERROR|WARN'; lines matching none are dropped (repeatable)")
+	fs.Var((*regexpList)(&config.GrepV), "grep-v", "Regular expression of the lines to drop before chunking, e.g. 'DEBUG' (repeatable)")
+	fs.BoolVar(&config.NormalizeWhitespace, "normalize-whitespace", false, "Trim trailing whitespace, expand tabs to -tab-width spaces and collapse runs of blank lines into one before chunking")
+	fs.IntVar(&config.TabWidth, "tab-width", 4, "Spaces per tab stop for -normalize-whitespace (0 keeps tabs)")
+	fs.BoolVar(&config.CollapseRepeats, "collapse-repeats", false, "Collapse runs of identical consecutive lines into one line followed by ×N before chunking")
+	fs.BoolVar(&config.Timestamps, "timestamps", false, "Parse log timestamps and record the time span of each chunk in its metadata")
+	fs.StringVar(&config.InputTimezone, "input-timezone", "UTC", "Time zone of log timestamps without an offset: UTC, Local, a zone name such as Europe/Berlin, or an offset such as +05:30")
+	fs.StringVar(&config.Timezone, "timezone", "UTC", "Time zone chunk time spans are written in")
+	fs.BoolVar(&config.MergeLogs, "merge-logs", false, "Merge all input logs into one stream in timestamp order, each line tagged with its [source], and chunk that")
+	fs.DurationVar(&config.TimeWindow, "time-window", 0, "Start a new line chunk in every time window of this length, e.g. 5m, as well as every -size lines (0 disables)")
+	fs.StringVar(&config.LSP, "lsp", "", "Language server command, e.g. gopls or 'pyright-langserver --stdio', whose symbols decide where line chunks of code start")
+	fs.BoolVar(&config.CodeRefs, "code-refs", false, "Record the other input files each chunk of code references, through imports and calls to the functions and types they define")
+	fs.BoolVar(&config.AddMetadata, "metadata", true, "Add metadata to chunks")
+	fs.StringVar(&config.MetadataMode, "metadata-mode", "header", "Where -metadata puts each chunk's metadata: header, a banner before the content, or sidecar, a JSON file next to each chunk file such as chunk_001.json, leaving the content untouched")
+	fs.BoolVar(&config.ChecksumHeader, "checksum-header", false, "Add each chunk's SHA-256 to its metadata header")
+	fs.StringVar(&config.Prefix, "prefix", "", "Prefix for output files (defaults to input filename)")
+	fs.StringVar(&config.NameTemplate, "name-template", defaultNameTemplate, "Go template for chunk file names; fields: .Prefix .Index .Number .Type .Start .End .StartLine .EndLine .Ext")
+	config.IndexWidth = 3
+	fs.Var(indexWidthValue{&config.IndexWidth}, "index-width", "Zero-padding `width` of {{.Index}} in chunk file names, or auto for the digits of the last chunk number, so that names sort past 999 chunks")
+	fs.IntVar(&config.StartIndex, "start-index", 1, "Number of the first chunk")
+	fs.BoolVar(&config.ContextHeader, "context-header", false, "Start every chunk with context for retrieval in isolation: its source path, the Markdown headings it falls under and the last sentence of the chunk before it")
+	fs.StringVar(&config.PromptTemplate, "prompt-template", "", "Go template `file` every chunk is wrapped in, making it a ready-to-paste prompt; fields: .Index .Total .Part .Parts .Number .Source .Type .Start .End .Content")
+	fs.Var((*stringList)(&config.Include), "include", "Glob of files to chunk when input is a directory, e.g. '**/*.go' (repeatable)")
+	fs.Var((*stringList)(&config.Exclude), "exclude", "Glob of files or directories to skip when input is a directory, e.g. 'vendor/**' (repeatable)")
+	fs.Var((*stringList)(&config.Meta), "meta", "Field `key=value` to tag every chunk with, in its metadata header, sidecar, manifest entry, records and vector store payload, e.g. project=atlas; the value is a Go template with .Index .Source .File .Type .Start .End and env, e.g. 'ticket={{env \"TICKET\"}}' (repeatable)")
+	fs.BoolVar(&config.NotebookOutputs, "notebook-outputs", false, "Include the text outputs of code cells after them when chunking Jupyter notebooks (.ipynb)")
+	fs.BoolVar(&config.Git, "git", false, "For inputs inside a git repository, record in each chunk's metadata the commit checked out, the file's path in the repository and the last commit to change the chunk's lines (needs git)")
+	fs.Var((*stringList)(&config.Priority), "priority", "Rule `glob=weight`, e.g. 'README*=10' or '**/*_test.go=-10': inputs are chunked in order of the weight of the first rule they match, highest first (repeatable)")
+	fs.BoolVar(&config.WriteManifest, "manifest", true, "Write a manifest.json describing all chunks")
+	fs.IntVar(&config.Questions, "questions", 0, "Generate this many candidate questions per chunk with an LLM (0 disables)")
+	fs.StringVar(&config.QuestionsEndpoint, "questions-endpoint", defaultChatEndpoint, "OpenAI-compatible chat completions URL used for question generation")
+	fs.StringVar(&config.QuestionsModel, "questions-model", "gpt-4o-mini", "Model used for question generation")
+	fs.StringVar(&config.QuestionsAPIKey, "questions-api-key", "", "API key for the question endpoint (defaults to $OPENAI_API_KEY)")
+	fs.BoolVar(&config.Strict, "strict", false, "Verify during the run that chunks cover the input exactly, with correct overlap and no gaps, and abort on any violation")
+	fs.StringVar(&config.LogFormat, "log-format", "text", "Console output: text, or json for one NDJSON event per line")
+	fs.StringVar(&config.LogLevel, "log-level", "info", "Least severe console output shown: debug, info, warn, or error")
+	fs.BoolVar(&config.Quiet, "quiet", false, "Only print warnings and errors (-log-level warn)")
+	fs.BoolVar(&config.Verbose, "verbose", false, "Also print how chunk boundaries were chosen and tokenizer details (-log-level debug)")
+	fs.StringVar(&config.Lang, "lang", "", "Language of console messages: en, es, or fa (defaults to the locale)")
+	fs.Var(&config.MaxMemory, "max-memory", "Memory budget `size`, e.g. 512MB: inputs whose chunking would need more stop the run with an error, as do lines longer than this (0 for no limit)")
+	fs.BoolVar(&config.SinkCheck, "sink-check", false, "Check that every output sink and the LLM endpoint work before processing, and stop early if not")
+}
+
+// validate checks the chunk options, as the chunk command and serve take
+// them, resolving the encoding name.
+func (config *ChunkConfig) validate() error {
+	// Validate chunk type
+	if !validChunkTypes[config.ChunkType] {
+		return errors.New(trf("Invalid chunk type. Must be: lines, chars, tokens, diff, subtitles, or semantic"))
+	}
+
+	// Validate size and overlap
+	if config.ChunkSize <= 0 {
+		return errors.New(trf("Chunk size must be positive"))
+	}
+	if config.OverlapSize < 0 {
+		return errors.New(trf("Overlap must not be negative"))
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return errors.New(trf("-sample-rate must be between 0 and 1"))
+	}
+	if config.MaxLine < 0 {
+		return errors.New(trf("-max-line must not be negative"))
+	}
+	if config.DedupeFuzzy < 0 || config.DedupeFuzzy > 1 {
+		return errors.New(trf("-dedupe-fuzzy must be between 0 and 1"))
+	}
+	if config.DedupeAction != "drop" && config.DedupeAction != "flag" {
+		return errors.New(trf("-dedupe-action must be drop or flag"))
+	}
+	if config.TabWidth < 0 {
+		return errors.New(trf("-tab-width must not be negative"))
+	}
+	if config.MaxLineType != "chars" && config.MaxLineType != "tokens" {
+		return errors.New(trf("-max-line-type must be chars or tokens"))
+	}
+	if config.Timestamps || config.MergeLogs || config.TimeWindow != 0 {
+		if _, err := newTimestampParser(*config); err != nil {
+			return err
+		}
+	}
+	if encoding := normalizeEncoding(config.Encoding); encoding != "" {
+		config.Encoding = encoding
+	} else {
+		return errors.New(trf("Invalid encoding %q. Must be: auto, utf-8, utf-16le, utf-16be, latin1, windows-1252, or shift-jis", config.Encoding))
+	}
+	if config.TimeWindow < 0 {
+		return errors.New(trf("-time-window must not be negative"))
+	}
+	if config.TimeWindow > 0 && (config.ChunkType != "lines" || config.Boundaries != "") {
+		return errors.New(trf("-time-window needs -type lines and cannot be combined with -boundaries"))
+	}
+	if config.LSP != "" && (config.ChunkType != "lines" || config.Boundaries != "" || config.TimeWindow > 0) {
+		return errors.New(trf("-lsp needs -type lines and cannot be combined with -boundaries or -time-window"))
+	}
+	if config.Semantic && config.Boundaries != "" {
+		return errors.New(trf("-type semantic finds its own boundaries, so it cannot be combined with -boundaries"))
+	}
+	if config.Diff && (config.Boundaries != "" || config.TimeWindow > 0 || config.LSP != "") {
+		return errors.New(trf("-type diff finds its own boundaries, so it cannot be combined with -boundaries, -time-window or -lsp"))
+	}
+	if config.Subtitles && (config.Boundaries != "" || config.TimeWindow > 0 || config.LSP != "" || config.Timestamps) {
+		return errors.New(trf("-type subtitles finds its own boundaries and times, so it cannot be combined with -boundaries, -time-window, -lsp or -timestamps"))
+	}
+	if _, ok := embedProviders[config.Embed]; config.Embed != "" && !ok {
+		return errors.New(trf("Invalid -embed provider %q. Must be: %s", config.Embed, strings.Join(embedProviderNames(), ", ")))
+	}
+	if _, ok := vectorStores[config.Sink]; config.Sink != "" && !ok {
+		return errors.New(trf("Invalid -sink %q. Must be: %s", config.Sink, strings.Join(vectorStoreNames(), ", ")))
+	}
+	if config.Sink != "" && config.Embed == "" {
+		return errors.New(trf("-sink %s stores the -embed vectors of the chunks, so it needs -embed", config.Sink))
+	}
+	if config.ChromaPath != "" && config.Sink != "chroma" {
+		return errors.New(trf("-chroma-path needs -sink chroma"))
+	}
+	if (config.DSN != "") != (config.Sink == "pgvector") {
+		return errors.New(trf("-sink pgvector needs -dsn, and -dsn needs -sink pgvector"))
+	}
+	if url, _ := config.sinkSettings(); config.Sink != "" && config.Sink != "pgvector" && url == "" {
+		return errors.New(trf("-sink %s needs -sink-url", config.Sink))
+	}
+	if u, err := url.Parse(config.Webhook); config.Webhook != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		return errors.New(trf("-webhook must be an http or https URL, got %q", config.Webhook))
+	}
+	if config.WebhookSecret != "" && config.Webhook == "" {
+		return errors.New(tr("-webhook-secret needs -webhook"))
+	}
+	if config.WebhookConcurrency < 1 {
+		return errors.New(tr("-webhook-concurrency must be at least 1"))
+	}
+	if config.Retries < 0 {
+		return errors.New(tr("-retries must not be negative"))
+	}
+	if config.SemanticPercentile <= 0 || config.SemanticPercentile >= 100 {
+		return errors.New(trf("-semantic-percentile must be between 0 and 100"))
 	}
 
-	fmt.Fprint(file, content)
+	// Validate chunk naming
+	if _, err := parseNameTemplate(config.NameTemplate); err != nil {
+		return err
+	}
+	if config.PromptTemplate != "" {
+		if _, err := parsePromptTemplate(config.filesystem(), config.PromptTemplate); err != nil {
+			return err
+		}
+		if config.Budget > 0 {
+			return errors.New(trf("-prompt-template cannot be combined with -budget, which would cut prompts short"))
+		}
+	}
+	if config.Budget < 0 {
+		return errors.New(trf("-budget must not be negative"))
+	}
+	if config.MinSize < 0 {
+		return errors.New(trf("-min-size must not be negative"))
+	}
+	if config.MaxChunks < 0 {
+		return errors.New(trf("-max-chunks must not be negative"))
+	}
+	// Commands without -max-chunks leave the action empty, which stops
+	if config.MaxChunksAction != "" && config.MaxChunksAction != "stop" && config.MaxChunksAction != "error" {
+		return errors.New(trf("-max-chunks-action must be stop or error"))
+	}
+	if _, err := parseMeta(config.Meta); err != nil {
+		return err
+	}
+	// Commands without -metadata-mode leave it empty, which is header
+	if config.MetadataMode != "" && config.MetadataMode != "header" && config.MetadataMode != "sidecar" {
+		return errors.New(trf("-metadata-mode must be header or sidecar, got %q", config.MetadataMode))
+	}
+	if config.sidecars() && outputIsStdout(*config) {
+		return errors.New(tr("-metadata-mode sidecar writes a file next to each chunk file, so it needs an -output directory, not stdout"))
+	}
+	if (config.IndexWidth < 0 && config.IndexWidth != indexWidthAuto) || config.StartIndex < 0 {
+		return errors.New(trf("Index width and start index must not be negative"))
+	}
 
-	fmt.Printf("Created chunk %d: %s\n", chunkNumber, filename)
+	// Validate output format
+	for _, format := range config.formats() {
+		if !validFormat(format) {
+			return errors.New(trf("Invalid output format %q. Must be: files, csv, jsonl, langchain, llamaindex, parquet, sqlite, corpus, concat, or zip", format))
+		}
+	}
 	return nil
 }
 
-func (c *Chunker) Process() error {
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(c.config.OutputDir, 0755); err != nil {
-		return fmt.Errorf("error creating output directory: %v", err)
+// chunkInputs chunks every input in order, numbering chunks continuously
+// across files and recording them in the manifest. A nil writer means the
+// default chunk files in the output directory.
+func chunkInputs(config ChunkConfig, inputs []inputFile, writer ChunkWriter, manifest *Manifest) error {
+	nextIndex, written := config.StartIndex, 0
+	if config.MaxMemory > 0 {
+		debug.SetMemoryLimit(int64(config.MaxMemory))
+	}
+	if config.CodeRefs && config.Symbols == nil {
+		symbols, err := buildSymbolIndex(config, inputs)
+		if err != nil {
+			return fmt.Errorf("error indexing symbols: %v", err)
+		}
+		config.Symbols = symbols
+	}
+	if config.DedupeFuzzy > 0 && config.Dedupe == nil {
+		config.Dedupe = newDedupeIndex(config.DedupeFuzzy, config.DedupeAction)
+		defer func() { manifest.Dedupe = config.Dedupe.report }()
+	}
+	if (config.Semantic || config.Embed != "") && config.Embedder == nil {
+		config.Embedder = newEmbeddingClient(config)
+	}
+	if config.LSP != "" && config.LSPClient == nil {
+		client, err := startLSP(config.LSP)
+		if err != nil {
+			return err
+		}
+		defer client.close()
+		config.LSPClient = client
 	}
 
-	switch c.config.ChunkType {
-	case "lines":
-		return c.ChunkByLines()
-	case "chars":
-		return c.ChunkByCharacters()
-	case "tokens":
-		return c.ChunkByTokens()
-	default:
-		return fmt.Errorf("unsupported chunk type: %s", c.config.ChunkType)
+	if config.numbersByTotal() && config.ChunkTotal == 0 {
+		counted, err := countChunks(config, inputs)
+		if err != nil {
+			return err
+		}
+		last := config.StartIndex
+		for _, chunk := range counted.Chunks {
+			last = max(last, chunk.Index)
+		}
+		config.ChunkTotal = len(counted.Chunks)
+		if config.IndexWidth == indexWidthAuto {
+			config.IndexWidth = len(strconv.Itoa(last))
+		}
+	}
+
+	for i, input := range inputs {
+		if config.MaxChunks > 0 && written >= config.MaxChunks {
+			stopAtChunkLimit(config, manifest, "", inputs[i:])
+			return nil
+		}
+		logEvent("file_started", "", map[string]any{"path": input.Path, "file": i + 1, "files": len(inputs)})
+		fileConfig := config
+		fileConfig.InputFile = input.Path
+		fileConfig.Prefix = input.Prefix
+		fileConfig.StartIndex = nextIndex
+		if config.MaxChunks > 0 {
+			fileConfig.MaxChunks = config.MaxChunks - written
+		}
+
+		chunker := NewChunker(fileConfig)
+		if writer != nil {
+			chunker.SetWriter(writer)
+		}
+		err := chunker.Process()
+		limited := errors.Is(err, errChunkLimit)
+		if limited {
+			err = chunker.drainInput()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", input.Path, err)
+		}
+		source := chunker.Source()
+		manifest.Add(source, chunker.Chunks(), chunker.Stats())
+		// Dropped near-duplicates keep their numbers
+		nextIndex += len(chunker.Chunks()) + chunker.dropped
+		written += len(chunker.Chunks())
+		logEvent("file_completed", "", map[string]any{"path": input.Path, "chunks": len(chunker.Chunks()), "bytes": source.Bytes, "sha256": source.SHA256})
+		if limited {
+			stopAtChunkLimit(config, manifest, input.Path, inputs[i+1:])
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// stopAtChunkLimit records in the manifest that the run stopped at
+// -max-chunks, within cutShort if it is set, leaving skipped unchunked.
+func stopAtChunkLimit(config ChunkConfig, manifest *Manifest, cutShort string, skipped []inputFile) {
+	report := &chunkLimitReport{Limit: config.MaxChunks, CutShort: cutShort}
+	for _, input := range skipped {
+		report.Skipped = append(report.Skipped, input.Path)
+	}
+	manifest.MaxChunks = report
+	// Under -max-chunks-action error, checkChunkLimit reports it instead
+	if config.MaxChunksAction == "error" {
+		return
+	}
+	if cutShort != "" {
+		logWarning(trf("stopped at the -max-chunks limit of %d chunks in %s; %d more input(s) not chunked", config.MaxChunks, cutShort, len(skipped)), map[string]any{"max_chunks": report})
+	} else {
+		logWarning(trf("stopped at the -max-chunks limit of %d chunks; %d more input(s) not chunked", config.MaxChunks, len(skipped)), map[string]any{"max_chunks": report})
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd := findCommand(os.Args[1]); cmd != nil {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	// Without a command name, the arguments are chunk options
+	runChunk(os.Args[1:])
+}
+
+// runChunk is the chunk command. Errors are reported through fatalf, which
+// knows about -log-format json, so it only returns nil.
+func runChunk(args []string) error {
 	var config ChunkConfig
+	var configFile string
+	var policyFile string
+	var showVersion bool
+	var dryRunOnly bool
+	var resume bool
+	var watch bool
+	var watchInterval time.Duration
+	var tiers string
 
-	flag.StringVar(&config.InputFile, "input", "", "Input file to chunk (required)")
-	flag.StringVar(&config.OutputDir, "output", "chunks", "Output directory for chunks")
-	flag.StringVar(&config.ChunkType, "type", "lines", "Chunk type: lines, chars, or tokens")
-	flag.IntVar(&config.ChunkSize, "size", 1000, "Size of each chunk")
-	flag.IntVar(&config.OverlapSize, "overlap", 50, "Overlap size between chunks")
-	flag.BoolVar(&config.AddMetadata, "metadata", true, "Add metadata to chunks")
-	flag.StringVar(&config.Prefix, "prefix", "", "Prefix for output files (defaults to input filename)")
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Chunk large files for AI processing.\n\n")
+	fs := flag.NewFlagSet("chunk", flag.ExitOnError)
+	defineChunkFlags(fs, &config)
+	fs.StringVar(&configFile, "config", "", "YAML config file with default option values (command-line flags and FILECHUNKER_* variables take precedence)")
+	fs.StringVar(&policyFile, "policy", "", "Policy file restricting the formats, output directories and endpoints chunks may go to")
+	fs.BoolVar(&showVersion, "version", false, "Print version, commit and build date, then exit")
+	fs.BoolVar(&resume, "resume", false, "Continue an interrupted run from the checkpoint in the output directory, skipping the chunk files it already wrote")
+	fs.BoolVar(&watch, "watch", false, "Keep running and re-chunk whenever an input file is added, changed or removed, found by polling every -watch-interval")
+	fs.DurationVar(&watchInterval, "watch-interval", 2*time.Second, "How often -watch polls the sizes and modification times of the inputs, e.g. 500ms or 1m")
+	fs.IntVar(&config.Workers, "workers", 1, "Write this many chunk files in parallel while the input is read in order (files format)")
+	fs.BoolVar(&config.Mmap, "mmap", false, "Map inputs into memory instead of reading them, for char and token chunking of very large files (Unix only)")
+	fs.BoolVar(&config.Progress, "progress", false, "Show a progress bar with bytes read, chunks written, throughput and ETA instead of a line per chunk")
+	fs.IntVar(&config.MaxChunks, "max-chunks", 0, "Write at most this many chunks in all, e.g. for an API that takes a bounded number of documents per batch (0 for no limit)")
+	fs.StringVar(&config.MaxChunksAction, "max-chunks-action", "stop", "At the -max-chunks limit: stop, writing the first chunks and listing the rest of the inputs in the manifest, or error, failing before anything is written")
+	fs.IntVar(&config.Budget, "budget", 0, "Total token budget, e.g. 2000000: write chunks in order until it is used, truncate the one that crosses it and drop the rest, listing them in the manifest (0 for no limit)")
+	fs.StringVar(&config.Report, "report", "", "Write a self-contained HTML report of the run, with its settings, statistics, warnings and sample chunks, to this file")
+	fs.StringVar(&tiers, "tiers", "", "Comma-separated chunk sizes, e.g. 256,1024,4096, to chunk the inputs at each size in one pass, into a directory per size")
+	fs.BoolVar(&dryRunOnly, "dry-run", false, "Chunk the input and list the files, ranges and sizes that would be written, without writing anything")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s chunk [options] [input ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] [input ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Chunk large files for AI processing. chunk is the default command.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
+		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s -input large_file.js -type lines -size 500 -overlap 25\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -input document.txt -type chars -size 4000\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -input code.py -type tokens -size 1500 -output ./chunks\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -input ./src -include '**/*.go' -exclude 'vendor/**'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -type tokens -size 1500 notes.md api.md changelog.md\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nRun '%s help' for the other commands.\n", os.Args[0])
 	}
 
-	flag.Parse()
+	fs.Parse(args)
 
-	if config.InputFile == "" {
-		fmt.Fprintf(os.Stderr, "Error: Input file is required\n\n")
-		flag.Usage()
-		os.Exit(1)
+	if showVersion {
+		fmt.Println(currentBuild())
+		return nil
 	}
 
-	// Set default prefix to input filename without extension
-	if config.Prefix == "" {
-		base := filepath.Base(config.InputFile)
-		config.Prefix = strings.TrimSuffix(base, filepath.Ext(base))
+	if err := applyEnvironment(fs); err != nil {
+		fatalf("%v", err)
+	}
+	if configFile != "" {
+		if err := applyConfigFile(fs, configFile); err != nil {
+			fatalf("%v", err)
+		}
 	}
 
-	// Validate input file exists
-	if _, err := os.Stat(config.InputFile); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: Input file does not exist: %s\n", config.InputFile)
-		os.Exit(1)
+	config.Inputs = append(config.Inputs, fs.Args()...)
+	config.resolveOverlap()
+
+	if err := config.applyConsole(); err != nil {
+		fatalf("%v", err)
 	}
+	setRateLimits(config.RPM, config.TPM)
 
-	// Validate chunk type
-	validTypes := map[string]bool{"lines": true, "chars": true, "tokens": true}
-	if !validTypes[config.ChunkType] {
-		fmt.Fprintf(os.Stderr, "Error: Invalid chunk type. Must be: lines, chars, or tokens\n")
+	if len(config.Inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "%s\n\n", trf("Error: %s", tr("Input file is required")))
+		fs.Usage()
 		os.Exit(1)
 	}
 
-	chunker := NewChunker(config)
+	// Validate input files exist
+	for _, input := range config.Inputs {
+		if _, err := os.Stat(input); os.IsNotExist(err) {
+			fatalf("Input file does not exist: %s", input)
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		fatalf("%v", err)
+	}
+	if config.Workers < 1 {
+		fatalf("-workers must be at least 1")
+	}
+	if config.Budget > 0 && (resume || watch || dryRunOnly || tiers != "") {
+		fatalf("-budget cannot be combined with -resume, -watch, -dry-run or -tiers")
+	}
 
-	fmt.Printf("Chunking file: %s\n", config.InputFile)
-	fmt.Printf("Chunk type: %s\n", config.ChunkType)
-	fmt.Printf("Chunk size: %d\n", config.ChunkSize)
-	fmt.Printf("Overlap: %d\n", config.OverlapSize)
-	fmt.Printf("Output directory: %s\n", config.OutputDir)
-	fmt.Println()
+	// Streaming to stdout keeps stdout for the chunks themselves
+	if outputIsStdout(config) {
+		console = os.Stderr
+		if formats := config.formats(); len(formats) > 1 {
+			fatalf("-output - streams a single format, got %s", config.Format)
+		}
+		if format := config.formats()[0]; !streamFormats[format] {
+			fatalf("the %s format cannot be streamed to stdout", format)
+		}
+	}
 
-	if err := chunker.Process(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	inputs, err := resolveInputs(config)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if len(inputs) == 0 {
+		fatalf("No input files matched in %s", strings.Join(config.Inputs, ", "))
+	}
+	if config.Boundaries != "" && len(inputs) > 1 && !config.MergeLogs {
+		fatalf("-boundaries applies to a single input file, got %d", len(inputs))
+	}
+
+	logEvent("run_started", "", map[string]any{
+		"inputs":  config.Inputs,
+		"files":   len(inputs),
+		"type":    config.ChunkType,
+		"size":    config.ChunkSize,
+		"overlap": config.OverlapSize,
+		"output":  config.OutputDir,
+		"formats": config.formats(),
+	})
+	textf("Chunking: %s (%d file(s))\n", strings.Join(config.Inputs, ", "), len(inputs))
+	if config.Semantic {
+		_, _, model := config.embedding()
+		textf("Chunk type: semantic (%s)\n", model)
+	} else if config.Diff {
+		textf("Chunk type: diff\n")
+	} else if config.Subtitles {
+		textf("Chunk type: subtitles\n")
+	} else {
+		textf("Chunk type: %s\n", config.ChunkType)
+	}
+	if config.Boundaries != "" {
+		textf("Boundaries: %s\n", config.Boundaries)
+	} else {
+		textf("Chunk size: %s\n", config.sizeString())
+	}
+	textf("Overlap: %d\n", config.OverlapSize)
+	if outputIsStdout(config) {
+		textf("Output: stdout\n")
+	} else if outputIsFile(config) {
+		textf("Output file: %s\n", config.OutputDir)
+	} else {
+		textf("Output directory: %s\n", config.OutputDir)
+	}
+	textf("\n")
+
+	if policyFile != "" {
+		if activePolicy, err = loadPolicy(policyFile); err != nil {
+			fatalf("%v", err)
+		}
+		if err := activePolicy.check(config); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if config.SinkCheck {
+		if err := checkSinks(config); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if watch && (outputIsStdout(config) || dryRunOnly) {
+		fatalf("-watch needs an output directory or file, and cannot be combined with -dry-run")
+	}
+	if watch && watchInterval <= 0 {
+		fatalf("-watch-interval must be positive")
+	}
+
+	// The watch keeps looking at the files being merged
+	watched := inputs
+	if config.MergeLogs {
+		if config, inputs, err = mergeLogInputs(config, inputs); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if tiers != "" {
+		sizes, err := parseTiers(tiers)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if resume || watch || dryRunOnly || outputIsStdout(config) || outputIsFile(config) || config.Boundaries != "" || config.Report != "" {
+			fatalf("-tiers needs an output directory and cannot be combined with -resume, -watch, -dry-run, -boundaries or -report")
+		}
+		if err := chunkTiers(config, inputs, sizes); err != nil {
+			fatalf("%v", err)
+		}
+		return nil
+	}
+
+	if dryRunOnly {
+		dryRun(config, inputs)
+		return nil
+	}
+
+	checkpointing := !outputIsStdout(config) && len(config.formats()) == 1 && config.formats()[0] == "files" && config.Budget == 0
+	if resume {
+		if !checkpointing {
+			fatalf("-resume needs the files format and an output directory")
+		}
+		cp, err := loadCheckpoint(config, auxiliaryPath(config, checkpointFilename))
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if cp == nil {
+			logWarning(trf("no checkpoint in %s; starting from the beginning", config.OutputDir), nil)
+		} else {
+			config.Checkpoint = cp
+			logEvent("resumed", trf("Resuming after chunk %d (%s)", cp.Index, cp.Source), map[string]any{"index": cp.Index, "source": cp.Source, "end": cp.End})
+			textf("\n")
+		}
+	}
+
+	manifest, err := chunkRun(config, inputs, checkpointing)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if watch {
+		config.Checkpoint = nil
+		watchInputs(config, watched, manifest, watchInterval, checkpointing)
+	}
+	return nil
+}
+
+// chunkRun chunks the inputs into the configured outputs and writes the
+// run-level files, returning the manifest of the run.
+func chunkRun(config ChunkConfig, inputs []inputFile, checkpointing bool) (*Manifest, error) {
+	// The passes over the inputs share the sentence embeddings, and a -budget
+	// cut embeds its chunk again
+	if (config.Semantic || config.Embed != "") && config.Embedder == nil {
+		config.Embedder = newEmbeddingClient(config)
+	}
+	if config.MaxChunks > 0 && config.MaxChunksAction == "error" {
+		if err := checkChunkLimit(config, inputs); err != nil {
+			return nil, err
+		}
+	}
+	// Create output directory if it doesn't exist
+	if !outputIsStdout(config) {
+		if err := config.filesystem().MkdirAll(outputDir(config)); err != nil {
+			return nil, fmt.Errorf(tr("error creating output directory: %v"), err)
+		}
+	}
+
+	writer, err := newChunkWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	// Runs that write chunk files keep a checkpoint to resume from
+	var progress *checkpointWriter
+	if checkpointing {
+		progress = newCheckpointWriter(writer, config, auxiliaryPath(config, checkpointFilename))
+		writer = progress
+	}
+
+	// JSON events already let an orchestrator follow the run
+	if config.Progress && !logJSON {
+		runProgress = newProgressBar(config, inputs)
+	}
+	if config.Report != "" {
+		runReport = newReportCollector(config.now())
+		defer func() { runReport = nil }()
+	}
+	if config.RedactSecrets && config.Redactions == nil {
+		config.Redactions = &redactionLog{}
+	}
+	if config.PromptTemplate != "" {
+		if config.Prompt, err = newPromptWrapper(config, inputs); err != nil {
+			return nil, err
+		}
+	}
+	manifest := NewManifest(config)
+	if config.Budget > 0 {
+		err = chunkWithinBudget(config, inputs, writer, manifest)
+	} else {
+		err = chunkInputs(config, inputs, writer, manifest)
+	}
+	if err == nil {
+		err = flushChunks(writer)
+	}
+	runProgress.finish()
+	runProgress = nil
+	if err != nil {
+		writer.Close()
+		if progress != nil {
+			progress.save()
+		}
+		return nil, err
+	}
+	// A failed sink does not stop the others; report it after the rest of the output is written
+	closeErr := writer.Close()
+
+	// A stream has no place for run-level files
+	if config.WriteManifest && !outputIsStdout(config) {
+		if err := manifest.Write(config.filesystem(), auxiliaryPath(config, manifestFilename)); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Questions > 0 && !outputIsStdout(config) {
+		if err := writeQuestions(config.filesystem(), auxiliaryPath(config, questionsFilename), manifest); err != nil {
+			return nil, err
+		}
+	}
+	if config.Redactions != nil && !outputIsStdout(config) {
+		if err := config.Redactions.write(config.filesystem(), auxiliaryPath(config, redactionsFilename)); err != nil {
+			return nil, err
+		}
+	}
+	if runReport != nil {
+		if err := writeReport(config, manifest, runReport); err != nil {
+			return nil, err
+		}
+	}
+
+	textf("\n")
+	manifest.Stats.Print()
+	manifest.printTransforms()
+	if config.Redactions != nil && len(config.Redactions.entries) > 0 {
+		logEvent("redacted", trf("Redacted %d secret(s): %s", len(config.Redactions.entries), config.Redactions.summary()), map[string]any{"redactions": len(config.Redactions.entries)})
+	}
+	if d := manifest.Dedupe; d != nil {
+		if d.Action == "drop" {
+			logEvent("deduplicated", trf("Dropped %d near-duplicate chunk(s)", len(d.Dropped)), map[string]any{"dropped": len(d.Dropped)})
+		} else {
+			logEvent("deduplicated", trf("Flagged %d near-duplicate chunk(s)", d.Flagged), map[string]any{"flagged": d.Flagged})
+		}
 	}
 
-	fmt.Println("\nChunking completed successfully!")
+	if closeErr != nil {
+		if progress != nil {
+			progress.save()
+		}
+		return nil, closeErr
+	}
+	if progress != nil {
+		if err := progress.finish(); err != nil {
+			return nil, fmt.Errorf(tr("error removing checkpoint: %v"), err)
+		}
+	}
+	textf("\n")
+	logEvent("completed", tr("Chunking completed successfully!"), nil)
+	return manifest, nil
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+const manifestFilename = "manifest.json"
+
+// Manifest describes every chunk produced by a run, across all input files.
+type Manifest struct {
+	CreatedAt   time.Time         `json:"created_at"`
+	Build       BuildInfo         `json:"build"`
+	ChunkType   string            `json:"chunk_type"`
+	ChunkSize   int               `json:"chunk_size"`
+	SizeUnit    string            `json:"size_unit,omitempty"` // bytes for a byte -size of char chunks, tokens or seconds for subtitles
+	Semantic    *semanticReport   `json:"semantic,omitempty"`  // how -type semantic found the boundaries of the char chunks
+	OverlapSize int               `json:"overlap"`
+	Tokenizer   string            `json:"tokenizer"`                 // what the chunks' token counts are counted with
+	Transforms  []string          `json:"transforms,omitempty"`      // applied to every source before chunking
+	Context     bool              `json:"context_header,omitempty"`  // chunks start with a context header
+	Prompt      string            `json:"prompt_template,omitempty"` // template the chunks were wrapped in
+	Sources     []string          `json:"sources"`
+	Files       []ManifestFile    `json:"files"`
+	Stats       RunStats          `json:"stats"`
+	Budget      *budgetReport     `json:"budget,omitempty"`     // chunks kept and dropped under -budget
+	MaxChunks   *chunkLimitReport `json:"max_chunks,omitempty"` // where the run stopped at -max-chunks
+	Dedupe      *dedupeReport     `json:"dedupe,omitempty"`     // near-duplicates dropped or flagged
+	Embedding   *embeddingInfo    `json:"embedding,omitempty"`  // how the chunk embeddings were made
+	Chunks      []ManifestChunk   `json:"chunks"`
+}
+
+// ManifestChunk records where a chunk came from. Start and End are line
+// numbers (inclusive) for line chunks, byte offsets for char chunks and
+// token indices for token chunks.
+type ManifestChunk struct {
+	Index   int    `json:"index"`
+	Source  string `json:"source"`
+	File    string `json:"file"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Overlap int    `json:"overlap,omitempty"` // leading units repeated from the previous chunk
+	Bytes   int    `json:"bytes"`
+	SHA256  string `json:"sha256"` // hex digest of the chunk content, without any metadata header
+	Tokens  int    `json:"tokens"` // in the chunk content, counted with the manifest's tokenizer
+
+	// Earliest and latest log timestamp in the chunk (-timestamps)
+	TimeStart string `json:"time_start,omitempty"`
+	TimeEnd   string `json:"time_end,omitempty"`
+
+	// Other inputs the chunk's code refers to (-code-refs)
+	References []codeReference `json:"references,omitempty"`
+
+	Questions []string `json:"questions,omitempty"`
+
+	// The earlier chunk this one nearly repeats (-dedupe-fuzzy -dedupe-action flag)
+	DuplicateOf int     `json:"duplicate_of,omitempty"`
+	Similarity  float64 `json:"similarity,omitempty"`
+
+	Embedding []float32 `json:"embedding,omitempty"` // -embed
+
+	Meta  map[string]string `json:"meta,omitempty"`  // -meta
+	Git   *chunkGit         `json:"git,omitempty"`   // -git
+	Cells *cellRange        `json:"cells,omitempty"` // of a notebook
+}
+
+// ManifestFile describes an input file as it was read, so that merge can
+// restore it byte for byte: line chunks always end lines with \n, so the
+// original line endings and final newline are recorded here.
+type ManifestFile struct {
+	Path         string `json:"path"`
+	Bytes        int64  `json:"bytes"`
+	SHA256       string `json:"sha256"`
+	LineEnding   string `json:"line_ending"` // lf, crlf or mixed
+	FinalNewline bool   `json:"final_newline"`
+	Encoding     string `json:"encoding,omitempty"` // transcoded to UTF-8 from, for chunking
+
+	// Lines changed by each pre-chunk transform
+	Transformed map[string]int `json:"transformed,omitempty"`
+
+	Git *chunkGit `json:"git,omitempty"` // commit and path, without a last commit (-git)
+
+	Notebook *notebookInfo `json:"notebook,omitempty"` // chunked as its cells rendered as text
+}
+
+// sourceDigest is written everything a Chunker reads from its input and
+// builds the input's ManifestFile. The line endings of a transcoded input
+// are those of its text, written to decoded.
+type sourceDigest struct {
+	hash    hash.Hash
+	bytes   int64
+	endings lineEndings
+	decoded *lineEndings
+}
+
+func newSourceDigest() *sourceDigest {
+	return &sourceDigest{hash: sha256.New()}
+}
+
+func (d *sourceDigest) Write(p []byte) (int, error) {
+	d.endings.Write(p)
+	d.bytes += int64(len(p))
+	return d.hash.Write(p)
+}
+
+// transcoded returns the writer for the UTF-8 text of a transcoded input.
+func (d *sourceDigest) transcoded() io.Writer {
+	d.decoded = &lineEndings{}
+	return d.decoded
+}
+
+func (d *sourceDigest) file(path string) ManifestFile {
+	endings := d.endings
+	if d.decoded != nil {
+		endings = *d.decoded
+	}
+	ending := "lf"
+	if endings.crlf > 0 {
+		ending = "crlf"
+		if endings.lf > 0 {
+			ending = "mixed"
+		}
+	}
+	return ManifestFile{
+		Path:         path,
+		Bytes:        d.bytes,
+		SHA256:       hex.EncodeToString(d.hash.Sum(nil)),
+		LineEnding:   ending,
+		FinalNewline: endings.last == '\n',
+	}
+}
+
+// lineEndings counts the line endings of what is written to it.
+type lineEndings struct {
+	lf, crlf int
+	last     byte
+}
+
+func (e *lineEndings) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			if e.last == '\r' {
+				e.crlf++
+			} else {
+				e.lf++
+			}
+		}
+		e.last = b
+	}
+	return len(p), nil
+}
+
+func NewManifest(config ChunkConfig) *Manifest {
+	provider, _, model := config.embedding()
+	var semantic *semanticReport
+	if config.Semantic {
+		semantic = &semanticReport{Model: model, Percentile: config.SemanticPercentile}
+	}
+	var embedding *embeddingInfo
+	if config.Embed != "" {
+		embedding = &embeddingInfo{Provider: provider, Model: model}
+	}
+	return &Manifest{
+		CreatedAt:   config.now().UTC(),
+		Build:       currentBuild(),
+		ChunkType:   config.ChunkType,
+		ChunkSize:   config.chunkSize(),
+		SizeUnit:    config.sizeUnit(),
+		Semantic:    semantic,
+		Embedding:   embedding,
+		OverlapSize: config.OverlapSize,
+		Tokenizer:   tokenizerName,
+		Transforms:  config.transformNames(),
+		Context:     config.ContextHeader,
+		Prompt:      config.PromptTemplate,
+	}
+}
+
+func (m *Manifest) Add(source ManifestFile, chunks []ManifestChunk, stats RunStats) {
+	m.Sources = append(m.Sources, source.Path)
+	m.Files = append(m.Files, source)
+	m.Chunks = append(m.Chunks, chunks...)
+	m.Stats.merge(stats)
+	if m.Embedding != nil && m.Embedding.Dimensions == 0 && len(m.Chunks) > 0 {
+		m.Embedding.Dimensions = len(m.Chunks[0].Embedding)
+	}
+}
+
+// sourceEncoding returns the encoding a source was transcoded from before
+// chunking, or "" if it is UTF-8.
+func (m *Manifest) sourceEncoding(path string) string {
+	for _, file := range m.Files {
+		if file.Path == path {
+			return file.Encoding
+		}
+	}
+	return ""
+}
+
+// sourceNotebook returns what the manifest records of a source that is a
+// notebook, nil for other sources.
+func (m *Manifest) sourceNotebook(path string) *notebookInfo {
+	for _, file := range m.Files {
+		if file.Path == path {
+			return file.Notebook
+		}
+	}
+	return nil
+}
+
+// readSource reads a source as it was chunked: as UTF-8, transcoded again
+// from its encoding if it had one.
+func (m *Manifest) readSource(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if encoding := m.sourceEncoding(path); encoding != "" {
+		data, _ = decodeBytes(data, encoding)
+	}
+	return data, nil
+}
+
+// printTransforms reports how many lines each transform changed in total.
+func (m *Manifest) printTransforms() {
+	for _, name := range m.Transforms {
+		changed := 0
+		for _, file := range m.Files {
+			changed += file.Transformed[name]
+		}
+		logEvent("transformed", trf("Transform %s changed %d line(s)", name, changed), map[string]any{"transform": name, "lines": changed})
+	}
+}
+
+func (m *Manifest) Write(fsys FS, filename string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %v", err)
+	}
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	return nil
+}
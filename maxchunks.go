@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errChunkLimit stops a Chunker at its -max-chunks limit.
+var errChunkLimit = errors.New("chunk limit reached")
+
+// chunkLimitReport records where a run stopped at -max-chunks: the input it
+// cut short, if it stopped within one, and the inputs it did not chunk.
+type chunkLimitReport struct {
+	Limit    int      `json:"limit"`
+	CutShort string   `json:"cut_short,omitempty"`
+	Skipped  []string `json:"skipped,omitempty"`
+}
+
+// drainInput reads the rest of an input cut short by -max-chunks, so that
+// its manifest entry describes the whole file rather than the part chunked.
+func (c *Chunker) drainInput() error {
+	c.digest = newSourceDigest()
+	c.transformed = map[string]int{}
+	file, err := c.openInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(io.Discard, file); err != nil {
+		return fmt.Errorf("error reading input: %v", err)
+	}
+	return nil
+}
+
+// checkChunkLimit chunks the inputs without writing anything, for
+// -max-chunks-action error, and fails if they make more than -max-chunks
+// chunks. It stops at the first chunk over the limit.
+func checkChunkLimit(config ChunkConfig, inputs []inputFile) error {
+	manifest, err := countChunks(config, inputs)
+	if err != nil {
+		return err
+	}
+	if manifest.MaxChunks != nil {
+		return fmt.Errorf(tr("the inputs make more than %d chunks (-max-chunks); raise -size or -max-chunks, or use -max-chunks-action stop"), config.MaxChunks)
+	}
+	return nil
+}
+
+// discardWriter drops every chunk written to it.
+type discardWriter struct{}
+
+func (discardWriter) WriteChunk(chunk *Chunk) error { return nil }
+func (discardWriter) Close() error                  { return nil }
+
+// countChunks chunks the inputs without writing anything, quietly, as the
+// run itself reports what it finds, and returns the manifest of the chunks
+// the run would write. Counting must not call out to an LLM or embed the
+// chunks, nor record them in the run's prompts, near-duplicates and
+// redactions, and it names them the default way, as it is what names by the
+// total count.
+func countChunks(config ChunkConfig, inputs []inputFile) (*Manifest, error) {
+	config.Questions = 0
+	config.Embed = ""
+	config.Prompt, config.Dedupe = nil, nil
+	if config.Redactions != nil {
+		config.Redactions = &redactionLog{}
+	}
+	config.NameTemplate, config.IndexWidth = defaultNameTemplate, 3
+	level := consoleLevel
+	consoleLevel = levelError
+	defer func() { consoleLevel = level }()
+	manifest := NewManifest(config)
+	if err := chunkInputs(config, inputs, discardWriter{}, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mcpProtocolVersions are the Model Context Protocol revisions mcp speaks,
+// newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool is a tool as tools/list describes it.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content           []mcpContent `json:"content"`
+	StructuredContent any          `json:"structuredContent,omitempty"`
+	IsError           bool         `json:"isError,omitempty"`
+}
+
+// mcpServer serves the chunk_file and get_chunk tools to an MCP host over
+// stdio, one JSON-RPC message per line. It keeps the chunks of each file it
+// chunked, for get_chunk to return them one at a time.
+type mcpServer struct {
+	server chunkServer
+	roots  []string           // directories the tools may read, all if none
+	chunks map[string][]Chunk // by absolute path
+	out    *json.Encoder
+}
+
+func defineMCPFlags(fs *flag.FlagSet, s *serveFlags, config *ChunkConfig) {
+	fs.StringVar(&s.configFile, "config", "", "YAML config file with default option values (command-line flags and FILECHUNKER_* variables take precedence)")
+	fs.StringVar(&s.policyFile, "policy", "", "Policy file restricting the endpoints chunks may be sent to, e.g. for -embed")
+	fs.IntVar(&config.MaxChunks, "max-chunks", 0, "Return at most this many chunks per file (0 for no limit)")
+	fs.StringVar(&config.MaxChunksAction, "max-chunks-action", "stop", "At the -max-chunks limit: stop, returning the first chunks, or error, failing the tool call")
+}
+
+func runMCP(args []string) error {
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	var config ChunkConfig
+	m := &mcpServer{server: chunkServer{define: defineMCPFlags}, chunks: map[string][]Chunk{}}
+	defineChunkFlags(fs, &config)
+	m.server.define(fs, &m.server.flags, &config)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s mcp [options] [directory ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Serve chunking to an MCP host such as Claude Desktop over stdio, with the tools\n")
+		fmt.Fprintf(os.Stderr, "chunk_file and get_chunk. The tools read files in the directories given, or any file if none are.\n")
+		fmt.Fprintf(os.Stderr, "The chunk options below are the defaults; tool calls may set these:\n  %s\n\n", strings.Join(serveOptionNames(), ", "))
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	// stdout carries the protocol
+	console = os.Stderr
+	if err := m.server.start(fs, args); err != nil {
+		return err
+	}
+	consoleLevel = max(consoleLevel, levelWarn)
+
+	for _, root := range fs.Args() {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			return fmt.Errorf("not a directory: %s", root)
+		}
+		m.roots = append(m.roots, abs)
+	}
+	m.out = json.NewEncoder(os.Stdout)
+	return m.serve(os.Stdin)
+}
+
+// serve answers the messages of in until it ends.
+func (m *mcpServer) serve(in io.Reader) error {
+	r := bufio.NewReader(in)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			m.handle(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading from the MCP host: %v", err)
+		}
+	}
+}
+
+func (m *mcpServer) handle(line []byte) {
+	var msg rpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		m.reply(json.RawMessage("null"), nil, &rpcError{rpcParseError, err.Error()})
+		return
+	}
+	// Notifications, such as notifications/initialized, and responses need
+	// no answer
+	if msg.ID == nil || msg.Method == "" {
+		return
+	}
+	if msg.JSONRPC != "2.0" {
+		m.reply(msg.ID, nil, &rpcError{rpcInvalidRequest, "not a JSON-RPC 2.0 request"})
+		return
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		protocol := mcpProtocolVersions[0]
+		for _, v := range mcpProtocolVersions {
+			if v == params.ProtocolVersion {
+				protocol = v
+			}
+		}
+		m.reply(msg.ID, map[string]any{
+			"protocolVersion": protocol,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "file-chunker", "version": currentBuild().Version},
+			"instructions":    "Use chunk_file to split a local file into chunks that fit a context window, then get_chunk to read them one at a time.",
+		}, nil)
+	case "ping":
+		m.reply(msg.ID, map[string]any{}, nil)
+	case "tools/list":
+		m.reply(msg.ID, map[string]any{"tools": mcpTools()}, nil)
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			m.reply(msg.ID, nil, &rpcError{rpcInvalidParams, err.Error()})
+			return
+		}
+		var result mcpToolResult
+		var err error
+		switch params.Name {
+		case "chunk_file":
+			result, err = m.chunkFile(params.Arguments)
+		case "get_chunk":
+			result, err = m.getChunk(params.Arguments)
+		default:
+			m.reply(msg.ID, nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool %q", params.Name)})
+			return
+		}
+		// A tool that fails tells the model why, as a result
+		if err != nil {
+			result = mcpToolResult{Content: []mcpContent{{"text", err.Error()}}, IsError: true}
+		}
+		m.reply(msg.ID, result, nil)
+	default:
+		m.reply(msg.ID, nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %q", msg.Method)})
+	}
+}
+
+func (m *mcpServer) reply(id json.RawMessage, result any, err *rpcError) {
+	if err := m.out.Encode(rpcMessage{JSONRPC: "2.0", ID: id, Result: result, Error: err}); err != nil {
+		logWarning(trf("error writing to the MCP host: %v", err), nil)
+	}
+}
+
+func mcpTools() []mcpTool {
+	path := map[string]any{"type": "string", "description": "Path of the file, absolute or relative to the first directory the server was given"}
+	options := map[string]any{
+		"type":                 "object",
+		"additionalProperties": map[string]any{"type": "string"},
+		"description":          "Other chunk options by name, e.g. {\"grep\": \"ERROR\", \"redact-secrets\": \"true\"}. Allowed: " + strings.Join(serveOptionNames(), ", "),
+	}
+	return []mcpTool{
+		{
+			Name:        "chunk_file",
+			Description: "Split a local file into chunks, by lines, characters or tokens, and list them with their line or character ranges and token counts. Read the chunks with get_chunk, or set include_content to get them all at once.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":            path,
+					"type":            map[string]any{"type": "string", "enum": []string{"lines", "chars", "tokens", "semantic", "diff", "subtitles"}, "description": "How to measure chunks"},
+					"size":            map[string]any{"type": "integer", "description": "Chunk size, in lines, characters or tokens per -type"},
+					"overlap":         map[string]any{"type": "integer", "description": "Lines, characters or tokens each chunk repeats from the one before"},
+					"options":         options,
+					"include_content": map[string]any{"type": "boolean", "description": "Return the content of every chunk, not only the list"},
+				},
+				"required": []string{"path"},
+			},
+		},
+		{
+			Name:        "get_chunk",
+			Description: "Return one chunk of a file chunk_file chunked, by its index, counting from 1. A file not chunked yet is chunked with the default options first.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":  path,
+					"index": map[string]any{"type": "integer", "minimum": 1, "description": "Index of the chunk, as chunk_file lists it"},
+				},
+				"required": []string{"path", "index"},
+			},
+		},
+	}
+}
+
+// chunkFile implements the chunk_file tool.
+func (m *mcpServer) chunkFile(args map[string]any) (mcpToolResult, error) {
+	path, err := m.path(args)
+	if err != nil {
+		return mcpToolResult{}, err
+	}
+	params := url.Values{}
+	for _, name := range []string{"type", "size", "overlap"} {
+		if v, ok := args[name]; ok {
+			params.Set(name, mcpString(v))
+		}
+	}
+	if options, ok := args["options"].(map[string]any); ok {
+		for name, v := range options {
+			params.Add(name, mcpString(v))
+		}
+	}
+	chunks, err := m.chunk(path, params)
+	if err != nil {
+		return mcpToolResult{}, err
+	}
+	withContent, _ := args["include_content"].(bool)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d chunk(s) of %s:\n", len(chunks), path)
+	records := make([]jsonlRecord, 0, len(chunks))
+	for i := range chunks {
+		record := newJSONLRecord(&chunks[i])
+		unit := "chars"
+		if record.Type == "lines" {
+			unit = "lines"
+		}
+		fmt.Fprintf(&b, "%d: %s %d-%d, %d tokens\n", record.Index, unit, record.Start, record.End, record.Tokens)
+		if withContent {
+			fmt.Fprintf(&b, "\n%s\n", record.Content)
+		} else {
+			record.Content = ""
+		}
+		records = append(records, record)
+	}
+	return mcpToolResult{
+		Content:           []mcpContent{{"text", b.String()}},
+		StructuredContent: map[string]any{"path": path, "chunks": records},
+	}, nil
+}
+
+// getChunk implements the get_chunk tool.
+func (m *mcpServer) getChunk(args map[string]any) (mcpToolResult, error) {
+	path, err := m.path(args)
+	if err != nil {
+		return mcpToolResult{}, err
+	}
+	index, ok := args["index"].(float64)
+	if !ok {
+		return mcpToolResult{}, errors.New("index must be a number")
+	}
+	chunks, ok := m.chunks[path]
+	if !ok {
+		if chunks, err = m.chunk(path, nil); err != nil {
+			return mcpToolResult{}, err
+		}
+	}
+	for i := range chunks {
+		if float64(chunks[i].Index) == index {
+			record := newJSONLRecord(&chunks[i])
+			return mcpToolResult{Content: []mcpContent{{"text", record.Content}}, StructuredContent: record}, nil
+		}
+	}
+	return mcpToolResult{}, fmt.Errorf("%s has no chunk %v; it has %d", path, index, len(chunks))
+}
+
+// chunk chunks the file at path with the server's options and params,
+// keeping the chunks for get_chunk.
+func (m *mcpServer) chunk(path string, params url.Values) ([]Chunk, error) {
+	config, err := m.server.config(params)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory; give the path of a file", path)
+	}
+	config.Inputs = []string{path}
+	inputs, err := resolveInputs(config)
+	if err != nil {
+		return nil, err
+	}
+	writer := &memoryWriter{}
+	if err := chunkInputs(config, inputs, writer, NewManifest(config)); err != nil {
+		return nil, err
+	}
+	m.chunks[path] = writer.chunks
+	return writer.chunks, nil
+}
+
+// path returns the absolute path of the path argument of a tool call, which
+// must be within the server's directories if it has any.
+func (m *mcpServer) path(args map[string]any) (string, error) {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	if !filepath.IsAbs(path) && len(m.roots) > 0 {
+		path = filepath.Join(m.roots[0], path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if len(m.roots) == 0 {
+		return path, nil
+	}
+	for _, root := range m.roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the directories this server may read: %s", path, strings.Join(m.roots, ", "))
+}
+
+// mcpString returns a tool argument as a flag value.
+func mcpString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a flag value for an amount of memory or data, such as 512MB
+// or 2GiB. Units are binary: 1KB and 1KiB are both 1024 bytes.
+type byteSize int64
+
+var byteUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+	"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+	"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+	"T": 1 << 40, "TB": 1 << 40, "TIB": 1 << 40,
+}
+
+func parseByteSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimRight(value, "kKmMgGtTiIbB ")
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(value[len(number):]))]
+	n, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: use e.g. 512MB or 2GB", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+func (s *byteSize) String() string {
+	if *s == 0 {
+		return "0"
+	}
+	return strings.ReplaceAll(formatBytes(int64(*s)), " ", "")
+}
+
+func (s *byteSize) Set(value string) error {
+	n, err := parseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*s = byteSize(n)
+	return nil
+}
+
+// Memory held per input byte by the strategies that keep a whole input in
+// memory, measured on English text: chars keep the read buffer and the
+// text, tokens also a slice of their spans and strings, and lines that are
+// cut after reading (-boundaries, -time-window, -lsp) every line.
+const (
+	charsMemoryFactor  = 3
+	tokensMemoryFactor = 14
+	linesMemoryFactor  = 3
+)
+
+// checkMemory refuses an input whose chunking strategy would need more than
+// -max-memory, before anything is read. Line chunking streams and is only
+// limited in the length of a line, see lineScanner.
+func (c *Chunker) checkMemory() error {
+	if c.config.MaxMemory <= 0 {
+		return nil
+	}
+	info, err := c.config.filesystem().Stat(c.config.InputFile)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+
+	var factor int64
+	switch {
+	case c.config.ChunkType == "tokens":
+		factor = tokensMemoryFactor
+	case c.config.ChunkType == "chars" && c.config.Mmap:
+		factor = charsMemoryFactor - 1
+	case c.config.ChunkType == "chars":
+		factor = charsMemoryFactor
+	case c.config.Boundaries != "" || c.config.TimeWindow > 0 || c.config.LSPClient != nil:
+		factor = linesMemoryFactor
+	default:
+		return nil
+	}
+	if need := info.Size() * factor; need > int64(c.config.MaxMemory) {
+		return fmt.Errorf("chunking it needs about %s of memory, over the -max-memory of %s; use line chunking, which streams, or raise -max-memory",
+			formatBytes(need), formatBytes(int64(c.config.MaxMemory)))
+	}
+	return nil
+}
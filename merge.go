@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const metadataContentMarker = "=== CONTENT ===\n\n"
+
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory of chunk files written by the files format (required)")
+	output := fs.String("output", "", "File to write the reconstructed source to (required)")
+	manifestPath := fs.String("manifest", "", "Manifest describing the chunks (default: manifest.json in the input directory)")
+	source := fs.String("source", "", "Source file to reconstruct when the manifest covers several")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s merge -input ./chunks -output original.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s join -input ./chunks -output original.txt\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Reassemble a source file from its chunks, removing metadata headers and overlap.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *input == "" || *output == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*input, manifestFilename)
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if !validChunkTypes[m.ChunkType] {
+		return fmt.Errorf("unsupported chunk type in %s: %s", *manifestPath, m.ChunkType)
+	}
+	if m.Context {
+		return fmt.Errorf("the chunks start with context headers, so they do not hold the source text; chunk again without -context-header to merge")
+	}
+	if m.Prompt != "" {
+		return fmt.Errorf("the chunks were wrapped in the prompt template %s, so they do not hold the source text; chunk again without -prompt-template to merge", m.Prompt)
+	}
+	file, err := m.selectFile(*source)
+	if err != nil {
+		return err
+	}
+
+	var chunks []ManifestChunk
+	for _, chunk := range m.Chunks {
+		if chunk.Source == file.Path {
+			chunks = append(chunks, chunk)
+		}
+	}
+	content, err := mergeChunks(*input, m.ChunkType, chunks)
+	if err != nil {
+		return err
+	}
+
+	// Token chunks keep the tokens but not the whitespace between them,
+	// which is taken back from the source at the recorded token ranges
+	restored := false
+	if m.ChunkType == "tokens" && len(m.Transforms) == 0 && file.Encoding == "" && file.Notebook == nil {
+		end := 0
+		if len(chunks) > 0 {
+			end = chunks[len(chunks)-1].End
+		}
+		if source, err := os.ReadFile(file.Path); err == nil {
+			content, restored = restoreTokenWhitespace(content, string(source), end)
+		}
+	}
+
+	// Transformed, transcoded or notebook chunks hold different text, so
+	// there is nothing to compare the source checksum with
+	verified := false
+	if file.SHA256 != "" && (m.ChunkType != "tokens" || restored) && len(m.Transforms) == 0 && file.Encoding == "" && file.Notebook == nil {
+		if m.ChunkType == "lines" {
+			content = restoreLineEndings(content, file)
+		}
+		sum := sha256.Sum256([]byte(content))
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			if m.ChunkType == "lines" && file.LineEnding == "mixed" {
+				return fmt.Errorf("%s mixes line endings, which line chunks do not preserve; it cannot be reconstructed byte for byte", file.Path)
+			}
+			return fmt.Errorf("reconstructed %s does not match its recorded checksum", file.Path)
+		}
+		verified = true
+	}
+
+	if err := os.WriteFile(*output, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing merged file: %v", err)
+	}
+
+	fmt.Printf("Merged %d chunks of %s into %s (%d bytes)\n", len(chunks), file.Path, *output, len(content))
+	switch {
+	case len(m.Transforms) > 0:
+		fmt.Fprintf(os.Stderr, "Note: the source was transformed (%s) before chunking; this is the transformed text\n", strings.Join(m.Transforms, ", "))
+	case file.Notebook != nil && m.ChunkType != "tokens":
+		fmt.Fprintln(os.Stderr, "Note: the source is a notebook, chunked as its cells rendered as text; this is that text")
+	case file.Encoding != "" && m.ChunkType != "tokens":
+		fmt.Fprintf(os.Stderr, "Note: the source was transcoded from %s before chunking; this is its text in UTF-8\n", file.Encoding)
+	case m.ChunkType == "tokens" && !restored:
+		fmt.Fprintf(os.Stderr, "Note: token chunks do not keep the original whitespace, and %s is missing or no longer holds their tokens; tokens were joined with single spaces\n", file.Path)
+	case !verified:
+		fmt.Fprintln(os.Stderr, "Warning: the manifest records no source checksum; the result was not verified")
+	}
+	return nil
+}
+
+func readManifest(filename string) (*Manifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding manifest %s: %v", filename, err)
+	}
+	return &m, nil
+}
+
+// selectFile picks the source to merge: the named one, or the only one.
+// Manifests written before sources were described only list their paths.
+func (m *Manifest) selectFile(path string) (ManifestFile, error) {
+	files := m.Files
+	if len(files) == 0 {
+		for _, source := range m.Sources {
+			files = append(files, ManifestFile{Path: source})
+		}
+	}
+
+	if path == "" {
+		if len(files) != 1 {
+			return ManifestFile{}, fmt.Errorf("the manifest covers %d sources; choose one with -source: %s", len(files), strings.Join(m.Sources, ", "))
+		}
+		return files[0], nil
+	}
+	for _, file := range files {
+		if file.Path == path {
+			return file, nil
+		}
+	}
+	return ManifestFile{}, fmt.Errorf("the manifest has no source %s", path)
+}
+
+// mergeChunks joins the cores of consecutive chunks, the content left when
+// the overlap is removed, checking that their recorded ranges follow on from
+// each other and that each chunk holds as many units as its range says.
+func mergeChunks(dir, chunkType string, chunks []ManifestChunk) (string, error) {
+	// Line ranges are 1-based and inclusive, byte and token ranges 0-based
+	// and exclusive
+	first := 0
+	if chunkType == "lines" {
+		first = 1
+	}
+
+	var b strings.Builder
+	next := first
+	for _, chunk := range chunks {
+		if chunk.Start+chunk.Overlap != next {
+			return "", fmt.Errorf("chunk %d (%s) starts its new %s at %d, expected %d", chunk.Index, chunk.File, chunkType, chunk.Start+chunk.Overlap, next)
+		}
+
+		content, err := readChunkContent(dir, chunk)
+		if err != nil {
+			return "", err
+		}
+		var units int
+		switch chunkType {
+		case "lines":
+			units = strings.Count(content, "\n")
+		case "chars":
+			units = len(content)
+		case "tokens":
+			units = len(tokenSpans(content))
+		}
+		if want := chunk.End - chunk.Start + first; units != want {
+			return "", fmt.Errorf("chunk %d (%s) has %d %s, the manifest says %d", chunk.Index, chunk.File, units, chunkType, want)
+		}
+
+		prefix := overlapPrefix(&Chunk{Type: chunkType, Overlap: chunk.Overlap, Content: content})
+		core := content[len(prefix):]
+		if chunkType == "tokens" {
+			core = strings.TrimLeft(core, " ")
+			if b.Len() > 0 && core != "" {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(core)
+		next = chunk.End + first
+	}
+	return b.String(), nil
+}
+
+// readChunkContent reads a chunk file and strips its metadata header. The
+// chunk checksum tells a header apart from content that happens to look like
+// one.
+func readChunkContent(dir string, chunk ManifestChunk) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, chunk.File))
+	if err != nil {
+		return "", fmt.Errorf("error reading chunk file: %v", err)
+	}
+	raw := string(data)
+
+	candidates := []string{raw}
+	if strings.HasPrefix(raw, "=== CHUNK ") {
+		if i := strings.Index(raw, "\n"+metadataContentMarker); i >= 0 {
+			candidates = []string{raw[i+1+len(metadataContentMarker):], raw}
+		}
+	}
+	if chunk.SHA256 == "" {
+		return candidates[0], nil
+	}
+	for _, content := range candidates {
+		if contentChecksum(content) == chunk.SHA256 {
+			return content, nil
+		}
+	}
+	return "", fmt.Errorf("chunk file %s does not match its checksum", chunk.File)
+}
+
+// restoreTokenWhitespace puts back the whitespace token chunks drop. content
+// is the first end tokens of source joined with single spaces; it is replaced
+// by the bytes of source those tokens span, the whole source if they are all
+// of its tokens. It reports false if source no longer holds those tokens.
+func restoreTokenWhitespace(content, source string, end int) (string, bool) {
+	spans := tokenSpans(source)
+	if end > len(spans) {
+		return content, false
+	}
+	tokens := make([]string, end)
+	for i, span := range spans[:end] {
+		tokens[i] = source[span[0]:span[1]]
+	}
+	if strings.Join(tokens, " ") != content {
+		return content, false
+	}
+	switch end {
+	case len(spans):
+		return source, true
+	case 0:
+		return "", true
+	}
+	return source[:spans[end-1][1]], true
+}
+
+// restoreLineEndings undoes the normalization of line chunks, which end
+// every line with \n: CRLF files get their \r back, and a missing final
+// newline is dropped again.
+func restoreLineEndings(content string, file ManifestFile) string {
+	if !file.FinalNewline && file.Bytes > 0 {
+		content = strings.TrimSuffix(content, "\n")
+	}
+	if file.LineEnding == "crlf" {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return content
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// metaKey is what a -meta key may look like, so that it can be a header
+// line, a JSON key and a column of any vector store.
+var metaKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// metaChunk is the data a -meta value is executed with.
+type metaChunk struct {
+	Index  int
+	Source string
+	File   string // chunk file name
+	Type   string
+	Start  int
+	End    int
+}
+
+// metaField is a -meta key=value pair, the value a template.
+type metaField struct {
+	key   string
+	value *template.Template
+}
+
+// metaFuncs are the functions -meta values may call besides the template
+// built-ins: env, the value of an environment variable, such as a CI
+// build's ticket ID.
+var metaFuncs = template.FuncMap{"env": os.Getenv}
+
+// parseMeta parses the -meta pairs, failing on keys that are not plain
+// names, keys given twice and templates that use fields metaChunk does not
+// have.
+func parseMeta(pairs []string) ([]metaField, error) {
+	var fields []metaField
+	seen := map[string]bool{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || !metaKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid -meta %q: use key=value, with a key of letters, digits, _, . and -", pair)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("-meta key %q is given more than once", key)
+		}
+		seen[key] = true
+		tmpl, err := template.New(key).Funcs(metaFuncs).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -meta %s value: %v", key, err)
+		}
+		if err := tmpl.Execute(io.Discard, metaChunk{}); err != nil {
+			return nil, fmt.Errorf("invalid -meta %s value: %v", key, err)
+		}
+		fields = append(fields, metaField{key, tmpl})
+	}
+	return fields, nil
+}
+
+// literalMeta returns a -meta pair whose value template executes to value
+// verbatim, "{{" included, for values that must not run as templates.
+func literalMeta(pair string) string {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok {
+		return pair
+	}
+	return key + "=" + strings.ReplaceAll(value, "{{", `{{"{{"}}`)
+}
+
+// expandMeta returns the -meta fields of chunk, nil if there are none.
+func expandMeta(fields []metaField, chunk *Chunk) (map[string]string, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	data := metaChunk{Index: chunk.Index, Source: chunk.Source, File: chunk.Filename, Type: chunk.Type, Start: chunk.Start, End: chunk.End}
+	meta := make(map[string]string, len(fields))
+	for _, field := range fields {
+		var b strings.Builder
+		if err := field.value.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("error expanding -meta %s: %v", field.key, err)
+		}
+		meta[field.key] = b.String()
+	}
+	return meta, nil
+}
+
+// sortedMetaKeys returns the keys of the -meta fields of a chunk, sorted,
+// for output that lists them in a stable order.
+func sortedMetaKeys(meta map[string]string) []string {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// queue passes chunks on to emit two behind when -min-size is set, so that
+// the last chunk of the input, once known, can be merged into the one
+// before it.
+func (c *Chunker) queue(chunk *Chunk) error {
+	if c.config.MinSize <= 0 {
+		return c.emit(chunk)
+	}
+	c.held = append(c.held, chunk)
+	if len(c.held) < 3 {
+		return nil
+	}
+	first := c.held[0]
+	c.held = c.held[1:]
+	return c.emit(first)
+}
+
+// flushQueue emits the held chunks at the end of the input, the last merged
+// into the one before it if it adds fewer than -min-size units.
+func (c *Chunker) flushQueue() error {
+	held := c.held
+	c.held = nil
+	if len(held) == 2 {
+		if units := c.newUnits(held[0], held[1]); units < c.config.MinSize {
+			mergeTail(held[0], held[1])
+			logDebug("tail_merged", trf("the last chunk of %s adds %d of the -min-size of %d, so it is merged into chunk %d", c.config.InputFile, units, c.config.MinSize, held[0].Index), map[string]any{"source": c.config.InputFile, "index": held[0].Index})
+			held = held[:1]
+		}
+	}
+	for _, chunk := range held {
+		if err := c.emit(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newUnits counts what last adds after the end of prev, in the units of
+// -size: lines, characters, bytes or tokens.
+func (c *Chunker) newUnits(prev, last *Chunk) int {
+	switch {
+	case last.Type == "chars" && c.config.SizeBytes:
+		return last.End - max(prev.End, last.Start)
+	case last.Type == "chars":
+		return utf8.RuneCountInString(last.Content[min(len(last.Content), max(0, prev.End-last.Start)):])
+	default:
+		return last.End - prev.End
+	}
+}
+
+// mergeTail extends prev with what last adds after it.
+func mergeTail(prev, last *Chunk) {
+	switch last.Type {
+	case "lines":
+		overlap := max(0, prev.End-last.Start+1)
+		lines := strings.SplitAfter(last.Content, "\n")
+		prev.Content += strings.Join(lines[min(overlap, len(lines)):], "")
+		prev.LineCount += last.LineCount - overlap
+	case "chars":
+		prev.Content += last.Content[min(len(last.Content), max(0, prev.End-last.Start)):]
+	case "tokens":
+		tokens := strings.Split(last.Content, " ")
+		if rest := tokens[min(len(tokens), max(0, prev.End-last.Start)):]; len(rest) > 0 {
+			prev.Content += " " + strings.Join(rest, " ")
+		}
+	}
+	prev.End = last.End
+}
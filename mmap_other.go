@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// mmapFile is not supported on this platform; -mmap reads the file instead.
+func mmapFile(path string) (data []byte, unmap func(), err error) {
+	return nil, nil, errors.New("memory mapping is not supported on this platform")
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps a file into memory read-only (-mmap). The data is valid
+// until unmap is called.
+func mmapFile(path string) (data []byte, unmap func(), err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %v", err)
+	}
+	// Empty files cannot be mapped, and a size beyond int cannot be addressed
+	size := info.Size()
+	if size == 0 {
+		return []byte{}, func() {}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("%s is too large to map", path)
+	}
+	data, err = syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error mapping file: %v", err)
+	}
+	return data, func() { syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultNameTemplate = "{{.Prefix}}_chunk_{{.Index}}{{.Ext}}"
+	chunkFileExt        = ".txt"
+)
+
+// chunkName is the data a -name-template is executed with.
+type chunkName struct {
+	Prefix    string
+	Index     string // chunk number, zero-padded to -index-width
+	Number    int    // chunk number without padding
+	Total     int    // chunks the run writes
+	Type      string
+	Start     int
+	End       int
+	StartLine int // same as Start; reads better in templates for line chunks
+	EndLine   int
+	Ext       string
+}
+
+// parseNameTemplate parses the chunk file name template, falling back to
+// the classic prefix_chunk_001.txt naming.
+func parseNameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultNameTemplate
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %v", err)
+	}
+	// Catch unknown fields before any chunk is written
+	if err := tmpl.Execute(io.Discard, chunkName{}); err != nil {
+		return nil, fmt.Errorf("invalid name template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// chunkFilename renders the file name of chunk from the name template.
+func (c *Chunker) chunkFilename(chunk *Chunk) (string, error) {
+	var b strings.Builder
+	err := c.nameTemplate.Execute(&b, chunkName{
+		Prefix:    c.config.Prefix,
+		Index:     fmt.Sprintf("%0*d", c.config.IndexWidth, chunk.Index),
+		Number:    chunk.Index,
+		Total:     c.config.ChunkTotal,
+		Type:      chunk.Type,
+		Start:     chunk.Start,
+		End:       chunk.End,
+		StartLine: chunk.Start,
+		EndLine:   chunk.End,
+		Ext:       chunkFileExt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error applying name template: %v", err)
+	}
+
+	name := b.String()
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("name template produced an invalid file name %q", name)
+	}
+	return name, nil
+}
+
+// indexWidthAuto is -index-width auto: as wide as the number of the run's
+// last chunk.
+const indexWidthAuto = -1
+
+// indexWidthValue is the -index-width flag, a number or auto.
+type indexWidthValue struct{ width *int }
+
+func (v indexWidthValue) String() string {
+	switch {
+	case v.width == nil:
+		return ""
+	case *v.width == indexWidthAuto:
+		return "auto"
+	}
+	return strconv.Itoa(*v.width)
+}
+
+func (v indexWidthValue) Set(value string) error {
+	if value == "auto" {
+		*v.width = indexWidthAuto
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid width %q: use a number of digits or auto", value)
+	}
+	*v.width = n
+	return nil
+}
+
+// numbersByTotal reports whether chunk names depend on how many chunks the
+// run writes, which a counting pass finds out first.
+func (config ChunkConfig) numbersByTotal() bool {
+	return config.IndexWidth == indexWidthAuto || strings.Contains(config.NameTemplate, ".Total")
+}
+
+// chunkNames catches name templates that give two chunks the same file name,
+// which would silently overwrite one with the other.
+type chunkNames map[string]bool
+
+func (n *chunkNames) add(name string) error {
+	if *n == nil {
+		*n = make(chunkNames)
+	}
+	if (*n)[name] {
+		return fmt.Errorf("name template gives more than one chunk the file name %s; include {{.Index}} to keep names unique", name)
+	}
+	(*n)[name] = true
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ansiEscape matches the terminal colour codes of tracebacks in notebook
+// error outputs.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// notebookText is the text of a notebook cell or output, which nbformat
+// stores as a string or as a list of lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = notebookText(s)
+	return nil
+}
+
+// notebookDocument is the part of an nbformat 4 notebook that is chunked.
+type notebookDocument struct {
+	Format   int            `json:"nbformat"`
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+type notebookCell struct {
+	Type    string           `json:"cell_type"` // markdown, code or raw
+	Source  notebookText     `json:"source"`
+	Outputs []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	Type      string                  `json:"output_type"` // stream, execute_result, display_data or error
+	Text      notebookText            `json:"text"`
+	Data      map[string]notebookText `json:"data"`
+	Name      string                  `json:"ename"`
+	Value     string                  `json:"evalue"`
+	Traceback []string                `json:"traceback"`
+}
+
+// notebookInfo records a Jupyter notebook input in the manifest: its chunks
+// hold the cells rendered as text, not the notebook's JSON.
+type notebookInfo struct {
+	Cells   int  `json:"cells"`
+	Outputs bool `json:"outputs,omitempty"` // code cell outputs were included (-notebook-outputs)
+}
+
+// cellRange is the cells, from 1, that a chunk of a notebook holds lines of.
+type cellRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// notebook renders a Jupyter notebook input as text for chunking: markdown
+// and raw cells as they are, code cells in fenced blocks in the notebook's
+// language, followed with -notebook-outputs by their text outputs, with a
+// blank line between cells. It keeps where each cell starts, as a line and
+// a byte offset of the text, to cut chunks between cells and to tell the
+// cells of each chunk.
+type notebook struct {
+	outputs bool
+	cells   []notebookCell
+	lines   []int // first line of each cell, from 1
+	offsets []int // byte offset of each cell
+}
+
+func isNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+// render reads the notebook from r and returns its text.
+func (n *notebook) render(r io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc notebookDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid notebook: %v", err)
+	}
+	if doc.Format < 4 {
+		return nil, fmt.Errorf("nbformat %d notebooks are not supported; convert it with jupyter nbconvert --to notebook", doc.Format)
+	}
+	language := doc.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = doc.Metadata.Kernelspec.Language
+	}
+
+	var b strings.Builder
+	line := 1
+	n.cells, n.lines, n.offsets = doc.Cells, nil, nil
+	for i, cell := range doc.Cells {
+		if i > 0 {
+			b.WriteString("\n")
+			line++
+		}
+		n.lines, n.offsets = append(n.lines, line), append(n.offsets, b.Len())
+		start := b.Len()
+		switch cell.Type {
+		case "code":
+			writeFenced(&b, language, string(cell.Source))
+			if n.outputs {
+				if out := cellOutputText(cell.Outputs); out != "" {
+					b.WriteString("\n")
+					writeFenced(&b, "output", out)
+				}
+			}
+		default:
+			b.WriteString(string(cell.Source))
+			if cell.Source != "" && !strings.HasSuffix(string(cell.Source), "\n") {
+				b.WriteString("\n")
+			}
+		}
+		line += strings.Count(b.String()[start:], "\n")
+	}
+	return strings.NewReader(b.String()), nil
+}
+
+// writeFenced writes text in a Markdown code block, with a fence longer
+// than any run of backticks in it.
+func writeFenced(b *strings.Builder, info, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	text = strings.TrimSuffix(text, "\n")
+	fmt.Fprintf(b, "%s%s\n", fence, info)
+	if text != "" {
+		b.WriteString(text + "\n")
+	}
+	b.WriteString(fence + "\n")
+}
+
+// cellOutputText returns the text of a code cell's outputs: its streams,
+// the plain text of its results and displays, and its errors without
+// terminal colours. Images and other binary data are named, not included.
+func cellOutputText(outputs []notebookOutput) string {
+	var parts []string
+	for _, out := range outputs {
+		switch out.Type {
+		case "stream":
+			parts = append(parts, string(out.Text))
+		case "execute_result", "display_data":
+			if text, ok := out.Data["text/plain"]; ok {
+				parts = append(parts, string(text))
+				continue
+			}
+			var types []string
+			for mime := range out.Data {
+				types = append(types, mime)
+			}
+			sort.Strings(types)
+			if len(types) > 0 {
+				parts = append(parts, "["+strings.Join(types, ", ")+" output]")
+			}
+		case "error":
+			text := out.Name + ": " + out.Value
+			if len(out.Traceback) > 0 {
+				text = ansiEscape.ReplaceAllString(strings.Join(out.Traceback, "\n"), "")
+			}
+			parts = append(parts, text)
+		}
+	}
+	for i, part := range parts {
+		parts[i] = strings.TrimSuffix(part, "\n")
+	}
+	return strings.Join(parts, "\n")
+}
+
+// boundaries returns where chunks of the notebook's lines may start, from
+// 0: at every cell but a code cell right after a markdown cell, which it
+// goes with, as that cell says what the code does.
+func (n *notebook) boundaries() []int {
+	var starts []int
+	for i, cell := range n.cells {
+		if i > 0 && cell.Type == "code" && n.cells[i-1].Type == "markdown" {
+			continue
+		}
+		starts = append(starts, n.lines[i]-1)
+	}
+	return starts
+}
+
+// cellsOf returns the cells chunk holds lines of, found by the lines of
+// line chunks and the byte offsets of char chunks; token chunks have no
+// cells.
+func (n *notebook) cellsOf(chunk *Chunk) *cellRange {
+	var starts []int
+	first, last := chunk.Start, chunk.End
+	switch chunk.Type {
+	case "lines":
+		starts = n.lines
+	case "chars":
+		starts, last = n.offsets, max(chunk.Start, chunk.End-1)
+	default:
+		return nil
+	}
+	if len(starts) == 0 {
+		return nil
+	}
+	// The cell of a position is the last one starting at or before it
+	cell := func(pos int) int {
+		return max(1, sort.SearchInts(starts, pos+1))
+	}
+	return &cellRange{First: cell(first), Last: cell(last)}
+}
+
+// chunkNotebookCells implements the cell chunking of notebooks: line chunks
+// start between cells, each holding as many whole cells as fit in -size
+// lines. A cell longer than that is split every -size lines.
+func (c *Chunker) chunkNotebookCells() error {
+	lines, err := c.readLines()
+	if err != nil {
+		return err
+	}
+
+	logDebug("notebook_rendered", fmt.Sprintf("%s: %d cells in %d lines", c.config.InputFile, len(c.notebook.cells), len(lines)), map[string]any{"source": c.config.InputFile, "cells": len(c.notebook.cells), "lines": len(lines)})
+	return c.chunkLinesPacked(lines, c.notebook.boundaries())
+}
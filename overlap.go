@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// overlapSetting is an -overlap value: a size in the units of -size, or a
+// percentage of -size such as 10%, which becomes a size once -size is known.
+type overlapSetting struct {
+	size    int
+	percent float64 // 0 for a size
+}
+
+// parseOverlap reads an overlap size, or a percentage below 100.
+func parseOverlap(value string) (overlapSetting, error) {
+	value = strings.TrimSpace(value)
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || percent < 0 || percent >= 100 {
+			return overlapSetting{}, fmt.Errorf("invalid overlap %q: a percentage must be at least 0%% and below 100%%", value)
+		}
+		return overlapSetting{percent: percent}, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return overlapSetting{}, fmt.Errorf("invalid overlap %q: use a size such as 50 or a percentage such as 10%%", value)
+	}
+	return overlapSetting{size: size}, nil
+}
+
+// forSize returns the overlap in units for chunks of size units; a
+// percentage is rounded down.
+func (o overlapSetting) forSize(size int) int {
+	if o.percent > 0 {
+		return int(float64(size) * o.percent / 100)
+	}
+	return o.size
+}
+
+// overlapValue is the -overlap flag, setting OverlapSize and OverlapPercent.
+type overlapValue struct {
+	size    *int
+	percent *float64
+}
+
+func (v overlapValue) String() string {
+	switch {
+	case v.size == nil:
+		return ""
+	case *v.percent > 0:
+		return strconv.FormatFloat(*v.percent, 'g', -1, 64) + "%"
+	}
+	return strconv.Itoa(*v.size)
+}
+
+func (v overlapValue) Set(value string) error {
+	o, err := parseOverlap(value)
+	if err != nil {
+		return err
+	}
+	*v.size, *v.percent = o.size, o.percent
+	return nil
+}
+
+// resolveOverlap sets OverlapSize for the chunk size of config when
+// -overlap is a percentage.
+func (config *ChunkConfig) resolveOverlap() {
+	config.OverlapSize = overlapSetting{config.OverlapSize, config.OverlapPercent}.forSize(config.ChunkSize)
+}
+
+// sizeValue is the -size flag: a number of units of -type, for char
+// chunks a byte size such as 4MB or 128KiB, which sets SizeBytes, or for
+// subtitle chunks a duration such as 10m, which sets SizeDuration. 10m is
+// both; -type decides which it is, see sizeDuration.
+type sizeValue struct {
+	size     *int
+	bytes    *bool
+	duration *time.Duration
+}
+
+func (v sizeValue) String() string {
+	switch {
+	case v.size == nil:
+		return ""
+	case *v.duration > 0 && !*v.bytes:
+		return v.duration.String()
+	case *v.bytes:
+		return strings.ReplaceAll(formatBytes(int64(*v.size)), " ", "")
+	}
+	return strconv.Itoa(*v.size)
+}
+
+func (v sizeValue) Set(value string) error {
+	*v.duration = 0
+	if size, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		*v.size, *v.bytes = size, false
+		return nil
+	}
+	duration, durationErr := time.ParseDuration(strings.TrimSpace(value))
+	if durationErr == nil && duration > 0 {
+		*v.duration = duration
+	}
+	size, err := parseByteSize(value)
+	if err == nil && size <= math.MaxInt32 {
+		*v.size, *v.bytes = int(size), true
+		return nil
+	}
+	if *v.duration == 0 {
+		return fmt.Errorf("invalid size %q: use a number such as 1000, with -type chars a byte size such as 4MB, or with -type subtitles a duration such as 10m", value)
+	}
+	*v.size, *v.bytes = int(duration.Seconds()), false
+	return nil
+}
+
+// sizeDuration returns the -size duration of subtitle chunks, 0 if -size is
+// a number of tokens or the chunks are not subtitles.
+func (config ChunkConfig) sizeDuration() time.Duration {
+	if !config.Subtitles {
+		return 0
+	}
+	return config.SizeDuration
+}
+
+// chunkSize is the manifest's chunk size: -size in its unit, seconds for a
+// duration.
+func (config ChunkConfig) chunkSize() int {
+	if d := config.sizeDuration(); d > 0 {
+		return int(d.Seconds())
+	}
+	return config.ChunkSize
+}
+
+// sizeString describes the chunk size for people: a number of units, or a
+// byte size.
+func (config ChunkConfig) sizeString() string {
+	if config.sizeDuration() > 0 || config.SizeDuration > 0 && !config.SizeBytes {
+		return config.SizeDuration.String()
+	}
+	if config.SizeBytes {
+		return formatBytes(int64(config.ChunkSize))
+	}
+	return strconv.Itoa(config.ChunkSize)
+}
+
+// sizeUnit is the unit of the manifest's chunk size when it is not that of
+// the chunk type.
+func (config ChunkConfig) sizeUnit() string {
+	switch {
+	case config.sizeDuration() > 0:
+		return "seconds"
+	case config.Subtitles:
+		return "tokens"
+	case config.SizeBytes:
+		return "bytes"
+	}
+	return ""
+}
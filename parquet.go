@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Parquet output is written with a small built-in encoder so the tool keeps
+// its zero-dependency build: every column is REQUIRED, PLAIN-encoded and
+// uncompressed, with one data page per column per row group.
+
+const (
+	parquetMagic = "PAR1"
+
+	// Flush a row group once this much column data is buffered
+	parquetRowGroupBytes = 64 << 20
+
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+)
+
+type parquetColumn struct {
+	name     string
+	physical int32
+	data     bytes.Buffer
+}
+
+type parquetColumnMeta struct {
+	column     *parquetColumn
+	offset     int64
+	size       int64
+	numValues  int64
+	pageOffset int64
+}
+
+type parquetRowGroup struct {
+	columns   []parquetColumnMeta
+	totalSize int64
+	numRows   int64
+}
+
+// parquetWriter writes all chunks plus their metadata into one Parquet file.
+type parquetWriter struct {
+	filename  string
+	file      io.WriteCloser
+	w         *bufio.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int64 // rows buffered in the current row group
+	totalRows int64
+	buffered  int
+	groups    []parquetRowGroup
+}
+
+func newParquetWriter(fsys FS, filename string) (*parquetWriter, error) {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Parquet file: %v", err)
+	}
+
+	w := &parquetWriter{filename: filename, file: file, w: bufio.NewWriter(file)}
+	for _, col := range []struct {
+		name     string
+		physical int32
+	}{
+		{"index", parquetInt64},
+		{"source", parquetByteArray},
+		{"file", parquetByteArray},
+		{"type", parquetByteArray},
+		{"start", parquetInt64},
+		{"end", parquetInt64},
+		{"overlap", parquetInt64},
+		{"bytes", parquetInt64},
+		{"tokens", parquetInt64},
+		{"content", parquetByteArray},
+	} {
+		w.columns = append(w.columns, &parquetColumn{name: col.name, physical: col.physical})
+	}
+
+	if err := w.write([]byte(parquetMagic)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *parquetWriter) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing Parquet file: %v", err)
+	}
+	return nil
+}
+
+func (w *parquetWriter) WriteChunk(chunk *Chunk) error {
+	values := []any{
+		int64(chunk.Index),
+		chunk.Source,
+		chunk.Filename,
+		chunk.Type,
+		int64(chunk.Start),
+		int64(chunk.End),
+		int64(chunk.Overlap),
+		int64(len(chunk.Content)),
+		int64(chunk.Tokens),
+		chunk.Content,
+	}
+
+	for i, value := range values {
+		col := w.columns[i]
+		switch v := value.(type) {
+		case int64:
+			binary.Write(&col.data, binary.LittleEndian, v)
+			w.buffered += 8
+		case string:
+			binary.Write(&col.data, binary.LittleEndian, uint32(len(v)))
+			col.data.WriteString(v)
+			w.buffered += 4 + len(v)
+		}
+	}
+	w.rows++
+	w.totalRows++
+
+	if w.buffered >= parquetRowGroupBytes {
+		if err := w.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	logChunk(chunk, trf("row in %s", w.filename))
+	return nil
+}
+
+func (w *parquetWriter) flushRowGroup() error {
+	if w.rows == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{numRows: w.rows}
+	for _, col := range w.columns {
+		var header thriftWriter
+		header.i32(1, 0) // type: DATA_PAGE
+		header.i32(2, int32(col.data.Len()))
+		header.i32(3, int32(col.data.Len()))
+		header.beginStruct(5) // data_page_header
+		header.i32(1, int32(w.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		meta := parquetColumnMeta{
+			column:     col,
+			offset:     w.offset,
+			pageOffset: w.offset,
+			numValues:  w.rows,
+			size:       int64(header.buf.Len() + col.data.Len()),
+		}
+		if err := w.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := w.write(col.data.Bytes()); err != nil {
+			return err
+		}
+		col.data.Reset()
+
+		group.columns = append(group.columns, meta)
+		group.totalSize += meta.size
+	}
+
+	w.groups = append(w.groups, group)
+	w.rows = 0
+	w.buffered = 0
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.flushRowGroup(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1) // version
+
+	meta.listBegin(2, thriftStruct, len(w.columns)+1) // schema
+	meta.beginListStruct()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(w.columns)))
+	meta.endStruct()
+	for _, col := range w.columns {
+		meta.beginListStruct()
+		meta.i32(1, col.physical)
+		meta.i32(3, 0) // repetition_type: REQUIRED
+		meta.binary(4, col.name)
+		if col.physical == parquetByteArray {
+			meta.i32(6, 0)       // converted_type: UTF8
+			meta.beginStruct(10) // logicalType
+			meta.beginStruct(1)  // STRING
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.endStruct()
+	}
+
+	meta.i64(3, w.totalRows)
+
+	meta.listBegin(4, thriftStruct, len(w.groups)) // row_groups
+	for _, group := range w.groups {
+		meta.beginListStruct()
+		meta.listBegin(1, thriftStruct, len(group.columns))
+		for _, col := range group.columns {
+			meta.beginListStruct()
+			meta.i64(2, col.offset) // file_offset
+			meta.beginStruct(3)     // meta_data
+			meta.i32(1, col.column.physical)
+			meta.listBegin(2, thriftI32, 2)
+			meta.listI32(parquetEncodingPlain)
+			meta.listI32(parquetEncodingRLE)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.listBinary(col.column.name)
+			meta.i32(4, 0) // codec: UNCOMPRESSED
+			meta.i64(5, col.numValues)
+			meta.i64(6, col.size)
+			meta.i64(7, col.size)
+			meta.i64(9, col.pageOffset)
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, group.totalSize)
+		meta.i64(3, group.numRows)
+		meta.endStruct()
+	}
+
+	meta.binary(6, "fileChunker")
+	meta.stop()
+
+	footer := meta.buf.Bytes()
+	if err := w.write(footer); err != nil {
+		w.file.Close()
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	if err := w.write(length[:]); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.write([]byte(parquetMagic)); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	if err := w.w.Flush(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("error writing Parquet file: %v", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("error closing Parquet file: %v", err)
+	}
+	return nil
+}
+
+// Thrift compact protocol, limited to what the Parquet footer needs.
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type thriftWriter struct {
+	buf       bytes.Buffer
+	lastField int16
+	fieldIDs  []int16 // lastField of each enclosing struct
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.buf.Write(b[:n])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastField; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.lastField = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginListStruct()
+}
+
+// beginListStruct starts a struct that is a list element and has no field header.
+func (t *thriftWriter) beginListStruct() {
+	t.fieldIDs = append(t.fieldIDs, t.lastField)
+	t.lastField = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.stop()
+	t.lastField = t.fieldIDs[len(t.fieldIDs)-1]
+	t.fieldIDs = t.fieldIDs[:len(t.fieldIDs)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
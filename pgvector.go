@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// pgvectorWriter stores chunks in a Postgres table with a pgvector column
+// (-sink pgvector), in the -collection table, created if it does not exist.
+// To keep the build free of drivers it streams SQL to psql, as sqliteWriter
+// does to sqlite3: the rows go in one COPY into a temporary table, upserted
+// into the table in the same transaction when the run ends.
+type pgvectorWriter struct {
+	table   string // quoted
+	index   string // quoted name of the table's vector index
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	w       *bufio.Writer
+	stderr  bytes.Buffer
+	copying bool // whether the COPY has started
+}
+
+func newPgvectorWriter(config ChunkConfig, _, _ string) (ChunkWriter, error) {
+	bin, err := exec.LookPath("psql")
+	if err != nil {
+		return nil, fmt.Errorf("-sink pgvector needs the psql command-line client in PATH: %v", err)
+	}
+
+	w := &pgvectorWriter{
+		table: quoteIdentifier(config.Collection),
+		index: quoteIdentifier(strings.ReplaceAll(config.Collection, ".", "_") + "_embedding"),
+		cmd:   exec.Command(bin, "-X", "-q", "-v", "ON_ERROR_STOP=1", "-d", config.DSN),
+	}
+	w.cmd.Stdout, w.cmd.Stderr = io.Discard, &w.stderr
+	w.stdin, err = w.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error starting psql: %v", err)
+	}
+	if err := w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting psql: %v", err)
+	}
+	w.w = bufio.NewWriter(w.stdin)
+	return w, nil
+}
+
+// checkPgvector connects to the database and checks pgvector is installed
+// or can be.
+func checkPgvector(config ChunkConfig, _, _ string) error {
+	bin, err := exec.LookPath("psql")
+	if err != nil {
+		return fmt.Errorf("-sink pgvector needs the psql command-line client in PATH: %v", err)
+	}
+	cmd := exec.Command(bin, "-X", "-q", "-v", "ON_ERROR_STOP=1", "-d", config.DSN, "-c",
+		"SELECT 1 FROM pg_available_extensions WHERE name = 'vector'")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error connecting to Postgres: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (w *pgvectorWriter) WriteChunk(chunk *Chunk) error {
+	if !w.copying {
+		// The first chunk gives the vector column its dimensions
+		_, err := fmt.Fprintf(w.w, `BEGIN;
+CREATE EXTENSION IF NOT EXISTS vector;
+CREATE TABLE IF NOT EXISTS %[1]s (
+  id uuid PRIMARY KEY,
+  content text NOT NULL,
+  metadata jsonb NOT NULL,
+  embedding vector(%[3]d) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s USING hnsw (embedding vector_cosine_ops);
+CREATE TEMP TABLE file_chunker_staging (LIKE %[1]s) ON COMMIT DROP;
+COPY file_chunker_staging (id, content, metadata, embedding) FROM STDIN;
+`, w.table, w.index, len(chunk.Embedding))
+		if err != nil {
+			return w.fail(err)
+		}
+		w.copying = true
+	}
+
+	metadata := flatMetadata(chunk)
+	delete(metadata, "content")
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("error encoding chunk metadata: %v", err)
+	}
+	vector := make([]string, len(chunk.Embedding))
+	for i, v := range chunk.Embedding {
+		vector[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	_, err = fmt.Fprintf(w.w, "%s\t%s\t%s\t[%s]\n", chunkUUID(chunk), copyEscape(chunk.Content), copyEscape(string(data)), strings.Join(vector, ","))
+	if err != nil {
+		return w.fail(err)
+	}
+
+	logChunk(chunk, trf("row in Postgres table %s", w.table))
+	return nil
+}
+
+func (w *pgvectorWriter) Close() error {
+	var err error
+	if w.copying {
+		_, err = fmt.Fprintf(w.w, `\.
+INSERT INTO %s SELECT * FROM file_chunker_staging
+  ON CONFLICT (id) DO UPDATE SET content = EXCLUDED.content, metadata = EXCLUDED.metadata, embedding = EXCLUDED.embedding;
+COMMIT;
+`, w.table)
+	}
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err != nil {
+		return w.fail(err)
+	}
+
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("error writing to Postgres: %v: %s", err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// fail stops psql after a write error, preferring its own error message,
+// which explains why the pipe broke.
+func (w *pgvectorWriter) fail(err error) error {
+	w.stdin.Close()
+	w.cmd.Wait()
+	if msg := strings.TrimSpace(w.stderr.String()); msg != "" {
+		return fmt.Errorf("error writing to Postgres: %s", msg)
+	}
+	return fmt.Errorf("error writing to Postgres: %v", err)
+}
+
+// quoteIdentifier quotes a Postgres table name, each part of one such as
+// public.chunks on its own.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// copyEscape escapes a column of COPY's text format. Postgres text cannot
+// hold NUL bytes, so they become U+FFFD.
+var copyEscape = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", "\uFFFD").Replace
+
+// dsnSettings returns the host and sslmode of a Postgres connection string,
+// given as a URL or as key=value settings. An empty host is a local socket.
+func dsnSettings(dsn string) (host, sslmode string) {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		return u.Hostname(), u.Query().Get("sslmode")
+	}
+	for _, field := range strings.Fields(dsn) {
+		key, value, _ := strings.Cut(field, "=")
+		value = strings.Trim(value, "'")
+		switch key {
+		case "host":
+			host = value
+		case "sslmode":
+			sslmode = value
+		}
+	}
+	return host, sslmode
+}
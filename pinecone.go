@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	pineconeBatch      = 100     // vectors per upsert
+	pineconeBatchBytes = 1 << 20 // content per upsert, well within the 2 MB a request may have
+)
+
+// pineconeWriter upserts chunks into a Pinecone index (-sink pinecone), at
+// the index host given with -sink-url, in the -namespace. Batches are sent
+// again on rate limits and server errors.
+type pineconeWriter struct {
+	store     *storeClient
+	url       string
+	namespace string
+	vectors   []pineconeVector
+	bytes     int // content in vectors
+	chunks    []*Chunk
+}
+
+type pineconeVector struct {
+	ID       string         `json:"id"`
+	Values   []float32      `json:"values"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+func newPineconeWriter(config ChunkConfig, url, apiKey string) (ChunkWriter, error) {
+	store := newPineconeClient(apiKey)
+	store.retries = config.Retries
+	return &pineconeWriter{store: store, url: url, namespace: config.Namespace}, nil
+}
+
+func newPineconeClient(apiKey string) *storeClient {
+	header := http.Header{}
+	header.Set("Api-Key", apiKey)
+	header.Set("X-Pinecone-API-Version", "2024-07")
+	return newStoreClient("Pinecone", header)
+}
+
+// checkPinecone asks the index for its statistics, which needs the host and
+// the API key to be right.
+func checkPinecone(config ChunkConfig, url, apiKey string) error {
+	_, err := newPineconeClient(apiKey).do(http.MethodPost, url+"/describe_index_stats", map[string]any{}, nil)
+	return err
+}
+
+func (w *pineconeWriter) WriteChunk(chunk *Chunk) error {
+	w.vectors = append(w.vectors, pineconeVector{ID: chunkUUID(chunk), Values: chunk.Embedding, Metadata: flatMetadata(chunk)})
+	w.bytes += len(chunk.Content)
+	w.chunks = append(w.chunks, chunk)
+	if len(w.vectors) < pineconeBatch && w.bytes < pineconeBatchBytes {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush upserts the vectors not sent yet.
+func (w *pineconeWriter) Flush() error {
+	if len(w.vectors) == 0 {
+		return nil
+	}
+	body := map[string]any{"vectors": w.vectors, "namespace": w.namespace}
+	if _, err := w.store.do(http.MethodPost, w.url+"/vectors/upsert", body, nil); err != nil {
+		return fmt.Errorf("error upserting chunks into Pinecone: %v", err)
+	}
+	for _, chunk := range w.chunks {
+		logChunk(chunk, trf("vector in Pinecone namespace %q", w.namespace))
+	}
+	w.vectors, w.bytes, w.chunks = nil, 0, nil
+	return nil
+}
+
+func (w *pineconeWriter) Close() error {
+	return w.Flush()
+}
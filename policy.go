@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// activePolicy restricts where chunks may go (-policy), or is nil. Code that
+// sends chunks over the network checks every URL against it.
+var activePolicy *policy
+
+// policy is a guardrail set up once for a team, e.g. through
+// FILECHUNKER_POLICY in a shared CI image, before sensitive corpora meet
+// external APIs. Empty lists allow everything.
+type policy struct {
+	file         string
+	formats      []string // output formats chunks may be written in
+	outputs      []string // directories chunks may be written under; - allows stdout
+	endpoints    []string // URL prefixes chunks may be sent to
+	requireHTTPS bool     // refuse plain HTTP except to the local machine
+	encryptTags  []string // -meta keys, or key=value pairs, whose chunks leave the machine only encrypted
+	tagged       string   // the -meta field of the run that requires encryption, see check
+}
+
+// loadPolicy reads a policy file, which uses the config file syntax:
+//
+//	allow-formats: [files, jsonl]
+//	allow-outputs: [./chunks, /data/chunks]
+//	allow-endpoints:
+//	  - https://llm.internal.example.com/
+//	require-https: true
+//	encrypt-tags: [classification=confidential, pii]
+func loadPolicy(filename string) (*policy, error) {
+	entries, err := loadConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &policy{file: filename}
+	for _, entry := range entries {
+		switch entry.Key {
+		case "allow-formats":
+			p.formats = entry.Values
+		case "allow-outputs":
+			for _, dir := range entry.Values {
+				if dir != "-" {
+					if dir, err = filepath.Abs(dir); err != nil {
+						return nil, fmt.Errorf("%s:%d: %v", filename, entry.Line, err)
+					}
+				}
+				p.outputs = append(p.outputs, dir)
+			}
+		case "allow-endpoints":
+			p.endpoints = entry.Values
+		case "require-https":
+			if len(entry.Values) != 1 || (entry.Values[0] != "true" && entry.Values[0] != "false") {
+				return nil, fmt.Errorf("%s:%d: require-https must be true or false", filename, entry.Line)
+			}
+			p.requireHTTPS = entry.Values[0] == "true"
+		case "encrypt-tags":
+			for _, tag := range entry.Values {
+				if key, _, _ := strings.Cut(tag, "="); !metaKey.MatchString(key) {
+					return nil, fmt.Errorf("%s:%d: invalid encrypt-tags entry %q: use a -meta key or key=value", filename, entry.Line, tag)
+				}
+			}
+			p.encryptTags = entry.Values
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown policy option %q", filename, entry.Line, entry.Key)
+		}
+	}
+	return p, nil
+}
+
+// check refuses a run whose outputs or endpoints the policy does not allow,
+// before anything is written or sent. A run tagging its chunks with one of
+// encrypt-tags may send them only over HTTPS or TLS, as with require-https.
+func (p *policy) check(config ChunkConfig) error {
+	if p == nil {
+		return nil
+	}
+	if tag := p.encryptedTag(config.Meta); tag != "" {
+		tagged := *p
+		tagged.requireHTTPS, tagged.tagged = true, tag
+		p = &tagged
+	}
+	for _, format := range config.formats() {
+		if len(p.formats) > 0 && !slices.Contains(p.formats, format) {
+			return fmt.Errorf("policy %s does not allow the %s format", p.file, format)
+		}
+	}
+	if err := p.allowOutput(config.OutputDir); err != nil {
+		return err
+	}
+	if config.Report != "" {
+		if err := p.allowOutput(config.Report); err != nil {
+			return err
+		}
+	}
+	if config.Semantic || config.Embed != "" {
+		_, endpoint, _ := config.embedding()
+		if err := p.allowURL(endpoint); err != nil {
+			return err
+		}
+	}
+	if config.ChromaPath != "" {
+		if err := p.allowOutput(config.ChromaPath); err != nil {
+			return err
+		}
+	} else if config.Sink == "pgvector" {
+		if err := p.allowDatabase(config.DSN); err != nil {
+			return err
+		}
+	} else if config.Sink != "" {
+		url, _ := config.sinkSettings()
+		if err := p.allowURL(url); err != nil {
+			return err
+		}
+	}
+	if config.Webhook != "" {
+		if err := p.allowURL(config.Webhook); err != nil {
+			return err
+		}
+	}
+	if config.Questions > 0 {
+		return p.allowURL(config.QuestionsEndpoint)
+	}
+	return nil
+}
+
+// encryptedTag returns the first of the -meta fields that encrypt-tags
+// lists, by key or by key and value. A value that is a template could
+// expand to any value, so it matches too.
+func (p *policy) encryptedTag(meta []string) string {
+	for _, field := range meta {
+		key, value, _ := strings.Cut(field, "=")
+		for _, tag := range p.encryptTags {
+			tagKey, tagValue, withValue := strings.Cut(tag, "=")
+			if key == tagKey && (!withValue || value == tagValue || strings.Contains(value, "{{")) {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// requirement says why the policy refuses unencrypted connections.
+func (p *policy) requirement(protocol string) string {
+	if p.tagged != "" {
+		return fmt.Sprintf("policy %s requires %s for chunks tagged %s", p.file, protocol, p.tagged)
+	}
+	return fmt.Sprintf("policy %s requires %s", p.file, protocol)
+}
+
+func (p *policy) allowOutput(output string) error {
+	if p == nil || len(p.outputs) == 0 {
+		return nil
+	}
+	if output == "-" {
+		if slices.Contains(p.outputs, "-") {
+			return nil
+		}
+		return fmt.Errorf("policy %s does not allow writing chunks to stdout", p.file)
+	}
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	for _, dir := range p.outputs {
+		if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy %s does not allow writing chunks to %s", p.file, output)
+}
+
+// allowURL refuses sending chunks to rawURL unless it starts with an
+// allowed prefix and, with require-https, uses HTTPS or the local machine.
+func (p *policy) allowURL(rawURL string) error {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	if p.requireHTTPS && u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		return fmt.Errorf("%s, refusing %s", p.requirement("HTTPS"), u.Redacted())
+	}
+	if len(p.endpoints) == 0 {
+		return nil
+	}
+	for _, prefix := range p.endpoints {
+		if strings.HasPrefix(rawURL, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy %s does not allow sending chunks to %s", p.file, u.Redacted())
+}
+
+// allowDatabase refuses sending chunks to the Postgres database of dsn
+// unless dsn starts with an allowed prefix and, with require-https or
+// encrypt-tags, the connection requires TLS or stays on the local machine.
+func (p *policy) allowDatabase(dsn string) error {
+	if p == nil {
+		return nil
+	}
+	host, sslmode := dsnSettings(dsn)
+	local := host == "" || strings.HasPrefix(host, "/") || isLoopback(host)
+	if p.requireHTTPS && !local && sslmode != "require" && sslmode != "verify-ca" && sslmode != "verify-full" {
+		return fmt.Errorf("%s, refusing the database at %s without sslmode=require", p.requirement("TLS"), host)
+	}
+	if len(p.endpoints) == 0 {
+		return nil
+	}
+	for _, prefix := range p.endpoints {
+		if strings.HasPrefix(dsn, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("policy %s does not allow sending chunks to the database at %s", p.file, host)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
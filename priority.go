@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// priorityRule gives the files matching a glob a weight (-priority): inputs
+// with a higher weight are chunked first, so that they come first in packed
+// output and are the last to be dropped by -budget.
+type priorityRule struct {
+	Pattern string
+	Weight  int
+}
+
+// parsePriorities reads rules of the form "glob=weight", e.g. "README*=10"
+// or "**/*_test.go=-10".
+func parsePriorities(values []string) ([]priorityRule, error) {
+	var rules []priorityRule
+	for _, value := range values {
+		pattern, weight, ok := strings.Cut(value, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		pattern = strings.TrimSpace(pattern)
+		if !ok || err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid -priority rule %q: use glob=weight, e.g. 'README*=10'", value)
+		}
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid -priority rule %q: %v", value, err)
+		}
+		rules = append(rules, priorityRule{Pattern: pattern, Weight: n})
+	}
+	return rules, nil
+}
+
+// priorityOf returns the weight of the first rule matching the file, or 0.
+// Patterns match the end of the path, so "README*" matches a README in any
+// directory and "docs/**" everything under any docs directory.
+func priorityOf(rules []priorityRule, p string) int {
+	p = filepath.ToSlash(p)
+	for _, rule := range rules {
+		if matchGlob("**/"+rule.Pattern, p) {
+			return rule.Weight
+		}
+	}
+	return 0
+}
+
+// sortByPriority orders inputs by descending weight, keeping the order they
+// were found in among inputs of the same weight.
+func sortByPriority(inputs []inputFile, rules []priorityRule) {
+	if len(rules) == 0 {
+		return
+	}
+	weights := make(map[string]int, len(inputs))
+	for _, input := range inputs {
+		weights[input.Path] = priorityOf(rules, input.Path)
+	}
+	sort.SliceStable(inputs, func(i, j int) bool {
+		return weights[inputs[i].Path] > weights[inputs[j].Path]
+	})
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// processIndexFilename lists the responses of a process run, in chunk order.
+const processIndexFilename = "responses.json"
+
+// processIndex is the responses.json of a process run.
+type processIndex struct {
+	Provider  string            `json:"provider"`
+	Endpoint  string            `json:"endpoint"`
+	Model     string            `json:"model"`
+	System    string            `json:"system,omitempty"`
+	Prompt    string            `json:"prompt"`
+	Responses []processResponse `json:"responses"`
+}
+
+// processResponse is the response to one chunk, or why there is none.
+type processResponse struct {
+	Index  int    `json:"index"`
+	Source string `json:"source"`
+	Chunk  string `json:"chunk"` // chunk file name
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	File   string `json:"file,omitempty"` // response file, relative to the output directory
+	Error  string `json:"error,omitempty"`
+}
+
+func runProcess(args []string) error {
+	fs := flag.NewFlagSet("process", flag.ExitOnError)
+
+	var config ChunkConfig
+	defineChunkFlags(fs, &config)
+	configFile := fs.String("config", "", "YAML config file with default option values (command-line flags and FILECHUNKER_* variables take precedence)")
+	policyFile := fs.String("policy", "", "Policy file restricting the endpoints chunks may be sent to")
+	prompt := fs.String("prompt", "", "Instruction sent with every chunk, a Go template with the -prompt-template fields; the chunk follows it unless it uses .Content")
+	system := fs.String("system", "", "System prompt sent with every chunk")
+	provider := fs.String("provider", "openai", "Chat API: openai, for OpenAI and compatible servers, or anthropic for the Anthropic Messages API")
+	endpoint := fs.String("endpoint", "", "Chat endpoint URL (defaults to the provider's, https://api.openai.com/v1/chat/completions or https://api.anthropic.com/v1/messages)")
+	model := fs.String("model", "", "Chat model (defaults to gpt-4o-mini, or claude-sonnet-4-5 for anthropic)")
+	apiKey := fs.String("api-key", "", "API key for the chat endpoint (defaults to $OPENAI_API_KEY, or $ANTHROPIC_API_KEY for anthropic)")
+	maxTokens := fs.Int("max-tokens", 0, "Most tokens a response may have (0 for the endpoint's default; anthropic, which needs a limit, then uses 4096)")
+	concurrency := fs.Int("concurrency", 2, "How many chunks to send at once")
+	force := fs.Bool("force", false, "Send every chunk, even those answered by an earlier run with the same prompt and model")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s process -prompt TEXT [options] [input ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Chunk the inputs and send each chunk with a prompt to an OpenAI-compatible chat endpoint or Anthropic,\n")
+		fmt.Fprintf(os.Stderr, "writing every response to a file of its own in -output (default responses), listed in %s.\n", processIndexFilename)
+		fmt.Fprintf(os.Stderr, "Chunks an earlier run with the same prompt and model answered are skipped, so running again retries the failures.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  %s process -type tokens -size 3000 -prompt 'Summarize this part of {{.Source}}:' report.md\n", os.Args[0])
+	}
+	fs.Parse(args)
+
+	if err := applyEnvironment(fs); err != nil {
+		return err
+	}
+	if *configFile != "" {
+		if err := applyConfigFile(fs, *configFile); err != nil {
+			return err
+		}
+	}
+	outputSet := false
+	fs.Visit(func(f *flag.Flag) {
+		outputSet = outputSet || f.Name == "output"
+	})
+	if !outputSet {
+		config.OutputDir = "responses"
+	}
+	config.Inputs = append(config.Inputs, fs.Args()...)
+	config.resolveOverlap()
+	if err := config.applyConsole(); err != nil {
+		return err
+	}
+	setRateLimits(config.RPM, config.TPM)
+	if len(config.Inputs) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if outputIsStdout(config) {
+		return errors.New("process writes its responses to an -output directory, not stdout")
+	}
+	if *concurrency < 1 {
+		return errors.New("-concurrency must be at least 1")
+	}
+	if _, ok := chatProviders[*provider]; !ok {
+		return fmt.Errorf("invalid -provider %q; must be openai or anthropic", *provider)
+	}
+	if *maxTokens < 0 {
+		return errors.New("-max-tokens must not be negative")
+	}
+	if *endpoint == "" {
+		*endpoint = chatProviders[*provider].endpoint
+	}
+	if *model == "" {
+		*model = chatProviders[*provider].model
+	}
+
+	// -prompt-template is the file form of -prompt
+	text := *prompt
+	if config.PromptTemplate != "" {
+		if text != "" {
+			return errors.New("give -prompt or -prompt-template, not both")
+		}
+		data, err := os.ReadFile(config.PromptTemplate)
+		if err != nil {
+			return fmt.Errorf("error reading prompt template: %v", err)
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return errors.New("-prompt or -prompt-template is required")
+	}
+	if !strings.Contains(text, ".Content") {
+		text = strings.TrimRight(text, "\n") + "\n\n{{.Content}}"
+	}
+	tmpl, err := parsePrompt(text)
+	if err != nil {
+		return err
+	}
+
+	if *policyFile != "" {
+		if activePolicy, err = loadPolicy(*policyFile); err != nil {
+			return err
+		}
+		if err := activePolicy.check(config); err != nil {
+			return err
+		}
+		if err := activePolicy.allowURL(*endpoint); err != nil {
+			return err
+		}
+	}
+
+	files, err := resolveInputs(config)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no input files matched in %s", strings.Join(config.Inputs, ", "))
+	}
+	if config.MergeLogs {
+		if config, files, err = mergeLogInputs(config, files); err != nil {
+			return err
+		}
+	}
+
+	// Chunking is quiet: the run reports the chunks as they are answered
+	level := consoleLevel
+	consoleLevel = max(consoleLevel, levelWarn)
+	writer := &memoryWriter{}
+	err = chunkInputs(config, files, writer, NewManifest(config))
+	consoleLevel = level
+	if err != nil {
+		return err
+	}
+	chunks := writer.chunks
+
+	wrapper := &promptWrapper{tmpl: tmpl, total: len(chunks), parts: map[string]int{}}
+	for _, chunk := range chunks {
+		wrapper.parts[chunk.Source]++
+	}
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	client := newCompleter(*provider, *endpoint, *model, *apiKey, *maxTokens, config.Retries)
+	index := processIndex{Provider: *provider, Endpoint: *endpoint, Model: *model, System: *system, Prompt: text, Responses: make([]processResponse, len(chunks))}
+	answered := map[processResponse]bool{}
+	if !*force {
+		answered = index.answered(filepath.Join(config.OutputDir, processIndexFilename))
+	}
+	textf("Processing: %d chunk(s) of %d file(s) with %s\n\n", len(chunks), len(files), *model)
+
+	type job struct {
+		i      int
+		prompt string
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sent, skipped, failed int
+	for range *concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				chunk, response := chunks[j.i], &index.Responses[j.i]
+				answer, err := client.Complete(*system, j.prompt)
+				if err == nil {
+					err = writeResponse(filepath.Join(config.OutputDir, response.File), answer)
+				}
+				mu.Lock()
+				if err != nil {
+					failed++
+					response.Error, response.File = err.Error(), ""
+					logWarning(trf("chunk %d of %s failed: %v", chunk.Index, chunk.Source, err), map[string]any{"index": chunk.Index, "source": chunk.Source, "error": err.Error()})
+				} else {
+					sent++
+					logEvent("chunk_processed", trf("Processed chunk %d: %s", chunk.Index, response.File), map[string]any{"index": chunk.Index, "source": chunk.Source, "file": response.File})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	parts := map[string]int{}
+	for i := range chunks {
+		chunk := chunks[i]
+		parts[chunk.Source]++
+		index.Responses[i] = processResponse{
+			Index: chunk.Index, Source: chunk.Source, Chunk: chunk.Filename, Start: chunk.Start, End: chunk.End,
+			File: strings.TrimSuffix(chunk.Filename, filepath.Ext(chunk.Filename)) + ".md",
+		}
+		// The prompt is made in order, as it counts the chunks
+		if err := wrapper.wrap(&chunk, parts[chunk.Source]); err != nil {
+			close(jobs)
+			wg.Wait()
+			return err
+		}
+		if answered[index.Responses[i]] {
+			mu.Lock()
+			skipped++
+			mu.Unlock()
+			logEvent("chunk_skipped", trf("Skipped chunk %d: %s has its response", chunk.Index, index.Responses[i].File), map[string]any{"index": chunk.Index, "file": index.Responses[i].File})
+			continue
+		}
+		jobs <- job{i, chunk.Content}
+	}
+	close(jobs)
+	wg.Wait()
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", processIndexFilename, err)
+	}
+	if err := os.WriteFile(filepath.Join(config.OutputDir, processIndexFilename), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", processIndexFilename, err)
+	}
+
+	logEvent("process_finished", "", map[string]any{"chunks": len(chunks), "sent": sent, "skipped": skipped, "failed": failed, "output": config.OutputDir})
+	textf("\nResponses: %d sent, %d skipped, %d failed, in %s\n", sent, skipped, failed, config.OutputDir)
+	if failed > 0 {
+		return fmt.Errorf(tr("%d of %d chunks failed; run process again to retry them"), failed, len(chunks))
+	}
+	return nil
+}
+
+// answered returns the responses of the earlier run whose index is at path
+// that a run of index can keep: those of the same chunks, asked with the same
+// prompt and model, whose files are still there.
+func (index processIndex) answered(path string) map[processResponse]bool {
+	answered := map[processResponse]bool{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return answered
+	}
+	var earlier processIndex
+	if err := json.Unmarshal(data, &earlier); err != nil {
+		logWarning(trf("ignoring %s: %v", path, err), nil)
+		return answered
+	}
+	if earlier.Provider != index.Provider || earlier.Endpoint != index.Endpoint || earlier.Model != index.Model || earlier.System != index.System || earlier.Prompt != index.Prompt {
+		return answered
+	}
+	for _, response := range earlier.Responses {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), response.File)); response.Error == "" && err == nil {
+			answered[response] = true
+		}
+	}
+	return answered
+}
+
+// writeResponse writes a response file through a temporary file, so that
+// an interrupted run never leaves one half written, which a rerun would
+// skip.
+func writeResponse(path, answer string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(answer, "\n") {
+		answer += "\n"
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(answer), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runProgress is the bar of the run in progress (-progress), or nil. While it
+// is shown it replaces the per-chunk "Created chunk" lines.
+var runProgress *progressBar
+
+// progressBar reports bytes read, chunks written, throughput and ETA on
+// stderr. On a terminal it redraws one line a few times a second; otherwise,
+// e.g. in a CI log, it prints a line every few seconds.
+type progressBar struct {
+	out      io.Writer
+	terminal bool
+	total    int64
+	read     map[string]int64 // bytes read so far, by source
+	chunks   int
+	started  time.Time
+	drawn    time.Time
+}
+
+const progressBarWidth = 30
+
+func newProgressBar(config ChunkConfig, inputs []inputFile) *progressBar {
+	p := &progressBar{out: os.Stderr, read: map[string]int64{}, started: time.Now()}
+	if info, err := os.Stderr.Stat(); err == nil {
+		p.terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+	for _, input := range inputs {
+		if info, err := config.filesystem().Stat(input.Path); err == nil {
+			p.total += info.Size()
+		}
+	}
+	return p
+}
+
+// chunk records a chunk of source, of which read bytes have been read.
+func (p *progressBar) chunk(source string, read int64) {
+	if p == nil {
+		return
+	}
+	p.read[source] = read
+	p.chunks++
+
+	interval := 5 * time.Second
+	if p.terminal {
+		interval = 100 * time.Millisecond
+	}
+	if now := time.Now(); now.Sub(p.drawn) >= interval {
+		p.drawn = now
+		p.draw(false)
+	}
+}
+
+// finish draws the final state and ends the line.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+	p.draw(true)
+}
+
+func (p *progressBar) draw(final bool) {
+	var read int64
+	for _, n := range p.read {
+		read += n
+	}
+	// Transforms such as -merge-logs can read more than the files hold
+	if final || read > p.total {
+		read = p.total
+	}
+
+	fraction := 1.0
+	if p.total > 0 {
+		fraction = float64(read) / float64(p.total)
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	elapsed := time.Since(p.started)
+	rate := float64(read) / max(elapsed.Seconds(), 0.001)
+	var eta string
+	switch {
+	case final:
+		eta = trf("done in %s", elapsed.Round(time.Second))
+	case rate > 0:
+		eta = trf("ETA %s", time.Duration(float64(p.total-read)/rate*float64(time.Second)).Round(time.Second))
+	default:
+		eta = trf("ETA %s", "-")
+	}
+
+	line := fmt.Sprintf("[%s] %3.0f%%  %s / %s  %s  %s/s  %s",
+		bar, fraction*100, formatBytes(read), formatBytes(p.total),
+		trf("%d chunks", p.chunks), formatBytes(int64(rate)), eta)
+	if p.terminal {
+		// Clear what is left of a longer previous line
+		fmt.Fprintf(p.out, "\r%s\033[K", line)
+		if final {
+			fmt.Fprintln(p.out)
+		}
+		return
+	}
+	fmt.Fprintln(p.out, line)
+}
+
+// formatBytes writes a byte count with a binary unit, e.g. 1.5 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
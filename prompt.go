@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// promptChunk is the data a -prompt-template is executed with.
+type promptChunk struct {
+	Index   int // position of the chunk in the run, 1 to Total
+	Total   int // chunks the run writes
+	Part    int // position of the chunk among those of its source, 1 to Parts
+	Parts   int
+	Number  int // chunk number, as in the file name
+	Source  string
+	Type    string
+	Start   int
+	End     int
+	Content string // the chunk's text, with its final newline
+}
+
+// promptWrapper wraps the content of every chunk of a run in a prompt
+// template (-prompt-template). The totals come from a counting pass over
+// the inputs before the run.
+type promptWrapper struct {
+	tmpl    *template.Template
+	total   int
+	parts   map[string]int // chunks of each source
+	written int            // chunks wrapped so far
+}
+
+// parsePromptTemplate parses a prompt template, failing on fields
+// promptChunk does not have.
+func parsePromptTemplate(fsys FS, filename string) (*template.Template, error) {
+	data, err := fsys.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt template: %v", err)
+	}
+	return parsePrompt(string(data))
+}
+
+// parsePrompt parses the text of a prompt template.
+func parsePrompt(text string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %v", err)
+	}
+	if err := tmpl.Execute(io.Discard, promptChunk{}); err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// newPromptWrapper parses the prompt template and counts the chunks the run
+// will write, in total and per source, so that every prompt can say which
+// part of how many it is.
+func newPromptWrapper(config ChunkConfig, inputs []inputFile) (*promptWrapper, error) {
+	tmpl, err := parsePromptTemplate(config.filesystem(), config.PromptTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := countChunks(config, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &promptWrapper{tmpl: tmpl, total: len(manifest.Chunks), parts: map[string]int{}}
+	for _, chunk := range manifest.Chunks {
+		p.parts[chunk.Source]++
+	}
+	return p, nil
+}
+
+// wrap replaces the content of chunk, the part-th of its source, with its
+// prompt.
+func (p *promptWrapper) wrap(chunk *Chunk, part int) error {
+	p.written++
+	var b strings.Builder
+	err := p.tmpl.Execute(&b, promptChunk{
+		Index:   p.written,
+		Total:   max(p.total, p.written),
+		Part:    part,
+		Parts:   max(p.parts[chunk.Source], part),
+		Number:  chunk.Index,
+		Source:  chunk.Source,
+		Type:    chunk.Type,
+		Start:   chunk.Start,
+		End:     chunk.End,
+		Content: chunk.Content,
+	})
+	if err != nil {
+		return fmt.Errorf("error applying prompt template: %v", err)
+	}
+	chunk.Content = b.String()
+	return nil
+}
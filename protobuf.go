@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protocol Buffers wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// protoEncoder appends the fields of a protobuf message, for the messages
+// of chunker.proto. Like proto3, it leaves out fields with zero values.
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (e *protoEncoder) int(field, v int) {
+	if v != 0 {
+		e.tag(field, protoVarint)
+		e.buf = binary.AppendUvarint(e.buf, uint64(int64(v)))
+	}
+}
+
+func (e *protoEncoder) string(field int, s string) {
+	if s != "" {
+		e.tag(field, protoBytes)
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+		e.buf = append(e.buf, s...)
+	}
+}
+
+// message appends an embedded message, even an empty one, as repeated
+// fields need their every element.
+func (e *protoEncoder) message(field int, m []byte) {
+	e.tag(field, protoBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(m)))
+	e.buf = append(e.buf, m...)
+}
+
+func (e *protoEncoder) double(field int, f float64) {
+	if f != 0 {
+		e.tag(field, protoFixed64)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+	}
+}
+
+// floats appends a packed repeated float field.
+func (e *protoEncoder) floats(field int, fs []float32) {
+	if len(fs) > 0 {
+		e.tag(field, protoBytes)
+		e.buf = binary.AppendUvarint(e.buf, uint64(4*len(fs)))
+		for _, f := range fs {
+			e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(f))
+		}
+	}
+}
+
+// decodeProto calls fn with each field of a protobuf message: its varint
+// or fixed value, or for length-delimited fields its bytes.
+func decodeProto(data []byte, fn func(field, wireType int, value uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), int(key&7)
+		var value uint64
+		var b []byte
+		switch wireType {
+		case protoVarint:
+			if value, n = binary.Uvarint(data); n <= 0 {
+				return errProtoTruncated
+			}
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return errProtoTruncated
+			}
+			value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return errProtoTruncated
+			}
+			value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return errProtoTruncated
+			}
+			b, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return errors.New("unsupported protobuf wire type")
+		}
+		if err := fn(field, wireType, value, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prunedSet is a chunk set that prune removed, or would remove with
+// -dry-run.
+type prunedSet struct {
+	Manifest  string    `json:"manifest"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []string  `json:"files"`
+}
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory to search for chunk sets, recursively (required)")
+	olderThan := fs.String("older-than", "", "Remove chunk sets whose manifest is older than this, e.g. 30d, 2w or 12h (required)")
+	dryRun := fs.Bool("dry-run", false, "List the chunk sets that would be removed without removing anything")
+	asJSON := fs.Bool("json", false, "Print the removed chunk sets as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s prune -input ./out -older-than 30d [-dry-run] [-json]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Remove expired chunk sets. A chunk set is found by its manifest, which dates it and\n")
+		fmt.Fprintf(os.Stderr, "lists its files; only those files and the run's other outputs are removed.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *input == "" || *olderThan == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+
+	sets, err := expiredChunkSets(*input, cutoff)
+	if err != nil {
+		return err
+	}
+
+	pruned := []prunedSet{}
+	for _, set := range sets {
+		if !*dryRun {
+			if err := removeChunkSet(set); err != nil {
+				return err
+			}
+		}
+		pruned = append(pruned, set)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(pruned)
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	for _, set := range pruned {
+		fmt.Printf("%s %s (%d files, created %s)\n", verb, set.Manifest, len(set.Files), set.CreatedAt.Format(time.RFC3339))
+	}
+	fmt.Printf("%s %d chunk set(s) older than %s\n", verb, len(pruned), *olderThan)
+	return nil
+}
+
+// parseAge reads a duration that may also be given in days (d) or weeks (w),
+// which time.ParseDuration does not know.
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q: use e.g. 30d, 2w or 12h", value)
+	}
+	return age, nil
+}
+
+// expiredChunkSets finds the manifests under dir created before cutoff.
+func expiredChunkSets(dir string, cutoff time.Time) ([]prunedSet, error) {
+	var sets []prunedSet
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (d.Name() != manifestFilename && !strings.HasSuffix(d.Name(), "."+manifestFilename)) {
+			return nil
+		}
+		m, err := readManifest(path)
+		if err != nil {
+			return err
+		}
+		if m.CreatedAt.IsZero() || !m.CreatedAt.Before(cutoff) {
+			return nil
+		}
+		sets = append(sets, prunedSet{Manifest: path, CreatedAt: m.CreatedAt, Files: chunkSetFiles(path, m)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching for chunk sets: %v", err)
+	}
+	return sets, nil
+}
+
+// chunkSetFiles lists the existing files of the run that wrote a manifest:
+// its chunk files, the single-file outputs of every format, and the
+// run-level files next to the manifest, which comes last.
+func chunkSetFiles(manifestPath string, m *Manifest) []string {
+	dir := filepath.Dir(manifestPath)
+	var candidates []string
+	if filepath.Base(manifestPath) == manifestFilename {
+		for _, chunk := range m.Chunks {
+			// Never follow a chunk name out of the chunk set's directory
+			if path := filepath.Join(dir, chunk.File); strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				candidates = append(candidates, path)
+			}
+		}
+		for format, ext := range formatExtensions {
+			if ext != "" {
+				candidates = append(candidates, filepath.Join(dir, "chunks"+ext), filepath.Join(dir, "chunks."+format+ext))
+			}
+		}
+		for _, name := range []string{questionsFilename, redactionsFilename, checkpointFilename, corpusIndexName} {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	} else {
+		// chunks.csv comes with chunks.manifest.json
+		base := strings.TrimSuffix(manifestPath, "."+manifestFilename)
+		for _, ext := range formatExtensions {
+			if ext != "" {
+				candidates = append(candidates, base+ext)
+			}
+		}
+		for _, name := range []string{questionsFilename, redactionsFilename, corpusIndexName} {
+			candidates = append(candidates, base+"."+name)
+		}
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	for _, path := range candidates {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return append(files, manifestPath)
+}
+
+// removeChunkSet deletes the files of a chunk set, then the directories
+// left empty between them and the manifest's directory.
+func removeChunkSet(set prunedSet) error {
+	dir := filepath.Dir(set.Manifest)
+	dirs := map[string]bool{}
+	for _, path := range set.Files {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing %s: %v", path, err)
+		}
+		for parent := filepath.Dir(path); parent != dir && strings.HasPrefix(parent, dir); parent = filepath.Dir(parent) {
+			dirs[parent] = true
+		}
+	}
+	dirs[dir] = true
+
+	// Deepest first, so that a parent is empty by the time it is tried
+	var sorted []string
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, d := range sorted {
+		if entries, err := os.ReadDir(d); err == nil && len(entries) == 0 {
+			os.Remove(d)
+		}
+	}
+	return nil
+}
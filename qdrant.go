@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const qdrantBatch = 64 // points per upsert
+
+// qdrantWriter upserts chunks into a Qdrant collection (-sink qdrant),
+// qdrantBatch points per request. The collection is created, for cosine
+// distance over vectors the size of the first chunk's embedding, if it does
+// not exist yet.
+type qdrantWriter struct {
+	store      *storeClient
+	url        string // of the collection
+	collection string
+	created    bool // whether the collection is known to exist
+	points     []qdrantPoint
+	chunks     []*Chunk
+}
+
+type qdrantPoint struct {
+	ID      string      `json:"id"`
+	Vector  []float32   `json:"vector"`
+	Payload jsonlRecord `json:"payload"`
+}
+
+func newQdrantWriter(config ChunkConfig, baseURL, apiKey string) (ChunkWriter, error) {
+	store := newQdrantClient(apiKey)
+	store.retries = config.Retries
+	return &qdrantWriter{
+		store:      store,
+		url:        baseURL + "/collections/" + url.PathEscape(config.Collection),
+		collection: config.Collection,
+	}, nil
+}
+
+func newQdrantClient(apiKey string) *storeClient {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("api-key", apiKey)
+	}
+	return newStoreClient("Qdrant", header)
+}
+
+// checkQdrant lists the collections, which needs the server to be up and
+// the API key, if it asks for one, to be right.
+func checkQdrant(config ChunkConfig, baseURL, apiKey string) error {
+	_, err := newQdrantClient(apiKey).do(http.MethodGet, baseURL+"/collections", nil, nil)
+	return err
+}
+
+func (w *qdrantWriter) WriteChunk(chunk *Chunk) error {
+	w.points = append(w.points, qdrantPoint{ID: chunkUUID(chunk), Vector: chunk.Embedding, Payload: chunkPayload(chunk)})
+	w.chunks = append(w.chunks, chunk)
+	if len(w.points) < qdrantBatch {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush upserts the points not sent yet, and waits for Qdrant to apply
+// them.
+func (w *qdrantWriter) Flush() error {
+	if len(w.points) == 0 {
+		return nil
+	}
+	if !w.created {
+		if err := w.createCollection(len(w.points[0].Vector)); err != nil {
+			return err
+		}
+		w.created = true
+	}
+	body := map[string]any{"points": w.points}
+	if _, err := w.store.do(http.MethodPut, w.url+"/points?wait=true", body, nil); err != nil {
+		return fmt.Errorf("error upserting chunks into Qdrant collection %s: %v", w.collection, err)
+	}
+	for _, chunk := range w.chunks {
+		logChunk(chunk, trf("point in Qdrant collection %s", w.collection))
+	}
+	w.points, w.chunks = nil, nil
+	return nil
+}
+
+func (w *qdrantWriter) createCollection(size int) error {
+	status, err := w.store.do(http.MethodGet, w.url, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if status != http.StatusNotFound {
+		return fmt.Errorf("error looking up Qdrant collection %s: %v", w.collection, err)
+	}
+	body := map[string]any{"vectors": map[string]any{"size": size, "distance": "Cosine"}}
+	if _, err := w.store.do(http.MethodPut, w.url, body, nil); err != nil {
+		return fmt.Errorf("error creating Qdrant collection %s: %v", w.collection, err)
+	}
+	logEvent("collection_created", trf("Created Qdrant collection %s (%d dimensions)", w.collection, size), map[string]any{"collection": w.collection, "dimensions": size})
+	return nil
+}
+
+func (w *qdrantWriter) Close() error {
+	return w.Flush()
+}
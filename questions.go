@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const questionsFilename = "questions.jsonl"
+
+var listMarker = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s*`)
+
+const questionsSystemPrompt = "You write evaluation questions for a retrieval system. " +
+	"Each question must be answerable from the given passage alone. " +
+	"Reply with one question per line and nothing else."
+
+// questionRecord is one line of questions.jsonl, pairing a generated
+// question with the chunk that answers it.
+type questionRecord struct {
+	Question string `json:"question"`
+	Chunk    int    `json:"chunk"`
+	File     string `json:"file"`
+	Source   string `json:"source"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+func (c *Chunker) generateQuestions(content string) ([]string, error) {
+	if c.questioner == nil {
+		return nil, nil
+	}
+
+	prompt := fmt.Sprintf("Write %d questions answered by this passage:\n\n%s", c.config.Questions, content)
+	reply, err := c.questioner.Complete(questionsSystemPrompt, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("error generating questions: %v", err)
+	}
+
+	return parseQuestions(reply, c.config.Questions), nil
+}
+
+// parseQuestions extracts up to n questions from a model reply, dropping the
+// list markers and numbering models tend to add.
+func parseQuestions(reply string, n int) []string {
+	var questions []string
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(listMarker.ReplaceAllString(strings.TrimSpace(line), ""))
+		if line == "" {
+			continue
+		}
+		questions = append(questions, line)
+		if len(questions) == n {
+			break
+		}
+	}
+	return questions
+}
+
+func writeQuestionsHeader(w io.Writer, questions []string) {
+	if len(questions) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Questions:\n")
+	for _, q := range questions {
+		fmt.Fprintf(w, "- %s\n", q)
+	}
+}
+
+func writeQuestions(fsys FS, filename string, m *Manifest) error {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating questions file: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, chunk := range m.Chunks {
+		for _, q := range chunk.Questions {
+			record := questionRecord{
+				Question: q,
+				Chunk:    chunk.Index,
+				File:     chunk.File,
+				Source:   chunk.Source,
+				Start:    chunk.Start,
+				End:      chunk.End,
+			}
+			if err := enc.Encode(record); err != nil {
+				return fmt.Errorf("error writing questions file: %v", err)
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing questions file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	firstBackoff = 500 * time.Millisecond
+	maxBackoff   = 30 * time.Second
+)
+
+// rateLimitAPIs are the APIs -rpm and -tpm can limit one by one. Only those
+// that take text count tokens.
+var rateLimitAPIs = map[string]bool{
+	"embeddings": true, "chat": true, "anthropic": true,
+	"webhook": false, "qdrant": false, "pinecone": false, "chroma": false,
+}
+
+// rateLimits is the -rpm or -tpm flag: a limit for every API, such as 500,
+// and limits for some, such as embeddings=3000,chat=500. The limit for
+// every API is under "".
+type rateLimits map[string]int
+
+func (r rateLimits) String() string {
+	var parts []string
+	for api, limit := range r {
+		if api == "" {
+			parts = append(parts, strconv.Itoa(limit))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=%d", api, limit))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (r rateLimits) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		api, limit, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			api, limit = "", api
+		}
+		if _, known := rateLimitAPIs[api]; api != "" && !known {
+			return fmt.Errorf("unknown API %q; must be one of %s", api, strings.Join(rateLimitAPINames(), ", "))
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid limit %q; must be a number of requests or tokens per minute", limit)
+		}
+		r[api] = n
+	}
+	return nil
+}
+
+func (r rateLimits) of(api string) int {
+	if limit, ok := r[api]; ok {
+		return limit
+	}
+	return r[""]
+}
+
+func rateLimitAPINames() []string {
+	var names []string
+	for name := range rateLimitAPIs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rateLimiter keeps the requests to one API within -rpm and the tokens they
+// send within -tpm, as two buckets that fill at the limit per minute and
+// hold a minute's worth.
+type rateLimiter struct {
+	mu       sync.Mutex
+	rpm, tpm int
+	requests float64 // requests that may be made now
+	tokens   float64 // tokens that may be sent now
+	updated  time.Time
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rateLimiter{}
+	rpmLimits      = rateLimits{}
+	tpmLimits      = rateLimits{}
+)
+
+// setRateLimits applies -rpm and -tpm to the API requests of the run.
+func setRateLimits(rpm, tpm rateLimits) {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	rpmLimits, tpmLimits, rateLimiters = rpm, tpm, map[string]*rateLimiter{}
+}
+
+// apiLimiter returns the limiter of an API, shared by all its clients, or
+// nil if it has no limits.
+func apiLimiter(api string) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	if l, ok := rateLimiters[api]; ok {
+		return l
+	}
+	var l *rateLimiter
+	rpm, tpm := rpmLimits.of(api), tpmLimits.of(api)
+	if !rateLimitAPIs[api] {
+		tpm = 0
+	}
+	if rpm > 0 || tpm > 0 {
+		l = &rateLimiter{rpm: rpm, tpm: tpm, requests: float64(rpm), tokens: float64(tpm), updated: time.Now()}
+	}
+	rateLimiters[api] = l
+	return l
+}
+
+// wait blocks until a request sending tokens is within the limits, and
+// counts it. A request larger than the token limit waits for a full bucket.
+func (l *rateLimiter) wait(api string, tokens int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tpm > 0 {
+		tokens = min(tokens, l.tpm)
+	}
+	for {
+		now := time.Now()
+		minutes := now.Sub(l.updated).Minutes()
+		l.updated = now
+		l.requests = min(float64(l.rpm), l.requests+minutes*float64(l.rpm))
+		l.tokens = min(float64(l.tpm), l.tokens+minutes*float64(l.tpm))
+
+		var wait time.Duration
+		if l.rpm > 0 && l.requests < 1 {
+			wait = max(wait, time.Duration((1-l.requests)/float64(l.rpm)*float64(time.Minute)))
+		}
+		if l.tpm > 0 && l.tokens < float64(tokens) {
+			wait = max(wait, time.Duration((float64(tokens)-l.tokens)/float64(l.tpm)*float64(time.Minute)))
+		}
+		if wait <= 0 {
+			if l.rpm > 0 {
+				l.requests--
+			}
+			if l.tpm > 0 {
+				l.tokens -= float64(tokens)
+			}
+			return
+		}
+		logDebug("rate_limited", fmt.Sprintf("waiting %s for the %s rate limit", wait.Round(time.Millisecond), api), map[string]any{"api": api, "wait": wait.String()})
+		time.Sleep(wait)
+	}
+}
+
+// withRetries makes a request to api with attempt until it succeeds, fails
+// in a way not worth retrying, or has been retried retries times. Every
+// attempt waits for the API's rate limits, counting tokens, its estimated
+// size. Network errors (status 0), 429 and 5xx are retried, after the wait
+// the attempt returns, from a Retry-After header, or else with exponential
+// backoff. name is the API as messages call it.
+func withRetries(name string, retries, tokens int, attempt func() (status int, wait time.Duration, err error)) (int, error) {
+	api := strings.ToLower(name)
+	limiter := apiLimiter(api)
+	backoff := firstBackoff
+	for i := 0; ; i++ {
+		limiter.wait(api, tokens)
+		status, wait, err := attempt()
+		if err == nil {
+			return status, nil
+		}
+		retryable := status == 0 || status == http.StatusTooManyRequests || status >= 500
+		if !retryable || i >= retries {
+			return status, err
+		}
+		if wait == 0 {
+			wait, backoff = backoff, min(2*backoff, maxBackoff)
+		}
+		logWarning(trf("%s request failed, retrying in %s: %v", name, wait, err),
+			map[string]any{"api": api, "attempt": i + 1, "wait": wait.String(), "error": err.Error()})
+		time.Sleep(wait)
+	}
+}
+
+// retryAfter returns the wait an answer asks for in its Retry-After header,
+// in seconds, up to maxBackoff, or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return min(time.Duration(seconds)*time.Second, maxBackoff)
+	}
+	return 0
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const redactionsFilename = "redactions.jsonl"
+
+// secretPattern finds one kind of secret. With group set, only that
+// submatch is the secret, e.g. the value of a password assignment.
+type secretPattern struct {
+	kind    string
+	pattern *regexp.Regexp
+	group   int
+}
+
+// secretPatterns are the secrets -redact-secrets knows by their shape, most
+// specific first, so that a line's AWS key is not also taken for a generic
+// token.
+var secretPatterns = []secretPattern{
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`), 0},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), 1},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), 0},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`), 0},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), 0},
+	{"stripe-key", regexp.MustCompile(`\b[sr]k_(?:live|test)_[A-Za-z0-9]{16,}\b`), 0},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), 0},
+	{"api-key", regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`), 0},
+	{"password", regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|passphrase|secret|api_?key|access_?token|auth_?token|client_?secret)["']?\s*[:=]\s*(?:"([^"\s]{4,})"|'([^'\s]{4,})'|([^\s"',;]{6,}))`), -1},
+}
+
+// quotedString finds string literals, whose contents are taken for secrets
+// when they look random enough, see highEntropy.
+var quotedString = regexp.MustCompile(`"([A-Za-z0-9+/=_\-.]{20,})"|'([A-Za-z0-9+/=_\-.]{20,})'`)
+
+var privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+var privateKeyEnd = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+
+// notSecrets are password values that are placeholders or code rather than
+// secrets.
+var notSecrets = []string{"null", "none", "nil", "true", "false", "undefined", "required", "optional", "string", "changeme", "password", "******"}
+
+// redaction is an entry of the audit file: what kind of secret was replaced
+// where, and by which placeholder, never the secret itself.
+type redaction struct {
+	Source      string `json:"source"`
+	Type        string `json:"type"`
+	Line        int    `json:"line"`
+	Offset      int64  `json:"offset"` // byte offset in the source text, after -encoding
+	Length      int    `json:"length"`
+	Placeholder string `json:"placeholder"`
+	Chunks      []int  `json:"chunks"`
+}
+
+// redactionLog collects the redactions of a run, and the chunks each
+// placeholder ended up in, for the audit file.
+type redactionLog struct {
+	entries []*redaction
+}
+
+// begin forgets what an earlier read of source recorded, as a re-read
+// records it again.
+func (l *redactionLog) begin(source string) {
+	if l == nil {
+		return
+	}
+	l.entries = slices.DeleteFunc(l.entries, func(r *redaction) bool { return r.Source == source })
+}
+
+func (l *redactionLog) add(r *redaction) {
+	if l != nil {
+		l.entries = append(l.entries, r)
+	}
+}
+
+// found records the chunk each placeholder in its content belongs to.
+func (l *redactionLog) found(chunk *Chunk) {
+	if l == nil || !strings.Contains(chunk.Content, "[REDACTED:") {
+		return
+	}
+	for _, r := range l.entries {
+		if r.Source == chunk.Source && strings.Contains(chunk.Content, r.Placeholder) && !slices.Contains(r.Chunks, chunk.Index) {
+			r.Chunks = append(r.Chunks, chunk.Index)
+		}
+	}
+}
+
+// write writes the audit file, one JSON line per redaction.
+func (l *redactionLog) write(fsys FS, filename string) error {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating redaction audit file: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, r := range l.entries {
+		if r.Chunks == nil {
+			r.Chunks = []int{}
+		}
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("error writing redaction audit file: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing redaction audit file: %v", err)
+	}
+	return nil
+}
+
+// summary counts the redactions by type, in the order of secretPatterns.
+func (l *redactionLog) summary() string {
+	counts := map[string]int{}
+	for _, r := range l.entries {
+		counts[r.Type]++
+	}
+	var parts []string
+	for _, kind := range append([]string{"private-key"}, append(secretKinds(), "high-entropy")...) {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func secretKinds() []string {
+	var kinds []string
+	for _, p := range secretPatterns {
+		kinds = append(kinds, p.kind)
+	}
+	return kinds
+}
+
+// redactSecrets replaces the secrets in the input with placeholders such as
+// [REDACTED:aws-access-key:1] (-redact-secrets): API keys and tokens by
+// their shape, password assignments, private key blocks, and string
+// literals random enough to be keys. The same secret gets the same
+// placeholder throughout a source. Every redaction is recorded in log with
+// its position but not its value. The lines changed count as changed.
+func redactSecrets(source string, log *redactionLog) func(r io.Reader, count func(lines int)) io.Reader {
+	return func(r io.Reader, count func(lines int)) io.Reader {
+		log.begin(source)
+		return &redactingReader{in: bufio.NewReader(r), source: source, log: log, count: count, numbers: map[string]int{}, kinds: map[string]int{}}
+	}
+}
+
+// redactingReader redacts its input line by line, keeping line endings and
+// tracking offsets for the audit file.
+type redactingReader struct {
+	in      *bufio.Reader
+	source  string
+	log     *redactionLog
+	count   func(lines int)
+	numbers map[string]int // placeholder number of each secret
+	kinds   map[string]int // placeholders given out per kind
+	line    int
+	offset  int64
+	key     *redaction // the private key block being dropped
+	pending string
+	err     error
+}
+
+func (r *redactingReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 && r.err == nil {
+		line, err := r.in.ReadString('\n')
+		if line != "" {
+			r.line++
+			r.pending = r.redact(line)
+			r.offset += int64(len(line))
+		}
+		r.err = err
+	}
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// redact returns line, which keeps its terminator, with its secrets
+// replaced.
+func (r *redactingReader) redact(line string) string {
+	terminator := lineTerminator(line)
+	text := line[:len(line)-len(terminator)]
+
+	// A private key block becomes one placeholder line
+	if r.key != nil {
+		r.count(1)
+		if end := privateKeyEnd.FindStringIndex(text); end != nil {
+			r.key.Length += end[1]
+			r.key = nil
+			// What follows the block stays, on the placeholder's line
+			if rest := text[end[1]:]; strings.TrimSpace(rest) != "" {
+				return rest + terminator
+			}
+			return ""
+		}
+		r.key.Length += len(line)
+		return ""
+	}
+	if loc := privateKeyBegin.FindStringIndex(text); loc != nil {
+		r.count(1)
+		key := &redaction{Source: r.source, Type: "private-key", Line: r.line, Offset: r.offset + int64(loc[0]), Placeholder: r.placeholder("private-key", fmt.Sprint(r.line))}
+		r.log.add(key)
+		// A key written on one line, as in JSON, ends on it
+		if end := privateKeyEnd.FindStringIndex(text[loc[1]:]); end != nil {
+			key.Length = loc[1] + end[1] - loc[0]
+			return text[:loc[0]] + key.Placeholder + text[loc[1]+end[1]:] + terminator
+		}
+		key.Length = len(line) - loc[0]
+		r.key = key
+		return text[:loc[0]] + key.Placeholder + terminator
+	}
+
+	// Find every secret first, so that the offsets refer to the line as read
+	type span struct {
+		start, end int
+		kind       string
+	}
+	var spans []span
+	overlaps := func(start, end int) bool {
+		for _, s := range spans {
+			if start < s.end && s.start < end {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range secretPatterns {
+		for _, m := range p.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			switch {
+			case p.group > 0:
+				start, end = m[2*p.group], m[2*p.group+1]
+			case p.group < 0:
+				// The first of the alternative groups that matched
+				for g := 1; 2*g < len(m); g++ {
+					if m[2*g] >= 0 {
+						start, end = m[2*g], m[2*g+1]
+						break
+					}
+				}
+				if slices.Contains(notSecrets, strings.ToLower(text[start:end])) || strings.ContainsAny(text[start:end], "(){}$<>") {
+					continue
+				}
+			}
+			if start >= 0 && !overlaps(start, end) {
+				spans = append(spans, span{start, end, p.kind})
+			}
+		}
+	}
+	for _, m := range quotedString.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2], m[3]
+		if start < 0 {
+			start, end = m[4], m[5]
+		}
+		if highEntropy(text[start:end]) && !overlaps(start, end) {
+			spans = append(spans, span{start, end, "high-entropy"})
+		}
+	}
+	if len(spans) == 0 {
+		return line
+	}
+
+	slices.SortFunc(spans, func(a, b span) int { return a.start - b.start })
+	r.count(1)
+	var out strings.Builder
+	last := 0
+	for _, s := range spans {
+		placeholder := r.placeholder(s.kind, text[s.start:s.end])
+		r.log.add(&redaction{Source: r.source, Type: s.kind, Line: r.line, Offset: r.offset + int64(s.start), Length: s.end - s.start, Placeholder: placeholder})
+		out.WriteString(text[last:s.start])
+		out.WriteString(placeholder)
+		last = s.end
+	}
+	out.WriteString(text[last:])
+	out.WriteString(terminator)
+	return out.String()
+}
+
+// placeholder returns the placeholder of a secret, the same each time the
+// secret appears.
+func (r *redactingReader) placeholder(kind, secret string) string {
+	key := kind + "\x00" + secret
+	n, ok := r.numbers[key]
+	if !ok {
+		r.kinds[kind]++
+		n = r.kinds[kind]
+		r.numbers[key] = n
+	}
+	return fmt.Sprintf("[REDACTED:%s:%d]", kind, n)
+}
+
+// highEntropy reports whether s looks like a random key rather than a word,
+// a path or a hash: it mixes upper and lower case letters and digits, and
+// its characters carry at least 4 bits of entropy each. Hex digests, which
+// are common in code and logs and use one case, are left alone.
+func highEntropy(s string) bool {
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		counts[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 4
+}
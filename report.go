@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runReport collects what the HTML report of the run in progress (-report)
+// shows beyond its manifest, or is nil.
+var runReport *reportCollector
+
+const (
+	reportSamples      = 5
+	reportSampleLength = 4000 // bytes of each sample chunk shown
+)
+
+// reportCollector keeps the warnings of a run and a sample of its chunks.
+// The sample is a reservoir, with a fixed seed so that the same run
+// samples the same chunks.
+type reportCollector struct {
+	mu       sync.Mutex
+	started  time.Time
+	warnings []string
+	samples  []reportChunk
+	seen     int
+	random   *rand.Rand
+}
+
+type reportChunk struct {
+	Index     int
+	Source    string
+	File      string
+	Start     int
+	End       int
+	Overlap   int
+	Bytes     int
+	Tokens    int
+	SHA256    string
+	Content   string
+	Truncated bool
+}
+
+func newReportCollector(now time.Time) *reportCollector {
+	return &reportCollector{started: now, random: rand.New(rand.NewSource(1))}
+}
+
+func (r *reportCollector) warning(message string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, message)
+}
+
+func (r *reportCollector) chunk(chunk *Chunk) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen++
+	slot := len(r.samples)
+	if slot >= reportSamples {
+		if slot = r.random.Intn(r.seen); slot >= reportSamples {
+			return
+		}
+	}
+	sample := reportChunk{
+		Index: chunk.Index, Source: chunk.Source, File: chunk.Filename,
+		Start: chunk.Start, End: chunk.End, Overlap: chunk.Overlap,
+		Bytes: len(chunk.Content), Tokens: chunk.Tokens, SHA256: chunk.SHA256,
+		Content: chunk.Content,
+	}
+	if len(sample.Content) > reportSampleLength {
+		sample.Content = sample.Content[:runeStart(sample.Content, reportSampleLength, len(sample.Content))]
+		sample.Truncated = true
+	}
+	if slot == len(r.samples) {
+		r.samples = append(r.samples, sample)
+	} else {
+		r.samples[slot] = sample
+	}
+}
+
+// reportData is what the report template renders.
+type reportData struct {
+	Generated string
+	Duration  string
+	Build     BuildInfo
+	Settings  [][2]string
+	Stats     RunStats
+	Overhead  string
+	Sizes     [][2]string // chunk size in bytes: minimum, median, maximum...
+	Histogram []reportBar
+	Files     []reportFile
+	Warnings  []string
+	Samples   []reportChunk
+}
+
+type reportFile struct {
+	Path   string
+	Bytes  int64
+	Chunks int
+}
+
+type reportBar struct {
+	Label   string
+	Count   int
+	Percent int
+}
+
+// writeReport writes the self-contained HTML report of a finished run:
+// its settings, statistics, warnings and sample chunks.
+func writeReport(config ChunkConfig, manifest *Manifest, r *reportCollector) error {
+	data := reportData{
+		Generated: config.now().Format(time.RFC3339),
+		Duration:  config.now().Sub(r.started).Round(time.Millisecond).String(),
+		Build:     manifest.Build,
+		Stats:     manifest.Stats,
+		Overhead:  fmt.Sprintf("%.1f%%", overheadPercent(manifest.Stats.OverlapBytes, manifest.Stats.Bytes)),
+		Warnings:  r.warnings,
+		Samples:   append([]reportChunk(nil), r.samples...),
+	}
+	sort.Slice(data.Samples, func(i, j int) bool { return data.Samples[i].Index < data.Samples[j].Index })
+
+	data.Settings = [][2]string{
+		{"Inputs", strings.Join(config.Inputs, ", ")},
+		{"Output", config.OutputDir},
+		{"Format", config.Format},
+		{"Chunk type", config.ChunkType},
+		{"Chunk size", config.sizeString()},
+		{"Overlap", fmt.Sprint(config.OverlapSize)},
+	}
+	for _, setting := range [][2]string{
+		{"Transforms", strings.Join(manifest.Transforms, ", ")},
+		{"Boundaries", config.Boundaries},
+		{"Include", strings.Join(config.Include, ", ")},
+		{"Exclude", strings.Join(config.Exclude, ", ")},
+	} {
+		if setting[1] != "" {
+			data.Settings = append(data.Settings, setting)
+		}
+	}
+
+	perFile := map[string]int{}
+	var sizes []int
+	for _, chunk := range manifest.Chunks {
+		perFile[chunk.Source]++
+		sizes = append(sizes, chunk.Bytes)
+	}
+	for _, file := range manifest.Files {
+		data.Files = append(data.Files, reportFile{Path: file.Path, Bytes: file.Bytes, Chunks: perFile[file.Path]})
+	}
+	if len(sizes) > 0 {
+		sort.Ints(sizes)
+		data.Sizes = [][2]string{
+			{"Smallest", formatBytes(int64(sizes[0]))},
+			{"Median", formatBytes(int64(sizes[len(sizes)/2]))},
+			{"Mean", formatBytes(int64(manifest.Stats.Bytes / len(sizes)))},
+			{"Largest", formatBytes(int64(sizes[len(sizes)-1]))},
+		}
+		data.Histogram = sizeHistogram(sizes)
+	}
+
+	file, err := config.filesystem().Create(config.Report)
+	if err != nil {
+		return fmt.Errorf("error creating report: %v", err)
+	}
+	if err := reportTemplate.Execute(file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	return file.Close()
+}
+
+// sizeHistogram buckets sorted chunk sizes into ten equal ranges.
+func sizeHistogram(sizes []int) []reportBar {
+	const buckets = 10
+	lo, hi := sizes[0], sizes[len(sizes)-1]
+	width := max(1, (hi-lo+buckets)/buckets)
+	bars := make([]reportBar, 0, buckets)
+	most := 0
+	for b := 0; b < buckets && lo+b*width <= hi; b++ {
+		from, to := lo+b*width, lo+(b+1)*width
+		count := sort.SearchInts(sizes, to) - sort.SearchInts(sizes, from)
+		bars = append(bars, reportBar{Label: fmt.Sprintf("%s – %s", formatBytes(int64(from)), formatBytes(int64(to-1))), Count: count})
+		most = max(most, count)
+	}
+	for i := range bars {
+		bars[i].Percent = bars[i].Count * 100 / max(1, most)
+	}
+	return bars
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>fileChunker report</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+h1 { font-size: 1.5rem; } h2 { font-size: 1.2rem; margin-top: 2rem; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; } td, th { padding: .2rem .8rem .2rem 0; text-align: left; vertical-align: top; }
+th { color: #666; font-weight: normal; } .num { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { background: #4a7bd0; height: .8rem; } .warning { color: #8a4b00; }
+.chunk { border: 1px solid #ddd; border-radius: 4px; margin: 1rem 0; }
+.chunk header { background: #f5f5f5; padding: .4rem .6rem; font-size: .9rem; }
+pre { margin: 0; padding: .6rem; overflow-x: auto; white-space: pre-wrap; font-size: .8rem; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>fileChunker report</h1>
+<p class="muted">Generated {{.Generated}} in {{.Duration}} by fileChunker {{.Build.Version}}</p>
+
+<h2>Settings</h2>
+<table>{{range .Settings}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>{{end}}</table>
+
+<h2>Statistics</h2>
+<table>
+<tr><th>Chunks</th><td class="num">{{.Stats.Chunks}}</td></tr>
+<tr><th>Bytes</th><td class="num">{{.Stats.Bytes}}</td></tr>
+<tr><th>Tokens</th><td class="num">{{.Stats.Tokens}}</td></tr>
+<tr><th>Overlap</th><td class="num">{{.Stats.OverlapBytes}} bytes ({{.Overhead}})</td></tr>
+{{range .Sizes}}<tr><th>{{index . 0}} chunk</th><td class="num">{{index . 1}}</td></tr>{{end}}
+</table>
+{{if .Histogram}}<h3>Chunk sizes</h3>
+<table>{{range .Histogram}}<tr><th>{{.Label}}</th><td class="num">{{.Count}}</td><td style="width: 20rem"><div class="bar" style="width: {{.Percent}}%"></div></td></tr>{{end}}</table>{{end}}
+
+<h2>Files</h2>
+<table>
+<tr><th>Path</th><th class="num">Bytes</th><th class="num">Chunks</th></tr>
+{{range .Files}}<tr><td>{{.Path}}</td><td class="num">{{.Bytes}}</td><td class="num">{{.Chunks}}</td></tr>{{end}}
+</table>
+
+<h2>Warnings</h2>
+{{if .Warnings}}<ul>{{range .Warnings}}<li class="warning">{{.}}</li>{{end}}</ul>{{else}}<p class="muted">None.</p>{{end}}
+
+<h2>Sample chunks</h2>
+{{range .Samples}}<section class="chunk">
+<header><strong>#{{.Index}}</strong> {{.Source}} {{.Start}}–{{.End}}{{if .Overlap}} (overlap {{.Overlap}}){{end}} · {{.Bytes}} bytes · {{.Tokens}} tokens · <span class="muted">{{.File}} · sha256 {{.SHA256}}</span></header>
+<pre>{{.Content}}{{if .Truncated}}
+…{{end}}</pre>
+</section>{{else}}<p class="muted">No chunks.</p>{{end}}
+</body>
+</html>
+`))
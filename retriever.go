@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Retriever ranks chunks for each query. The result holds one list of chunk
+// positions per query, best match first, with at most k entries.
+type Retriever interface {
+	Retrieve(chunks []Chunk, queries []string, k int) ([][]int, error)
+}
+
+func newRetriever(name string) (Retriever, error) {
+	switch {
+	case name == "bm25":
+		return bm25Retriever{k1: 1.2, b: 0.75}, nil
+	case strings.HasPrefix(name, "exec:"):
+		args := strings.Fields(strings.TrimPrefix(name, "exec:"))
+		if len(args) == 0 {
+			return nil, fmt.Errorf("exec retriever needs a command, e.g. exec:./retrieve.py")
+		}
+		return execRetriever{args: args}, nil
+	default:
+		return nil, fmt.Errorf("unsupported retriever: %s", name)
+	}
+}
+
+// bm25Retriever is a dependency-free lexical baseline.
+type bm25Retriever struct {
+	k1, b float64
+}
+
+func (r bm25Retriever) Retrieve(chunks []Chunk, queries []string, k int) ([][]int, error) {
+	docs := make([]map[string]int, len(chunks))
+	lengths := make([]float64, len(chunks))
+	docFreq := make(map[string]int)
+	totalLength := 0.0
+
+	for i, chunk := range chunks {
+		terms := searchTerms(chunk.Content)
+		freq := make(map[string]int)
+		for _, term := range terms {
+			freq[term]++
+		}
+		for term := range freq {
+			docFreq[term]++
+		}
+		docs[i] = freq
+		lengths[i] = float64(len(terms))
+		totalLength += lengths[i]
+	}
+
+	avgLength := 1.0
+	if len(chunks) > 0 && totalLength > 0 {
+		avgLength = totalLength / float64(len(chunks))
+	}
+	n := float64(len(chunks))
+
+	results := make([][]int, len(queries))
+	for qi, query := range queries {
+		scores := make([]float64, len(chunks))
+		for _, term := range searchTerms(query) {
+			df := float64(docFreq[term])
+			if df == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for i, doc := range docs {
+				tf := float64(doc[term])
+				if tf == 0 {
+					continue
+				}
+				scores[i] += idf * tf * (r.k1 + 1) / (tf + r.k1*(1-r.b+r.b*lengths[i]/avgLength))
+			}
+		}
+
+		ranked := make([]int, 0, len(chunks))
+		for i := range chunks {
+			if scores[i] > 0 {
+				ranked = append(ranked, i)
+			}
+		}
+		sort.SliceStable(ranked, func(a, b int) bool {
+			return scores[ranked[a]] > scores[ranked[b]]
+		})
+		if len(ranked) > k {
+			ranked = ranked[:k]
+		}
+		results[qi] = ranked
+	}
+
+	return results, nil
+}
+
+func searchTerms(text string) []string {
+	var terms []string
+	for _, token := range tokenize(strings.ToLower(text)) {
+		if strings.IndexFunc(token, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// execRetriever delegates ranking to an external program, so embedding-based
+// or production retrievers can be evaluated without linking them in.
+type execRetriever struct {
+	args []string
+}
+
+type execRetrieverChunk struct {
+	ID     int    `json:"id"`
+	Text   string `json:"text"`
+	Source string `json:"source"`
+}
+
+type execRetrieverRequest struct {
+	K       int                  `json:"k"`
+	Chunks  []execRetrieverChunk `json:"chunks"`
+	Queries []string             `json:"queries"`
+}
+
+type execRetrieverResponse struct {
+	Results [][]int `json:"results"`
+}
+
+func (r execRetriever) Retrieve(chunks []Chunk, queries []string, k int) ([][]int, error) {
+	request := execRetrieverRequest{K: k, Queries: queries}
+	for i, chunk := range chunks {
+		request.Chunks = append(request.Chunks, execRetrieverChunk{ID: i, Text: chunk.Content, Source: chunk.Source})
+	}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding retriever request: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(r.args[0], r.args[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running retriever %s: %v", r.args[0], err)
+	}
+
+	var response execRetrieverResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("error decoding retriever output: %v", err)
+	}
+	return response.Results, nil
+}
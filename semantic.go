@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// semanticWindow is how many sentences on each side of a boundary between
+// two are embedded, which steadies the distances.
+const semanticWindow = 2
+
+// sentenceBreak finds where a new sentence starts: after the end of one, at
+// a paragraph break, or at a line that starts a heading, a list item or a
+// quote.
+var sentenceBreak = regexp.MustCompile(`[.!?]["')\]]*\s+|\n[ \t]*\n\s*|\n([ \t]*(?:#|[-*+>|] |\d+[.)] ))`)
+
+// chunkTypeValue is the -type flag. semantic chunks are char chunks whose
+// boundaries come from embeddings, so it sets Semantic and the type chars,
+// while diff and subtitles chunks are line chunks cut at the hunks of a
+// patch and between cues, so it sets Diff or Subtitles and the type lines.
+type chunkTypeValue struct {
+	typ       *string
+	semantic  *bool
+	diff      *bool
+	subtitles *bool
+}
+
+func (v chunkTypeValue) String() string {
+	switch {
+	case v.typ == nil:
+		return ""
+	case *v.semantic:
+		return "semantic"
+	case *v.diff:
+		return "diff"
+	case *v.subtitles:
+		return "subtitles"
+	}
+	return *v.typ
+}
+
+func (v chunkTypeValue) Set(value string) error {
+	*v.typ, *v.semantic, *v.diff, *v.subtitles = value, value == "semantic", value == "diff", value == "subtitles"
+	switch {
+	case *v.semantic:
+		*v.typ = "chars"
+	case *v.diff, *v.subtitles:
+		*v.typ = "lines"
+	}
+	return nil
+}
+
+// semanticReport records how the boundaries of -type semantic were found.
+type semanticReport struct {
+	Model      string  `json:"model"`
+	Percentile float64 `json:"percentile"`
+}
+
+// chunkSemantic implements -type semantic: the input is split into
+// sentences, the sentences on either side of each boundary between two are
+// embedded, and chunks end where the cosine distance between the two sides
+// is among the largest of the input, above its -semantic-percentile, which
+// is where the topic shifts. Chunks are then cut between sentences so that none exceeds
+// -size characters, and overlap by the whole sentences that fit in
+// -overlap.
+func (c *Chunker) chunkSemantic() error {
+	content, err := c.readInput(c.digest, c.transformed)
+	if err != nil {
+		return err
+	}
+	text := string(content)
+	starts := sentenceStarts(text)
+
+	shifts, err := c.topicShifts(text, starts)
+	if err != nil {
+		return err
+	}
+	back := func(cut, n int) int {
+		floor := runesBack(text, cut, n, 0)
+		if c.config.SizeBytes {
+			floor = max(0, cut-n)
+		}
+		if i := sort.SearchInts(starts, floor); i < len(starts) && starts[i] < cut {
+			return starts[i]
+		}
+		return cut
+	}
+	return c.chunkAtCuts(boundaryCuts(c.fitSentences(text, starts, shifts), len(text)), back, func(number, start, end, overlap int) error {
+		return c.writeTextChunk(text[start:end], number, start, end, overlap)
+	})
+}
+
+// sentenceStarts returns the byte offsets at which the sentences of text
+// start, 0 first. Each sentence runs to the start of the next, whitespace
+// included, so that together they cover text.
+func sentenceStarts(text string) []int {
+	if text == "" {
+		return nil
+	}
+	starts := []int{0}
+	for _, m := range sentenceBreak.FindAllStringSubmatchIndex(text, -1) {
+		start := m[1]
+		// A heading or list item starts with its line
+		if m[2] >= 0 {
+			start = m[2]
+		}
+		if start > starts[len(starts)-1] && start < len(text) {
+			starts = append(starts, start)
+		}
+	}
+	return starts
+}
+
+// topicShifts returns the sentence starts at which the topic shifts.
+func (c *Chunker) topicShifts(text string, starts []int) ([]int, error) {
+	if len(starts) < 3 {
+		return nil, nil
+	}
+	// The sentences before each boundary and those after it
+	window := func(from, to int) string {
+		from, to = max(0, from), min(len(starts), to)
+		return strings.Join(strings.Fields(text[starts[from]:sentenceStop(starts, to-1, len(text))]), " ")
+	}
+	var windows []string
+	for i := 1; i < len(starts); i++ {
+		windows = append(windows, window(i-semanticWindow, i), window(i, i+semanticWindow))
+	}
+	vectors, err := c.config.Embedder.Embed(windows)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding sentences: %v", err)
+	}
+
+	distances := make([]float64, len(starts)-1)
+	for i := range distances {
+		distances[i] = cosineDistance(vectors[2*i], vectors[2*i+1])
+	}
+	threshold := percentile(distances, c.config.SemanticPercentile)
+	var shifts []int
+	for i, d := range distances {
+		if d > threshold {
+			shifts = append(shifts, starts[i+1])
+		}
+	}
+	logDebug("topic_shifts", fmt.Sprintf("%d topic shifts among %d sentences, at cosine distances above %.3f", len(shifts), len(starts), threshold), map[string]any{"sentences": len(starts), "shifts": len(shifts), "threshold": threshold})
+	return shifts, nil
+}
+
+// fitSentences adds to the topic shifts the cuts that keep chunks within
+// -size: between sentences where they fit, and every -size units within a
+// sentence longer than that.
+func (c *Chunker) fitSentences(text string, starts, shifts []int) []int {
+	size := c.config.ChunkSize
+	units := func(a, b int) int {
+		if c.config.SizeBytes {
+			return b - a
+		}
+		return utf8.RuneCountInString(text[a:b])
+	}
+	shift := map[int]bool{}
+	for _, s := range shifts {
+		shift[s] = true
+	}
+
+	var cuts []int
+	start := 0
+	for i, s := range starts {
+		end := sentenceStop(starts, i, len(text))
+		if s > start && (shift[s] || units(start, end) > size) {
+			cuts, start = append(cuts, s), s
+		}
+		for units(start, end) > size {
+			start = c.unitsForward(text, start, size)
+			cuts = append(cuts, start)
+		}
+	}
+	return cuts
+}
+
+// unitsForward returns the position n units after i, in runes or, with a
+// byte -size, bytes, without splitting a character or, with -graphemes, a
+// grapheme cluster.
+func (c *Chunker) unitsForward(text string, i, n int) int {
+	end := runesForward(text, i, n)
+	if c.config.SizeBytes {
+		end = min(len(text), i+n)
+		for end > i+1 && end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+	if c.config.Graphemes {
+		end = graphemeForward(text, end)
+	}
+	return end
+}
+
+// sentenceStop returns where sentence i of a text of n bytes ends.
+func sentenceStop(starts []int, i, n int) int {
+	if i+1 < len(starts) {
+		return starts[i+1]
+	}
+	return n
+}
+
+// percentile returns the value below which p percent of values fall.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[int(p/100*float64(len(sorted)-1))]
+}
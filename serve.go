@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serveOptions are the chunk options a serve request may set, as query or
+// form parameters. The others name files, processes or endpoints on the
+// server, or where chunks go, which only its operator chooses.
+var serveOptions = map[string]bool{
+	"type": true, "size": true, "min-size": true, "overlap": true, "encoding": true, "graphemes": true,
+	"max-line": true, "max-line-type": true, "tab-width": true, "normalize-whitespace": true, "collapse-repeats": true,
+	"redact-secrets": true, "strip-comments": true, "grep": true, "grep-v": true, "sample-rate": true, "sample-levels": true,
+	"timestamps": true, "input-timezone": true, "timezone": true, "time-window": true,
+	"dedupe-fuzzy": true, "dedupe-action": true, "semantic-percentile": true, "strict": true,
+	"metadata": true, "metadata-mode": true, "meta": true, "checksum-header": true, "prefix": true, "name-template": true, "index-width": true, "start-index": true,
+	"context-header": true,
+}
+
+// serveFlags are the options of serve besides the chunk options.
+type serveFlags struct {
+	addr       string
+	configFile string
+	policyFile string
+	maxUpload  byteSize
+}
+
+func defineServeFlags(fs *flag.FlagSet, s *serveFlags, config *ChunkConfig) {
+	fs.StringVar(&s.addr, "addr", ":8080", "Address to listen on")
+	fs.StringVar(&s.configFile, "config", "", "YAML config file with default option values (command-line flags and FILECHUNKER_* variables take precedence)")
+	fs.StringVar(&s.policyFile, "policy", "", "Policy file restricting the endpoints chunks may be sent to, e.g. for -embed")
+	s.maxUpload = 32 << 20
+	fs.Var(&s.maxUpload, "max-upload", "Largest file `size` a request may upload, e.g. 32MB")
+	fs.IntVar(&config.MaxChunks, "max-chunks", 0, "Return at most this many chunks per request (0 for no limit)")
+	fs.StringVar(&config.MaxChunksAction, "max-chunks-action", "stop", "At the -max-chunks limit: stop, returning the first chunks, or error, failing the request")
+}
+
+// chunkServer answers the requests of serve. Each request is chunked with
+// the server's options, re-read from its arguments, environment and
+// config file, and those of serveOptions the request sets.
+type chunkServer struct {
+	args    []string
+	define  func(fs *flag.FlagSet, s *serveFlags, config *ChunkConfig) // the options of the command besides the chunk options
+	flags   serveFlags
+	logging bool // whether to log requests
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var config ChunkConfig
+	s := chunkServer{define: defineServeFlags}
+	defineChunkFlags(fs, &config)
+	s.define(fs, &s.flags, &config)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Serve a REST API: POST /chunk with a file, as multipart form field \"file\" or as the raw body,\n")
+		fmt.Fprintf(os.Stderr, "and receive its chunks as a JSON array, or with format=zip as a zip of chunk files.\n")
+		fmt.Fprintf(os.Stderr, "The same address serves the gRPC service of chunker.proto, which streams chunks back as they are cut.\n")
+		fmt.Fprintf(os.Stderr, "The chunk options below are the defaults; requests may set these as parameters:\n  %s\n\n", strings.Join(serveOptionNames(), ", "))
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("serve chunks the files requests upload and takes no inputs, got %s", strings.Join(fs.Args(), " "))
+	}
+	if err := s.start(fs, args); err != nil {
+		return err
+	}
+	// The chunk events of every request would drown the request log
+	s.logging = consoleLevel <= levelInfo
+	consoleLevel = max(consoleLevel, levelWarn)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chunk", s.handleChunk)
+	mux.HandleFunc("/filechunker.v1.Chunker/", s.handleGRPC)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	// gRPC clients speak HTTP/2 without TLS
+	server := &http.Server{Addr: s.flags.addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second, Protocols: new(http.Protocols)}
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+	if s.logging {
+		writeEvent("listening", trf("Listening on %s", s.flags.addr), map[string]any{"addr": s.flags.addr})
+	}
+	return server.ListenAndServe()
+}
+
+// start applies the options of the command running the server, parsed by
+// fs from args: its language, logging and policy. It checks the chunk
+// options too, which are the defaults of every request.
+func (s *chunkServer) start(fs *flag.FlagSet, args []string) error {
+	s.args = args
+	config, err := s.config(nil)
+	if err != nil {
+		return err
+	}
+	if err := config.applyConsole(); err != nil {
+		return err
+	}
+	setRateLimits(config.RPM, config.TPM)
+
+	var set bool
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "input", "sink", "webhook", "boundaries", "prompt-template":
+			set = true
+		}
+	})
+	if set {
+		return fmt.Errorf("%s chunks the files of its requests, so -input, -sink, -webhook, -boundaries and -prompt-template do not apply", fs.Name())
+	}
+	if s.flags.policyFile != "" {
+		if activePolicy, err = loadPolicy(s.flags.policyFile); err != nil {
+			return err
+		}
+		if err := activePolicy.check(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serveOptionNames() []string {
+	var names []string
+	for name := range serveOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// config returns the chunk options of a request with params.
+func (s *chunkServer) config(params url.Values) (ChunkConfig, error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var config ChunkConfig
+	var flags serveFlags
+	defineChunkFlags(fs, &config)
+	s.define(fs, &flags, &config)
+	if err := fs.Parse(s.args); err != nil {
+		return config, err
+	}
+	if err := applyEnvironment(fs); err != nil {
+		return config, err
+	}
+	if flags.configFile != "" {
+		if err := applyConfigFile(fs, flags.configFile); err != nil {
+			return config, err
+		}
+	}
+
+	for name, values := range params {
+		if name == "filename" || name == "format" {
+			continue
+		}
+		if !serveOptions[name] {
+			return config, fmt.Errorf("option %q cannot be set by a request", name)
+		}
+		for _, value := range values {
+			// A template could read the server's environment through env,
+			// so the -meta values of a request are taken literally
+			set := value
+			if name == "meta" {
+				set = literalMeta(value)
+			}
+			if err := fs.Set(name, set); err != nil {
+				return config, fmt.Errorf("invalid value %q for option %s: %v", value, name, err)
+			}
+		}
+	}
+	config.resolveOverlap()
+	if err := config.validate(); err != nil {
+		return config, err
+	}
+	// The -meta tags of a request can call for encryption under the policy
+	return config, activePolicy.check(config)
+}
+
+// handleChunk chunks the file of a POST /chunk request.
+func (s *chunkServer) handleChunk(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.flags.maxUpload))
+	name, data, params, err := readUpload(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		s.fail(w, r, status, err)
+		return
+	}
+	config, err := s.config(params)
+	if err != nil {
+		s.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+	asZip := params.Get("format") == "zip" || r.Header.Get("Accept") == "application/zip"
+	if format := params.Get("format"); format != "" && format != "json" && format != "zip" {
+		s.fail(w, r, http.StatusBadRequest, fmt.Errorf("format must be json or zip, got %q", format))
+		return
+	}
+
+	config, fsys, inputs, err := uploaded(config, name, data)
+	if err != nil {
+		s.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	manifest := NewManifest(config)
+	var chunks int
+	if asZip {
+		zw, err := newZipWriter(fsys, "chunks.zip", config)
+		if err == nil {
+			err = chunkInputs(config, inputs, zw, manifest)
+			if closeErr := zw.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			s.fail(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+		archive, err := fsys.ReadFile("chunks.zip")
+		if err != nil {
+			s.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		chunks = len(manifest.Chunks)
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": base + "_chunks.zip"}))
+		w.Write(archive)
+	} else {
+		writer := &memoryWriter{}
+		if err := chunkInputs(config, inputs, writer, manifest); err != nil {
+			s.fail(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+		records := make([]jsonlRecord, 0, len(writer.chunks))
+		for i := range writer.chunks {
+			records = append(records, newJSONLRecord(&writer.chunks[i]))
+		}
+		chunks = len(records)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(records)
+	}
+	s.log(r, http.StatusOK, fmt.Sprintf("%s: %d chunks", name, chunks), map[string]any{"file": name, "bytes": len(data), "chunks": chunks, "ms": time.Since(start).Milliseconds()})
+}
+
+// uploaded returns config set to chunk the uploaded file name, which the
+// filesystem it returns holds, and its inputs.
+func uploaded(config ChunkConfig, name string, data []byte) (ChunkConfig, *memFS, []inputFile, error) {
+	fsys := newMemFS(map[string]string{name: string(data)})
+	config.FS = fsys
+	config.Inputs = []string{name}
+	config.OutputDir = "chunks"
+	inputs, err := resolveInputs(config)
+	return config, fsys, inputs, err
+}
+
+// uploadName returns the base name of an uploaded file, which chooses the
+// chunk file names and the handling of Markdown or code.
+func uploadName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "input.txt"
+	}
+	return name
+}
+
+// readUpload returns the file of a request, with its name, and the request
+// parameters: the multipart form field "file" and the form values, or the
+// body named by the filename parameter, with the query string.
+func readUpload(r *http.Request) (name string, data []byte, params url.Values, err error) {
+	params = r.URL.Query()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(8 << 20); err != nil {
+			return "", nil, nil, fmt.Errorf("error reading form: %w", err)
+		}
+		for key, values := range r.MultipartForm.Value {
+			params[key] = append(params[key], values...)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("the form has no file field: %v", err)
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			return "", nil, nil, fmt.Errorf("error reading file: %w", err)
+		}
+		name = header.Filename
+	} else {
+		if data, err = io.ReadAll(r.Body); err != nil {
+			return "", nil, nil, fmt.Errorf("error reading body: %w", err)
+		}
+		name = params.Get("filename")
+	}
+	return uploadName(name), data, params, nil
+}
+
+func (s *chunkServer) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	s.log(r, status, err.Error(), map[string]any{"error": err.Error()})
+}
+
+func (s *chunkServer) log(r *http.Request, status int, detail string, fields map[string]any) {
+	if !s.logging {
+		return
+	}
+	fields["method"], fields["path"], fields["status"], fields["remote"] = r.Method, r.URL.Path, status, r.RemoteAddr
+	writeEvent("request", fmt.Sprintf("%s %s %d %s", r.Method, r.URL.Path, status, detail), fields)
+}
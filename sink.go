@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sink is one destination of a multiWriter. Once it fails it is skipped for
+// the rest of the run.
+type sink struct {
+	name   string
+	writer ChunkWriter
+	err    error
+}
+
+// multiWriter fans every chunk out to several sinks. A sink that fails is
+// reported and dropped while the others keep going; the run only stops when
+// no healthy sink is left.
+type multiWriter struct {
+	sinks  []*sink
+	failed []*sink
+}
+
+func (m *multiWriter) fail(name string, err error) {
+	logWarning(trf("sink %s failed and is disabled for the rest of the run: %v", name, err),
+		map[string]any{"sink": name, "error": err.Error()})
+	m.failed = append(m.failed, &sink{name: name, err: err})
+}
+
+func (m *multiWriter) WriteChunk(chunk *Chunk) error {
+	healthy := 0
+	for _, s := range m.sinks {
+		if s.err != nil {
+			continue
+		}
+		if err := s.writer.WriteChunk(chunk); err != nil {
+			s.err = err
+			m.fail(s.name, err)
+			continue
+		}
+		healthy++
+	}
+
+	if healthy == 0 {
+		return fmt.Errorf("all output sinks failed: %v", m.failures())
+	}
+	return nil
+}
+
+// Flush waits for the sinks that write in the background.
+func (m *multiWriter) Flush() error {
+	healthy := 0
+	for _, s := range m.sinks {
+		if s.err != nil {
+			continue
+		}
+		if err := flushChunks(s.writer); err != nil {
+			s.err = err
+			m.fail(s.name, err)
+			continue
+		}
+		healthy++
+	}
+
+	if healthy == 0 {
+		return fmt.Errorf("all output sinks failed: %v", m.failures())
+	}
+	return nil
+}
+
+func (m *multiWriter) Close() error {
+	for _, s := range m.sinks {
+		if err := s.writer.Close(); err != nil && s.err == nil {
+			s.err = err
+			m.failed = append(m.failed, s)
+		}
+	}
+
+	if len(m.failed) > 0 {
+		return fmt.Errorf("some output sinks failed: %v", m.failures())
+	}
+	return nil
+}
+
+func (m *multiWriter) failures() string {
+	var parts []string
+	for _, s := range m.failed {
+		parts = append(parts, fmt.Sprintf("%s: %v", s.name, s.err))
+	}
+	return strings.Join(parts, "; ")
+}
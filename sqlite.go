@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const sqliteSchema = `CREATE TABLE chunks (
+  id INTEGER PRIMARY KEY,
+  source TEXT NOT NULL,
+  file TEXT NOT NULL,
+  type TEXT NOT NULL,
+  start INTEGER NOT NULL,
+  "end" INTEGER NOT NULL,
+  overlap INTEGER NOT NULL,
+  tokens INTEGER NOT NULL,
+  content TEXT NOT NULL
+);
+CREATE INDEX chunks_source ON chunks (source);
+CREATE VIRTUAL TABLE chunks_fts USING fts5(content, source UNINDEXED, content='chunks', content_rowid='id');
+`
+
+// sqliteWriter stores chunks in a SQLite database with an FTS5 full-text
+// index. To keep the build free of cgo and third-party drivers it streams
+// SQL to the sqlite3 command-line shell.
+type sqliteWriter struct {
+	filename string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	w        *bufio.Writer
+	stderr   bytes.Buffer
+}
+
+func newSQLiteWriter(filename string) (*sqliteWriter, error) {
+	bin, err := exec.LookPath("sqlite3")
+	if err != nil {
+		return nil, fmt.Errorf("the sqlite format needs the sqlite3 command-line shell in PATH: %v", err)
+	}
+
+	// Start from an empty database, like the other formats overwrite their output
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error removing existing database: %v", err)
+	}
+
+	w := &sqliteWriter{filename: filename, cmd: exec.Command(bin, "-bail", filename)}
+	w.cmd.Stderr = &w.stderr
+	w.stdin, err = w.cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error starting sqlite3: %v", err)
+	}
+	if err := w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting sqlite3: %v", err)
+	}
+	w.w = bufio.NewWriter(w.stdin)
+
+	if _, err := w.w.WriteString(sqliteSchema + "BEGIN;\n"); err != nil {
+		return nil, w.fail(err)
+	}
+	return w, nil
+}
+
+func (w *sqliteWriter) WriteChunk(chunk *Chunk) error {
+	_, err := fmt.Fprintf(w.w, "INSERT INTO chunks VALUES (%d, %s, %s, %s, %d, %d, %d, %d, %s);\n",
+		chunk.Index, sqlQuote(chunk.Source), sqlQuote(chunk.Filename), sqlQuote(chunk.Type),
+		chunk.Start, chunk.End, chunk.Overlap, chunk.Tokens, sqlQuote(chunk.Content))
+	if err != nil {
+		return w.fail(err)
+	}
+
+	logChunk(chunk, trf("row in %s", w.filename))
+	return nil
+}
+
+func (w *sqliteWriter) Close() error {
+	// Build the full-text index in one pass once all rows are in
+	_, err := w.w.WriteString("COMMIT;\nINSERT INTO chunks_fts(chunks_fts) VALUES ('rebuild');\n")
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err != nil {
+		return w.fail(err)
+	}
+
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("error writing SQLite database: %v: %s", err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// fail stops sqlite3 after a write error, preferring its own error message,
+// which explains why the pipe broke.
+func (w *sqliteWriter) fail(err error) error {
+	w.stdin.Close()
+	w.cmd.Wait()
+	if msg := strings.TrimSpace(w.stderr.String()); msg != "" {
+		return fmt.Errorf("error writing SQLite database: %s", msg)
+	}
+	return fmt.Errorf("error writing SQLite database: %v", err)
+}
+
+// sqlQuote renders s as a SQL string literal. Text containing NUL bytes,
+// which the shell cannot read inside a literal, is sent as a hex blob.
+func sqlQuote(s string) string {
+	if strings.IndexByte(s, 0) >= 0 {
+		return "CAST(X'" + hex.EncodeToString([]byte(s)) + "' AS TEXT)"
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,86 @@
+package main
+
+import "strings"
+
+// RunStats totals what a run wrote and how much of it is overlap, i.e.
+// content already present at the end of the previous chunk.
+type RunStats struct {
+	Chunks        int `json:"chunks"`
+	Bytes         int `json:"bytes"`
+	Tokens        int `json:"tokens"`
+	OverlapBytes  int `json:"overlap_bytes"`
+	OverlapTokens int `json:"overlap_tokens"`
+}
+
+func (s *RunStats) add(chunk *Chunk) {
+	s.Chunks++
+	s.Bytes += len(chunk.Content)
+	s.Tokens += chunk.Tokens
+
+	// The overlap is found in the content as chunked
+	if chunk.raw != "" {
+		raw := *chunk
+		raw.Content = chunk.raw
+		chunk = &raw
+	}
+	prefix := overlapPrefix(chunk)
+	s.OverlapBytes += len(prefix)
+	s.OverlapTokens += len(tokenSpans(prefix))
+}
+
+func (s *RunStats) merge(other RunStats) {
+	s.Chunks += other.Chunks
+	s.Bytes += other.Bytes
+	s.Tokens += other.Tokens
+	s.OverlapBytes += other.OverlapBytes
+	s.OverlapTokens += other.OverlapTokens
+}
+
+// overheadPercent relates duplicated content to the content that would have
+// been written without any overlap.
+func overheadPercent(duplicated, total int) float64 {
+	if total-duplicated <= 0 {
+		return 0
+	}
+	return float64(duplicated) / float64(total-duplicated) * 100
+}
+
+func (s RunStats) Print() {
+	if logJSON {
+		logEvent("summary", "", map[string]any{"stats": s})
+		return
+	}
+	textf("Summary: %d chunks, %d bytes, %d tokens\n", s.Chunks, s.Bytes, s.Tokens)
+	textf("Overlap overhead: %d bytes (%.1f%%), %d tokens (%.1f%%) duplicated across chunks\n",
+		s.OverlapBytes, overheadPercent(s.OverlapBytes, s.Bytes),
+		s.OverlapTokens, overheadPercent(s.OverlapTokens, s.Tokens))
+}
+
+// overlapPrefix returns the leading part of the chunk's content that repeats
+// the previous chunk.
+func overlapPrefix(chunk *Chunk) string {
+	if chunk.Overlap <= 0 {
+		return ""
+	}
+
+	switch chunk.Type {
+	case "lines":
+		end := 0
+		for i := 0; i < chunk.Overlap; i++ {
+			next := strings.IndexByte(chunk.Content[end:], '\n')
+			if next < 0 {
+				return chunk.Content
+			}
+			end += next + 1
+		}
+		return chunk.Content[:end]
+	case "tokens":
+		spans := tokenSpans(chunk.Content)
+		if chunk.Overlap >= len(spans) {
+			return chunk.Content
+		}
+		return chunk.Content[:spans[chunk.Overlap-1][1]]
+	default:
+		return chunk.Content[:min(chunk.Overlap, len(chunk.Content))]
+	}
+}
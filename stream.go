@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// streamWriter writes chunks one after another to a stream, as the files
+// format would write them to disk, for -output -.
+type streamWriter struct {
+	w           *bufio.Writer
+	addMetadata bool
+	addChecksum bool
+}
+
+func newStreamWriter(w io.Writer, config ChunkConfig) *streamWriter {
+	return &streamWriter{w: bufio.NewWriter(w), addMetadata: config.metadataHeader(), addChecksum: config.ChecksumHeader}
+}
+
+func (w *streamWriter) WriteChunk(chunk *Chunk) error {
+	content := *chunk
+	// Keep the next chunk's header on its own line
+	if n := len(content.Content); n > 0 && content.Content[n-1] != '\n' {
+		content.Content += "\n"
+	}
+	if err := writeChunkFile(w.w, &content, w.addMetadata, w.addChecksum); err != nil {
+		return fmt.Errorf("error writing to stdout: %v", err)
+	}
+
+	logChunk(chunk, trf("%s on stdout", chunk.Filename))
+	return nil
+}
+
+func (w *streamWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("error writing to stdout: %v", err)
+	}
+	return nil
+}
+
+// stdoutFS hands out stdout for every file it is asked to create, so the
+// single-file formats can stream without knowing about it.
+type stdoutFS struct {
+	osFS
+}
+
+func (stdoutFS) Create(name string) (io.WriteCloser, error) {
+	return nopWriteCloser{os.Stdout}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
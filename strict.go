@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// strictChecker verifies, chunk by chunk, that a run is a faithful cover of
+// its input: each chunk's overlap repeats the end of the previous chunk,
+// the remaining "core" ranges follow each other without gaps or overlap,
+// and the cores put together reproduce the input exactly. Line chunks are
+// compared with line endings normalized to \n, token chunks token by token.
+type strictChecker struct {
+	chunkType string
+	prev      *Chunk
+	cores     hash.Hash
+	coreBytes int
+}
+
+func newStrictChecker(chunkType string) *strictChecker {
+	return &strictChecker{chunkType: chunkType, cores: sha256.New()}
+}
+
+func (s *strictChecker) check(chunk *Chunk) error {
+	// Core ranges must start exactly where the previous chunk ended
+	wantStart, first := 0, 0
+	if s.chunkType == "lines" {
+		wantStart, first = 1, 1
+	}
+	if s.prev != nil {
+		wantStart = s.prev.End + first
+	} else if chunk.Overlap != 0 {
+		return strictError(chunk, "first chunk has overlap %d", chunk.Overlap)
+	}
+	if coreStart := chunk.Start + chunk.Overlap; coreStart != wantStart {
+		return strictError(chunk, "core range starts at %d, want %d", coreStart, wantStart)
+	}
+
+	// Character chunks are compared as strings rather than unit by unit
+	if s.chunkType == "chars" {
+		units := []string{chunk.Content}
+		if chunk.Overlap > len(chunk.Content) {
+			return strictError(chunk, "overlap %d exceeds the chunk's %d bytes", chunk.Overlap, len(chunk.Content))
+		}
+		if s.prev != nil && !strings.HasSuffix(s.prev.Content, chunk.Content[:chunk.Overlap]) {
+			return strictError(chunk, "overlap does not repeat the end of chunk %d", s.prev.Index)
+		}
+		s.writeUnit(units[0][chunk.Overlap:])
+	} else {
+		units := chunkUnits(chunk)
+		if chunk.Overlap > len(units) {
+			return strictError(chunk, "overlap %d exceeds the chunk's %d units", chunk.Overlap, len(units))
+		}
+		if s.prev != nil && chunk.Overlap > 0 {
+			prevUnits := chunkUnits(s.prev)
+			if chunk.Overlap > len(prevUnits) {
+				return strictError(chunk, "overlap %d exceeds the previous chunk's %d units", chunk.Overlap, len(prevUnits))
+			}
+			if !equalUnits(units[:chunk.Overlap], prevUnits[len(prevUnits)-chunk.Overlap:]) {
+				return strictError(chunk, "overlap does not repeat the end of chunk %d", s.prev.Index)
+			}
+		}
+		for _, unit := range units[chunk.Overlap:] {
+			s.writeUnit(unit)
+		}
+	}
+
+	prev := *chunk
+	s.prev = &prev
+	return nil
+}
+
+// finish compares the accumulated cores with the whole input.
+func (s *strictChecker) finish(source string, content []byte) error {
+	want := newStrictChecker(s.chunkType)
+	text := string(content)
+	if s.chunkType == "lines" {
+		text = normalizeLines(text)
+	}
+	for _, unit := range splitUnits(s.chunkType, text) {
+		want.writeUnit(unit)
+	}
+	if !bytes.Equal(s.cores.Sum(nil), want.cores.Sum(nil)) {
+		return fmt.Errorf("strict mode: chunks of %s do not reproduce the input (%d bytes of chunk content vs %d in the input)",
+			source, s.coreBytes, want.coreBytes)
+	}
+	return nil
+}
+
+func (s *strictChecker) writeUnit(unit string) {
+	s.cores.Write([]byte(unit))
+	s.coreBytes += len(unit)
+	if s.chunkType == "tokens" {
+		// Keep token boundaries in the hash
+		s.cores.Write([]byte{0})
+	}
+}
+
+// chunkUnits splits chunk content into the units its range counts: lines
+// (with their newline) or tokens. Character content is one unit.
+func chunkUnits(chunk *Chunk) []string {
+	return splitUnits(chunk.Type, chunk.Content)
+}
+
+func splitUnits(chunkType, text string) []string {
+	switch chunkType {
+	case "lines":
+		lines := strings.SplitAfter(text, "\n")
+		return lines[:len(lines)-1]
+	case "tokens":
+		return tokenize(text)
+	default:
+		return []string{text}
+	}
+}
+
+// normalizeLines renders text the way line chunks carry it: every line,
+// including an unterminated last one, loses one trailing \r and ends in \n.
+func normalizeLines(text string) string {
+	var b strings.Builder
+	for len(text) > 0 {
+		line, rest, _ := strings.Cut(text, "\n")
+		b.WriteString(strings.TrimSuffix(line, "\r"))
+		b.WriteByte('\n')
+		text = rest
+	}
+	return b.String()
+}
+
+func equalUnits(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func strictError(chunk *Chunk, format string, args ...any) error {
+	return fmt.Errorf("strict mode: chunk %d of %s: "+format, append([]any{chunk.Index, chunk.Source}, args...)...)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cueTiming matches the timing line of an SRT or WebVTT cue, such as
+// "00:01:02,500 --> 00:01:04,000" or "01:02.500 --> 01:04.000 align:start".
+var cueTiming = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s+-->\s+((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+
+// subtitleCue is a cue of a subtitle file: its block of lines, with the
+// SRT sequence number or WebVTT identifier before the timing, the time it
+// is shown from and to, and the tokens of the block, as the chunk counts
+// them.
+type subtitleCue struct {
+	line        int // first line of the block, from 0
+	start, stop time.Duration
+	tokens      int
+}
+
+// parseSubtitles finds the cues of an SRT or WebVTT file, blocks of lines
+// between blank lines of which the first or second is a timing line. Other
+// blocks, such as the WEBVTT header and NOTE and STYLE blocks, go with the
+// cue before them, or the first.
+func parseSubtitles(lines []string) []subtitleCue {
+	var cues []subtitleCue
+	for i := 0; i < len(lines); {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		for t := i; t < min(i+2, end); t++ {
+			m := cueTiming.FindStringSubmatch(lines[t])
+			if m == nil {
+				continue
+			}
+			start, err1 := parseCueTime(m[1])
+			stop, err2 := parseCueTime(m[2])
+			if err1 != nil || err2 != nil {
+				break
+			}
+			cue := subtitleCue{line: i, start: start, stop: stop}
+			for _, line := range lines[i:end] {
+				cue.tokens += len(tokenSpans(line))
+			}
+			cues = append(cues, cue)
+			break
+		}
+		i = end
+	}
+	return cues
+}
+
+// parseCueTime reads a cue timestamp, [hours:]minutes:seconds with
+// milliseconds after a comma (SRT) or a dot (WebVTT).
+func parseCueTime(s string) (time.Duration, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	parts := strings.Split(s, ":")
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+		unit *= 60
+	}
+	return d, nil
+}
+
+// formatCueTime writes a cue time as HH:MM:SS.mmm, the form of WebVTT.
+func formatCueTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// subtitleCuts chooses the cues chunks start at: as many whole cues as fit
+// in each chunk, by the time from the start of its first cue to the end of
+// its last with a duration, or else by the tokens of their blocks. A cue
+// longer than that is a chunk of its own.
+func subtitleCuts(cues []subtitleCue, duration time.Duration, size int) []int {
+	var cuts []int
+	first, tokens := 0, 0
+	for i, cue := range cues {
+		fits := tokens+cue.tokens <= size
+		if duration > 0 {
+			fits = cue.stop-cues[first].start <= duration
+		}
+		if i > first && !fits {
+			cuts = append(cuts, cue.line)
+			first, tokens = i, 0
+		}
+		tokens += cue.tokens
+	}
+	return cuts
+}
+
+// cueSpan returns the time from the first cue of a line chunk to the end of
+// its last, if it holds any cues.
+func cueSpan(cues []subtitleCue, chunk *Chunk) (start, end string) {
+	i := sort.Search(len(cues), func(i int) bool { return cues[i].line >= chunk.Start-1 })
+	j := sort.Search(len(cues), func(j int) bool { return cues[j].line > chunk.End-1 })
+	if i >= j {
+		return "", ""
+	}
+	stop := cues[i].stop
+	for _, cue := range cues[i:j] {
+		stop = max(stop, cue.stop)
+	}
+	return formatCueTime(cues[i].start), formatCueTime(stop)
+}
+
+// chunkSubtitles implements -type subtitles: line chunks of an SRT or
+// WebVTT file that never split a cue, each as long as -size allows, a
+// duration such as 10m or a number of tokens. Chunks overlap by the whole
+// cues before them that fit in -overlap tokens, and record the time they
+// span.
+func (c *Chunker) chunkSubtitles() error {
+	lines, err := c.readLines()
+	if err != nil {
+		return err
+	}
+
+	cues := parseSubtitles(lines)
+	if len(cues) == 0 && len(lines) > 0 {
+		return fmt.Errorf("no SRT or WebVTT cues found")
+	}
+	logDebug("subtitles_parsed", fmt.Sprintf("%s: %d cues", c.config.InputFile, len(cues)), map[string]any{"source": c.config.InputFile, "cues": len(cues)})
+	c.cues = cues
+
+	// Overlap reaches back by whole cues
+	back := func(cut, n int) int {
+		k := sort.Search(len(cues), func(k int) bool { return cues[k].line >= cut })
+		start, tokens := cut, 0
+		for j := k - 1; j >= 0 && tokens+cues[j].tokens <= n; j-- {
+			start, tokens = cues[j].line, tokens+cues[j].tokens
+		}
+		return start
+	}
+	cuts := subtitleCuts(cues, c.config.sizeDuration(), c.config.ChunkSize)
+	return c.chunkAtCuts(boundaryCuts(cuts, len(lines)), back, func(number, start, end, overlap int) error {
+		return c.writeChunk(lines[start:end], number, start+1, end, overlap)
+	})
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	suggestFiles  = 20       // files sampled at most, spread over the input
+	suggestSample = 64 << 10 // bytes read from the start of each
+)
+
+// suggestContents are the structures suggest tells apart, in the order it
+// reports them.
+var suggestContents = []string{"code", "prose", "logs", "jsonl"}
+
+// suggestion is what suggest found in the input and what it recommends.
+type suggestion struct {
+	Files         int            `json:"files"`
+	Sampled       int            `json:"sampled"`
+	Bytes         int64          `json:"bytes"`
+	Structure     map[string]int `json:"structure"` // percent of the sampled bytes
+	Content       string         `json:"content"`
+	TokensPerLine float64        `json:"tokens_per_line"`
+	Goal          string         `json:"goal"`
+	Context       int            `json:"context"`
+	Type          string         `json:"type"`
+	Size          int            `json:"size"`
+	Overlap       int            `json:"overlap"`
+	Format        string         `json:"format"`
+	Tokenizer     string         `json:"tokenizer"`
+	Include       []string       `json:"include,omitempty"`
+	Exclude       []string       `json:"exclude,omitempty"`
+	Reasons       []string       `json:"reasons"`
+}
+
+func runSuggest(args []string) error {
+	fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+	var inputs stringList
+	fs.Var(&inputs, "input", "Input file or directory to sample (repeatable)")
+	goal := fs.String("goal", "rag", "What the chunks are for: rag, review, or training")
+	context := fs.Int("context", 128000, "Context window in tokens of the model that reads the chunks")
+	save := fs.String("save", "", "Write the recommendation as a config file (profile) to use with -config")
+	force := fs.Bool("force", false, "Overwrite an existing -save file")
+	asJSON := fs.Bool("json", false, "Print the recommendation as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s suggest [options] [input ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Sample the input, detect whether it is code, prose, logs or JSONL, and recommend chunk options with the reasoning behind them.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	inputs = append(inputs, fs.Args()...)
+	if len(inputs) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch *goal {
+	case "rag", "review", "training":
+	default:
+		return fmt.Errorf("unknown goal %q: use rag, review, or training", *goal)
+	}
+	if *context <= 0 {
+		return fmt.Errorf("-context must be positive")
+	}
+	if *save != "" && !*force {
+		if _, err := os.Stat(*save); err == nil {
+			return fmt.Errorf("%s already exists; use -force to overwrite it", *save)
+		}
+	}
+
+	// Version control metadata says nothing about the input
+	files, err := resolveInputs(ChunkConfig{Inputs: inputs, Exclude: []string{".git", ".hg", ".svn"}})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no input files matched in %s", strings.Join(inputs, ", "))
+	}
+	s, rec, err := suggestConfig(files, *goal, *context)
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 1 {
+		rec.input = inputs[0]
+	}
+
+	if *save != "" {
+		if err := os.WriteFile(*save, []byte(rec.yaml()), 0644); err != nil {
+			return fmt.Errorf("error writing config file: %v", err)
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	s.print()
+	if *save != "" {
+		fmt.Printf("\nWrote %s. Run: %s -config %s\n", *save, os.Args[0], *save)
+	} else {
+		fmt.Printf("\nSave it as a profile with -save filechunker.yaml, then run with -config filechunker.yaml.\n")
+	}
+	return nil
+}
+
+// suggestConfig samples the files, classifies their structure and turns the
+// result into a recommendation through recommendConfig, measuring the
+// tokens per line instead of guessing them.
+func suggestConfig(files []inputFile, goal string, context int) (suggestion, initConfig, error) {
+	s := suggestion{Files: len(files), Goal: goal, Context: context, Structure: map[string]int{}}
+	for _, file := range files {
+		if info, err := os.Stat(file.Path); err == nil {
+			s.Bytes += info.Size()
+		}
+	}
+
+	// Spread the sample over the list, which is in directory order
+	var sampled []inputFile
+	step := max(1, len(files)/suggestFiles)
+	for i := 0; i < len(files) && len(sampled) < suggestFiles; i += step {
+		sampled = append(sampled, files[i])
+	}
+
+	bytesOf := map[string]int{}
+	extensions := map[string][]string{} // of the files of each structure
+	total, lines, tokens := 0, 0, 0
+	for _, file := range sampled {
+		text, err := readSample(file.Path)
+		if err != nil {
+			return s, initConfig{}, err
+		}
+		if text == "" {
+			continue
+		}
+		content := classifySample(file.Path, text)
+		bytesOf[content] += len(text)
+		if ext := filepath.Ext(file.Path); ext != "" && !slices.Contains(extensions[content], ext) {
+			extensions[content] = append(extensions[content], ext)
+		}
+		total += len(text)
+		lines += max(1, strings.Count(text, "\n"))
+		tokens += len(tokenSpans(text))
+		s.Sampled++
+	}
+	if total == 0 {
+		return s, initConfig{}, fmt.Errorf("the input files are empty")
+	}
+
+	s.Content = "mixed"
+	for _, content := range suggestContents {
+		percent := bytesOf[content] * 100 / total
+		if percent > 0 {
+			s.Structure[content] = percent
+		}
+		if percent >= 60 {
+			s.Content = content
+		}
+	}
+	s.TokensPerLine = float64(tokens) / float64(lines)
+
+	rec := recommendConfig(s.Content, context, goal, int(s.TokensPerLine+0.5))
+	rec.origin = "suggest command"
+	// Include what the input holds rather than the usual extensions
+	if rec.include != nil && len(extensions[s.Content]) > 0 {
+		rec.include = nil
+		for _, ext := range extensions[s.Content] {
+			rec.include = append(rec.include, "**/*"+ext)
+		}
+	}
+	rec.comments = append([]string{fmt.Sprintf("Sampled %d of %d files: %s.", s.Sampled, s.Files, s.structureSummary())}, rec.comments...)
+	s.Type, s.Size, s.Overlap, s.Format = rec.typ, rec.size, rec.overlap, rec.format
+	s.Include, s.Exclude = rec.include, rec.exclude
+	s.Tokenizer = "approximate"
+
+	switch s.Content {
+	case "code":
+		s.Reasons = append(s.Reasons, "Most of the input is source code: line chunks keep statements whole and map back to line numbers.")
+	case "prose":
+		s.Reasons = append(s.Reasons, "Most of the input is prose: token chunks match what the model counts and end at word boundaries.")
+	case "logs":
+		s.Reasons = append(s.Reasons, "Most of the input is logs: line chunks keep every entry whole; -timestamps adds each chunk's time span.")
+	case "jsonl":
+		s.Reasons = append(s.Reasons, "Most of the input is JSONL: line chunks keep every record whole, with no overlap since records stand alone.")
+	default:
+		s.Reasons = append(s.Reasons, "No one structure makes up most of the input, so the recommendation suits prose; consider separate runs with -include.")
+	}
+	if s.Type == "lines" {
+		s.Reasons = append(s.Reasons, fmt.Sprintf("Lines average %.1f tokens, so %d lines are about %d tokens.", s.TokensPerLine, s.Size, int(float64(s.Size)*s.TokensPerLine)))
+	}
+	for _, comment := range rec.comments[1:] {
+		s.Reasons = append(s.Reasons, comment)
+	}
+	s.Reasons = append(s.Reasons, "Tokens are counted by the approximate tokenizer, the only one this build has, so leave some headroom below the model's limit.")
+	return s, rec, nil
+}
+
+// readSample reads the start of a file as UTF-8 text, or nothing for a
+// binary file.
+func readSample(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading input: %v", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, suggestSample))
+	if err != nil {
+		return "", fmt.Errorf("error reading input: %v", err)
+	}
+	data, _ = decodeBytes(data, "auto")
+	if isBinary(data) {
+		return "", nil
+	}
+	text := string(data)
+	// Stop at the last whole line of a cut sample
+	if len(data) == suggestSample {
+		if i := strings.LastIndexByte(text, '\n'); i > 0 {
+			text = text[:i+1]
+		}
+	}
+	return text, nil
+}
+
+// classifySample tells code, prose, logs and JSONL apart, by the file
+// extension where it says and otherwise by the lines: JSON objects,
+// timestamps, or the punctuation and indentation of code.
+func classifySample(path, text string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case ext == ".jsonl" || ext == ".ndjson":
+		return "jsonl"
+	case ext == ".log":
+		return "logs"
+	case lspLanguages[ext] != "":
+		return "code"
+	case isMarkdown(path) || ext == ".txt" || ext == ".rst":
+		return "prose"
+	}
+
+	var lines, objects, stamped, codeLike int
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		lines++
+		if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+			objects++
+		}
+		if timestampPattern.MatchString(line) {
+			stamped++
+		}
+		if strings.HasSuffix(trimmed, ";") || strings.HasSuffix(trimmed, "{") || trimmed == "}" ||
+			(strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ")) && !strings.HasSuffix(trimmed, ".") {
+			codeLike++
+		}
+	}
+	switch {
+	case lines == 0:
+		return "prose"
+	case objects*10 >= lines*8:
+		return "jsonl"
+	case stamped*2 >= lines:
+		return "logs"
+	case codeLike*10 >= lines*4:
+		return "code"
+	}
+	return "prose"
+}
+
+// structureSummary lists the structures found, most common first.
+func (s suggestion) structureSummary() string {
+	contents := append([]string(nil), suggestContents...)
+	sort.SliceStable(contents, func(i, j int) bool { return s.Structure[contents[i]] > s.Structure[contents[j]] })
+	var parts []string
+	for _, content := range contents {
+		if percent, ok := s.Structure[content]; ok {
+			parts = append(parts, fmt.Sprintf("%s %d%%", content, percent))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s suggestion) print() {
+	fmt.Printf("Sampled %d of %d files (%s in all)\n", s.Sampled, s.Files, formatBytes(s.Bytes))
+	fmt.Printf("Structure: %s -> %s\n\n", s.structureSummary(), s.Content)
+	fmt.Printf("Recommended for %s with a %d-token context window:\n", s.Goal, s.Context)
+	fmt.Printf("  type:      %s\n", s.Type)
+	fmt.Printf("  size:      %d\n", s.Size)
+	fmt.Printf("  overlap:   %d\n", s.Overlap)
+	fmt.Printf("  format:    %s\n", s.Format)
+	fmt.Printf("  tokenizer: %s\n", s.Tokenizer)
+	if len(s.Include) > 0 {
+		fmt.Printf("  include:   %s\n", strings.Join(s.Include, ", "))
+	}
+	if len(s.Exclude) > 0 {
+		fmt.Printf("  exclude:   %s\n", strings.Join(s.Exclude, ", "))
+	}
+	fmt.Printf("\nWhy:\n")
+	for _, reason := range s.Reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// parseTiers parses -tiers, a comma-separated list of chunk sizes.
+func parseTiers(list string) ([]int, error) {
+	var sizes []int
+	for _, field := range strings.Split(list, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid -tiers size %q: sizes must be positive integers", field)
+		}
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// tierConfig returns the options of one tier of a -tiers run: the chunk
+// size, its overlap if -overlap is a percentage, and a directory of its own
+// in the output directory.
+func tierConfig(config ChunkConfig, size int) ChunkConfig {
+	config.ChunkSize = size
+	config.resolveOverlap()
+	config.OutputDir = filepath.Join(config.OutputDir, fmt.Sprintf("%s-%d", config.ChunkType, size))
+	return config
+}
+
+// chunkTiers chunks the inputs once per tier size. The tiers share an
+// inputCache, so every input is read and tokenized only once, unless a
+// -max-memory budget asks for every tier to read the inputs again.
+func chunkTiers(config ChunkConfig, inputs []inputFile, sizes []int) error {
+	if config.MaxMemory == 0 {
+		config.Cache = newInputCache()
+	}
+	for _, size := range sizes {
+		tier := tierConfig(config, size)
+		logEvent("tier_started", trf("Tier: %d %s per chunk in %s", size, config.ChunkType, tier.OutputDir), map[string]any{"size": size, "output": tier.OutputDir})
+		if _, err := chunkRun(tier, inputs, false); err != nil {
+			return err
+		}
+		textf("\n")
+	}
+	return nil
+}
+
+// inputCache keeps the inputs of a run in memory, with their tokens, for
+// runs that chunk the same inputs several times.
+type inputCache struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	tokens map[string][]string // by source, of the transformed text
+}
+
+func newInputCache() *inputCache {
+	return &inputCache{files: map[string][]byte{}, tokens: map[string][]string{}}
+}
+
+// read returns the contents of a file, reading it on first use.
+func (c *inputCache) read(fsys FS, path string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.files[path]; ok {
+		return data, nil
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	c.files[path] = data
+	return data, nil
+}
+
+// tokenize returns the tokens of text, the transformed contents of source,
+// tokenizing it on first use. A nil cache always tokenizes.
+func (c *inputCache) tokenize(source, text string) []string {
+	if c == nil {
+		return tokenize(text)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tokens, ok := c.tokens[source]; ok {
+		return tokens
+	}
+	tokens := tokenize(text)
+	c.tokens[source] = tokens
+	return tokens
+}
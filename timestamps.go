@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampFormats lists the log timestamp formats -timestamps recognizes,
+// in the order of the alternatives in timestampPattern.
+var timestampFormats = []string{"iso8601", "clf", "syslog", "epoch"}
+
+// timestampPattern finds the first timestamp in a log line: ISO 8601 /
+// RFC 3339 (with T or a space, optional fraction and offset), Common Log
+// Format (02/Jan/2006:15:04:05 -0700), syslog (Jan  2 15:04:05, no year), or
+// Unix seconds or milliseconds at the start of the line (after the [source]
+// tag of -merge-logs) or in a ts/time field.
+var timestampPattern = regexp.MustCompile(
+	`(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?)(Z|[+-]\d{2}:?\d{2})?` +
+		`|(\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})` +
+		`|\b([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})\b` +
+		`|(?:^(?:\[[^\]]*\] )?|(?:ts|time|timestamp)"?\s*[=:]\s*)(\d{13}|\d{10}(?:\.\d+)?)\b`)
+
+// timestampParser parses log timestamps into absolute times. Timestamps
+// without an offset are read in the input zone, so logs from services in
+// different zones, or mixing formats, still order correctly.
+type timestampParser struct {
+	inputZone  *time.Location
+	outputZone *time.Location
+	now        time.Time // for the year syslog timestamps leave out
+}
+
+func newTimestampParser(config ChunkConfig) (*timestampParser, error) {
+	inputZone, err := parseZone(config.InputTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -input-timezone: %v", err)
+	}
+	outputZone, err := parseZone(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -timezone: %v", err)
+	}
+	return &timestampParser{inputZone: inputZone, outputZone: outputZone, now: config.now()}, nil
+}
+
+// parseZone accepts UTC, Local, an IANA zone name such as Europe/Berlin, or
+// a fixed offset such as +05:30.
+func parseZone(name string) (*time.Location, error) {
+	if t, err := time.Parse("-07:00", name); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(name, offset), nil
+	}
+	return time.LoadLocation(name)
+}
+
+// parse returns the first timestamp in line.
+func (p *timestampParser) parse(line string) (time.Time, bool) {
+	m := timestampPattern.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	var t time.Time
+	var err error
+	switch {
+	case m[1] != "":
+		value := strings.Replace(strings.Replace(m[1], " ", "T", 1), ",", ".", 1)
+		if offset := m[2]; offset != "" {
+			if offset != "Z" && !strings.Contains(offset, ":") {
+				offset = offset[:3] + ":" + offset[3:]
+			}
+			t, err = time.Parse("2006-01-02T15:04:05.999999999Z07:00", value+offset)
+		} else {
+			t, err = time.ParseInLocation("2006-01-02T15:04:05.999999999", value, p.inputZone)
+		}
+	case m[3] != "":
+		t, err = time.Parse("02/Jan/2006:15:04:05 -0700", m[3])
+	case m[4] != "":
+		t, err = time.ParseInLocation("Jan _2 15:04:05", m[4], p.inputZone)
+		if err == nil {
+			// Syslog leaves out the year: take the current one, or the one
+			// before for dates that would lie in the future
+			t = t.AddDate(p.now.In(p.inputZone).Year(), 0, 0)
+			if t.After(p.now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+	case m[5] != "":
+		if len(m[5]) == 13 {
+			ms, _ := strconv.ParseInt(m[5], 10, 64)
+			t = time.UnixMilli(ms)
+		} else {
+			seconds, _ := strconv.ParseFloat(m[5], 64)
+			t = time.Unix(0, int64(seconds*float64(time.Second)))
+		}
+	}
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// format writes a time in the output zone.
+func (p *timestampParser) format(t time.Time) string {
+	return t.In(p.outputZone).Format(time.RFC3339Nano)
+}
+
+// span returns the earliest and latest timestamps in content, formatted in
+// the output zone, or empty strings if it has none.
+func (p *timestampParser) span(content string) (string, string) {
+	var first, last time.Time
+	found := false
+	for _, line := range strings.Split(content, "\n") {
+		t, ok := p.parse(line)
+		if !ok {
+			continue
+		}
+		if !found || t.Before(first) {
+			first = t
+		}
+		if !found || t.After(last) {
+			last = t
+		}
+		found = true
+	}
+	if !found {
+		return "", ""
+	}
+	return p.format(first), p.format(last)
+}
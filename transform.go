@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// transform rewrites an input on its way to the chunker. Chunk ranges then
+// refer to the transformed text, which the manifest records by listing the
+// transforms. apply wraps the input stream, so that line chunking of large
+// logs stays streaming, and reports the lines it changes to count.
+type transform struct {
+	name  string
+	apply func(r io.Reader, count func(lines int)) io.Reader
+}
+
+// transforms returns the pre-chunk transforms the options enable, in the
+// order they run.
+func (config ChunkConfig) transforms() []transform {
+	var transforms []transform
+	if config.RedactSecrets {
+		transforms = append(transforms, transform{"redact-secrets", redactSecrets(config.InputFile, config.Redactions)})
+	}
+	if config.StripComments {
+		transforms = append(transforms, transform{"strip-comments", stripComments(config.InputFile)})
+	}
+	if len(config.Grep) > 0 || len(config.GrepV) > 0 {
+		transforms = append(transforms, transform{"grep", filterLines(config.Grep, config.GrepV)})
+	}
+	if config.SampleRate < 1 {
+		transforms = append(transforms, transform{"sample", sampleLogLevels(config.SampleRate, parseSampleLevels(config.SampleLevels))})
+	}
+	if config.NormalizeWhitespace {
+		transforms = append(transforms, transform{"normalize-whitespace", normalizeWhitespace(config.TabWidth)})
+	}
+	if config.CollapseRepeats {
+		transforms = append(transforms, transform{"collapse-repeats", collapseRepeats})
+	}
+	if config.MaxLine > 0 {
+		transforms = append(transforms, transform{"max-line", splitLongLines(config.MaxLine, config.MaxLineType)})
+	}
+	return transforms
+}
+
+// transformNames lists the transforms by name. merge-logs comes first: it
+// turns the inputs into one stream before the others run.
+func (config ChunkConfig) transformNames() []string {
+	var names []string
+	if config.MergeLogs {
+		names = append(names, "merge-logs")
+	}
+	for _, t := range config.transforms() {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+// openInput opens the input file for chunking. Its bytes go into digest as
+// they are read, are transcoded to UTF-8 (-encoding), rendered as text if
+// it is a notebook, then go through the configured transforms, which count
+// their changes in changes.
+func (c *Chunker) openInput(digest io.Writer, changes map[string]int) (io.ReadCloser, error) {
+	var file io.ReadCloser
+	if c.config.Cache != nil {
+		data, err := c.config.Cache.read(c.config.filesystem(), c.config.InputFile)
+		if err != nil {
+			return nil, err
+		}
+		file = io.NopCloser(bytes.NewReader(data))
+	} else {
+		f, err := c.config.filesystem().Open(c.config.InputFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening file: %v", err)
+		}
+		file = f
+	}
+
+	if merged, ok := file.(*mergedLog); ok {
+		merged.count = func(lines int) { changes["merge-logs"] += lines }
+	}
+
+	var r io.Reader = io.TeeReader(file, digest)
+	// Merged logs are transcoded source by source
+	if _, merged := file.(*mergedLog); !merged {
+		r, c.encoding = decodeInput(r, c.config.Encoding)
+		if d, ok := digest.(*sourceDigest); ok && c.encoding != "utf-8" {
+			r = io.TeeReader(r, d.transcoded())
+		}
+	}
+	// The cells of a notebook are chunked, not its JSON
+	if c.notebook != nil {
+		rendered, err := c.notebook.render(r)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error reading notebook: %v", err)
+		}
+		r = rendered
+	}
+	for _, t := range c.config.transforms() {
+		r = t.apply(r, func(lines int) { changes[t.name] += lines })
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, file}, nil
+}
+
+// readInput reads the whole input through openInput, or with -mmap maps it
+// into memory until Process returns. Mapping needs the operating system
+// filesystem and an input that no transform rewrites and that is not a
+// notebook; other inputs are read.
+func (c *Chunker) readInput(digest io.Writer, changes map[string]int) ([]byte, error) {
+	if c.config.Mmap && c.config.FS == nil && c.config.Cache == nil && len(c.config.transformNames()) == 0 && c.notebook == nil {
+		data, unmap, err := mmapFile(c.config.InputFile)
+		if err == nil {
+			c.unmap = append(c.unmap, unmap)
+			digest.Write(data)
+			data, c.encoding = decodeBytes(data, c.config.Encoding)
+			if d, ok := digest.(*sourceDigest); ok && c.encoding != "utf-8" {
+				d.transcoded().Write(data)
+			}
+			return data, nil
+		}
+		logDebug("mmap_failed", fmt.Sprintf("%s is read instead of mapped: %v", c.config.InputFile, err), map[string]any{"path": c.config.InputFile})
+	}
+
+	r, err := c.openInput(digest, changes)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return content, nil
+}
+
+// lineReader streams a line-by-line rewrite of its input. process receives
+// each line without its terminator and writes the output to out; it is
+// called once more with eof set when the input ends, to flush its state.
+// Output lines end with \n.
+type lineReader struct {
+	in      *bufio.Reader
+	out     bytes.Buffer
+	process func(out *bytes.Buffer, line string, eof bool)
+	err     error
+}
+
+func newLineReader(r io.Reader, process func(out *bytes.Buffer, line string, eof bool)) *lineReader {
+	return &lineReader{in: bufio.NewReader(r), process: process}
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 && r.err == nil {
+		line, err := r.in.ReadString('\n')
+		if line != "" {
+			line = line[:len(line)-len(lineTerminator(line))]
+			r.process(&r.out, line, false)
+		}
+		if err != nil {
+			r.process(&r.out, "", true)
+			r.err = err
+		}
+	}
+	if r.out.Len() > 0 {
+		return r.out.Read(p)
+	}
+	return 0, r.err
+}
+
+// lineTerminator returns the \n or \r\n that ends line, if any.
+func lineTerminator(line string) string {
+	switch {
+	case len(line) >= 2 && line[len(line)-2:] == "\r\n":
+		return "\r\n"
+	case len(line) >= 1 && line[len(line)-1] == '\n':
+		return "\n"
+	}
+	return ""
+}
+
+// collapseRepeats replaces runs of identical consecutive lines with one copy
+// followed by ×N (-collapse-repeats), which shrinks noisy logs a lot. Blank
+// lines are left alone. The removed lines count as changed.
+func collapseRepeats(r io.Reader, count func(lines int)) io.Reader {
+	var prev string
+	run := 0
+	flush := func(out *bytes.Buffer) {
+		if run == 0 {
+			return
+		}
+		out.WriteString(prev)
+		if run > 1 {
+			fmt.Fprintf(out, " ×%d", run)
+			count(run - 1)
+		}
+		out.WriteByte('\n')
+		run = 0
+	}
+	return newLineReader(r, func(out *bytes.Buffer, line string, eof bool) {
+		switch {
+		case eof:
+			flush(out)
+		case run > 0 && line == prev && line != "":
+			run++
+		default:
+			flush(out)
+			prev, run = line, 1
+		}
+	})
+}
+
+// normalizeWhitespace trims trailing whitespace, expands tabs to spaces at
+// tab stops every tabWidth columns (0 keeps tabs), and collapses runs of
+// blank lines into one (-normalize-whitespace). Lines changed or dropped
+// count as changed.
+func normalizeWhitespace(tabWidth int) func(r io.Reader, count func(lines int)) io.Reader {
+	return func(r io.Reader, count func(lines int)) io.Reader {
+		blank := false
+		return newLineReader(r, func(out *bytes.Buffer, line string, eof bool) {
+			if eof {
+				return
+			}
+			normalized := strings.TrimRight(line, " \t\r\f\v")
+			if tabWidth > 0 && strings.Contains(normalized, "\t") {
+				normalized = expandTabs(normalized, tabWidth)
+			}
+			if normalized == "" && blank {
+				count(1)
+				return
+			}
+			blank = normalized == ""
+			if normalized != line {
+				count(1)
+			}
+			out.WriteString(normalized)
+			out.WriteByte('\n')
+		})
+	}
+}
+
+// expandTabs replaces the tabs of line with spaces up to the next tab stop.
+func expandTabs(line string, width int) string {
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := width - column%width
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
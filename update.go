@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const latestReleaseURL = "https://api.github.com/repos/admiralhr99/fileChunker/releases/latest"
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func runUpdate(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only report whether a newer release is available")
+	force := fs.Bool("force", false, "Install the latest release even if it is not newer, or this is a development build")
+	releaseURL := fs.String("release-url", latestReleaseURL, "Release metadata URL (GitHub releases API format)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s update [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Replace this binary with the latest release, after verifying its SHA-256 checksum.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	rel, err := fetchRelease(client, *releaseURL)
+	if err != nil {
+		return err
+	}
+
+	version := currentBuild().Version
+	fmt.Printf("Current version: %s\n", version)
+	fmt.Printf("Latest release: %s\n", rel.TagName)
+	newer := isNewerVersion(rel.TagName, version)
+	if *check {
+		if version == "dev" {
+			fmt.Printf("This is a development build; '%s update -force' installs %s.\n", os.Args[0], rel.TagName)
+		} else if newer {
+			fmt.Printf("Run '%s update' to install %s.\n", os.Args[0], rel.TagName)
+		} else {
+			fmt.Println("Already up to date.")
+		}
+		return nil
+	}
+	if !newer && !*force {
+		if version == "dev" {
+			return fmt.Errorf("this is a development build; use -force to replace it with %s", rel.TagName)
+		}
+		fmt.Println("Already up to date.")
+		return nil
+	}
+
+	asset, err := rel.binaryAsset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	data, err := download(client, asset.URL)
+	if err != nil {
+		return err
+	}
+	want, err := rel.checksum(client, asset.Name)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.Name, want, got)
+	}
+
+	binary, err := extractBinary(asset.Name, data)
+	if err != nil {
+		return err
+	}
+	exe, err := replaceExecutable(binary)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %s to %s (sha256 %s verified).\n", exe, rel.TagName, want)
+	return nil
+}
+
+func fetchRelease(client *http.Client, url string) (*release, error) {
+	data, err := download(client, url)
+	if err != nil {
+		return nil, fmt.Errorf("error checking for releases: %v", err)
+	}
+	var rel release
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return nil, fmt.Errorf("error decoding release metadata: %v", err)
+	}
+	if rel.TagName == "" {
+		return nil, fmt.Errorf("release metadata has no tag_name")
+	}
+	return &rel, nil
+}
+
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// binaryAsset picks the release asset built for this platform, e.g.
+// file-chunker_linux_amd64.tar.gz, skipping checksum files.
+func (r *release) binaryAsset(goos, goarch string) (releaseAsset, error) {
+	for _, asset := range r.Assets {
+		name := strings.ToLower(asset.Name)
+		if isChecksumAsset(name) {
+			continue
+		}
+		if assetForPlatform(name, goos, goarch) {
+			return asset, nil
+		}
+	}
+	return releaseAsset{}, fmt.Errorf("release %s has no binary for %s/%s", r.TagName, goos, goarch)
+}
+
+// assetForPlatform reports whether an asset name has goos and goarch as
+// consecutive parts between underscores, so that arm does not pick an arm64
+// asset or an asset whose version contains "arm".
+func assetForPlatform(name, goos, goarch string) bool {
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip", ".exe"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	parts := strings.Split(name, "_")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == goos && parts[i+1] == goarch {
+			return true
+		}
+	}
+	return false
+}
+
+func isChecksumAsset(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".sha256") || strings.Contains(name, "checksums") || strings.Contains(name, "sha256sums")
+}
+
+// checksum finds the published SHA-256 of an asset, either in a
+// <asset>.sha256 file or in a sha256sum-style list covering all assets. An
+// update without a checksum is refused.
+func (r *release) checksum(client *http.Client, assetName string) (string, error) {
+	for _, asset := range r.Assets {
+		if !isChecksumAsset(asset.Name) {
+			continue
+		}
+		data, err := download(client, asset.URL)
+		if err != nil {
+			return "", fmt.Errorf("error downloading checksums: %v", err)
+		}
+		if sum, ok := findChecksum(data, assetName, asset.Name == assetName+".sha256"); ok {
+			return sum, nil
+		}
+	}
+	return "", fmt.Errorf("release %s publishes no SHA-256 checksum for %s; refusing to update", r.TagName, assetName)
+}
+
+// findChecksum reads "<hex>  <name>" lines. A per-asset file may hold just
+// the digest.
+func findChecksum(data []byte, assetName string, single bool) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			continue
+		}
+		if (len(fields) == 1 && single) || (len(fields) > 1 && strings.TrimPrefix(fields[1], "*") == assetName) {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+	return "", false
+}
+
+// extractBinary returns the executable inside a .tar.gz or .zip asset, or
+// the asset itself when it is a bare binary.
+func extractBinary(assetName string, data []byte) ([]byte, error) {
+	switch {
+	case strings.HasSuffix(assetName, ".tar.gz") || strings.HasSuffix(assetName, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", assetName, err)
+		}
+		archive := tar.NewReader(gz)
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", assetName, err)
+			}
+			if header.Typeflag == tar.TypeReg && isBinaryName(path.Base(header.Name)) {
+				return io.ReadAll(archive)
+			}
+		}
+	case strings.HasSuffix(assetName, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", assetName, err)
+		}
+		for _, file := range zr.File {
+			if !file.FileInfo().Mode().IsRegular() || !isBinaryName(path.Base(file.Name)) {
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", assetName, err)
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	default:
+		return data, nil
+	}
+	return nil, fmt.Errorf("no file-chunker binary found in %s", assetName)
+}
+
+func isBinaryName(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	return name == "file-chunker" || name == "filechunker"
+}
+
+// replaceExecutable writes the new binary next to the running one and renames
+// it into place, so an interrupted update never leaves a truncated binary.
+func replaceExecutable(binary []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("error locating the running binary: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", fmt.Errorf("error locating the running binary: %v", err)
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return "", fmt.Errorf("error locating the running binary: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".update-*")
+	if err != nil {
+		return "", fmt.Errorf("error writing update: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("error writing update: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("error writing update: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("error writing update: %v", err)
+	}
+
+	// Windows cannot replace a running executable, but it can rename it
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return "", fmt.Errorf("error replacing %s: %v", exe, err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return "", fmt.Errorf("error replacing %s: %v", exe, err)
+	}
+	return exe, nil
+}
+
+// isNewerVersion compares dotted release versions such as v1.4.0, ignoring
+// any pre-release suffix. A development build has no version to compare.
+func isNewerVersion(latest, current string) bool {
+	if current == "dev" {
+		return false
+	}
+	a, b := versionParts(latest), versionParts(current)
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "-")
+	v, _, _ = strings.Cut(v, "+")
+	var parts []int
+	for _, field := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
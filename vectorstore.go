@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vectorStore is a -sink: the URL and environment variable of the API key
+// used unless -sink-url and -sink-api-key say otherwise, and the writer
+// that upserts the chunks.
+type vectorStore struct {
+	url    string
+	keyEnv string
+	open   func(config ChunkConfig, url, apiKey string) (ChunkWriter, error)
+	check  func(config ChunkConfig, url, apiKey string) error
+}
+
+// vectorStores are the -sink vector stores.
+var vectorStores = map[string]vectorStore{
+	"qdrant":   {url: "http://localhost:6333", keyEnv: "QDRANT_API_KEY", open: newQdrantWriter, check: checkQdrant},
+	"pinecone": {keyEnv: "PINECONE_API_KEY", open: newPineconeWriter, check: checkPinecone},
+	"chroma":   {url: "http://localhost:8000", keyEnv: "CHROMA_API_KEY", open: newChromaWriter, check: checkChroma},
+	"pgvector": {open: newPgvectorWriter, check: checkPgvector}, // connects with -dsn
+}
+
+// vectorStoreNames returns the names of the -sink vector stores, sorted.
+func vectorStoreNames() []string {
+	var names []string
+	for name := range vectorStores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sinkSettings returns the URL and API key of the -sink.
+func (config ChunkConfig) sinkSettings() (url, apiKey string) {
+	store := vectorStores[config.Sink]
+	url, apiKey = config.SinkURL, config.SinkAPIKey
+	if url == "" {
+		url = store.url
+	}
+	if apiKey == "" && store.keyEnv != "" {
+		apiKey = os.Getenv(store.keyEnv)
+	}
+	// Hosts, such as those of Pinecone indexes, are served over HTTPS
+	if url != "" && !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+	return strings.TrimSuffix(url, "/"), apiKey
+}
+
+func newVectorStoreWriter(config ChunkConfig) (ChunkWriter, error) {
+	url, apiKey := config.sinkSettings()
+	return vectorStores[config.Sink].open(config, url, apiKey)
+}
+
+func checkVectorStore(config ChunkConfig) error {
+	url, apiKey := config.sinkSettings()
+	return vectorStores[config.Sink].check(config, url, apiKey)
+}
+
+// chunkUUID returns a UUID derived from the chunk's source, range and
+// content, so that upserting a chunk again replaces it instead of adding a
+// copy.
+func chunkUUID(chunk *Chunk) string {
+	return nameUUID(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%s", chunk.Source, chunk.Type, chunk.Start, chunk.End, chunk.SHA256))
+}
+
+// nameUUID returns the UUID derived from name.
+func nameUUID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	sum[6] = sum[6]&0x0f | 0x50 // version 5, name-based with SHA
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// chunkPayload is the metadata stored with a chunk's vector: its JSONL
+// record, content included, without the vector itself.
+func chunkPayload(chunk *Chunk) jsonlRecord {
+	record := newJSONLRecord(chunk)
+	record.Embedding = nil
+	return record
+}
+
+// flatMetadata maps the chunk's metadata to the flat kind of stores such as
+// Pinecone, whose values are strings, numbers, booleans or lists of
+// strings: the fields of its JSONL record without the vector, its
+// references as file or file#symbol strings, its -git fields prefixed with
+// git_, and its -meta fields. Empty fields are left out.
+func flatMetadata(chunk *Chunk) map[string]any {
+	metadata := map[string]any{
+		"index":   chunk.Index,
+		"content": chunk.Content,
+		"source":  chunk.Source,
+		"file":    chunk.Filename,
+		"type":    chunk.Type,
+		"start":   chunk.Start,
+		"end":     chunk.End,
+		"overlap": chunk.Overlap,
+		"tokens":  chunk.Tokens,
+	}
+	if chunk.TimeStart != "" {
+		metadata["time_start"], metadata["time_end"] = chunk.TimeStart, chunk.TimeEnd
+	}
+	if len(chunk.References) > 0 {
+		var refs []string
+		for _, ref := range chunk.References {
+			if ref.Symbol != "" {
+				refs = append(refs, ref.File+"#"+ref.Symbol)
+			} else {
+				refs = append(refs, ref.File)
+			}
+		}
+		metadata["references"] = refs
+	}
+	if len(chunk.Questions) > 0 {
+		metadata["questions"] = chunk.Questions
+	}
+	if chunk.DuplicateOf != 0 {
+		metadata["duplicate_of"], metadata["similarity"] = chunk.DuplicateOf, chunk.Similarity
+	}
+	if chunk.Cells != nil {
+		metadata["cell_first"], metadata["cell_last"] = chunk.Cells.First, chunk.Cells.Last
+	}
+	if g := chunk.Git; g != nil {
+		metadata["git_commit"], metadata["git_path"] = g.Commit, g.Path
+		if g.LastCommit != "" {
+			metadata["git_last_commit"], metadata["git_last_modified"] = g.LastCommit, g.LastModified
+		}
+		if g.Uncommitted {
+			metadata["git_uncommitted"] = true
+		}
+	}
+	// -meta fields sit beside the chunk's own, which they cannot replace
+	for key, value := range chunk.Meta {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// storeClient sends JSON requests to a vector store's HTTP API. With
+// retries, a request that fails on the network, is rate limited or meets a
+// server error is sent again after a pause that doubles every time, or the
+// one the store asks for.
+type storeClient struct {
+	name    string
+	header  http.Header
+	client  *http.Client
+	retries int
+	local   bool                                    // a server of the run's own, storing into a directory the policy allowed
+	sign    func(req *http.Request, payload []byte) // sets the headers that sign a request, if requests are signed
+}
+
+func newStoreClient(name string, header http.Header) *storeClient {
+	header.Set("Content-Type", "application/json")
+	return &storeClient{name: name, header: header, client: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+// do sends body, if not nil, to url and decodes the answer into out, if not
+// nil. It returns the HTTP status, and an error for any but a 2xx one.
+func (s *storeClient) do(method, url string, body, out any) (int, error) {
+	return s.doWithHeader(method, url, nil, body, out)
+}
+
+// doWithHeader is do with header added to the client's for this request.
+func (s *storeClient) doWithHeader(method, url string, header http.Header, body, out any) (int, error) {
+	if !s.local {
+		if err := activePolicy.allowURL(url); err != nil {
+			return 0, err
+		}
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return 0, fmt.Errorf("error encoding %s request: %v", s.name, err)
+		}
+	}
+
+	var data []byte
+	status, err := withRetries(s.name, s.retries, 0, func() (status int, wait time.Duration, err error) {
+		status, data, wait, err = s.send(method, url, header, payload)
+		return status, wait, err
+	})
+	if err == nil && out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return status, fmt.Errorf("error decoding %s response: %v", s.name, err)
+		}
+	}
+	return status, err
+}
+
+// send makes one request, returning the HTTP status, the body of the answer
+// and how long the store asked to wait before trying again, if it did.
+func (s *storeClient) send(method, url string, header http.Header, payload []byte) (status int, data []byte, wait time.Duration, err error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("error creating %s request: %v", s.name, err)
+	}
+	req.Header = s.header.Clone()
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.sign != nil {
+		s.sign(req, payload)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("error calling %s: %v", s.name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("error reading %s response: %v", s.name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, data, retryAfter(resp), fmt.Errorf("%s returned HTTP %d: %s", s.name, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return resp.StatusCode, data, 0, nil
+}
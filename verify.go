@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// verifyReport is the result of checking a chunk directory against its
+// manifest.
+type verifyReport struct {
+	Manifest string          `json:"manifest"`
+	Chunks   int             `json:"chunks"`
+	OK       bool            `json:"ok"`
+	Problems []verifyProblem `json:"problems"`
+}
+
+// verifyProblem is one thing wrong with a chunk set. Kind is one of
+// missing, checksum, size, index, overlap, gap or coverage.
+type verifyProblem struct {
+	Kind    string `json:"kind"`
+	Chunk   int    `json:"chunk,omitempty"`
+	File    string `json:"file,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Message string `json:"message"`
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+
+	input := fs.String("input", "", "Directory of chunk files written by the files format (required)")
+	manifestPath := fs.String("manifest", "", "Manifest describing the chunks (default: manifest.json in the input directory)")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify -input ./chunks [-json]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Check chunk files against their manifest: missing chunks, checksum mismatches and gaps in ranges.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *input == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*input, manifestFilename)
+	}
+
+	m, err := readManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	report := verifyChunks(*input, m)
+	report.Manifest = *manifestPath
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range report.Problems {
+			if p.File != "" {
+				fmt.Printf("%s: chunk %d (%s): %s\n", p.Kind, p.Chunk, p.File, p.Message)
+			} else {
+				fmt.Printf("%s: %s: %s\n", p.Kind, p.Source, p.Message)
+			}
+		}
+		if report.OK {
+			fmt.Printf("Verified %d chunks against %s: ok\n", report.Chunks, *manifestPath)
+		}
+	}
+
+	if !report.OK {
+		return fmt.Errorf("%d problem(s) found in %d chunks", len(report.Problems), report.Chunks)
+	}
+	return nil
+}
+
+func verifyChunks(dir string, m *Manifest) verifyReport {
+	report := verifyReport{Chunks: len(m.Chunks), Problems: []verifyProblem{}}
+	problem := func(kind string, chunk ManifestChunk, format string, args ...any) {
+		report.Problems = append(report.Problems, verifyProblem{
+			Kind:    kind,
+			Chunk:   chunk.Index,
+			File:    chunk.File,
+			Source:  chunk.Source,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Ranges are checked per source, in manifest order, with the same rules
+	// as -strict: each core range starts where the previous chunk ended
+	first := 0
+	if m.ChunkType == "lines" {
+		first = 1
+	}
+	last := map[string]ManifestChunk{}
+
+	// Near-duplicates dropped by -dedupe-fuzzy still cover their ranges
+	chunks := m.Chunks
+	dropped := map[int]bool{}
+	if m.Dedupe != nil && len(m.Dedupe.Dropped) > 0 {
+		chunks = append([]ManifestChunk(nil), m.Chunks...)
+		for _, d := range m.Dedupe.Dropped {
+			chunks = append(chunks, ManifestChunk{Index: d.Index, Source: d.Source, Start: d.Start, End: d.End, Overlap: d.Overlap})
+			dropped[d.Index] = true
+		}
+		sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	}
+
+	for i, chunk := range chunks {
+		if i > 0 && chunk.Index != chunks[i-1].Index+1 {
+			problem("index", chunk, "index follows %d", chunks[i-1].Index)
+		}
+
+		prev, seen := last[chunk.Source]
+		switch {
+		case !seen && chunk.Overlap != 0:
+			problem("overlap", chunk, "first chunk of its source has overlap %d", chunk.Overlap)
+		case !seen && chunk.Start != first:
+			problem("gap", chunk, "source starts at %d, want %d", chunk.Start, first)
+		case seen:
+			want := prev.End + first
+			if coreStart := chunk.Start + chunk.Overlap; coreStart > want {
+				problem("gap", chunk, "range %d-%d leaves %d-%d after chunk %d uncovered", chunk.Start, chunk.End, want, coreStart-1, prev.Index)
+			} else if coreStart < want {
+				problem("overlap", chunk, "new content starts at %d, inside chunk %d, which ends at %d", coreStart, prev.Index, prev.End)
+			}
+		}
+		last[chunk.Source] = chunk
+		if dropped[chunk.Index] {
+			continue
+		}
+
+		filename := filepath.Join(dir, chunk.File)
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			problem("missing", chunk, "chunk file not found")
+			continue
+		} else if err != nil {
+			problem("missing", chunk, "%v", err)
+			continue
+		}
+		content, err := readChunkContent(dir, chunk)
+		if err != nil {
+			problem("checksum", chunk, "%v", err)
+			continue
+		}
+		if len(content) != chunk.Bytes {
+			problem("size", chunk, "%d bytes, the manifest says %d", len(content), chunk.Bytes)
+		}
+	}
+
+	// Byte ranges can also be checked against the size of the source, unless
+	// a transform, transcoding or the rendering of a notebook changed it
+	if m.ChunkType == "chars" && len(m.Transforms) == 0 {
+		for _, file := range m.Files {
+			if chunk, ok := last[file.Path]; ok && file.Encoding == "" && file.Notebook == nil && int64(chunk.End) != file.Bytes {
+				report.Problems = append(report.Problems, verifyProblem{
+					Kind:    "coverage",
+					Source:  file.Path,
+					Message: fmt.Sprintf("chunks end at byte %d of %d", chunk.End, file.Bytes),
+				})
+			}
+		}
+	}
+
+	report.OK = len(report.Problems) == 0
+	return report
+}
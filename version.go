@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Release builds set these with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234 -X main.buildDate=2024-05-01T12:00:00Z".
+// Otherwise they are taken from the build info Go embeds in the binary.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// pseudoVersion matches the timestamp and commit of Go pseudo-versions such
+// as v0.0.0-20240501120000-abcdef123456.
+var pseudoVersion = regexp.MustCompile(`[-.]\d{14}-[0-9a-f]{12}$`)
+
+// BuildInfo identifies the build that produced a chunk set.
+type BuildInfo struct {
+	Version  string `json:"version"`
+	Commit   string `json:"commit,omitempty"`
+	Date     string `json:"date,omitempty"`
+	Modified bool   `json:"modified,omitempty"` // built from a tree with uncommitted changes
+	Go       string `json:"go"`
+}
+
+func currentBuild() BuildInfo {
+	build := BuildInfo{Version: version, Commit: commit, Date: buildDate, Go: runtime.Version()}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	// go install github.com/admiralhr99/fileChunker@v1.2.3 records the
+	// version; local builds record a pseudo-version, which stays dev
+	if v := info.Main.Version; build.Version == "dev" && strings.HasPrefix(v, "v") && !strings.Contains(v, "+") && !pseudoVersion.MatchString(v) {
+		build.Version = v
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if build.Commit == "" {
+				build.Commit = setting.Value
+			}
+		case "vcs.time":
+			if build.Date == "" {
+				build.Date = setting.Value
+			}
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+func (b BuildInfo) String() string {
+	var details []string
+	if b.Commit != "" {
+		commit := b.Commit[:min(len(b.Commit), 12)]
+		if b.Modified {
+			commit += "-dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if b.Date != "" {
+		details = append(details, "built "+b.Date)
+	}
+	details = append(details, b.Go)
+	return fmt.Sprintf("file-chunker %s (%s)", b.Version, strings.Join(details, ", "))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchInputs implements -watch: it polls the inputs every interval and
+// re-chunks when a file is added, changed or removed. Polling needs no
+// platform-specific notification API and also works on network and
+// container-mounted filesystems. Every change reruns the whole run, because
+// chunk numbering continues across files; chunk files the new run no longer
+// produces are removed, so the output stays in sync with the inputs. Errors
+// are reported and the watch goes on, since a file may be caught mid-write.
+func watchInputs(config ChunkConfig, inputs []inputFile, manifest *Manifest, interval time.Duration, checkpointing bool) {
+	seen := inputStamps(config, inputs)
+	logEvent("watching", trf("Watching %d file(s) for changes every %s", len(inputs), interval), map[string]any{"files": len(inputs), "interval": interval.String()})
+
+	for {
+		time.Sleep(interval)
+
+		current, err := resolveInputs(config)
+		if err != nil {
+			logWarning(err.Error(), nil)
+			continue
+		}
+		stamps := inputStamps(config, current)
+		changed := changedInputs(seen, stamps)
+		if len(changed) == 0 {
+			continue
+		}
+		seen = stamps
+
+		textf("\n")
+		logEvent("inputs_changed", trf("Changed: %s", strings.Join(changed, ", ")), map[string]any{"paths": changed})
+		if len(current) == 0 {
+			logWarning(trf("No input files matched in %s", strings.Join(config.Inputs, ", ")), nil)
+			continue
+		}
+		runConfig, runInputs := config, current
+		if config.MergeLogs {
+			if runConfig, runInputs, err = mergeLogInputs(config, current); err != nil {
+				logWarning(err.Error(), nil)
+				continue
+			}
+		}
+		next, err := chunkRun(runConfig, runInputs, checkpointing)
+		if err != nil {
+			logWarning(err.Error(), nil)
+			continue
+		}
+		removeStaleChunks(config, manifest, next)
+		manifest = next
+	}
+}
+
+// inputStamps records the size and modification time of every input.
+// Inputs that cannot be read are left out and show up as removed.
+func inputStamps(config ChunkConfig, inputs []inputFile) map[string]sourceStamp {
+	stamps := map[string]sourceStamp{}
+	for _, input := range inputs {
+		if info, err := config.filesystem().Stat(input.Path); err == nil {
+			stamps[input.Path] = stampOf(info)
+		}
+	}
+	return stamps
+}
+
+// changedInputs lists the paths added, changed or removed between two
+// snapshots, sorted.
+func changedInputs(before, after map[string]sourceStamp) []string {
+	var changed []string
+	for path, stamp := range after {
+		if old, ok := before[path]; !ok || !old.equal(stamp) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// removeStaleChunks deletes the chunk files, and their sidecars, of the
+// previous run that the latest run did not write again. Only the files
+// format leaves one file per chunk behind; the single-file formats are
+// rewritten whole.
+func removeStaleChunks(config ChunkConfig, previous, latest *Manifest) {
+	if formats := config.formats(); len(formats) != 1 || formats[0] != "files" {
+		return
+	}
+	written := map[string]bool{}
+	for _, chunk := range latest.Chunks {
+		written[chunk.File] = true
+	}
+	for _, chunk := range previous.Chunks {
+		if written[chunk.File] {
+			continue
+		}
+		if err := config.filesystem().Remove(filepath.Join(config.OutputDir, chunk.File)); err != nil {
+			logWarning(err.Error(), nil)
+			continue
+		}
+		logEvent("chunk_removed", trf("Removed stale chunk %s", chunk.File), map[string]any{"file": chunk.File, "source": chunk.Source})
+		if config.sidecars() {
+			if err := config.filesystem().Remove(filepath.Join(config.OutputDir, sidecarName(chunk.File))); err != nil {
+				logWarning(err.Error(), nil)
+			}
+		}
+	}
+}
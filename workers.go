@@ -0,0 +1,75 @@
+package main
+
+import "sync"
+
+// parallelWriter hands chunks to a pool of workers (-workers), so that many
+// chunk files are written at once while the input is still read in order.
+// It is only used for the files format, where every chunk is a file of its
+// own; the single-file formats depend on the order of their writes.
+type parallelWriter struct {
+	ChunkWriter
+	queue chan *Chunk
+	wg    sync.WaitGroup // chunks queued but not yet written
+	mu    sync.Mutex
+	err   error // first write error
+}
+
+func newParallelWriter(w ChunkWriter, workers int) *parallelWriter {
+	p := &parallelWriter{ChunkWriter: w, queue: make(chan *Chunk, 2*workers)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for chunk := range p.queue {
+				if err := p.ChunkWriter.WriteChunk(chunk); err != nil {
+					p.mu.Lock()
+					if p.err == nil {
+						p.err = err
+					}
+					p.mu.Unlock()
+				}
+				p.wg.Done()
+			}
+		}()
+	}
+	return p
+}
+
+// WriteChunk queues the chunk. A failed write is returned by the next call,
+// by Flush or by Close.
+func (p *parallelWriter) WriteChunk(chunk *Chunk) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	p.wg.Add(1)
+	p.queue <- chunk
+	return nil
+}
+
+// Flush waits until every queued chunk is written.
+func (p *parallelWriter) Flush() error {
+	p.wg.Wait()
+	return p.failed()
+}
+
+func (p *parallelWriter) Close() error {
+	err := p.Flush()
+	close(p.queue)
+	if closeErr := p.ChunkWriter.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (p *parallelWriter) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// flushChunks waits for the chunks a writer has accepted to be written, for
+// writers that write in the background.
+func flushChunks(w ChunkWriter) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
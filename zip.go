@@ -0,0 +1,103 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// zipWriter writes every chunk file into a single compressed archive, with
+// the same names and contents the files format would put on disk.
+type zipWriter struct {
+	filename    string
+	addMetadata bool
+	addChecksum bool
+	sidecars    bool
+	file        io.WriteCloser
+	w           *bufio.Writer
+	zip         *zip.Writer
+	modified    time.Time
+	names       chunkNames
+}
+
+func newZipWriter(fsys FS, filename string, config ChunkConfig) (*zipWriter, error) {
+	file, err := fsys.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating zip file: %v", err)
+	}
+	w := bufio.NewWriter(file)
+	return &zipWriter{
+		filename:    filename,
+		addMetadata: config.metadataHeader(),
+		addChecksum: config.ChecksumHeader,
+		sidecars:    config.sidecars(),
+		file:        file,
+		w:           w,
+		zip:         zip.NewWriter(w),
+		modified:    config.now(),
+	}, nil
+}
+
+func (w *zipWriter) WriteChunk(chunk *Chunk) error {
+	if err := w.names.add(chunk.Filename); err != nil {
+		return err
+	}
+	entry, err := w.zip.CreateHeader(&zip.FileHeader{
+		Name:     chunk.Filename,
+		Method:   zip.Deflate,
+		Modified: w.modified,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing zip file: %v", err)
+	}
+	if err := writeChunkFile(entry, chunk, w.addMetadata, w.addChecksum); err != nil {
+		return fmt.Errorf("error writing zip file: %v", err)
+	}
+	if w.sidecars {
+		if err := w.writeSidecar(chunk); err != nil {
+			return err
+		}
+	}
+
+	logChunk(chunk, trf("%s in %s", chunk.Filename, w.filename))
+	return nil
+}
+
+// writeSidecar adds the sidecar file of chunk next to it in the archive
+// (-metadata-mode sidecar).
+func (w *zipWriter) writeSidecar(chunk *Chunk) error {
+	name := sidecarName(chunk.Filename)
+	if err := w.names.add(name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(newChunkSidecar(chunk), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sidecar file: %v", err)
+	}
+	entry, err := w.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: w.modified})
+	if err == nil {
+		_, err = entry.Write(append(data, '\n'))
+	}
+	if err != nil {
+		return fmt.Errorf("error writing zip file: %v", err)
+	}
+	return nil
+}
+
+func (w *zipWriter) Close() error {
+	zipErr := w.zip.Close()
+	if zipErr == nil {
+		zipErr = w.w.Flush()
+	}
+	closeErr := w.file.Close()
+	if zipErr != nil {
+		return fmt.Errorf("error writing zip file: %v", zipErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("error closing zip file: %v", closeErr)
+	}
+	return nil
+}